@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+)
+
+// parseCrop parses a crop window of a width x height image. The window is x0,y0,x1,y1 from the top left of the
+// image, where each corner is in pixels, or a percentage of the image's size if it ends with %, like
+// 25%,25%,50%,50%. Percentages are rounded outwards to whole pixels. An empty window is the whole image.
+func parseCrop(value string, width, height int) (image.Rectangle, error) {
+	full := image.Rect(0, 0, width, height)
+	if value == "" {
+		return full, nil
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid crop window %q: expected x0,y0,x1,y1", value)
+	}
+
+	var corners [4]int
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		size := width
+		if i%2 == 1 {
+			size = height
+		}
+		if strings.HasSuffix(part, "%") {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(part, "%"), 64)
+			if err != nil {
+				return image.Rectangle{}, fmt.Errorf("invalid crop window %q: %s", value, err)
+			}
+			// the window grows outwards to the pixels that it covers part of
+			corner := percent * float64(size) / 100
+			if i < 2 {
+				corners[i] = int(math.Floor(corner))
+			} else {
+				corners[i] = int(math.Ceil(corner))
+			}
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("invalid crop window %q: pixels must be whole numbers, and percentages end with %%", value)
+		}
+		corners[i] = n
+	}
+
+	// image.Rect would swap corners that are the wrong way around, rather than leave the window empty
+	crop := image.Rectangle{Min: image.Pt(corners[0], corners[1]), Max: image.Pt(corners[2], corners[3])}
+	if crop.Empty() || !crop.In(full) {
+		return image.Rectangle{}, fmt.Errorf("the crop window %v is empty or outside of the %dx%d image", crop, width, height)
+	}
+	return crop, nil
+}
+
+// outputImage returns the image to save from a render of the crop window of a width x height image, denoised if
+// denoised is set, along with the framebuffer whose render passes are saved. With onCanvas set, both are the size of
+// the whole image, with the render in place of the crop window and black everywhere else.
+func outputImage(fb *rt.Framebuffer, crop image.Rectangle, width, height int, onCanvas, denoised bool) (*rt.HDRImage, *rt.Framebuffer, error) {
+	img := fb.Image()
+	if denoised {
+		// the crop window is denoised on its own, so that the black around it does not bleed in
+		var err error
+		img, err = rt.Denoise(fb, rt.DefaultDenoiseOptions())
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not denoise: %s", err)
+		}
+	}
+
+	if !onCanvas || crop == image.Rect(0, 0, width, height) {
+		return img, fb, nil
+	}
+	canvas := rt.NewHDRImage(width, height)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			canvas.Set(crop.Min.X+x, crop.Min.Y+y, img.At(x, y))
+		}
+	}
+	whole := rt.NewFramebuffer(width, height, fb.AOVs())
+	if err := whole.Paste(fb, crop.Min); err != nil {
+		return nil, nil, err
+	}
+	return canvas, whole, nil
+}
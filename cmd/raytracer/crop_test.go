@@ -0,0 +1,91 @@
+package main
+
+import (
+	"image"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCrop(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		value   string
+		want    image.Rectangle
+		wantErr bool
+	}{
+		{desc: "no window", value: "", want: image.Rect(0, 0, 400, 225)},
+		{desc: "pixels", value: "10,20,110,220", want: image.Rect(10, 20, 110, 220)},
+		{desc: "pixels with spaces", value: "10, 20, 110, 220", want: image.Rect(10, 20, 110, 220)},
+		{desc: "the whole image in pixels", value: "0,0,400,225", want: image.Rect(0, 0, 400, 225)},
+		{desc: "a single pixel", value: "0,0,1,1", want: image.Rect(0, 0, 1, 1)},
+		{desc: "percentages", value: "25%,20%,50%,40%", want: image.Rect(100, 45, 200, 90)},
+		{desc: "the whole image in percentages", value: "0%,0%,100%,100%", want: image.Rect(0, 0, 400, 225)},
+		{desc: "percentages are rounded outwards", value: "10.1%,10.1%,20.1%,20.1%", want: image.Rect(40, 22, 81, 46)},
+		{desc: "pixels and percentages", value: "10,0%,50%,100", want: image.Rect(10, 0, 200, 100)},
+		{desc: "fractional pixels", value: "0.25,0.25,0.5,0.5", wantErr: true},
+		{desc: "too few corners", value: "0,0,10", wantErr: true},
+		{desc: "not a number", value: "a,0,10,10", wantErr: true},
+		{desc: "not a percentage", value: "a%,0,10,10", wantErr: true},
+		{desc: "an empty window", value: "10,10,10,20", wantErr: true},
+		{desc: "corners the wrong way around", value: "20,20,10,10", wantErr: true},
+		{desc: "past the right edge", value: "300,0,401,225", wantErr: true},
+		{desc: "past the bottom edge", value: "0,100,400,226", wantErr: true},
+		{desc: "before the left edge", value: "-1,0,10,10", wantErr: true},
+		{desc: "past the edge in percentages", value: "50%,50%,100.1%,100%", wantErr: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseCrop(tc.value, 400, 225)
+			if tc.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestOutputImage(t *testing.T) {
+	// a 2x1 render of the window at (1, 2) of a 4x3 image
+	crop := image.Rect(1, 2, 3, 3)
+	fb := rt.NewFramebuffer(2, 1, []rt.AOV{rt.AOVAlbedo})
+	fb.AddSample(0, 0, rt.NewVec3(1, 0, 0))
+	fb.AddSample(1, 0, rt.NewVec3(0, 1, 0))
+
+	for _, tc := range []struct {
+		desc     string
+		onCanvas bool
+		want     [][]rt.Vec3
+	}{
+		{desc: "region", want: [][]rt.Vec3{{rt.NewVec3(1, 0, 0), rt.NewVec3(0, 1, 0)}}},
+		{desc: "canvas", onCanvas: true, want: [][]rt.Vec3{
+			{{}, {}, {}, {}},
+			{{}, {}, {}, {}},
+			{{}, rt.NewVec3(1, 0, 0), rt.NewVec3(0, 1, 0), {}},
+		}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			img, out, err := outputImage(fb, crop, 4, 3, tc.onCanvas, false)
+			assert.Nil(t, err)
+			assert.Equal(t, len(tc.want[0]), img.Width)
+			assert.Equal(t, len(tc.want), img.Height)
+			assert.Equal(t, img.Width, out.Width)
+			assert.Equal(t, img.Height, out.Height)
+			assert.Equal(t, fb.AOVs(), out.AOVs())
+			for y, row := range tc.want {
+				for x, want := range row {
+					assert.Equal(t, want, img.At(x, y), "pixel %d,%d", x, y)
+					assert.Equal(t, want, out.Color(x, y), "pixel %d,%d of the framebuffer", x, y)
+				}
+			}
+		})
+	}
+
+	// a render of the whole image is the same on the canvas
+	img, out, err := outputImage(fb, image.Rect(0, 0, 2, 1), 2, 1, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, fb, out)
+	assert.Equal(t, fb.Image(), img)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/andrewzlchen/raytracer/src/distributed"
+)
+
+// worker renders tiles for coordinators until the process is killed
+func worker(args []string) error {
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:9000", "address to listen for coordinators on")
+	w := distributed.NewWorker("")
+	flags.StringVar(&w.AssetDir, "assets", "", "directory that file paths in scenes are resolved against")
+	flags.DurationVar(&w.JobTTL, "job-ttl", w.JobTTL, "how long a scene is kept for after its last tile if its coordinator never unloads it, or 0 to keep it until it is unloaded")
+	flags.Parse(args)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Waiting for tiles on %s\n", listener.Addr())
+	return w.Serve(listener)
+}
+
+// coordinate splits a scene into tiles, renders them on workers and writes the merged image to stdout.
+// Interrupting the process stops the render, but the tiles rendered so far are still written.
+func coordinate(args []string) error {
+	flags := flag.NewFlagSet("coordinate", flag.ExitOnError)
+	workers := flags.String("workers", "", "comma separated addresses of the worker processes")
+	scenePath := flags.String("scene", "", "JSON scene description to render")
+	spp := flags.Int("spp", samplesPerPixel, "number of samples per pixel")
+	seed := flags.Int64("seed", 1, "seed of the random numbers used by the render")
+	tileSize := flags.Int("tile", 32, "width and height of the tiles handed to workers, in pixels")
+	tileTimeout := flags.Duration("tile-timeout", 0, "how long a worker may take to render a tile before it is handed to another worker, or 0 to wait forever")
+	format := flags.String("progress", "bar", "how to show the progress of the render on stderr: bar for a progress bar, json for JSON lines, or none")
+	flags.Parse(args)
+
+	if *workers == "" || *scenePath == "" {
+		return errors.New("-workers and -scene are required")
+	}
+	progress, err := newProgressPrinter(os.Stderr, *format)
+	if err != nil {
+		return err
+	}
+	scene, err := ioutil.ReadFile(*scenePath)
+	if err != nil {
+		return fmt.Errorf("could not read scene: %s", err)
+	}
+
+	ctx, stop := interruptible()
+	defer stop()
+	coordinator := distributed.NewCoordinator(strings.Split(*workers, ","))
+	coordinator.TileSize = *tileSize
+	coordinator.TileTimeout = *tileTimeout
+	coordinator.OnProgress = progress.report
+	fb, renderErr := coordinator.Render(ctx, distributed.Job{
+		ID:              fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano()),
+		Scene:           scene,
+		Width:           imageWidth,
+		Height:          imageHeight,
+		SamplesPerPixel: *spp,
+		MaxDepth:        maxDepth,
+		Seed:            *seed,
+	})
+	progress.end()
+	// an interrupted render still has the tiles that were done
+	if renderErr != nil && (fb == nil || ctx.Err() == nil) {
+		return renderErr
+	}
+	if renderErr != nil {
+		fmt.Fprint(os.Stderr, "Interrupted, saving the tiles rendered so far\n")
+	}
+
+	bufferedStdout := bufio.NewWriter(os.Stdout)
+	if err := rt.WritePPM(bufferedStdout, fb.Image()); err != nil {
+		return err
+	}
+	if err := bufferedStdout.Flush(); err != nil {
+		return err
+	}
+	if renderErr != nil {
+		return fmt.Errorf("interrupted: %s", renderErr)
+	}
+	fmt.Fprint(os.Stderr, "Done!\n")
+	return nil
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"math/rand"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
 
 	rt "github.com/andrewzlchen/raytracer/src"
 )
@@ -18,43 +23,357 @@ const (
 	maxDepth        = 50
 )
 
+var (
+	sceneFile       = flag.String("scene", "", "JSON scene description to render instead of the built-in scene")
+	envMap          = flag.String("env", "", "equirectangular .hdr or .pfm image used to light the scene, replacing the sky gradient or the scene's environment")
+	envRotation     = flag.Float64("env-rotation", 0, "rotation of the environment map about the vertical axis, in degrees")
+	envScale        = flag.Float64("env-scale", 1, "multiplier applied to the radiance of the environment map")
+	aovList         = flag.String("aov", "", "comma separated render passes to save alongside the image (depth, normal, albedo, position, uv, objectID, materialID or all)")
+	aovOutput       = flag.String("aov-out", "passes", "file name prefix of the saved render passes")
+	aovFormat       = flag.String("aov-format", "pfm", "format of the saved render passes: pfm for one image per pass, exr for a single multi-layer image")
+	spp             = flag.Int("spp", samplesPerPixel, "number of samples per pixel")
+	seed            = flag.Int64("seed", 1, "seed of the random numbers used by the render")
+	checkpointFile  = flag.String("checkpoint", "", "file to periodically save the render progress to, so that it can be resumed")
+	checkpointEvery = flag.Int("checkpoint-every", 10, "number of passes between checkpoints, where each pass adds one sample per pixel")
+	resume          = flag.String("resume", "", "checkpoint file to continue rendering from, up to the -spp samples per pixel")
+	denoise         = flag.Bool("denoise", false, "filter the noise out of the image, guided by the albedo, normal and depth passes")
+	outPattern      = flag.String("out", "", "render the frames of an animated -scene to numbered files named by this pattern, like frame_%04d.png (.png, .ppm or .pfm)")
+	frameRange      = flag.String("frames", "", "frames to render with -out, like 1-48, instead of the scene's own frame range")
+	cropWindow      = flag.String("crop", "", "render only this window of the image, as x0,y0,x1,y1 in pixels from the top left, or in percentages of the image's size like 25%,25%,50%,50%")
+	cropOutput      = flag.String("crop-output", "region", "what to save of a -crop render: region for just the crop window, or canvas for the whole image with the crop window filled in")
+	maxDiffuse      = flag.Int("max-diffuse", 0, "maximum number of diffuse bounces along a path, or 0 for no cap beyond the overall depth")
+	maxSpecular     = flag.Int("max-specular", 0, "maximum number of mirror-like bounces along a path, or 0 for no cap beyond the overall depth")
+	maxTransmission = flag.Int("max-transmission", 0, "maximum number of times a path may pass through a surface, or 0 for no cap beyond the overall depth")
+	rouletteDepth   = flag.Int("roulette-depth", 0, "number of bounces after which dim paths are randomly ended, 0 for the default or negative to never end them early")
+	integratorName  = flag.String("integrator", "path", "light transport algorithm: path for a path tracer, bdpt for a bidirectional path tracer that finds caustics lit by the sky, pm for photon mapping, ppm for progressive photon mapping, whitted for a fast preview that only bounces off of mirrors and glass, ao for ambient occlusion, or debug for the -debug view")
+	debugMode       = flag.String("debug", "normal", "what the debug integrator shows: normal, uv, depth, facing or bvh for the cost of tracing through the BVH")
+	debugScale      = flag.Float64("debug-scale", 0, "depth shown as black, or BVH cost shown as red, by the debug integrator, or 0 for the default")
+	aoSamples       = flag.Int("ao-samples", 4, "number of occlusion rays traced per sample by the ao integrator")
+	aoDistance      = flag.Float64("ao-distance", 0, "distance within which objects block the sky for the ao integrator, or 0 for any distance")
+	photons         = flag.Int("photons", 0, "number of photons shot by the pm integrator, or by the ppm integrator in each pass, or 0 for the default")
+	photonRadius    = flag.Float64("photon-radius", 0, "distance within which photons are gathered by the pm integrator, or by the ppm integrator in the first pass, or 0 for the default")
+	ppmAlpha        = flag.Float64("ppm-alpha", 0, "fraction of the photons within its radius that the ppm integrator keeps each pass as the radius shrinks, or 0 for the default")
+	progressFormat  = flag.String("progress", "bar", "how to show the progress of the render on stderr: bar for a progress bar, json for JSON lines, or none")
+)
+
 // RENDER
 func main() {
-	// Add elements to the world
-	world := &rt.HittableList{}
-	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5})
-	world.Add(&rt.Sphere{Center: rt.NewVec3(0, -100.5, -1), Radius: 100})
+	if len(os.Args) > 1 {
+		// subcommands for running as a service instead of rendering a single image
+		commands := map[string]func(args []string) error{
+			"serve":      serve,
+			"worker":     worker,
+			"coordinate": coordinate,
+		}
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "could not %s: %s\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	flag.Parse()
 
-	// Print the p3 metadata
-	fmt.Printf("P3\n%d %d\n255\n", imageWidth, imageHeight)
+	if err := render(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
 
-	// Set up buffered stdout
-	bufferedStdout := bufio.NewWriter(os.Stdout)
-	defer bufferedStdout.Flush()
+// render renders the -scene to stdout, or to the -out files if it is animated. Interrupting the process stops the
+// render, but the image rendered so far is still written.
+func render() error {
+	ctx, stop := interruptible()
+	defer stop()
+	progress, err := newProgressPrinter(os.Stderr, *progressFormat)
+	if err != nil {
+		return err
+	}
+	crop, err := parseCrop(*cropWindow, imageWidth, imageHeight)
+	if err != nil {
+		return err
+	}
+	if *cropOutput != "region" && *cropOutput != "canvas" {
+		return fmt.Errorf("unknown crop output %q: expected region or canvas", *cropOutput)
+	}
 
-	// Set up camera
-	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	integrator, err := newIntegrator()
+	if err != nil {
+		return err
+	}
+
+	// Set up the environment light
+	environment, err := loadEnvironment()
+	if err != nil {
+		return fmt.Errorf("could not set up environment light: %s", err)
+	}
+
+	// Pick the auxiliary passes to render
+	aovs, err := parseAOVs(*aovList)
 	if err != nil {
-		panic("could not set up the camera")
+		return fmt.Errorf("could not parse render passes: %s", err)
+	}
+	renderAOVs := aovs
+	if *denoise {
+		renderAOVs = withAOVs(aovs, rt.AOVAlbedo, rt.AOVNormal, rt.AOVDepth)
 	}
 
-	for j := imageHeight - 1; j >= 0; j-- {
-		fmt.Fprintf(os.Stderr, "\rScanlines remaining: %d\n", j)
-		for i := 0; i < imageWidth; i++ {
-			pixelColor := rt.NewVec3(0, 0, 0)
-			for s := 0; s < samplesPerPixel; s++ {
-				u := (float64(i) + rand.Float64()) / float64(imageWidth-1)
-				v := (float64(j) + rand.Float64()) / float64(imageHeight-1)
+	// Render an image sequence instead of a single image if asked to
+	if *outPattern != "" {
+		if *checkpointFile != "" || *resume != "" {
+			return errors.New("checkpoints cannot be used when rendering frames with -out")
+		}
+		if err := renderSequence(ctx, progress, crop, integrator, environment, aovs, renderAOVs); err != nil {
+			return fmt.Errorf("could not render frames: %s", err)
+		}
+		fmt.Fprint(os.Stderr, "Done!\n")
+		return nil
+	}
+	if *frameRange != "" {
+		return errors.New("-frames can only be used along with -out")
+	}
+
+	scene, camera, err := loadScene()
+	if err != nil {
+		return fmt.Errorf("could not set up the scene: %s", err)
+	}
+	if environment != nil {
+		scene.Environment = environment
+	}
+
+	// Continue from an earlier render if asked to
+	if *checkpointEvery <= 0 {
+		return errors.New("the number of passes between checkpoints must be positive")
+	}
+	var resumed *rt.Framebuffer
+	if *resume != "" {
+		resumed, err = rt.LoadCheckpoint(*resume)
+		if err != nil {
+			return fmt.Errorf("could not resume render: %s", err)
+		}
+	}
 
-				ray := camera.GetRay(u, v)
-				currentColor, err := ray.Color(world, maxDepth)
-				if err != nil {
-					panic(fmt.Sprintf("could not get color: %s", err))
-				}
-				pixelColor = pixelColor.AddVector(currentColor)
+	fb, renderErr := rt.Render(ctx, scene, camera, rt.RenderOptions{
+		Width:           imageWidth,
+		Height:          imageHeight,
+		SamplesPerPixel: *spp,
+		MaxDepth:        maxDepth,
+		Integrator:      integrator,
+		AOVs:            renderAOVs,
+		Region:          crop,
+		Seed:            *seed,
+		Resume:          resumed,
+		OnProgress:      progress.report,
+		OnPass: func(fb *rt.Framebuffer) error {
+			if *checkpointFile == "" || (fb.Passes%*checkpointEvery != 0 && fb.Passes != *spp) {
+				return nil
 			}
-			rt.WriteColor(bufferedStdout, pixelColor, samplesPerPixel)
+			return rt.SaveCheckpoint(*checkpointFile, fb)
+		},
+	})
+	progress.end()
+	// an interrupted render still has an image worth saving
+	if renderErr != nil && (fb == nil || ctx.Err() == nil) {
+		return fmt.Errorf("could not render: %s", renderErr)
+	}
+	if renderErr != nil {
+		fmt.Fprint(os.Stderr, "Interrupted, saving the image rendered so far\n")
+	}
+
+	image, fb, err := outputImage(fb, crop, imageWidth, imageHeight, *cropOutput == "canvas", *denoise)
+	if err != nil {
+		return err
+	}
+	// Set up buffered stdout
+	bufferedStdout := bufio.NewWriter(os.Stdout)
+	if err := rt.WritePPM(bufferedStdout, image); err != nil {
+		return fmt.Errorf("could not write image: %s", err)
+	}
+	if err := bufferedStdout.Flush(); err != nil {
+		return fmt.Errorf("could not write image: %s", err)
+	}
+
+	if len(aovs) > 0 {
+		if err := writeAOVs(fb, *aovOutput, *aovFormat); err != nil {
+			return fmt.Errorf("could not write render passes: %s", err)
 		}
 	}
+	if renderErr != nil {
+		return fmt.Errorf("interrupted: %s", renderErr)
+	}
 	fmt.Fprint(os.Stderr, "Done!\n")
+	return nil
+}
+
+// interruptible returns a context that is cancelled the first time the process is interrupted, so that the render
+// can stop and save what it has. Interrupting the process again kills it straight away.
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupted:
+		case <-ctx.Done():
+		}
+		signal.Stop(interrupted)
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// parseAOVs parses a comma separated list of render pass names, where "all" selects every pass
+func parseAOVs(list string) ([]rt.AOV, error) {
+	if list == "" {
+		return nil, nil
+	}
+	if list == "all" {
+		return rt.AllAOVs, nil
+	}
+	var aovs []rt.AOV
+	for _, name := range strings.Split(list, ",") {
+		aov, err := rt.ParseAOV(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		aovs = append(aovs, aov)
+	}
+	return aovs, nil
+}
+
+// withAOVs returns the passed-in render passes with any of the extra passes that are missing added to the end
+func withAOVs(aovs []rt.AOV, extra ...rt.AOV) []rt.AOV {
+	combined := append([]rt.AOV{}, aovs...)
+	for _, aov := range extra {
+		found := false
+		for _, existing := range combined {
+			if existing == aov {
+				found = true
+				break
+			}
+		}
+		if !found {
+			combined = append(combined, aov)
+		}
+	}
+	return combined
+}
+
+// writeAOVs saves the auxiliary passes of a render. The pfm format writes one image per pass named
+// <prefix>_<pass>.pfm, and the exr format writes the beauty and every pass as layers of <prefix>.exr.
+func writeAOVs(fb *rt.Framebuffer, prefix, format string) error {
+	switch format {
+	case "exr":
+		return writeFile(prefix+".exr", func(w io.Writer) error {
+			return rt.WriteFramebufferEXR(w, fb)
+		})
+	case "pfm":
+		for _, aov := range fb.AOVs() {
+			img, err := fb.PassImage(aov)
+			if err != nil {
+				return err
+			}
+			err = writeFile(fmt.Sprintf("%s_%s.pfm", prefix, aov), func(w io.Writer) error {
+				return rt.EncodePFM(w, img)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown render pass format %q: expected pfm or exr", format)
+	}
+}
+
+// writeFile creates a file and fills it with the passed-in writer function
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := write(bw); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write %s: %s", path, err)
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newIntegrator returns the integrator picked by the -integrator flag
+func newIntegrator() (rt.Integrator, error) {
+	switch *integratorName {
+	case "path":
+		return &rt.PathIntegrator{
+			MaxDepth:        maxDepth,
+			MaxDiffuse:      *maxDiffuse,
+			MaxSpecular:     *maxSpecular,
+			MaxTransmission: *maxTransmission,
+			RouletteDepth:   *rouletteDepth,
+		}, nil
+	case "bdpt":
+		return &rt.BDPTIntegrator{MaxDepth: maxDepth}, nil
+	case "pm":
+		return &rt.PhotonMapIntegrator{MaxDepth: maxDepth, Photons: *photons, Radius: *photonRadius}, nil
+	case "ppm":
+		if *ppmAlpha < 0 || *ppmAlpha > 1 {
+			return nil, fmt.Errorf("the ppm alpha must be between 0 and 1, got %v", *ppmAlpha)
+		}
+		return &rt.ProgressivePhotonMapIntegrator{MaxDepth: maxDepth, Photons: *photons, Radius: *photonRadius, Alpha: *ppmAlpha}, nil
+	case "whitted":
+		return &rt.WhittedIntegrator{MaxDepth: maxDepth}, nil
+	case "ao":
+		if *aoSamples <= 0 {
+			return nil, errors.New("the number of ambient occlusion samples must be positive")
+		}
+		return &rt.AmbientOcclusionIntegrator{Samples: *aoSamples, Distance: *aoDistance}, nil
+	case "debug":
+		mode, err := rt.ParseDebugMode(*debugMode)
+		if err != nil {
+			return nil, err
+		}
+		return &rt.DebugIntegrator{Mode: mode, Scale: *debugScale}, nil
+	default:
+		return nil, fmt.Errorf("unknown integrator %q: expected path, bdpt, pm, ppm, whitted, ao or debug", *integratorName)
+	}
+}
+
+// loadEnvironment loads the environment light set by the -env flag, or returns nil if there is none
+func loadEnvironment() (*rt.EnvironmentLight, error) {
+	if *envMap == "" {
+		return nil, nil
+	}
+	image, err := rt.LoadHDRImage(*envMap)
+	if err != nil {
+		return nil, fmt.Errorf("could not load environment map: %s", err)
+	}
+	return rt.NewEnvironmentLight(image, *envRotation, *envScale)
+}
+
+// loadScene builds the scene described by the -scene flag, or the built-in scene if there is none
+func loadScene() (*rt.Scene, rt.Camera, error) {
+	if *sceneFile != "" {
+		description, err := rt.LoadSceneDescription(*sceneFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return description.Build()
+	}
+
+	// Add elements to the world
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5, ID: 1})
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, -100.5, -1), Radius: 100, ID: 2})
+
+	// Set up camera
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not set up the camera: %s", err)
+	}
+	return &rt.Scene{World: world}, camera, nil
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+)
+
+const (
+	// progressInterval is the shortest time between two progress reports
+	progressInterval = 100 * time.Millisecond
+	// progressBarWidth is the number of characters in the progress bar
+	progressBarWidth = 30
+)
+
+// progressPrinter shows the progress of renders, either as a progress bar that updates in place or as JSON lines
+type progressPrinter struct {
+	w      io.Writer
+	format string
+	// frame is the frame being rendered, or nil when rendering a single image
+	frame *int
+	last  time.Time
+	// open is whether the progress bar has been drawn without ending its line
+	open bool
+}
+
+// progressLine is a progress report in the json format
+type progressLine struct {
+	Frame            *int    `json:"frame,omitempty"`
+	TilesDone        int     `json:"tilesDone"`
+	TotalTiles       int     `json:"totalTiles"`
+	SamplesDone      int64   `json:"samplesDone"`
+	TotalSamples     int64   `json:"totalSamples"`
+	Rays             int64   `json:"rays"`
+	RaysPerSecond    float64 `json:"raysPerSecond"`
+	ElapsedSeconds   float64 `json:"elapsedSeconds"`
+	RemainingSeconds float64 `json:"remainingSeconds"`
+}
+
+// newProgressPrinter returns a printer of the passed-in format: bar, json or none
+func newProgressPrinter(w io.Writer, format string) (*progressPrinter, error) {
+	switch format {
+	case "bar", "json", "none":
+		return &progressPrinter{w: w, format: format}, nil
+	default:
+		return nil, fmt.Errorf("unknown progress format %q: expected bar, json or none", format)
+	}
+}
+
+// startFrame labels the reports that follow with the frame of an image sequence
+func (p *progressPrinter) startFrame(frame int) {
+	p.frame = &frame
+	p.last = time.Time{}
+}
+
+// report shows the progress, unless the last report was too recent. The first and last reports of a render are
+// always shown.
+func (p *progressPrinter) report(progress rt.Progress) {
+	finished := progress.SamplesDone == progress.TotalSamples
+	if p.format == "none" || (!finished && time.Since(p.last) < progressInterval && !p.last.IsZero()) {
+		return
+	}
+	p.last = time.Now()
+
+	if p.format == "json" {
+		line, _ := json.Marshal(progressLine{
+			Frame:            p.frame,
+			TilesDone:        progress.TilesDone,
+			TotalTiles:       progress.TotalTiles,
+			SamplesDone:      progress.SamplesDone,
+			TotalSamples:     progress.TotalSamples,
+			Rays:             progress.Rays,
+			RaysPerSecond:    progress.RaysPerSecond,
+			ElapsedSeconds:   progress.Elapsed.Seconds(),
+			RemainingSeconds: progress.Remaining.Seconds(),
+		})
+		fmt.Fprintf(p.w, "%s\n", line)
+		return
+	}
+
+	label := ""
+	if p.frame != nil {
+		label = fmt.Sprintf("Frame %d ", *p.frame)
+	}
+	filled := int(progress.Fraction() * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	// the trailing spaces clear what is left of a longer line drawn before
+	fmt.Fprintf(p.w, "\r%s[%s] %5.1f%%  %.2f Mrays/s  ETA %s    ",
+		label, bar, 100*progress.Fraction(), progress.RaysPerSecond/1e6, progress.Remaining.Round(time.Second))
+	p.open = true
+	if finished {
+		p.end()
+	}
+}
+
+// end ends the line of the progress bar, so that other messages are not written over it
+func (p *progressPrinter) end() {
+	if p.open {
+		fmt.Fprint(p.w, "\n")
+		p.open = false
+	}
+}
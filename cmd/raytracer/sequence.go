@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+)
+
+// renderSequence renders every frame of the animated -scene to numbered files named by the -out pattern.
+// environment replaces the scene's environment light unless it is nil. If ctx is cancelled, the frame being
+// rendered is written as far as it got and the rest are skipped.
+func renderSequence(ctx context.Context, progress *progressPrinter, crop image.Rectangle, integrator rt.Integrator, environment *rt.EnvironmentLight, aovs, renderAOVs []rt.AOV) error {
+	if *sceneFile == "" {
+		return errors.New("rendering frames needs a -scene")
+	}
+	if !strings.Contains(*outPattern, "%") {
+		return fmt.Errorf("the -out pattern %q needs a verb for the frame number, like %%04d", *outPattern)
+	}
+	encode, err := imageEncoder(*outPattern)
+	if err != nil {
+		return err
+	}
+	description, err := rt.LoadSceneDescription(*sceneFile)
+	if err != nil {
+		return err
+	}
+	frames, err := parseFrameRange(*frameRange, description.Frames)
+	if err != nil {
+		return err
+	}
+	animation, err := description.Animate()
+	if err != nil {
+		return err
+	}
+
+	for frame := frames.Start; frame <= frames.End; frame++ {
+		scene, camera, err := animation.Frame(float64(frame))
+		if err != nil {
+			return err
+		}
+		if environment != nil {
+			scene.Environment = environment
+		}
+
+		progress.startFrame(frame)
+		fb, renderErr := rt.Render(ctx, scene, camera, rt.RenderOptions{
+			Width:           imageWidth,
+			Height:          imageHeight,
+			SamplesPerPixel: *spp,
+			MaxDepth:        maxDepth,
+			Integrator:      integrator,
+			AOVs:            renderAOVs,
+			Region:          crop,
+			Seed:            *seed,
+			OnProgress:      progress.report,
+		})
+		progress.end()
+		if renderErr != nil && (fb == nil || ctx.Err() == nil) {
+			return fmt.Errorf("could not render frame %d: %s", frame, renderErr)
+		}
+
+		img, fb, err := outputImage(fb, crop, imageWidth, imageHeight, *cropOutput == "canvas", *denoise)
+		if err != nil {
+			return fmt.Errorf("could not save frame %d: %s", frame, err)
+		}
+		path := fmt.Sprintf(*outPattern, frame)
+		if err := writeFile(path, func(w io.Writer) error { return encode(w, img) }); err != nil {
+			return err
+		}
+		if len(aovs) > 0 {
+			if err := writeAOVs(fb, fmt.Sprintf("%s_%04d", *aovOutput, frame), *aovFormat); err != nil {
+				return fmt.Errorf("could not write render passes of frame %d: %s", frame, err)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+		if renderErr != nil {
+			return fmt.Errorf("interrupted during frame %d: %s", frame, renderErr)
+		}
+	}
+	return nil
+}
+
+// parseFrameRange parses a range of frames like "1-48" or a single frame like "12". An empty range is the range
+// of the scene description.
+func parseFrameRange(value string, sceneFrames *rt.FrameRange) (rt.FrameRange, error) {
+	if value == "" {
+		if sceneFrames == nil {
+			return rt.FrameRange{}, errors.New("the scene has no frame range, so one must be set with -frames")
+		}
+		return *sceneFrames, nil
+	}
+
+	var frames rt.FrameRange
+	if n, _ := fmt.Sscanf(value, "%d-%d", &frames.Start, &frames.End); n == 1 && !strings.Contains(value, "-") {
+		frames.End = frames.Start
+	} else if n != 2 {
+		return rt.FrameRange{}, fmt.Errorf("invalid frame range %q: expected start-end", value)
+	}
+	if frames.End < frames.Start {
+		return rt.FrameRange{}, fmt.Errorf("invalid frame range %q: the last frame comes before the first", value)
+	}
+	return frames, nil
+}
+
+// imageEncoder returns the function that writes images in the format of a file's extension
+func imageEncoder(path string) (func(w io.Writer, img *rt.HDRImage) error, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return rt.EncodePNG, nil
+	case ".ppm":
+		return rt.WritePPM, nil
+	case ".pfm":
+		return rt.EncodePFM, nil
+	default:
+		return nil, fmt.Errorf("unknown image format of %q: expected .png, .ppm or .pfm", path)
+	}
+}
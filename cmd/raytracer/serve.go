@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/andrewzlchen/raytracer/src/server"
+)
+
+// serve runs the HTTP render service until it is interrupted
+func serve(args []string) error {
+	opts := server.DefaultOptions()
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	flags.IntVar(&opts.Concurrency, "concurrency", opts.Concurrency, "number of jobs rendered at the same time")
+	flags.IntVar(&opts.QueueSize, "queue", opts.QueueSize, "number of jobs that can wait for a free renderer")
+	flags.StringVar(&opts.AssetDir, "assets", "", "directory that file paths in submitted scenes are resolved against")
+	flags.IntVar(&opts.MaxWidth, "max-width", opts.MaxWidth, "widest image that a job can ask for, or 0 for no limit")
+	flags.IntVar(&opts.MaxHeight, "max-height", opts.MaxHeight, "tallest image that a job can ask for, or 0 for no limit")
+	flags.IntVar(&opts.MaxSamplesPerPixel, "max-spp", opts.MaxSamplesPerPixel, "most samples per pixel that a job can ask for, or 0 for no limit")
+	flags.IntVar(&opts.MaxDepth, "max-depth", opts.MaxDepth, "most bounces per ray that a job can ask for, or 0 for no limit")
+	flags.DurationVar(&opts.JobTTL, "job-ttl", opts.JobTTL, "how long finished jobs and their images are kept for, or 0 to keep them until -max-jobs is reached")
+	flags.IntVar(&opts.MaxJobs, "max-jobs", opts.MaxJobs, "number of jobs that are kept before the oldest finished ones are forgotten, or 0 for no limit")
+	flags.Parse(args)
+
+	s, err := server.New(opts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	httpServer := &http.Server{Addr: *addr, Handler: s}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		<-interrupted
+		httpServer.Shutdown(context.Background())
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", *addr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package raytracer
+
+import "math"
+
+// AABB is an axis-aligned bounding box
+type AABB struct {
+	Min, Max Vec3
+}
+
+// NewAABB returns the smallest box that contains both points
+func NewAABB(a, b Vec3) *AABB {
+	return &AABB{
+		Min: NewVec3(math.Min(a.X, b.X), math.Min(a.Y, b.Y), math.Min(a.Z, b.Z)),
+		Max: NewVec3(math.Max(a.X, b.X), math.Max(a.Y, b.Y), math.Max(a.Z, b.Z)),
+	}
+}
+
+// Bounded is implemented by objects that fit inside a bounding box, which lets them be put in a BVH
+type Bounded interface {
+	// BoundingBox returns a box that contains the whole object
+	BoundingBox() *AABB
+}
+
+// Union returns the smallest box that contains both boxes
+func (b *AABB) Union(other *AABB) *AABB {
+	return &AABB{
+		Min: NewVec3(math.Min(b.Min.X, other.Min.X), math.Min(b.Min.Y, other.Min.Y), math.Min(b.Min.Z, other.Min.Z)),
+		Max: NewVec3(math.Max(b.Max.X, other.Max.X), math.Max(b.Max.Y, other.Max.Y), math.Max(b.Max.Z, other.Max.Z)),
+	}
+}
+
+// Center returns the point in the middle of the box
+func (b *AABB) Center() Vec3 {
+	return b.Min.AddVector(b.Max).MultiplyFloat(0.5)
+}
+
+// Corners returns the eight corners of the box
+func (b *AABB) Corners() []Vec3 {
+	corners := make([]Vec3, 0, 8)
+	for _, x := range []float64{b.Min.X, b.Max.X} {
+		for _, y := range []float64{b.Min.Y, b.Max.Y} {
+			for _, z := range []float64{b.Min.Z, b.Max.Z} {
+				corners = append(corners, NewVec3(x, y, z))
+			}
+		}
+	}
+	return corners
+}
+
+// Hit returns whether the ray passes through the box between tMin and tMax
+func (b *AABB) Hit(ray Ray, tMin, tMax float64) bool {
+	_, _, ok := b.Intersect(ray, tMin, tMax)
+	return ok
+}
+
+// Intersect returns the part of [tMin, tMax] where the ray is inside the box, and whether there is one, using the
+// slab method
+func (b *AABB) Intersect(ray Ray, tMin, tMax float64) (float64, float64, bool) {
+	origin, direction := ray.Origin(), ray.Direction()
+	for _, slab := range [3][4]float64{
+		{origin.X, direction.X, b.Min.X, b.Max.X},
+		{origin.Y, direction.Y, b.Min.Y, b.Max.Y},
+		{origin.Z, direction.Z, b.Min.Z, b.Max.Z},
+	} {
+		// dividing by a zero direction gives infinities, which still compare correctly
+		inverse := 1 / slab[1]
+		t0 := (slab[2] - slab[0]) * inverse
+		t1 := (slab[3] - slab[0]) * inverse
+		if inverse < 0 {
+			t0, t1 = t1, t0
+		}
+		// NaNs come from rays that lie exactly in the plane of a slab, and are ignored
+		if t0 > tMin {
+			tMin = t0
+		}
+		if t1 < tMax {
+			tMax = t1
+		}
+		if tMax < tMin {
+			return 0, 0, false
+		}
+	}
+	return tMin, tMax, true
+}
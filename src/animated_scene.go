@@ -0,0 +1,394 @@
+package raytracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FrameRange is the range of frames of an animation that are rendered, including both ends
+type FrameRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// TrackDescription describes an animated property. Interpolation is "linear", "bezier" or "catmull-rom", and
+// defaults to linear.
+type TrackDescription struct {
+	Interpolation string                `json:"interpolation,omitempty"`
+	Keys          []KeyframeDescription `json:"keys"`
+}
+
+// KeyframeDescription describes the value of an animated property at a frame. In and Out are the optional Bézier
+// handles of the keyframe.
+type KeyframeDescription struct {
+	Frame float64        `json:"frame"`
+	Value AnimationValue `json:"value"`
+	In    AnimationValue `json:"in,omitempty"`
+	Out   AnimationValue `json:"out,omitempty"`
+}
+
+// AnimationValue is the value of an animated property. In JSON it is either a number or a list of numbers.
+type AnimationValue []float64
+
+// UnmarshalJSON decodes a number or a list of numbers
+func (v *AnimationValue) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var values []float64
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("invalid animation value: %s", err)
+		}
+		*v = values
+		return nil
+	}
+	var value float64
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid animation value: %s", err)
+	}
+	*v = AnimationValue{value}
+	return nil
+}
+
+// Track returns the track that the description describes
+func (td TrackDescription) Track() (*Track, error) {
+	interpolation := InterpolationLinear
+	if td.Interpolation != "" {
+		var err error
+		interpolation, err = ParseInterpolation(td.Interpolation)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keyframes := make([]Keyframe, len(td.Keys))
+	for i, key := range td.Keys {
+		keyframes[i] = Keyframe{Frame: key.Frame, Value: key.Value, In: key.In, Out: key.Out}
+	}
+	return NewTrack(interpolation, keyframes)
+}
+
+// vectorAt returns the value of a vector property at a frame: the value of its track if it is animated, and its
+// static value otherwise. A track of single numbers sets all three components.
+func vectorAt(animation map[string]TrackDescription, name string, frame float64, static [3]float64) ([3]float64, error) {
+	td, ok := animation[name]
+	if !ok {
+		return static, nil
+	}
+	track, err := td.Track()
+	if err != nil {
+		return static, fmt.Errorf("invalid %s animation: %s", name, err)
+	}
+	value := track.At(frame)
+	switch len(value) {
+	case 1:
+		return [3]float64{value[0], value[0], value[0]}, nil
+	case 3:
+		return [3]float64{value[0], value[1], value[2]}, nil
+	default:
+		return static, fmt.Errorf("invalid %s animation: expected 1 or 3 values, got %d", name, len(value))
+	}
+}
+
+// checkTracks returns an error if any of the animated properties are not in the allowed list
+func checkTracks(animation map[string]TrackDescription, allowed ...string) error {
+	for name := range animation {
+		found := false
+		for _, a := range allowed {
+			found = found || a == name
+		}
+		if !found {
+			return fmt.Errorf("%q cannot be animated: expected %s", name, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// at returns the camera at a frame of the animation
+func (cd CameraDescription) at(frame float64) (Camera, error) {
+	if err := checkTracks(cd.Animation, "origin", "rotation"); err != nil {
+		return nil, err
+	}
+	origin, err := vectorAt(cd.Animation, "origin", frame, cd.Origin)
+	if err != nil {
+		return nil, err
+	}
+	rotation, err := vectorAt(cd.Animation, "rotation", frame, cd.Rotation)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(cd.Type) {
+	case "", "perspective":
+		if rotation == [3]float64{} {
+			return NewCamera(vec3FromArray(origin))
+		}
+		return NewRotatedCamera(vec3FromArray(origin), EulerRotation(vec3FromArray(rotation)))
+	case "orthographic":
+		height := cd.Height
+		if height == 0 {
+			height = 2
+		}
+		return NewOrthographicCamera(vec3FromArray(origin), EulerRotation(vec3FromArray(rotation)), height)
+	case "fisheye":
+		fieldOfView := cd.FieldOfView
+		if fieldOfView == 0 {
+			fieldOfView = 180
+		}
+		return NewFisheyeCamera(vec3FromArray(origin), EulerRotation(vec3FromArray(rotation)), fieldOfView)
+	case "equirectangular":
+		return NewEquirectangularCamera(vec3FromArray(origin), EulerRotation(vec3FromArray(rotation)))
+	case "stereo":
+		layout, err := cd.stereoLayout(SideBySide)
+		if err != nil {
+			return nil, err
+		}
+		convergence := cd.Convergence
+		if convergence == 0 {
+			convergence = 1
+		}
+		return NewStereoCamera(vec3FromArray(origin), EulerRotation(vec3FromArray(rotation)), cd.interocular(), convergence, layout)
+	case "ods":
+		layout, err := cd.stereoLayout(TopBottom)
+		if err != nil {
+			return nil, err
+		}
+		return NewODSCamera(vec3FromArray(origin), EulerRotation(vec3FromArray(rotation)), cd.interocular(), layout)
+	default:
+		return nil, fmt.Errorf("unknown camera type %q: expected perspective, orthographic, fisheye, equirectangular, stereo or ods", cd.Type)
+	}
+}
+
+// interocular returns the distance between the eyes of a stereo camera
+func (cd CameraDescription) interocular() float64 {
+	if cd.Interocular == 0 {
+		return 0.064
+	}
+	return cd.Interocular
+}
+
+// stereoLayout returns the layout of a stereo camera's image, or the passed-in default if it is not set
+func (cd CameraDescription) stereoLayout(defaultLayout StereoLayout) (StereoLayout, error) {
+	if cd.Layout == "" {
+		return defaultLayout, nil
+	}
+	return ParseStereoLayout(cd.Layout)
+}
+
+// matrix returns the transformation of the object at a frame of the animation
+func (od ObjectDescription) matrix(frame float64) (Matrix4, error) {
+	if err := checkTracks(od.Animation, "position", "rotation", "scale"); err != nil {
+		return Matrix4{}, err
+	}
+	position, err := vectorAt(od.Animation, "position", frame, od.Position)
+	if err != nil {
+		return Matrix4{}, err
+	}
+	rotation, err := vectorAt(od.Animation, "rotation", frame, od.Rotation)
+	if err != nil {
+		return Matrix4{}, err
+	}
+	scale := [3]float64{1, 1, 1}
+	if od.Scale != nil {
+		scale = *od.Scale
+	}
+	scale, err = vectorAt(od.Animation, "scale", frame, scale)
+	if err != nil {
+		return Matrix4{}, err
+	}
+	if position == [3]float64{} && rotation == [3]float64{} && scale == [3]float64{1, 1, 1} {
+		return Identity(), nil
+	}
+
+	center := vec3FromArray(od.Center)
+	return Translation(vec3FromArray(position)).
+		Multiply(Translation(center)).
+		Multiply(EulerRotation(vec3FromArray(rotation))).
+		Multiply(Scaling(vec3FromArray(scale))).
+		Multiply(Translation(center.MultiplyFloat(-1))), nil
+}
+
+// isAnimated returns whether the object or any of the objects that it is made of move, or use one of the passed-in
+// animated materials
+func (od ObjectDescription) isAnimated(animatedMaterials map[string]bool) bool {
+	if len(od.Animation) > 0 || animatedMaterials[od.Material] {
+		return true
+	}
+	return (od.Left != nil && od.Left.isAnimated(animatedMaterials)) ||
+		(od.Right != nil && od.Right.isAnimated(animatedMaterials))
+}
+
+// animatableMaterialParameters are the JSON names of the material parameters that can be animated
+var animatableMaterialParameters = []string{
+	"albedo", "eta", "k", "roughnessU", "roughnessV", "baseColor", "metallic", "roughness", "specular",
+	"specularTint", "sheen", "sheenTint", "clearcoat", "clearcoatGloss", "transmission", "ior",
+}
+
+// at returns the material description with its animated parameters set to their values at a frame
+func (md MaterialDescription) at(frame float64) (MaterialDescription, error) {
+	if len(md.Animation) == 0 {
+		return md, nil
+	}
+	if err := checkTracks(md.Animation, animatableMaterialParameters...); err != nil {
+		return md, err
+	}
+
+	// the parameters have many types, so they are replaced in the JSON form of the description
+	data, err := json.Marshal(md)
+	if err != nil {
+		return md, fmt.Errorf("could not encode material: %s", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return md, fmt.Errorf("could not encode material: %s", err)
+	}
+	delete(fields, "animation")
+	for name, td := range md.Animation {
+		track, err := td.Track()
+		if err != nil {
+			return md, fmt.Errorf("invalid %s animation: %s", name, err)
+		}
+		var value interface{} = track.At(frame)
+		if track.Size() == 1 {
+			value = value.([]float64)[0]
+		}
+		if fields[name], err = json.Marshal(value); err != nil {
+			return md, fmt.Errorf("could not encode %s: %s", name, err)
+		}
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return md, fmt.Errorf("could not encode material: %s", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var animated MaterialDescription
+	if err := decoder.Decode(&animated); err != nil {
+		return md, fmt.Errorf("invalid animated parameter: %s", err)
+	}
+	return animated, nil
+}
+
+// AnimatedScene renders the frames of an animated scene description. Everything that does not change between
+// frames is only built once: objects that do not move and whose materials are not animated are kept in a BVH that
+// every frame shares, along with the environment, the lights and the materials that are not animated.
+type AnimatedScene struct {
+	description *SceneDescription
+	builder     *sceneBuilder
+	// static holds the objects that never change, and is nil if there are none
+	static Hittable
+	// animatedMaterials and animatedObjects are rebuilt for every frame
+	animatedMaterials []string
+	animatedObjects   []int
+	environment       *EnvironmentLight
+	lights            []Light
+}
+
+// Animate prepares the description for rendering many frames
+func (d *SceneDescription) Animate() (*AnimatedScene, error) {
+	a := &AnimatedScene{description: d, builder: newSceneBuilder(d)}
+	first := d.firstFrame()
+
+	isAnimated := map[string]bool{}
+	for name, md := range d.Materials {
+		if len(md.Animation) > 0 {
+			isAnimated[name] = true
+			a.animatedMaterials = append(a.animatedMaterials, name)
+			// building the material checks its animation and loads its textures ahead of the frames
+			if _, err := a.builder.animatedMaterial(md, first); err != nil {
+				return nil, fmt.Errorf("could not build material %q: %s", name, err)
+			}
+			continue
+		}
+		material, err := a.builder.animatedMaterial(md, first)
+		if err != nil {
+			return nil, fmt.Errorf("could not build material %q: %s", name, err)
+		}
+		a.builder.materials[name] = material
+	}
+	sort.Strings(a.animatedMaterials)
+
+	var bounded, unbounded []Hittable
+	for i, od := range d.Objects {
+		if od.isAnimated(isAnimated) {
+			a.animatedObjects = append(a.animatedObjects, i)
+			continue
+		}
+		object, err := a.builder.object(od, i+1, first)
+		if err != nil {
+			return nil, fmt.Errorf("could not build object %d: %w", i, err)
+		}
+		if b, ok := object.(Bounded); ok && b.BoundingBox() != nil {
+			bounded = append(bounded, object)
+		} else {
+			unbounded = append(unbounded, object)
+		}
+	}
+	if len(bounded) > 0 {
+		bvh, err := NewBVH(bounded)
+		if err != nil {
+			return nil, fmt.Errorf("could not build the BVH of static objects: %s", err)
+		}
+		unbounded = append(unbounded, bvh)
+	}
+	switch len(unbounded) {
+	case 0:
+	case 1:
+		a.static = unbounded[0]
+	default:
+		a.static = &HittableList{Objects: unbounded}
+	}
+
+	var err error
+	if a.environment, err = a.builder.environment(); err != nil {
+		return nil, err
+	}
+	if a.lights, err = a.builder.lights(); err != nil {
+		return nil, err
+	}
+	if _, err := d.Camera.at(first); err != nil {
+		return nil, fmt.Errorf("could not set up the camera: %w", err)
+	}
+	// check the animated objects up front, so that a bad description fails before any frame is rendered
+	if _, _, err := a.Frame(first); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Frame returns the scene and the camera at a frame of the animation. The scenes of different frames share the
+// parts that do not change, which must not be modified.
+func (a *AnimatedScene) Frame(frame float64) (*Scene, Camera, error) {
+	d := a.description
+	b := newSceneBuilder(d)
+	// static materials and the loaded textures are shared with every frame
+	for name, material := range a.builder.materials {
+		b.materials[name] = material
+	}
+	b.textures = a.builder.textures
+	for _, name := range a.animatedMaterials {
+		material, err := b.animatedMaterial(d.Materials[name], frame)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not build material %q at frame %g: %s", name, frame, err)
+		}
+		b.materials[name] = material
+	}
+
+	world := &HittableList{}
+	if a.static != nil {
+		world.Add(a.static)
+	}
+	for _, i := range a.animatedObjects {
+		object, err := b.object(d.Objects[i], i+1, frame)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not build object %d at frame %g: %w", i, frame, err)
+		}
+		world.Add(object)
+	}
+
+	camera, err := d.Camera.at(frame)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not set up the camera at frame %g: %w", frame, err)
+	}
+	return &Scene{World: world, Environment: a.environment, Lights: a.lights, MaterialIDs: b.materialIDs()}, camera, nil
+}
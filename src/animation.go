@@ -0,0 +1,159 @@
+package raytracer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Interpolation is how an animated value moves between keyframes
+type Interpolation int
+
+const (
+	// InterpolationLinear moves in a straight line at a constant speed between keyframes
+	InterpolationLinear Interpolation = iota
+	// InterpolationBezier follows a cubic Bézier curve through the handles of the keyframes
+	InterpolationBezier
+	// InterpolationCatmullRom follows a smooth curve through every keyframe, with tangents set by the neighbouring
+	// keyframes
+	InterpolationCatmullRom
+)
+
+var interpolationNames = map[Interpolation]string{
+	InterpolationLinear:     "linear",
+	InterpolationBezier:     "bezier",
+	InterpolationCatmullRom: "catmull-rom",
+}
+
+// String returns the name of the interpolation
+func (i Interpolation) String() string {
+	if name, ok := interpolationNames[i]; ok {
+		return name
+	}
+	return fmt.Sprintf("Interpolation(%d)", int(i))
+}
+
+// ParseInterpolation returns the interpolation with the passed-in name, ignoring case
+func ParseInterpolation(name string) (Interpolation, error) {
+	for interpolation, n := range interpolationNames {
+		if strings.EqualFold(n, name) {
+			return interpolation, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown interpolation %q: expected linear, bezier or catmull-rom", name)
+}
+
+// Keyframe is the value of an animated property at one frame
+type Keyframe struct {
+	Frame float64
+	Value []float64
+	// In and Out are the Bézier handles that the curve leaves towards the keyframe from the previous one, and
+	// leaves the keyframe along towards the next one. Missing handles are placed a third of the way along the
+	// Catmull-Rom tangent, which gives the same smooth curve as Catmull-Rom interpolation.
+	In, Out []float64
+}
+
+// Track is a property animated by keyframes. Before the first keyframe and after the last one the property holds
+// still.
+type Track struct {
+	Interpolation Interpolation
+	// Keyframes are sorted by frame
+	Keyframes []Keyframe
+}
+
+// NewTrack returns a track through the passed-in keyframes, which may be in any order but must all have values
+// of the same size
+func NewTrack(interpolation Interpolation, keyframes []Keyframe) (*Track, error) {
+	if len(keyframes) == 0 {
+		return nil, errors.New("a track needs at least one keyframe")
+	}
+	if _, ok := interpolationNames[interpolation]; !ok {
+		return nil, fmt.Errorf("unknown interpolation %s", interpolation)
+	}
+
+	sorted := append([]Keyframe{}, keyframes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Frame < sorted[j].Frame })
+	size := len(sorted[0].Value)
+	if size == 0 {
+		return nil, errors.New("keyframes must have a value")
+	}
+	for i, keyframe := range sorted {
+		if len(keyframe.Value) != size {
+			return nil, fmt.Errorf("the keyframe at frame %g has %d values instead of %d", keyframe.Frame, len(keyframe.Value), size)
+		}
+		if (keyframe.In != nil && len(keyframe.In) != size) || (keyframe.Out != nil && len(keyframe.Out) != size) {
+			return nil, fmt.Errorf("the handles of the keyframe at frame %g must have %d values", keyframe.Frame, size)
+		}
+		if i > 0 && keyframe.Frame == sorted[i-1].Frame {
+			return nil, fmt.Errorf("there are two keyframes at frame %g", keyframe.Frame)
+		}
+	}
+	return &Track{Interpolation: interpolation, Keyframes: sorted}, nil
+}
+
+// Size returns the number of values that the track animates
+func (t *Track) Size() int {
+	return len(t.Keyframes[0].Value)
+}
+
+// At returns the value of the track at a frame, which does not need to be a whole number
+func (t *Track) At(frame float64) []float64 {
+	keys := t.Keyframes
+	last := len(keys) - 1
+	if frame <= keys[0].Frame {
+		return append([]float64{}, keys[0].Value...)
+	}
+	if frame >= keys[last].Frame {
+		return append([]float64{}, keys[last].Value...)
+	}
+
+	// find the keyframes on either side of the frame
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].Frame > frame }) - 1
+	k0, k1 := keys[i], keys[i+1]
+	duration := k1.Frame - k0.Frame
+	s := (frame - k0.Frame) / duration
+
+	value := make([]float64, t.Size())
+	for c := range value {
+		p0, p1 := k0.Value[c], k1.Value[c]
+		switch t.Interpolation {
+		case InterpolationLinear:
+			value[c] = p0 + s*(p1-p0)
+		case InterpolationCatmullRom:
+			// a cubic Hermite curve with tangents scaled from per frame to per segment
+			m0, m1 := t.tangent(i, c)*duration, t.tangent(i+1, c)*duration
+			s2, s3 := s*s, s*s*s
+			value[c] = (2*s3-3*s2+1)*p0 + (s3-2*s2+s)*m0 + (-2*s3+3*s2)*p1 + (s3-s2)*m1
+		case InterpolationBezier:
+			c0 := p0 + t.tangent(i, c)*duration/3
+			if k0.Out != nil {
+				c0 = k0.Out[c]
+			}
+			c1 := p1 - t.tangent(i+1, c)*duration/3
+			if k1.In != nil {
+				c1 = k1.In[c]
+			}
+			r := 1 - s
+			value[c] = r*r*r*p0 + 3*r*r*s*c0 + 3*r*s*s*c1 + s*s*s*p1
+		}
+	}
+	return value
+}
+
+// tangent returns the Catmull-Rom slope, per frame, of component c of the track at keyframe i. The first and last
+// keyframes use the slope towards their only neighbour.
+func (t *Track) tangent(i, c int) float64 {
+	keys := t.Keyframes
+	before, after := i-1, i+1
+	if before < 0 {
+		before = i
+	}
+	if after >= len(keys) {
+		after = i
+	}
+	if before == after {
+		return 0
+	}
+	return (keys[after].Value[c] - keys[before].Value[c]) / (keys[after].Frame - keys[before].Frame)
+}
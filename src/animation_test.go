@@ -0,0 +1,168 @@
+package raytracer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrack_At(t *testing.T) {
+	keys := []rt.Keyframe{
+		{Frame: 0, Value: []float64{0}},
+		{Frame: 10, Value: []float64{10}},
+		{Frame: 20, Value: []float64{0}},
+	}
+	for _, tc := range []struct {
+		desc          string
+		interpolation rt.Interpolation
+		keys          []rt.Keyframe
+		frame         float64
+		want          float64
+	}{
+		{desc: "linear between keys", interpolation: rt.InterpolationLinear, keys: keys, frame: 5, want: 5},
+		{desc: "linear on a key", interpolation: rt.InterpolationLinear, keys: keys, frame: 10, want: 10},
+		{desc: "holds before the first key", interpolation: rt.InterpolationLinear, keys: keys, frame: -3, want: 0},
+		{desc: "holds after the last key", interpolation: rt.InterpolationCatmullRom, keys: keys, frame: 25, want: 0},
+		{desc: "catmull-rom passes through keys", interpolation: rt.InterpolationCatmullRom, keys: keys, frame: 10, want: 10},
+		// the tangent at the first key points at the second key, and the peak is flat
+		{desc: "catmull-rom between keys", interpolation: rt.InterpolationCatmullRom, keys: keys, frame: 5, want: 6.25},
+		{desc: "bezier without handles matches catmull-rom", interpolation: rt.InterpolationBezier, keys: keys, frame: 5, want: 6.25},
+		{
+			desc:          "bezier with handles",
+			interpolation: rt.InterpolationBezier,
+			keys: []rt.Keyframe{
+				{Frame: 0, Value: []float64{0}, Out: []float64{0}},
+				{Frame: 10, Value: []float64{1}, In: []float64{1}},
+			},
+			frame: 5,
+			want:  0.5,
+		},
+		{
+			desc:          "bezier ease in",
+			interpolation: rt.InterpolationBezier,
+			keys: []rt.Keyframe{
+				{Frame: 0, Value: []float64{0}, Out: []float64{0}},
+				{Frame: 10, Value: []float64{1}, In: []float64{1}},
+			},
+			frame: 2,
+			want:  0.104,
+		},
+		{desc: "a single key", interpolation: rt.InterpolationBezier, keys: keys[:1], frame: 5, want: 0},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			track, err := rt.NewTrack(tc.interpolation, tc.keys)
+			assert.Nil(t, err)
+			assert.InDelta(t, tc.want, track.At(tc.frame)[0], 1e-9)
+		})
+	}
+}
+
+func TestNewTrack(t *testing.T) {
+	track, err := rt.NewTrack(rt.InterpolationLinear, []rt.Keyframe{
+		{Frame: 10, Value: []float64{1, 2, 3}},
+		{Frame: 0, Value: []float64{0, 0, 0}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{0.5, 1, 1.5}, track.At(5), "keys are sorted by frame")
+
+	for _, tc := range []struct {
+		desc string
+		keys []rt.Keyframe
+	}{
+		{desc: "no keys"},
+		{desc: "no value", keys: []rt.Keyframe{{Frame: 0}}},
+		{desc: "different sizes", keys: []rt.Keyframe{{Frame: 0, Value: []float64{0}}, {Frame: 1, Value: []float64{0, 1}}}},
+		{desc: "two keys on a frame", keys: []rt.Keyframe{{Frame: 1, Value: []float64{0}}, {Frame: 1, Value: []float64{1}}}},
+		{desc: "wrong handle size", keys: []rt.Keyframe{{Frame: 0, Value: []float64{0}, Out: []float64{0, 1}}}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := rt.NewTrack(rt.InterpolationLinear, tc.keys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseInterpolation(t *testing.T) {
+	for _, name := range []string{"linear", "bezier", "catmull-rom"} {
+		interpolation, err := rt.ParseInterpolation(strings.ToUpper(name))
+		assert.Nil(t, err)
+		assert.Equal(t, name, interpolation.String())
+	}
+	_, err := rt.ParseInterpolation("cubic")
+	assert.Error(t, err)
+}
+
+func TestAnimatedScene_Frame(t *testing.T) {
+	description, err := rt.ParseSceneDescription(strings.NewReader(`{
+		"camera": {"origin": [0, 0, 0], "animation": {"origin": {"keys": [{"frame": 0, "value": [0, 0, 0]}, {"frame": 4, "value": [0, 0.2, 0]}]}}},
+		"frames": {"start": 0, "end": 4},
+		"materials": {
+			"fading": {"type": "principled", "baseColor": [0.8, 0.2, 0.2], "animation": {"roughness": {"keys": [{"frame": 0, "value": 0}, {"frame": 4, "value": 1}]}}},
+			"matte": {"type": "lambertian"}
+		},
+		"objects": [
+			{"type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "fading"},
+			{"type": "sphere", "center": [1, 0, -2], "radius": 0.5, "material": "matte", "rotation": [0, 0, 45], "scale": [1, 2, 1]},
+			{"type": "sphere", "center": [-1, 0, -2], "radius": 0.5, "animation": {"position": {"interpolation": "catmull-rom", "keys": [{"frame": 0, "value": [0, 0, 0]}, {"frame": 4, "value": [0, 1, 0]}]}}},
+			{"type": "sphere", "center": [0, -100.5, -1], "radius": 100}
+		]
+	}`))
+	assert.Nil(t, err)
+	animation, err := description.Animate()
+	assert.Nil(t, err)
+
+	var static rt.Hittable
+	for frame := 0.0; frame <= 4; frame += 2 {
+		scene, camera, err := animation.Frame(frame)
+		assert.Nil(t, err)
+
+		// the static objects are built once, and the other two are rebuilt on every frame
+		world := scene.World.(*rt.HittableList)
+		assert.Len(t, world.Objects, 3)
+		assert.IsType(t, &rt.BVH{}, world.Objects[0])
+		if static != nil {
+			assert.True(t, static == world.Objects[0], "the static objects should be shared by every frame")
+		}
+		static = world.Objects[0]
+		fading := world.Objects[1].(*rt.Sphere).Material.(*rt.PrincipledBSDF)
+		assert.InDelta(t, frame/4, fading.Roughness.Value(0, 0, rt.Vec3{}).X, 1e-9)
+
+		// every frame renders the same as a scene built from scratch
+		opts := rt.RenderOptions{Width: 8, Height: 5, SamplesPerPixel: 2, MaxDepth: 4, AOVs: []rt.AOV{rt.AOVObjectID, rt.AOVMaterialID}, Seed: 1}
+		got, err := rt.Render(context.Background(), scene, camera, opts)
+		assert.Nil(t, err)
+		scene, camera, err = description.BuildFrame(frame)
+		assert.Nil(t, err)
+		want, err := rt.Render(context.Background(), scene, camera, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, want.Image().Pixels, got.Image().Pixels, "frame %g", frame)
+		for _, aov := range opts.AOVs {
+			wantPass, _ := want.Pass(aov)
+			gotPass, _ := got.Pass(aov)
+			assert.Equal(t, wantPass, gotPass, "frame %g %s pass", frame, aov)
+		}
+	}
+
+	t.Run("invalid animations", func(t *testing.T) {
+		for _, tc := range []struct {
+			desc, input, wantError string
+		}{
+			{desc: "unknown property", input: `{"objects": [{"type": "sphere", "radius": 1, "animation": {"color": {"keys": [{"frame": 0, "value": 1}]}}}]}`, wantError: `"color" cannot be animated`},
+			{desc: "unknown interpolation", input: `{"camera": {"animation": {"origin": {"interpolation": "step", "keys": [{"frame": 0, "value": 1}]}}}, "objects": []}`, wantError: `unknown interpolation "step"`},
+			{desc: "wrong size", input: `{"objects": [{"type": "sphere", "radius": 1, "animation": {"position": {"keys": [{"frame": 0, "value": [1, 2]}]}}}]}`, wantError: "expected 1 or 3 values"},
+			{desc: "color parameter", input: `{"materials": {"m": {"type": "conductor", "preset": "gold", "animation": {"eta": {"keys": [{"frame": 0, "value": 1}]}}}}, "objects": []}`, wantError: "invalid animated parameter"},
+			{desc: "flat object", input: `{"objects": [{"type": "sphere", "radius": 1, "scale": [1, 0, 1]}]}`, wantError: "cannot be undone"},
+		} {
+			t.Run(tc.desc, func(t *testing.T) {
+				description, err := rt.ParseSceneDescription(strings.NewReader(tc.input))
+				assert.Nil(t, err)
+				_, err = description.Animate()
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantError)
+			})
+		}
+	})
+}
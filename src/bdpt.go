@@ -0,0 +1,714 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// BDPTIntegrator is a bidirectional path tracer. For every camera ray, it also traces a path of light from the
+// environment or one of the scene's lights into the scene, and joins every vertex of the camera's path to every
+// vertex of the light's path. Each of the ways of building a path is weighted with multiple importance sampling, so
+// that light which a PathIntegrator rarely finds, like light that reaches a room through a small opening or the
+// camera through glass, converges much sooner.
+//
+// In a render with a perspective camera, the light's paths are also joined straight to the camera, and the light
+// they carry is added to whichever pixel it lands on. Other cameras only join the camera's paths to the light's.
+// Worlds that are not bounded cannot be surrounded by the light's paths, so they are rendered by a PathIntegrator.
+//
+// Each light path starts on the environment or on one of the scene's lights, which are all as likely, while every
+// vertex of the camera's path is joined to a new point on each of them. Light from a point, spot or sun light that
+// passes through glass can only be found by the light paths. Lights that are not one of these are only sampled
+// with shadow rays from the camera's path, like a PathIntegrator samples them.
+type BDPTIntegrator struct {
+	// MaxDepth is the maximum number of times that a path may bounce, counting the bounces of both the camera's
+	// and the light's part of it
+	MaxDepth int
+
+	cache tracerCache
+}
+
+// Radiance traces a camera path and a light path and returns the light that their joins carry along the ray.
+// Light that reaches the camera straight from the light's path is only added to the image by Render, since it
+// lands on other pixels than the ray's. The light around the scene is worked out the first time it is called with
+// a scene, and reused for later calls with the same scene.
+func (b *BDPTIntegrator) Radiance(r Ray, scene *Scene, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	return b.cache.get(scene, func() func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+		return b.begin(scene, nil)
+	})(r, rng, hitRecord)
+}
+
+// begin works out the light that surrounds the scene once for the whole render
+func (b *BDPTIntegrator) begin(scene *Scene, film *film) func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	light, ok := newInfiniteLight(scene)
+	if !ok {
+		path := &PathIntegrator{MaxDepth: b.MaxDepth}
+		return func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+			return path.Radiance(ray, scene, rng, hitRecord)
+		}
+	}
+	t := &bdptTracer{maxDepth: b.MaxDepth, scene: scene, light: light, film: film}
+	for _, l := range scene.Lights {
+		if e, ok := l.(emitter); ok {
+			t.emitters = append(t.emitters, e)
+		} else {
+			t.shadowed = append(t.shadowed, l)
+		}
+	}
+	t.pick = 1 / float64(len(t.emitters)+1)
+	if film != nil {
+		t.camera, _ = film.camera.(projector)
+	}
+	return t.radiance
+}
+
+// bdptTracer traces the samples of one render with a BDPTIntegrator
+type bdptTracer struct {
+	maxDepth int
+	scene    *Scene
+	light    *infiniteLight
+	// emitters are the lights inside of the scene that light paths can start from, and pick is the probability of
+	// a light path starting on each of them or on the environment. shadowed are the lights that light paths cannot
+	// start from, which are only sampled with shadow rays.
+	emitters []emitter
+	pick     float64
+	shadowed []Light
+	// film is where light that reaches the camera from the light's paths is added, and camera is the render's
+	// camera if it can find where on the film it sees a point. Without either, light paths are never joined to the
+	// camera.
+	film   *film
+	camera projector
+}
+
+// vertexKind is what a vertex of a path is on
+type vertexKind int
+
+const (
+	cameraVertex vertexKind = iota
+	environmentVertex
+	surfaceVertex
+	// lightVertex is on a point or spot light. A sun light is infinitely far away, so its vertices are on the
+	// environment.
+	lightVertex
+)
+
+// pathVertex is a vertex of a camera or light path
+type pathVertex struct {
+	kind vertexKind
+	// p is where a camera, surface or light vertex is. Vertices on the environment are infinitely far away, and
+	// instead have the unit direction that their light travels in.
+	p, direction Vec3
+	// light is the light inside of the scene that a light or environment vertex is on, or nil for the environment
+	// itself. Camera paths never hit the scene's lights.
+	light emitter
+	// hit describes the surface at a surface vertex. Its normal faces the previous vertex of the path.
+	hit HitRecord
+	// beta is the throughput of the path from its start up to the vertex
+	beta Vec3
+	// pdfFwd is the density with which the vertex was picked from the previous one on its path, and pdfRev the
+	// density with which it would be picked from the next one if the whole path were traced the other way. Both are
+	// per unit area, or per unit solid angle for vertices on the environment.
+	pdfFwd, pdfRev float64
+	// delta is true when the next vertex was picked from a delta distribution, like the reflection of a mirror, so
+	// that the vertex cannot be joined to anything
+	delta bool
+}
+
+// towards returns the unit direction from v to w
+func (v *pathVertex) towards(w *pathVertex) Vec3 {
+	if w.kind == environmentVertex {
+		return w.direction.Negate()
+	}
+	if v.kind == environmentVertex {
+		return v.direction
+	}
+	direction, _ := w.p.SubtractVector(v.p).Unit()
+	return direction
+}
+
+// convertDensity turns the solid angle density of picking next from v into a density per unit area of next
+func (v *pathVertex) convertDensity(pdf float64, next *pathVertex) float64 {
+	if next.kind == environmentVertex {
+		return pdf
+	}
+	offset := next.p.SubtractVector(v.p)
+	distanceSquared := offset.LengthSquared()
+	if distanceSquared == 0 {
+		return 0
+	}
+	if next.kind == surfaceVertex {
+		pdf *= math.Abs(next.hit.GeometricNormal.Dot(offset)) / math.Sqrt(distanceSquared)
+	}
+	return pdf / distanceSquared
+}
+
+// evaluate returns the BSDF of a surface vertex times the cosine of wi, for light that arrives from wi and leaves
+// towards wo, along with the density of picking wi given wo. Unlike Material.Evaluate, wo may be on either side of
+// the surface.
+func (v *pathVertex) evaluate(wo, wi Vec3) (Vec3, float64) {
+	hitRecord := v.hit
+	if wo.Dot(hitRecord.Normal) < 0 {
+		// this is the hit record of a ray that arrived from wo's side
+		hitRecord.Normal = hitRecord.Normal.Negate()
+		hitRecord.GeometricNormal = hitRecord.GeometricNormal.Negate()
+		hitRecord.FrontFace = !hitRecord.FrontFace
+	}
+	return hitRecord.Material.Evaluate(wo, wi, &hitRecord)
+}
+
+// f returns the BSDF of a surface vertex times the cosine towards next, for light that travels between prev and
+// next. Light paths carry light from next to prev on the camera's side, and from prev to next on the light's.
+func (v *pathVertex) f(prev, next *pathVertex, onLightPath bool) Vec3 {
+	wo, wi := v.towards(prev), v.towards(next)
+	value, _ := v.evaluate(wo, wi)
+	if onLightPath {
+		value = value.MultiplyFloat(adjoint(&v.hit, wo, wi))
+	}
+	return value
+}
+
+// refractor is implemented by materials that light can pass through
+type refractor interface {
+	// relativeIOR returns the ratio of the index of refraction on the far side of the surface to the one on the
+	// side that the ray arrived from
+	relativeIOR(hitRecord *HitRecord) float64
+}
+
+// adjoint returns what a BSDF value for light that arrives from wi and leaves towards wo must be multiplied by for
+// light that travels the other way, which is what light paths need as they follow the light. wo must be on the side
+// of the surface that the hit record's normal faces. The two values differ when light passes into a medium with a
+// different index of refraction, since radiance is squeezed into a narrower cone and power is not, and when a bump
+// map has tilted the shading normal away from the true one.
+func adjoint(hitRecord *HitRecord, wo, wi Vec3) float64 {
+	scale := 1.0
+	geometric, shading := hitRecord.GeometricNormal, hitRecord.Normal
+	if refracting, ok := hitRecord.Material.(refractor); ok && wi.Dot(geometric) < 0 {
+		eta := refracting.relativeIOR(hitRecord)
+		scale = eta * eta
+	}
+	denominator := math.Abs(wo.Dot(geometric) * wi.Dot(shading))
+	if denominator == 0 {
+		return 0
+	}
+	return scale * math.Abs(wo.Dot(shading)*wi.Dot(geometric)) / denominator
+}
+
+// radiance traces a camera path along the ray and a light path from the environment or a light, and returns the
+// light of every join between them that reaches the camera along the ray
+func (t *bdptTracer) radiance(r Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	cameraPath := t.cameraPath(r, rng)
+	lightPath := t.lightPath(rng)
+
+	radiance := Vec3{}
+	for cameraVertices := 1; cameraVertices <= len(cameraPath); cameraVertices++ {
+		for lightVertices := 0; lightVertices <= len(lightPath); lightVertices++ {
+			// a join has a vertex on the camera, one on the light, and a bounce at each of the others
+			depth := cameraVertices + lightVertices - 2
+			if (cameraVertices == 1 && lightVertices == 1) || depth < 0 || depth > t.maxDepth {
+				continue
+			}
+			if cameraVertices == 1 {
+				t.splat(lightPath, lightVertices, hitRecord)
+				continue
+			}
+			join := t.join(lightPath, cameraPath, lightVertices, cameraVertices, rng, hitRecord)
+			radiance = radiance.AddVector(join)
+		}
+	}
+
+	for i := 1; i < len(cameraPath) && i <= t.maxDepth && len(t.shadowed) > 0; i++ {
+		pt := &cameraPath[i]
+		if pt.kind != surfaceVertex {
+			continue
+		}
+		*hitRecord = pt.hit
+		lights := t.scene.sampleLights(t.shadowed, pt.towards(&cameraPath[i-1]), hitRecord, rng)
+		radiance = radiance.AddVector(pt.beta.MultiplyVector(lights))
+	}
+	return radiance
+}
+
+// cameraPath traces the camera's path along the ray, starting with a vertex on the camera
+func (t *bdptTracer) cameraPath(r Ray, rng *rand.Rand) []pathVertex {
+	path := []pathVertex{{kind: cameraVertex, p: r.Origin(), beta: NewVec3(1, 1, 1)}}
+	// only the density of the camera's rays towards the first bounce matters, which is only known by cameras that
+	// light paths can be joined to
+	pdf := 1.0
+	if t.camera != nil {
+		pdf = t.cameraPdf(r.At(1))
+	}
+	return t.walk(path, r, NewVec3(1, 1, 1), pdf, t.maxDepth+1, false, rng)
+}
+
+// cameraPdf returns the solid angle density with which the camera traces rays towards p
+func (t *bdptTracer) cameraPdf(p Vec3) float64 {
+	_, u, v, density, ok := t.camera.project(p)
+	if !ok {
+		return 0
+	}
+	if _, _, ok := t.film.pixel(u, v); !ok {
+		return 0
+	}
+	return density / t.film.area()
+}
+
+// lightPath traces a path of light from the environment or one of the lights into the scene, starting with a vertex
+// on the light. No random numbers are drawn to pick the light when the environment is the only one.
+func (t *bdptTracer) lightPath(rng *rand.Rand) []pathVertex {
+	if len(t.emitters) > 0 {
+		if source := rng.Intn(len(t.emitters) + 1); source < len(t.emitters) {
+			return t.emitterPath(t.emitters[source], rng)
+		}
+	}
+
+	r, radiance, pdfPos, pdfDir := t.light.emit(rng)
+	path := []pathVertex{{kind: environmentVertex, direction: r.Direction(), beta: radiance}}
+	if pdfPos == 0 || pdfDir == 0 {
+		// joins to new points on the environment only need a vertex to replace
+		return path
+	}
+	beta := radiance.MultiplyFloat(1 / (t.pick * pdfPos * pdfDir))
+	path = t.walk(path, r, beta, pdfDir, t.maxDepth, true, rng)
+
+	// the light's rays are parallel, so how densely they hit a surface depends on where they start and not on how
+	// far they travel, and the vertex on the environment is picked by its direction
+	if len(path) > 1 {
+		path[1].pdfFwd = pdfPos * math.Abs(r.Direction().Dot(path[1].hit.GeometricNormal))
+	}
+	path[0].pdfFwd = t.light.pdf(r.Direction().Negate())
+	return path
+}
+
+// emitterPath traces a path of light from one of the lights inside of the scene
+func (t *bdptTracer) emitterPath(light emitter, rng *rand.Rand) []pathVertex {
+	r, power := light.emit(rng, t.light.center, t.light.radius)
+	// camera paths never hit the light, so the density of the point on it only has to be the same for every way of
+	// building a path from it
+	path := []pathVertex{lightSourceVertex(light, r.Origin(), r.Direction())}
+	if power.IsZero() {
+		return path
+	}
+	path = t.walk(path, r, power.MultiplyFloat(1/t.pick), light.emitPdf(r.Direction()), t.maxDepth, true, rng)
+	if light.infinite() && len(path) > 1 {
+		path[1].pdfFwd = t.lightPdf(&path[0], &path[1])
+	}
+	return path
+}
+
+// lightSourceVertex returns the vertex that starts a path on a light inside of the scene at p, or on the environment
+// if the light is infinitely far away, along with the unit direction that the light travels in from it
+func lightSourceVertex(light emitter, p, direction Vec3) pathVertex {
+	if light.infinite() {
+		return pathVertex{kind: environmentVertex, direction: direction, light: light, pdfFwd: 1}
+	}
+	return pathVertex{kind: lightVertex, p: p, light: light, pdfFwd: 1}
+}
+
+// walk extends a path by following the ray from its last vertex, with beta the throughput of the path so far and
+// pdf the solid angle density of the ray's direction. It adds at most maxVertices vertices. A camera path that
+// escapes the scene ends with a vertex on the environment.
+func (t *bdptTracer) walk(path []pathVertex, r Ray, beta Vec3, pdf float64, maxVertices int, onLightPath bool, rng *rand.Rand) []pathVertex {
+	var hitRecord HitRecord
+	for added := 0; added < maxVertices; added++ {
+		if !t.scene.World.Hit(r, 0.001, math.Inf(1), &hitRecord) {
+			if !onLightPath {
+				direction, _ := r.Direction().Unit()
+				path = append(path, pathVertex{kind: environmentVertex, direction: direction.Negate(), beta: beta, pdfFwd: pdf})
+			}
+			return path
+		}
+		vertex := pathVertex{kind: surfaceVertex, p: hitRecord.P, hit: hitRecord, beta: beta}
+		vertex.pdfFwd = path[len(path)-1].convertDensity(pdf, &vertex)
+		path = append(path, vertex)
+		if added+1 == maxVertices {
+			return path
+		}
+
+		scatter, ok := hitRecord.Material.Scatter(r, &hitRecord, rng)
+		if !ok {
+			return path
+		}
+		wo, _ := r.Direction().Unit()
+		wo = wo.Negate()
+		wi, _ := scatter.Ray.Direction().Unit()
+		attenuation := scatter.Attenuation
+		if onLightPath {
+			attenuation = attenuation.MultiplyFloat(adjoint(&hitRecord, wo, wi))
+		}
+		beta = beta.MultiplyVector(attenuation)
+		if beta.IsZero() {
+			return path
+		}
+
+		current, previous := &path[len(path)-1], &path[len(path)-2]
+		pdfRev := 0.0
+		pdf = scatter.Pdf
+		if scatter.IsSpecular {
+			current.delta = true
+			pdf = 0
+		} else {
+			_, pdfRev = current.evaluate(wi, wo)
+		}
+		previous.pdfRev = current.convertDensity(pdfRev, previous)
+		r = scatter.Ray
+	}
+	return path
+}
+
+// join returns the light carried by the path made of the first lightVertices vertices of the light path and the
+// first cameraVertices vertices of the camera path, which must have at least two vertices
+func (t *bdptTracer) join(lightPath, cameraPath []pathVertex, lightVertices, cameraVertices int, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	pt := &cameraPath[cameraVertices-1]
+	var sampled *pathVertex
+	var radiance Vec3
+	switch {
+	case lightVertices == 0:
+		// the camera path escaped to the environment by itself
+		if pt.kind != environmentVertex {
+			return Vec3{}
+		}
+		radiance = pt.beta.MultiplyVector(t.light.radiance(pt.direction.Negate()))
+	case pt.kind != surfaceVertex:
+		return Vec3{}
+	case lightVertices == 1:
+		// the last camera vertex is joined to a new point on the environment and on each of the lights, picked for
+		// this join
+		for source := -1; source < len(t.emitters); source++ {
+			vertex, light := t.sampleSource(source, pt, &cameraPath[cameraVertices-2], rng, hitRecord)
+			if vertex != nil {
+				weight := t.misWeight(lightPath, cameraPath, vertex, lightVertices, cameraVertices)
+				radiance = radiance.AddVector(light.MultiplyFloat(weight))
+			}
+		}
+		return radiance
+	default:
+		qs := &lightPath[lightVertices-1]
+		if qs.kind != surfaceVertex {
+			return Vec3{}
+		}
+		radiance = qs.beta.
+			MultiplyVector(qs.f(&lightPath[lightVertices-2], pt, true)).
+			MultiplyVector(pt.f(&cameraPath[cameraVertices-2], qs, false)).
+			MultiplyVector(pt.beta).
+			MultiplyFloat(1 / qs.p.SubtractVector(pt.p).LengthSquared())
+		if radiance.IsZero() || !t.visible(qs.p, pt.p, hitRecord) {
+			return Vec3{}
+		}
+	}
+	return radiance.MultiplyFloat(t.misWeight(lightPath, cameraPath, sampled, lightVertices, cameraVertices))
+}
+
+// sampleSource picks a new point on the environment, or on the emitter with the passed-in index if it is not
+// negative, for a join to the surface vertex pt that was reached from prev. It returns a vertex on the light and
+// the light that the join carries to the camera, or nil if no light does.
+func (t *bdptTracer) sampleSource(source int, pt, prev *pathVertex, rng *rand.Rand, hitRecord *HitRecord) (*pathVertex, Vec3) {
+	var sampled pathVertex
+	var direction Vec3
+	distance := math.Inf(1)
+	if source < 0 {
+		var light Vec3
+		var pdf float64
+		direction, light, pdf = t.light.sample(rng)
+		if pdf == 0 {
+			return nil, Vec3{}
+		}
+		sampled = pathVertex{kind: environmentVertex, direction: direction.Negate(), beta: light.MultiplyFloat(1 / pdf)}
+		sampled.pdfFwd = t.light.pdf(direction)
+	} else {
+		light := t.emitters[source]
+		var irradiance Vec3
+		direction, distance, irradiance = light.Sample(pt.p, rng)
+		if irradiance.IsZero() {
+			return nil, Vec3{}
+		}
+		sampled = lightSourceVertex(light, pt.p.AddVector(direction.MultiplyFloat(distance)), direction.Negate())
+		sampled.beta = irradiance
+	}
+
+	radiance := pt.beta.MultiplyVector(pt.f(prev, &sampled, false)).MultiplyVector(sampled.beta)
+	if radiance.IsZero() || t.scene.World.Hit(NewRay(pt.p, direction), 0.001, distance-0.001, hitRecord) {
+		return nil, Vec3{}
+	}
+	return &sampled, radiance
+}
+
+// splat joins the last of the first lightVertices vertices of the light path straight to the camera, and adds the
+// light that reaches the camera to the film
+func (t *bdptTracer) splat(lightPath []pathVertex, lightVertices int, hitRecord *HitRecord) {
+	if t.camera == nil {
+		return
+	}
+	qs := &lightPath[lightVertices-1]
+	if qs.kind != surfaceVertex {
+		return
+	}
+	eye, u, v, density, ok := t.camera.project(qs.p)
+	if !ok {
+		return
+	}
+	if _, _, ok := t.film.pixel(u, v); !ok {
+		return
+	}
+
+	// the camera's importance is how densely its rays are spread towards the point, shared out over the film
+	sampled := &pathVertex{kind: cameraVertex, p: eye}
+	radiance := qs.beta.
+		MultiplyVector(qs.f(&lightPath[lightVertices-2], sampled, true)).
+		MultiplyFloat(density / t.film.area() / qs.p.SubtractVector(eye).LengthSquared())
+	if radiance.IsZero() || !t.visible(qs.p, eye, hitRecord) {
+		return
+	}
+	t.film.splat(u, v, radiance.MultiplyFloat(t.misWeight(lightPath, nil, sampled, lightVertices, 1)))
+}
+
+// visible returns whether nothing is in the way between two points
+func (t *bdptTracer) visible(from, to Vec3, hitRecord *HitRecord) bool {
+	offset := to.SubtractVector(from)
+	distance := offset.Length()
+	if distance <= 0.002 {
+		return true
+	}
+	return !t.scene.World.Hit(NewRay(from, offset.MultiplyFloat(1/distance)), 0.001, distance-0.001, hitRecord)
+}
+
+// pdf returns the density of picking next from a vertex that was reached from prev, per unit area of next or per
+// unit solid angle if next is on the environment
+func (t *bdptTracer) pdf(v, prev, next *pathVertex) float64 {
+	switch v.kind {
+	case environmentVertex:
+		return t.lightPdf(v, next)
+	case lightVertex:
+		return v.convertDensity(v.light.emitPdf(v.towards(next)), next)
+	case cameraVertex:
+		if t.camera == nil {
+			return 0
+		}
+		return v.convertDensity(t.cameraPdf(next.p), next)
+	default:
+		_, pdf := v.evaluate(v.towards(prev), v.towards(next))
+		return v.convertDensity(pdf, next)
+	}
+}
+
+// lightPdf returns the density per unit area of next with which the light's rays leave the environment vertex v
+// towards it. They start evenly spread over a disk as wide as the scene, for the sun as well as the environment.
+func (t *bdptTracer) lightPdf(v, next *pathVertex) float64 {
+	pdf := 1 / (math.Pi * t.light.radius * t.light.radius)
+	if next.kind == surfaceVertex {
+		pdf *= math.Abs(next.hit.GeometricNormal.Dot(v.direction))
+	}
+	return pdf
+}
+
+// misWeight returns the weight of the join of the first lightVertices vertices of the light path and the first
+// cameraVertices vertices of the camera path, using the power heuristic over every way of building the same path.
+// sampled replaces the last vertex of the light path when it is a single vertex, or of the camera path when the
+// light path is joined straight to the camera.
+func (t *bdptTracer) misWeight(lightPath, cameraPath []pathVertex, sampled *pathVertex, lightVertices, cameraVertices int) float64 {
+	if lightVertices+cameraVertices == 2 {
+		return 1
+	}
+
+	// the join changes the densities at the ends of both paths, so they are swapped in and restored afterwards
+	var qs, pt, qsMinus, ptMinus *pathVertex
+	if lightVertices > 0 {
+		qs = &lightPath[lightVertices-1]
+		if lightVertices > 1 {
+			qsMinus = &lightPath[lightVertices-2]
+		}
+	}
+	var camera pathVertex
+	if cameraVertices == 1 {
+		pt = &camera
+	} else {
+		pt = &cameraPath[cameraVertices-1]
+		ptMinus = &cameraPath[cameraVertices-2]
+	}
+	savedPt := *pt
+	var savedQs pathVertex
+	var savedQsMinus, savedPtMinus float64
+	if qs != nil {
+		savedQs = *qs
+	}
+	if qsMinus != nil {
+		savedQsMinus = qsMinus.pdfRev
+	}
+	if ptMinus != nil {
+		savedPtMinus = ptMinus.pdfRev
+	}
+
+	if lightVertices == 1 {
+		*qs = *sampled
+	} else if cameraVertices == 1 {
+		*pt = *sampled
+	}
+	// the joined vertices are not delta, since the join itself did not pick a direction from a delta distribution
+	pt.delta = false
+	if qs != nil {
+		qs.delta = false
+		pt.pdfRev = t.pdf(qs, qsMinus, pt)
+		qs.pdfRev = t.pdf(pt, ptMinus, qs)
+	} else {
+		pt.pdfRev = t.light.pdf(pt.direction.Negate())
+	}
+	if ptMinus != nil {
+		if qs != nil {
+			ptMinus.pdfRev = t.pdf(pt, qs, ptMinus)
+		} else {
+			ptMinus.pdfRev = t.lightPdf(pt, ptMinus)
+		}
+	}
+	if qsMinus != nil {
+		qsMinus.pdfRev = t.pdf(qs, pt, qsMinus)
+	}
+
+	// each ratio is how much more likely the path is to be built by a join with more vertices on one side, relative
+	// to this join. Joins to a single vertex on the light try every light, while longer light paths pick one of
+	// them, which changes the ratio between the two.
+	remap := func(pdf float64) float64 {
+		if pdf == 0 {
+			return 1
+		}
+		return pdf
+	}
+	sum, ratio := 0.0, 1.0
+	for i := cameraVertices - 1; i > 0; i-- {
+		ratio *= remap(cameraPath[i].pdfRev) / remap(cameraPath[i].pdfFwd)
+		if lightVertices+cameraVertices-i == 2 {
+			ratio *= t.pick
+		}
+		// joins that leave just the camera on the camera's side need a camera that light paths can be joined to
+		if !cameraPath[i].delta && !cameraPath[i-1].delta && (i > 1 || t.camera != nil) {
+			sum += ratio * ratio
+		}
+	}
+	ratio = 1
+	for i := lightVertices - 1; i >= 0; i-- {
+		ratio *= remap(lightPath[i].pdfRev) / remap(lightPath[i].pdfFwd)
+		if i == 1 {
+			ratio /= t.pick
+		}
+		// camera paths can only reach the environment itself, and not the lights inside of the scene
+		if !lightPath[i].delta && ((i == 0 && lightPath[0].light == nil) || (i > 0 && !lightPath[i-1].delta)) {
+			sum += ratio * ratio
+		}
+	}
+
+	*pt = savedPt
+	if qs != nil {
+		*qs = savedQs
+	}
+	if qsMinus != nil {
+		qsMinus.pdfRev = savedQsMinus
+	}
+	if ptMinus != nil {
+		ptMinus.pdfRev = savedPtMinus
+	}
+	return 1 / (1 + sum)
+}
+
+// infiniteLight is the light of the environment that surrounds the scene, which light paths start from
+type infiniteLight struct {
+	// environment is the environment map, or nil for the sky gradient
+	environment *EnvironmentLight
+	// center and radius describe a sphere around the whole world
+	center Vec3
+	radius float64
+}
+
+// newInfiniteLight returns the light around the scene, or false if the world is not bounded
+func newInfiniteLight(scene *Scene) (*infiniteLight, bool) {
+	box := worldBounds(scene.World)
+	if box == nil {
+		return nil, false
+	}
+	center := box.Center()
+	radius := box.Max.SubtractVector(center).Length()
+	if radius <= 0 || math.IsInf(radius, 0) || math.IsNaN(radius) {
+		return nil, false
+	}
+	return &infiniteLight{environment: scene.Environment, center: center, radius: radius}, true
+}
+
+// worldBounds returns a box around every object in the world, or nil if some of them are unbounded
+func worldBounds(world Hittable) *AABB {
+	switch w := world.(type) {
+	case *HittableList:
+		var box *AABB
+		for _, object := range w.Objects {
+			objectBox := worldBounds(object)
+			if objectBox == nil {
+				return nil
+			}
+			if box == nil {
+				box = objectBox
+			} else {
+				box = box.Union(objectBox)
+			}
+		}
+		return box
+	case *countingWorld:
+		return worldBounds(w.Hittable)
+	case Bounded:
+		return w.BoundingBox()
+	}
+	return nil
+}
+
+// radiance returns the light that arrives from the environment along the passed-in direction, which points away
+// from the scene
+func (l *infiniteLight) radiance(direction Vec3) Vec3 {
+	if l.environment == nil {
+		return NewRay(Vec3{}, direction).linearBlueGradient()
+	}
+	return l.environment.Radiance(direction)
+}
+
+// sample picks a unit direction towards the environment, and returns it along with the light arriving from it and
+// its solid angle density. The environment map is sampled by its brightness, and the sky gradient evenly.
+func (l *infiniteLight) sample(rng *rand.Rand) (direction, radiance Vec3, pdf float64) {
+	if l.environment != nil {
+		return l.environment.Sample(rng.Float64(), rng.Float64())
+	}
+	direction = uniformSampleSphere(randomPair(rng))
+	return direction, l.radiance(direction), 1 / (4 * math.Pi)
+}
+
+// pdf returns the solid angle density with which sample picks the passed-in direction
+func (l *infiniteLight) pdf(direction Vec3) float64 {
+	if l.environment != nil {
+		return l.environment.Pdf(direction)
+	}
+	return 1 / (4 * math.Pi)
+}
+
+// emit picks a ray of light that leaves the environment towards the scene. It returns the ray, the light that it
+// carries, the density of its origin per unit area of the disk that the rays start from and the solid angle
+// density of its direction.
+func (l *infiniteLight) emit(rng *rand.Rand) (r Ray, radiance Vec3, pdfPos, pdfDir float64) {
+	direction, radiance, pdfDir := l.sample(rng)
+	if pdfDir == 0 {
+		return Ray{}, Vec3{}, 0, 0
+	}
+	// the rays start on a disk facing the scene from just outside of the sphere around it, which they all cross
+	x, y := uniformSampleDisk(randomPair(rng))
+	frame := NewONB(direction)
+	origin := l.center.
+		AddVector(direction.MultiplyFloat(l.radius)).
+		AddVector(frame.ToWorld(NewVec3(x*l.radius, y*l.radius, 0)))
+	return NewRay(origin, direction.Negate()), radiance, 1 / (math.Pi * l.radius * l.radius), pdfDir
+}
+
+// uniformSampleSphere returns a unit direction with a density of 1 / 4pi
+func uniformSampleSphere(u0, u1 float64) Vec3 {
+	z := 1 - 2*u0
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * math.Pi * u1
+	return NewVec3(r*math.Cos(phi), r*math.Sin(phi), z)
+}
+
+// uniformSampleDisk returns a point on the unit disk with a density of 1 / pi
+func uniformSampleDisk(u0, u1 float64) (x, y float64) {
+	r := math.Sqrt(u0)
+	phi := 2 * math.Pi * u1
+	return r * math.Cos(phi), r * math.Sin(phi)
+}
@@ -0,0 +1,165 @@
+package raytracer_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+// sphereScene returns the command line renderer's built-in scene of a sphere resting on a much larger one under the
+// sky, with the small sphere made of the passed-in material
+func sphereScene(material rt.Material) *rt.Scene {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5, Material: material, ID: 1})
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, -100.5, -1), Radius: 100, ID: 2})
+	return &rt.Scene{World: world}
+}
+
+// causticScene returns a glass sphere over a small diffuse disk, lit by a bright patch of sky overhead, which the
+// glass focuses into a caustic on the disk
+func causticScene(t *testing.T) *rt.Scene {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5, Material: rt.NewRoughDielectric(1.5, 0, 0)})
+	world.Add(&rt.Disk{Center: rt.NewVec3(0, -0.5, -1), Radius: 1.5, Material: rt.NewLambertian(rt.NewVec3(0.8, 0.8, 0.8))})
+	img := rt.NewHDRImage(16, 8)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			radiance := 0.1
+			if y < 2 {
+				radiance = 5
+			}
+			img.Set(x, y, rt.NewVec3(radiance, radiance, radiance))
+		}
+	}
+	environment, err := rt.NewEnvironmentLight(img, 0, 1)
+	assert.Nil(t, err)
+	return &rt.Scene{World: world, Environment: environment}
+}
+
+// meanLuminance returns the average luminance of the pixels of a render, and of each of its quarters
+func meanLuminance(fb *rt.Framebuffer) (float64, [4]float64) {
+	var total float64
+	var quarters [4]float64
+	for y := 0; y < fb.Height; y++ {
+		for x := 0; x < fb.Width; x++ {
+			luminance := rt.Luminance(fb.Color(x, y))
+			total += luminance
+			quarters[2*(2*y/fb.Height)+2*x/fb.Width] += luminance
+		}
+	}
+	pixels := float64(fb.Width * fb.Height)
+	for i := range quarters {
+		quarters[i] /= pixels / 4
+	}
+	return total / pixels, quarters
+}
+
+func TestBDPTIntegrator_Converges(t *testing.T) {
+	perspective, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+	orthographic, err := rt.NewOrthographicCamera(rt.NewVec3(0, 0, 0), rt.Identity(), 2)
+	assert.Nil(t, err)
+	// lights inside of the scene are joined to the camera's paths as well as starting light paths
+	pointLit := sphereScene(rt.NewLambertian(rt.NewVec3(0.7, 0.3, 0.3)))
+	pointLit.Lights = []rt.Light{&rt.PointLight{Position: rt.NewVec3(0.8, 0.8, -0.5), Intensity: rt.NewVec3(1, 1, 1)}}
+	sunLit := sphereScene(rt.NewRoughDielectric(1.5, 0.3, 0.3))
+	sunLit.Lights = []rt.Light{
+		&rt.SunLight{Direction: rt.NewVec3(-1, -1, -0.5), Irradiance: rt.NewVec3(1, 1, 1), AngularDiameter: 2},
+		&rt.SpotLight{Position: rt.NewVec3(-0.8, 0.8, -0.5), Direction: rt.NewVec3(1, -1, -0.5), Intensity: rt.NewVec3(1, 1, 1), Angle: 30},
+	}
+	for _, tc := range []struct {
+		desc   string
+		scene  *rt.Scene
+		camera rt.Camera
+	}{
+		{desc: "a diffuse sphere", scene: sphereScene(rt.NewLambertian(rt.NewVec3(0.7, 0.3, 0.3))), camera: perspective},
+		{desc: "a glass sphere", scene: sphereScene(rt.NewRoughDielectric(1.5, 0, 0)), camera: perspective},
+		{desc: "a frosted glass sphere", scene: sphereScene(rt.NewRoughDielectric(1.5, 0.3, 0.3)), camera: perspective},
+		{desc: "a caustic", scene: causticScene(t), camera: perspective},
+		{desc: "a caustic seen by a camera that light paths cannot be joined to", scene: causticScene(t), camera: orthographic},
+		{desc: "a diffuse sphere lit by a point light", scene: pointLit, camera: perspective},
+		{desc: "a frosted glass sphere lit by the sun and a spot light", scene: sunLit, camera: perspective},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := rt.RenderOptions{Width: 32, Height: 18, SamplesPerPixel: 256, Seed: 1}
+			opts.Integrator = &rt.PathIntegrator{MaxDepth: 16, RouletteDepth: -1}
+			reference, err := rt.Render(context.Background(), tc.scene, tc.camera, opts)
+			assert.Nil(t, err)
+			opts.Integrator = &rt.BDPTIntegrator{MaxDepth: 16}
+			opts.Seed = 2
+			bidirectional, err := rt.Render(context.Background(), tc.scene, tc.camera, opts)
+			assert.Nil(t, err)
+
+			want, wantQuarters := meanLuminance(reference)
+			got, gotQuarters := meanLuminance(bidirectional)
+			assert.InDelta(t, 1, got/want, 0.01, "mean luminance %v, want %v", got, want)
+			for i := range wantQuarters {
+				assert.InDelta(t, 1, gotQuarters[i]/wantQuarters[i], 0.04, "quarter %d: %v, want %v", i, gotQuarters[i], wantQuarters[i])
+			}
+		})
+	}
+}
+
+func TestBDPTIntegrator_LightsBehindGlass(t *testing.T) {
+	// the camera looks down at the floor, so that it does not see the caustic through the glass, which no join of a
+	// camera path and a light path can build
+	camera, err := rt.NewRotatedCamera(rt.NewVec3(0, 0.3, -0.2), rt.EulerRotation(rt.NewVec3(-75, 0, 0)))
+	assert.Nil(t, err)
+	darkness, err := rt.NewEnvironmentLight(rt.NewHDRImage(1, 1), 0, 1)
+	assert.Nil(t, err)
+	// a glass sphere hangs between each light and the floor, and focuses its light into a caustic, which a
+	// PathIntegrator never finds
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0.8, -1), Radius: 0.3, Material: rt.NewRoughDielectric(1.5, 0, 0)})
+	world.Add(&rt.Disk{Center: rt.NewVec3(0, -0.5, -1), Radius: 1.5, Material: rt.NewLambertian(rt.NewVec3(0.8, 0.8, 0.8))})
+	white := rt.NewVec3(1, 1, 1)
+
+	for _, tc := range []struct {
+		desc  string
+		light rt.Light
+	}{
+		{desc: "a point light", light: &rt.PointLight{Position: rt.NewVec3(0.2, 1.8, -1), Intensity: white.MultiplyFloat(2)}},
+		{desc: "a spot light", light: &rt.SpotLight{Position: rt.NewVec3(0.2, 1.8, -1), Direction: rt.NewVec3(-0.2, -1, 0), Intensity: white.MultiplyFloat(2), Angle: 40, Softness: 0.3}},
+		{desc: "the sun", light: &rt.SunLight{Direction: rt.NewVec3(-0.3, -1, 0.2), Irradiance: white, AngularDiameter: 2}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			scene := &rt.Scene{World: world, Environment: darkness, Lights: []rt.Light{tc.light}}
+			opts := rt.RenderOptions{Width: 32, Height: 18, SamplesPerPixel: 256, Seed: 1}
+			opts.Integrator = &rt.PhotonMapIntegrator{MaxDepth: 16, Photons: 200000}
+			reference, err := rt.Render(context.Background(), scene, camera, opts)
+			assert.Nil(t, err)
+			opts.Integrator = &rt.BDPTIntegrator{MaxDepth: 16}
+			opts.Seed = 2
+			bidirectional, err := rt.Render(context.Background(), scene, camera, opts)
+			assert.Nil(t, err)
+
+			want, wantQuarters := meanLuminance(reference)
+			got, gotQuarters := meanLuminance(bidirectional)
+			assert.InDelta(t, 1, got/want, 0.02, "mean luminance %v, want %v", got, want)
+			for i := range wantQuarters {
+				assert.InDelta(t, 1, gotQuarters[i]/wantQuarters[i], 0.04, "quarter %d: %v, want %v", i, gotQuarters[i], wantQuarters[i])
+			}
+		})
+	}
+}
+
+func TestBDPTIntegrator_Radiance(t *testing.T) {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -2), Radius: 1})
+	darkness, err := rt.NewEnvironmentLight(rt.NewHDRImage(1, 1), 0, 1)
+	assert.Nil(t, err)
+	integrator := &rt.BDPTIntegrator{MaxDepth: 4}
+	trace := func(scene *rt.Scene) rt.Vec3 {
+		var hitRecord rt.HitRecord
+		return integrator.Radiance(rt.NewRay(rt.NewVec3(0, 0, 0), rt.NewVec3(0, 0, -1)), scene, rand.New(rand.NewSource(1)), &hitRecord)
+	}
+
+	sky := &rt.Scene{World: world}
+	first := trace(sky)
+	assert.True(t, first.MaxComponent() > 0, "the sphere is lit by the sky, got %v", first)
+	assert.Equal(t, first, trace(sky), "the light around the scene is reused")
+	assert.Equal(t, rt.Vec3{}, trace(&rt.Scene{World: world, Environment: darkness}), "a new scene has its own light")
+}
@@ -0,0 +1,102 @@
+package raytracer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// BVH is a bounding volume hierarchy: a binary tree of bounding boxes that lets a ray skip every object whose box
+// it misses
+type BVH struct {
+	left, right Hittable
+	box         *AABB
+}
+
+// NewBVH builds a hierarchy over objects, which must all implement Bounded. Objects are split in half along the
+// longest axis of their centers at every level.
+func NewBVH(objects []Hittable) (*BVH, error) {
+	if len(objects) == 0 {
+		return nil, errors.New("a BVH needs at least one object")
+	}
+	// entries are sorted while building, so the caller's slice keeps its order
+	entries := make([]bvhEntry, len(objects))
+	for i, object := range objects {
+		bounded, ok := object.(Bounded)
+		if !ok || bounded.BoundingBox() == nil {
+			return nil, fmt.Errorf("object %d of type %T has no bounding box", i, object)
+		}
+		entries[i] = bvhEntry{object: object, box: bounded.BoundingBox()}
+	}
+	return buildBVH(entries), nil
+}
+
+// bvhEntry is an object along with its bounding box, while a BVH is built
+type bvhEntry struct {
+	object Hittable
+	box    *AABB
+}
+
+func buildBVH(entries []bvhEntry) *BVH {
+	box := entries[0].box
+	centers := NewAABB(entries[0].box.Center(), entries[0].box.Center())
+	for _, entry := range entries[1:] {
+		box = box.Union(entry.box)
+		centers = centers.Union(NewAABB(entry.box.Center(), entry.box.Center()))
+	}
+
+	switch len(entries) {
+	case 1:
+		return &BVH{left: entries[0].object, box: box}
+	case 2:
+		return &BVH{left: entries[0].object, right: entries[1].object, box: box}
+	}
+
+	// split along the axis where the centers are the most spread out
+	extent := centers.Max.SubtractVector(centers.Min)
+	axis := func(v Vec3) float64 { return v.X }
+	if extent.Y > extent.X && extent.Y >= extent.Z {
+		axis = func(v Vec3) float64 { return v.Y }
+	} else if extent.Z > extent.X && extent.Z > extent.Y {
+		axis = func(v Vec3) float64 { return v.Z }
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return axis(entries[i].box.Center()) < axis(entries[j].box.Center())
+	})
+
+	middle := len(entries) / 2
+	return &BVH{left: buildBVH(entries[:middle]), right: buildBVH(entries[middle:]), box: box}
+}
+
+// BoundingBox returns the box around every object in the hierarchy
+func (b *BVH) BoundingBox() *AABB {
+	return b.box
+}
+
+// Hit returns the closest object in the hierarchy that the ray hits
+func (b *BVH) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	if !b.box.Hit(ray, tMin, tMax) {
+		return false
+	}
+
+	didHit := b.left.Hit(ray, tMin, tMax, hitRecord)
+	if b.right == nil {
+		return didHit
+	}
+	if didHit {
+		// only a closer hit on the right can replace the one on the left
+		tMax = hitRecord.T
+	}
+	return b.right.Hit(ray, tMin, tMax, hitRecord) || didHit
+}
+
+// Validate returns an error if any object in the hierarchy cannot be traced
+func (b *BVH) Validate() error {
+	if err := validate(b.left); err != nil {
+		return err
+	}
+	if b.right == nil {
+		return nil
+	}
+	return validate(b.right)
+}
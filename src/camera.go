@@ -1,18 +1,42 @@
 package raytracer
 
-import "errors"
-
-// Camera is a representation of the virtual camera system
-type Camera struct {
-	origin          *Vec3
-	horizontal      *Vec3
-	vertical        *Vec3
-	lowerLeftCorner *Vec3
+import (
+	"errors"
+	"math"
+)
+
+// Camera turns points on the image into the rays that are traced through them
+type Camera interface {
+	// GetRay returns the ray that is traced through the (u,v) point of the image, where (0,0) is the bottom left
+	// corner and (1,1) is the top right
+	GetRay(u, v float64) Ray
+	// Validate returns a *ValidationError if some of the camera's rays would have no direction
+	Validate() error
+}
+
+// projector is implemented by cameras that can find where on the image they see a point, which lets integrators
+// add light that they trace from the lights to the image
+type projector interface {
+	// project returns the (u,v) point of the image through which the camera sees p, along with the point that the
+	// camera sees it from and the number of (u,v) points per unit solid angle around the direction to p, which is
+	// how densely the camera's rays are spread there. It returns false if p is not in front of the camera.
+	project(p Vec3) (eye Vec3, u, v, density float64, ok bool)
+}
+
+// aspectRatio is the ratio of the width of rendered images to their height
+const aspectRatio = 16.0 / 9.0
+
+// PerspectiveCamera is a pinhole camera that looks down the negative Z axis, unless it is rotated
+type PerspectiveCamera struct {
+	origin          Vec3
+	horizontal      Vec3
+	vertical        Vec3
+	lowerLeftCorner Vec3
 }
 
-// NewCamera returns a new camera struct
-func NewCamera(origin *Vec3) (*Camera, error) {
-	c := &Camera{origin: origin}
+// NewCamera returns a new perspective camera
+func NewCamera(origin Vec3) (*PerspectiveCamera, error) {
+	c := &PerspectiveCamera{origin: origin}
 	horizontal := NewVec3(c.ViewportWidth(), 0, 0)
 	vertical := NewVec3(0, c.ViewportHeight(), 0)
 	halfHorizontal, err := horizontal.DivideFloat(2)
@@ -33,31 +57,75 @@ func NewCamera(origin *Vec3) (*Camera, error) {
 	c.vertical = vertical
 	c.lowerLeftCorner = lowerLeftCorner
 
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewRotatedCamera returns a perspective camera at origin that is turned by rotation from looking down the
+// negative Z axis
+func NewRotatedCamera(origin Vec3, rotation Matrix4) (*PerspectiveCamera, error) {
+	c, err := NewCamera(origin)
+	if err != nil {
+		return nil, err
+	}
+	c.horizontal = rotation.TransformVector(c.horizontal)
+	c.vertical = rotation.TransformVector(c.vertical)
+	c.lowerLeftCorner = origin.AddVector(rotation.TransformVector(c.lowerLeftCorner.SubtractVector(origin)))
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
+// Validate returns an error if the camera's origin is not finite, or if its rotation collapses the viewport so
+// that some of its rays would have no direction
+func (c *PerspectiveCamera) Validate() error {
+	if err := checkPoint("camera", "origin", c.origin); err != nil {
+		return err
+	}
+	// every ray's direction is the direction to the middle of the viewport plus some of the viewport's sides, so
+	// none of them are zero when the three are independent
+	forward := c.lowerLeftCorner.
+		AddVector(c.horizontal.MultiplyFloat(0.5)).
+		AddVector(c.vertical.MultiplyFloat(0.5)).
+		SubtractVector(c.origin)
+	return checkBasis("camera", "viewport", c.horizontal, c.vertical, forward)
+}
+
+// checkBasis returns an error if three directions of a camera do not span space, so that some of its rays would
+// have no direction
+func checkBasis(object, field string, x, y, z Vec3) error {
+	volume := x.Cross(y).Dot(z)
+	if math.IsNaN(volume) || math.IsInf(volume, 0) || volume == 0 {
+		return validationError(object, field, ErrDegenerate)
+	}
+	return nil
+}
+
 // AspectRatio returns the current aspect ratio of the camera
-func (c *Camera) AspectRatio() float64 {
-	return 16.0 / 9.0
+func (c *PerspectiveCamera) AspectRatio() float64 {
+	return aspectRatio
 }
 
 // ViewportHeight returns the viewport height of the camera
-func (c *Camera) ViewportHeight() float64 {
+func (c *PerspectiveCamera) ViewportHeight() float64 {
 	return 2.0
 }
 
 // ViewportWidth returns the viewport width of the camera
-func (c *Camera) ViewportWidth() float64 {
+func (c *PerspectiveCamera) ViewportWidth() float64 {
 	return c.AspectRatio() * c.ViewportHeight()
 }
 
 // FocalLength returns the focal length of the camera
-func (c *Camera) FocalLength() float64 {
+func (c *PerspectiveCamera) FocalLength() float64 {
 	return 1.0
 }
 
 // GetRay returns the ray that should be rendered on the (u,v) point on a flat canvas
-func (c *Camera) GetRay(u, v float64) *Ray {
+func (c *PerspectiveCamera) GetRay(u, v float64) Ray {
 	direction := c.lowerLeftCorner.
 		AddVector(c.horizontal.MultiplyFloat(u)).
 		AddVector(c.vertical.MultiplyFloat(v)).
@@ -65,3 +133,24 @@ func (c *Camera) GetRay(u, v float64) *Ray {
 
 	return NewRay(c.origin, direction)
 }
+
+// project finds where the line from the camera's origin to p crosses the viewport
+func (c *PerspectiveCamera) project(p Vec3) (eye Vec3, u, v, density float64, ok bool) {
+	normal := c.horizontal.Cross(c.vertical)
+	toViewport := c.lowerLeftCorner.SubtractVector(c.origin).Dot(normal)
+	along := p.SubtractVector(c.origin).Dot(normal)
+	// points in front of the camera are on the same side of it as the viewport
+	if along == 0 || along*toViewport <= 0 {
+		return Vec3{}, 0, 0, 0, false
+	}
+
+	// r goes from the origin to where the direction to p crosses the viewport
+	r := p.SubtractVector(c.origin).MultiplyFloat(toViewport / along)
+	q := r.AddVector(c.origin).SubtractVector(c.lowerLeftCorner)
+	area := normal.LengthSquared()
+	u = q.Cross(c.vertical).Dot(normal) / area
+	v = c.horizontal.Cross(q).Dot(normal) / area
+	// a patch of the viewport covers a solid angle that shrinks with its distance squared and the cosine of its tilt
+	density = math.Pow(r.Length(), 3) / math.Abs(r.Dot(normal))
+	return c.origin, u, v, density, true
+}
@@ -0,0 +1,162 @@
+package raytracer_test
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+// assertDirection asserts that a ray heads in the passed-in direction
+func assertDirection(t *testing.T, want rt.Vec3, ray rt.Ray) {
+	got, err := ray.Direction().Unit()
+	assert.Nil(t, err)
+	assert.InDelta(t, want.X, got.X, 1e-9, "x of %v", got)
+	assert.InDelta(t, want.Y, got.Y, 1e-9, "y of %v", got)
+	assert.InDelta(t, want.Z, got.Z, 1e-9, "z of %v", got)
+}
+
+func TestCamera_GetRay(t *testing.T) {
+	origin := rt.NewVec3(1, 2, 3)
+	perspective, err := rt.NewCamera(origin)
+	assert.Nil(t, err)
+	orthographic, err := rt.NewOrthographicCamera(origin, rt.Identity(), 2)
+	assert.Nil(t, err)
+	fisheye, err := rt.NewFisheyeCamera(origin, rt.Identity(), 180)
+	assert.Nil(t, err)
+	panorama, err := rt.NewEquirectangularCamera(origin, rt.Identity())
+	assert.Nil(t, err)
+	turned, err := rt.NewEquirectangularCamera(origin, rt.RotationY(90))
+	assert.Nil(t, err)
+
+	for _, tc := range []struct {
+		desc      string
+		camera    rt.Camera
+		u, v      float64
+		direction rt.Vec3
+	}{
+		{desc: "a perspective camera looks ahead through the middle", camera: perspective, u: 0.5, v: 0.5, direction: rt.NewVec3(0, 0, -1)},
+		{desc: "an orthographic camera looks ahead through the corner", camera: orthographic, u: 0, v: 1, direction: rt.NewVec3(0, 0, -1)},
+		{desc: "a fisheye camera looks ahead through the middle", camera: fisheye, u: 0.5, v: 0.5, direction: rt.NewVec3(0, 0, -1)},
+		{desc: "a 180° fisheye camera looks up through the top", camera: fisheye, u: 0.5, v: 1, direction: rt.NewVec3(0, 1, 0)},
+		{desc: "a fisheye camera's angle grows evenly", camera: fisheye, u: 0.5, v: 2.0 / 3, direction: rt.NewVec3(0, math.Sin(math.Pi/6), -math.Cos(math.Pi/6))},
+		{desc: "a panorama looks ahead through the middle", camera: panorama, u: 0.5, v: 0.5, direction: rt.NewVec3(0, 0, -1)},
+		{desc: "a panorama looks right three quarters across", camera: panorama, u: 0.75, v: 0.5, direction: rt.NewVec3(1, 0, 0)},
+		{desc: "a panorama looks behind at its left edge", camera: panorama, u: 0, v: 0.5, direction: rt.NewVec3(0, 0, 1)},
+		{desc: "a panorama looks behind at its right edge", camera: panorama, u: 1, v: 0.5, direction: rt.NewVec3(0, 0, 1)},
+		{desc: "a panorama looks down at its bottom", camera: panorama, u: 0.3, v: 0, direction: rt.NewVec3(0, -1, 0)},
+		{desc: "a turned panorama looks ahead of its rotation", camera: turned, u: 0.5, v: 0.5, direction: rt.NewVec3(-1, 0, 0)},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assertDirection(t, tc.direction, tc.camera.GetRay(tc.u, tc.v))
+		})
+	}
+
+	// the rays of an orthographic camera start across the viewport instead of at the origin
+	corner := orthographic.GetRay(0, 1).Origin()
+	assert.InDelta(t, 1-16.0/9, corner.X, 1e-9)
+	assert.InDelta(t, 3, corner.Y, 1e-9)
+	assert.InDelta(t, 3, corner.Z, 1e-9)
+}
+
+func TestStereoCamera_GetRay(t *testing.T) {
+	origin := rt.NewVec3(0, 1, 0)
+	for _, tc := range []struct {
+		desc        string
+		layout      rt.StereoLayout
+		left, right [2]float64
+	}{
+		{desc: "side by side", layout: rt.SideBySide, left: [2]float64{0.25, 0.5}, right: [2]float64{0.75, 0.5}},
+		{desc: "top and bottom", layout: rt.TopBottom, left: [2]float64{0.5, 0.75}, right: [2]float64{0.5, 0.25}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			camera, err := rt.NewStereoCamera(origin, rt.Identity(), 0.1, 2, tc.layout)
+			assert.Nil(t, err)
+
+			// the middle of each eye's image looks at the same point on the screen
+			left := camera.GetRay(tc.left[0], tc.left[1])
+			right := camera.GetRay(tc.right[0], tc.right[1])
+			assert.Equal(t, rt.NewVec3(-0.05, 1, 0), left.Origin())
+			assert.Equal(t, rt.NewVec3(0.05, 1, 0), right.Origin())
+			screen := rt.NewVec3(0, 1, -2)
+			assertDirection(t, rt.NewVec3(0.05, 0, -2).MultiplyFloat(1/math.Sqrt(4.0025)), left)
+			assert.InDelta(t, 0, left.At(1).SubtractVector(screen).Length(), 1e-9)
+			assert.InDelta(t, 0, right.At(1).SubtractVector(screen).Length(), 1e-9)
+		})
+	}
+}
+
+func TestODSCamera_GetRay(t *testing.T) {
+	camera, err := rt.NewODSCamera(rt.NewVec3(0, 0, 0), rt.Identity(), 0.1, rt.TopBottom)
+	assert.Nil(t, err)
+	for _, tc := range []struct {
+		desc              string
+		u, v              float64
+		origin, direction rt.Vec3
+	}{
+		{desc: "the left eye looking ahead", u: 0.5, v: 0.75, origin: rt.NewVec3(-0.05, 0, 0), direction: rt.NewVec3(0, 0, -1)},
+		{desc: "the right eye looking ahead", u: 0.5, v: 0.25, origin: rt.NewVec3(0.05, 0, 0), direction: rt.NewVec3(0, 0, -1)},
+		{desc: "the left eye looking right", u: 0.75, v: 0.75, origin: rt.NewVec3(0, 0, -0.05), direction: rt.NewVec3(1, 0, 0)},
+		{desc: "the right eye looking behind", u: 0, v: 0.25, origin: rt.NewVec3(-0.05, 0, 0), direction: rt.NewVec3(0, 0, 1)},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ray := camera.GetRay(tc.u, tc.v)
+			assert.InDelta(t, 0, ray.Origin().SubtractVector(tc.origin).Length(), 1e-9, "origin %v", ray.Origin())
+			assertDirection(t, tc.direction, ray)
+		})
+	}
+}
+
+func TestCamera_ValidateProjections(t *testing.T) {
+	_, err := rt.NewOrthographicCamera(rt.NewVec3(0, 0, 0), rt.Identity(), 0)
+	assert.True(t, errors.Is(err, rt.ErrNotPositive))
+	_, err = rt.NewFisheyeCamera(rt.NewVec3(0, 0, 0), rt.Identity(), 400)
+	assert.True(t, errors.Is(err, rt.ErrOutOfRange))
+	_, err = rt.NewEquirectangularCamera(rt.NewVec3(0, 0, 0), rt.Scaling(rt.NewVec3(0, 1, 1)))
+	assert.True(t, errors.Is(err, rt.ErrDegenerate))
+
+	// eyes that are not apart see the same view, but crossed eyes are an error
+	_, err = rt.NewStereoCamera(rt.NewVec3(0, 0, 0), rt.Identity(), 0, 1, rt.SideBySide)
+	assert.Nil(t, err)
+	_, err = rt.NewODSCamera(rt.NewVec3(0, 0, 0), rt.Identity(), 0, rt.TopBottom)
+	assert.Nil(t, err)
+	_, err = rt.NewODSCamera(rt.NewVec3(0, 0, 0), rt.Identity(), -0.1, rt.TopBottom)
+	assert.True(t, errors.Is(err, rt.ErrOutOfRange))
+}
+
+func TestSceneDescription_Camera(t *testing.T) {
+	for _, tc := range []struct {
+		desc, camera string
+		want         rt.Camera
+		isError      bool
+	}{
+		{desc: "the default", camera: `{"origin": [0, 0, 0]}`, want: &rt.PerspectiveCamera{}},
+		{desc: "a perspective camera", camera: `{"type": "perspective"}`, want: &rt.PerspectiveCamera{}},
+		{desc: "an orthographic camera", camera: `{"type": "orthographic", "height": 4}`, want: &rt.OrthographicCamera{}},
+		{desc: "a fisheye camera", camera: `{"type": "fisheye", "fov": 220}`, want: &rt.FisheyeCamera{}},
+		{desc: "a panorama", camera: `{"type": "equirectangular", "rotation": [0, 90, 0]}`, want: &rt.EquirectangularCamera{}},
+		{desc: "a stereo camera", camera: `{"type": "stereo", "interocular": 0.1, "convergence": 3, "layout": "top-bottom"}`, want: &rt.StereoCamera{}},
+		{desc: "an omni-directional stereo camera", camera: `{"type": "ods"}`, want: &rt.ODSCamera{}},
+		{desc: "a camera type in capitals", camera: `{"type": "Fisheye"}`, want: &rt.FisheyeCamera{}},
+		{desc: "a stereo camera type in capitals", camera: `{"type": "ODS", "layout": "Side-By-Side"}`, want: &rt.ODSCamera{}},
+		{desc: "an unknown stereo layout", camera: `{"type": "ods", "layout": "interleaved"}`, isError: true},
+		{desc: "crossed eyes", camera: `{"type": "stereo", "interocular": -0.1}`, isError: true},
+		{desc: "an unknown camera", camera: `{"type": "pinhole"}`, isError: true},
+		{desc: "a fisheye camera that sees too much", camera: `{"type": "fisheye", "fov": 361}`, isError: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			description, err := rt.ParseSceneDescription(strings.NewReader(`{"camera": ` + tc.camera + `, "objects": []}`))
+			assert.Nil(t, err)
+			_, camera, err := description.Build()
+			if tc.isError {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.IsType(t, tc.want, camera)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package raytracer
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// checkpointVersion is bumped whenever the layout of a checkpoint changes
+const checkpointVersion = 1
+
+// checkpoint is the on-disk form of a framebuffer. The random numbers of every sample are derived from the seed,
+// the pass and the pixel, so the seed and the number of passes are the whole state of the random number generator.
+type checkpoint struct {
+	Version          int
+	Width, Height    int
+	Seed             int64
+	Passes           int
+	SampleCount      []int
+	Color            []float64
+	LuminanceSquared []float64
+	AOVs             []checkpointAOV
+}
+
+// checkpointAOV is the on-disk form of an auxiliary pass
+type checkpointAOV struct {
+	AOV  AOV
+	Sum  []float64
+	Hits []int
+}
+
+// WriteCheckpoint writes everything that is needed to resume rendering into a framebuffer
+func WriteCheckpoint(w io.Writer, fb *Framebuffer) error {
+	c := checkpoint{
+		Version:          checkpointVersion,
+		Width:            fb.Width,
+		Height:           fb.Height,
+		Seed:             fb.Seed,
+		Passes:           fb.Passes,
+		SampleCount:      fb.SampleCount,
+		Color:            fb.color,
+		LuminanceSquared: fb.luminanceSquared,
+	}
+	for _, aov := range fb.AOVs() {
+		buffer := fb.aovs[aov]
+		c.AOVs = append(c.AOVs, checkpointAOV{AOV: aov, Sum: buffer.sum, Hits: buffer.hits})
+	}
+	if err := gob.NewEncoder(w).Encode(&c); err != nil {
+		return fmt.Errorf("could not encode checkpoint: %s", err)
+	}
+	return nil
+}
+
+// ReadCheckpoint reads a framebuffer written by WriteCheckpoint
+func ReadCheckpoint(r io.Reader) (*Framebuffer, error) {
+	var c checkpoint
+	if err := gob.NewDecoder(r).Decode(&c); err != nil {
+		return nil, fmt.Errorf("could not decode checkpoint: %s", err)
+	}
+	if c.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d", c.Version)
+	}
+	if c.Width <= 0 || c.Height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", c.Width, c.Height)
+	}
+
+	pixels := c.Width * c.Height
+	if len(c.SampleCount) != pixels || len(c.Color) != 3*pixels || len(c.LuminanceSquared) != pixels {
+		return nil, errors.New("checkpoint does not match its image size")
+	}
+	aovs := make([]AOV, 0, len(c.AOVs))
+	for _, saved := range c.AOVs {
+		if _, ok := aovNames[saved.AOV]; !ok {
+			return nil, fmt.Errorf("unknown render pass %d", int(saved.AOV))
+		}
+		if len(saved.Sum) != len(saved.AOV.Channels())*pixels || len(saved.Hits) != pixels {
+			return nil, fmt.Errorf("the %s pass does not match the image size", saved.AOV)
+		}
+		aovs = append(aovs, saved.AOV)
+	}
+
+	fb := NewFramebuffer(c.Width, c.Height, aovs)
+	fb.Seed = c.Seed
+	fb.Passes = c.Passes
+	fb.SampleCount = c.SampleCount
+	fb.color = c.Color
+	fb.luminanceSquared = c.LuminanceSquared
+	for _, saved := range c.AOVs {
+		fb.aovs[saved.AOV] = &aovBuffer{sum: saved.Sum, hits: saved.Hits}
+	}
+	return fb, nil
+}
+
+// SaveCheckpoint writes a checkpoint to disk. The checkpoint is written next to path and then renamed over it, so
+// a render that is killed while saving leaves the previous checkpoint intact.
+func SaveCheckpoint(path string, fb *Framebuffer) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("could not create checkpoint: %s", err)
+	}
+	if err := WriteCheckpoint(f, fb); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not write checkpoint: %s", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not replace checkpoint: %s", err)
+	}
+	return nil
+}
+
+// LoadCheckpoint reads a checkpoint saved by SaveCheckpoint
+func LoadCheckpoint(path string) (*Framebuffer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open checkpoint: %s", err)
+	}
+	defer f.Close()
+	return ReadCheckpoint(f)
+}
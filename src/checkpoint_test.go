@@ -0,0 +1,132 @@
+package raytracer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkpointScene returns a small scene with a glossy and a diffuse sphere, so that the render uses random numbers
+// in several places
+func checkpointScene(t *testing.T) (*rt.Scene, rt.Camera) {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5, ID: 1, Material: rt.NewRoughDielectric(1.5, 0.3, 0.3)})
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, -100.5, -1), Radius: 100, ID: 2})
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+	return &rt.Scene{World: world}, camera
+}
+
+func TestRender_ResumeFromCheckpoint(t *testing.T) {
+	scene, camera := checkpointScene(t)
+	opts := rt.RenderOptions{
+		Width:           8,
+		Height:          6,
+		SamplesPerPixel: 6,
+		MaxDepth:        8,
+		AOVs:            []rt.AOV{rt.AOVDepth, rt.AOVObjectID},
+		Seed:            42,
+	}
+	uninterrupted, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+
+	// stop the render halfway through, as if it had been killed after saving a checkpoint
+	var checkpoint bytes.Buffer
+	interrupted := opts
+	interrupted.OnPass = func(fb *rt.Framebuffer) error {
+		if fb.Passes < 3 {
+			return nil
+		}
+		if err := rt.WriteCheckpoint(&checkpoint, fb); err != nil {
+			return err
+		}
+		return errors.New("killed")
+	}
+	_, err = rt.Render(context.Background(), scene, camera, interrupted)
+	assert.Error(t, err)
+
+	resumed, err := rt.ReadCheckpoint(&checkpoint)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, resumed.Passes)
+	assert.Equal(t, int64(42), resumed.Seed)
+
+	resumedOpts := opts
+	resumedOpts.Seed = 0
+	resumedOpts.Resume = resumed
+	fb, err := rt.Render(context.Background(), scene, camera, resumedOpts)
+	assert.Nil(t, err)
+
+	assert.Equal(t, uninterrupted.Image().Pixels, fb.Image().Pixels)
+	assert.Equal(t, uninterrupted.SampleCount, fb.SampleCount)
+	for _, aov := range opts.AOVs {
+		want, _ := uninterrupted.Pass(aov)
+		got, _ := fb.Pass(aov)
+		assert.Equal(t, want, got, "%s pass", aov)
+	}
+	for y := 0; y < fb.Height; y++ {
+		for x := 0; x < fb.Width; x++ {
+			assert.Equal(t, uninterrupted.Variance(x, y), fb.Variance(x, y))
+		}
+	}
+}
+
+func TestRender_SeedChangesResult(t *testing.T) {
+	scene, camera := checkpointScene(t)
+	opts := rt.RenderOptions{Width: 4, Height: 3, SamplesPerPixel: 2, MaxDepth: 8, Seed: 1}
+	one, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+	again, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+	opts.Seed = 2
+	two, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+
+	assert.Equal(t, one.Image().Pixels, again.Image().Pixels)
+	assert.NotEqual(t, one.Image().Pixels, two.Image().Pixels)
+}
+
+func TestRender_ResumeMismatch(t *testing.T) {
+	scene, camera := checkpointScene(t)
+	fb := rt.NewFramebuffer(4, 3, []rt.AOV{rt.AOVDepth})
+	fb.Passes = 2
+
+	for _, tc := range []struct {
+		desc string
+		opts rt.RenderOptions
+	}{
+		{desc: "different size", opts: rt.RenderOptions{Width: 5, Height: 3, SamplesPerPixel: 4, AOVs: []rt.AOV{rt.AOVDepth}}},
+		{desc: "different passes", opts: rt.RenderOptions{Width: 4, Height: 3, SamplesPerPixel: 4}},
+		{desc: "fewer samples", opts: rt.RenderOptions{Width: 4, Height: 3, SamplesPerPixel: 1, AOVs: []rt.AOV{rt.AOVDepth}}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.opts.Resume = fb
+			_, err := rt.Render(context.Background(), scene, camera, tc.opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSaveCheckpoint(t *testing.T) {
+	fb := rt.NewFramebuffer(2, 1, []rt.AOV{rt.AOVNormal})
+	fb.Seed = 7
+	fb.Passes = 1
+	fb.AddSample(1, 0, rt.NewVec3(1, 2, 3))
+	fb.AddFirstHit(1, 0, &rt.FirstHit{Hit: true, Normal: rt.NewVec3(0, 1, 0)})
+
+	path := filepath.Join(t.TempDir(), "render.checkpoint")
+	assert.Nil(t, rt.SaveCheckpoint(path, fb))
+	// saving again replaces the old checkpoint
+	assert.Nil(t, rt.SaveCheckpoint(path, fb))
+
+	loaded, err := rt.LoadCheckpoint(path)
+	assert.Nil(t, err)
+	assert.Equal(t, fb, loaded)
+
+	_, err = rt.ReadCheckpoint(bytes.NewReader([]byte("not a checkpoint")))
+	assert.Error(t, err)
+}
@@ -2,12 +2,15 @@ package raytracer
 
 import (
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
 	"math"
 )
 
 // WriteColor writes color vector values out to an output stream
-func WriteColor(w io.Writer, color *Vec3, samplesPerPixel int) error {
+func WriteColor(w io.Writer, color Vec3, samplesPerPixel int) error {
 	r := color.X
 	g := color.Y
 	b := color.Z
@@ -26,3 +29,40 @@ func WriteColor(w io.Writer, color *Vec3, samplesPerPixel int) error {
 	}
 	return nil
 }
+
+// Luminance returns the perceived brightness of a linear RGB color
+func Luminance(color Vec3) float64 {
+	return 0.2126*color.X + 0.7152*color.Y + 0.0722*color.Z
+}
+
+// WritePPM writes an image of average radiance values as a plain text PPM
+func WritePPM(w io.Writer, img *HDRImage) error {
+	if _, err := fmt.Fprintf(w, "P3\n%d %d\n255\n", img.Width, img.Height); err != nil {
+		return err
+	}
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			if err := WriteColor(w, img.At(x, y), 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EncodePNG writes an image of average radiance values as an 8-bit PNG, gamma-corrected the same way as WritePPM
+func EncodePNG(w io.Writer, img *HDRImage) error {
+	out := image.NewNRGBA(image.Rect(0, 0, img.Width, img.Height))
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			c := img.At(x, y)
+			out.SetNRGBA(x, y, color.NRGBA{R: displayByte(c.X), G: displayByte(c.Y), B: displayByte(c.Z), A: 255})
+		}
+	}
+	return png.Encode(w, out)
+}
+
+// displayByte gamma-corrects a linear color component for gamma = 2.0 and translates it to [0,255]
+func displayByte(value float64) uint8 {
+	return uint8(256 * clamp(math.Sqrt(math.Max(0, value)), 0.0, 0.999))
+}
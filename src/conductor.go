@@ -0,0 +1,122 @@
+package raytracer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// ComplexIOR is the complex index of refraction of a conductor for the red, green and blue channels.
+// Eta is the real part and K, the extinction coefficient, is the imaginary part.
+type ComplexIOR struct {
+	Eta, K Vec3
+}
+
+// ConductorPresets holds measured indices of refraction of common metals, averaged over each color channel
+var ConductorPresets = map[string]ComplexIOR{
+	"gold":      {Eta: NewVec3(0.143, 0.374, 1.442), K: NewVec3(3.983, 2.385, 1.603)},
+	"copper":    {Eta: NewVec3(0.200, 0.924, 1.102), K: NewVec3(3.912, 2.452, 2.142)},
+	"aluminium": {Eta: NewVec3(1.657, 0.880, 0.521), K: NewVec3(9.224, 6.270, 4.837)},
+	"silver":    {Eta: NewVec3(0.155, 0.117, 0.138), K: NewVec3(4.828, 3.122, 2.147)},
+}
+
+// RoughConductor is a metal whose surface is made up of tiny mirrors oriented according to a GGX distribution
+type RoughConductor struct {
+	IOR          ComplexIOR
+	Distribution GGX
+}
+
+// NewRoughConductor returns a conductor with the passed-in complex index of refraction. roughnessU and
+// roughnessV are the perceptual roughness along the tangent and bitangent; a roughness of 0 is a perfect mirror.
+func NewRoughConductor(eta, k Vec3, roughnessU, roughnessV float64) *RoughConductor {
+	return &RoughConductor{
+		IOR: ComplexIOR{Eta: eta, K: k},
+		Distribution: GGX{
+			AlphaX: RoughnessToAlpha(roughnessU),
+			AlphaY: RoughnessToAlpha(roughnessV),
+		},
+	}
+}
+
+// NewConductorPreset returns a conductor made of one of the metals in ConductorPresets
+func NewConductorPreset(name string, roughnessU, roughnessV float64) (*RoughConductor, error) {
+	ior, ok := ConductorPresets[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(ConductorPresets))
+		for n := range ConductorPresets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown conductor %q: expected one of %s", name, strings.Join(names, ", "))
+	}
+	return NewRoughConductor(ior.Eta, ior.K, roughnessU, roughnessV), nil
+}
+
+// Scatter reflects the ray off of a microfacet normal sampled from the visible part of the distribution
+func (c *RoughConductor) Scatter(rayIn Ray, hitRecord *HitRecord, rng *rand.Rand) (ScatterRecord, bool) {
+	frame := shadingFrame(hitRecord)
+	wo, ok := localOutgoing(frame, rayIn)
+	if !ok {
+		return ScatterRecord{}, false
+	}
+
+	if c.Distribution.IsSmooth() {
+		wi := NewVec3(-wo.X, -wo.Y, wo.Z)
+		return ScatterRecord{
+			Ray:         NewRay(hitRecord.P, frame.ToWorld(wi)),
+			Attenuation: FresnelConductor(wo.Z, c.IOR.Eta, c.IOR.K),
+			IsSpecular:  true,
+		}, true
+	}
+
+	u0, u1 := randomPair(rng)
+	wm := c.Distribution.SampleVisibleNormal(wo, u0, u1)
+	wi := wo.Negate().Reflect(wm)
+	if wi.Z <= 0 {
+		// the reflection points into the surface
+		return ScatterRecord{}, false
+	}
+
+	cosOM := math.Abs(wo.Dot(wm))
+	pdf := c.Distribution.VisibleD(wo, wm) / (4 * cosOM)
+	if pdf == 0 {
+		return ScatterRecord{}, false
+	}
+	// the D terms of the BRDF and the pdf cancel out, leaving only the masking of wi
+	attenuation := FresnelConductor(cosOM, c.IOR.Eta, c.IOR.K).
+		MultiplyFloat(c.Distribution.G(wo, wi) / c.Distribution.G1(wo))
+	return ScatterRecord{
+		Ray:         NewRay(hitRecord.P, frame.ToWorld(wi)),
+		Attenuation: attenuation,
+		Pdf:         pdf,
+	}, true
+}
+
+// Evaluate returns the Torrance-Sparrow BRDF multiplied by the cosine term
+func (c *RoughConductor) Evaluate(wo, wi Vec3, hitRecord *HitRecord) (Vec3, float64) {
+	if c.Distribution.IsSmooth() {
+		return NewVec3(0, 0, 0), 0
+	}
+	frame := shadingFrame(hitRecord)
+	woLocal, wiLocal := frame.ToLocal(wo), frame.ToLocal(wi)
+	if woLocal.Z <= 0 || wiLocal.Z <= 0 {
+		return NewVec3(0, 0, 0), 0
+	}
+	wm, err := woLocal.AddVector(wiLocal).Unit()
+	if err != nil {
+		return NewVec3(0, 0, 0), 0
+	}
+
+	cosOM := math.Abs(woLocal.Dot(wm))
+	fresnel := FresnelConductor(cosOM, c.IOR.Eta, c.IOR.K)
+	brdf := c.Distribution.D(wm) * c.Distribution.G(woLocal, wiLocal) / (4 * woLocal.Z * wiLocal.Z)
+	pdf := c.Distribution.VisibleD(woLocal, wm) / (4 * cosOM)
+	return fresnel.MultiplyFloat(brdf * wiLocal.Z), pdf
+}
+
+// AlbedoAt returns the reflectance of the conductor at normal incidence
+func (c *RoughConductor) AlbedoAt(hitRecord *HitRecord) Vec3 {
+	return FresnelConductor(1, c.IOR.Eta, c.IOR.K)
+}
@@ -0,0 +1,107 @@
+package raytracer
+
+import "math"
+
+// Cone is a cone that stands on its base in the XZ plane, with its tip straight above the center of the base
+type Cone struct {
+	// Center is the middle of the base of the cone
+	Center         Vec3
+	Radius, Height float64
+	// PhiMax is the angle in degrees that the cone sweeps around its axis, starting from +X. 0 is a full turn.
+	PhiMax float64
+	// Capped closes the base of the cone with a disk
+	Capped bool
+	// Material is the material that the cone is made of. A nil material is a grey diffuse surface.
+	Material Material
+	// ID identifies the cone in the object ID pass. 0 is reserved for the background.
+	ID int
+}
+
+// NewCone returns a new cone with an open base
+func NewCone(center Vec3, radius, height float64) *Cone {
+	return &Cone{Center: center, Radius: radius, Height: height}
+}
+
+// Hit returns whether the passed-in ray hits the cone
+func (c *Cone) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	var crossings crossingList
+	c.crossings(ray, &crossings)
+	return crossings.first(ray, tMin, tMax, hitRecord)
+}
+
+// Closed returns whether the cone has an inside, which it has when it is capped and sweeps a full turn
+func (c *Cone) Closed() bool {
+	return c.Capped && sweep(c.PhiMax) == 2*math.Pi
+}
+
+// Intervals returns the span of the ray that is inside the cone. It is empty if the cone is not closed.
+func (c *Cone) Intervals(ray Ray, intervals []Interval) []Interval {
+	if !c.Closed() {
+		return intervals
+	}
+	var crossings crossingList
+	c.crossings(ray, &crossings)
+	return crossings.intervals(intervals)
+}
+
+// Validate returns an error if the cone has no radius or height
+func (c *Cone) Validate() error {
+	if err := checkPoint("cone", "center", c.Center); err != nil {
+		return err
+	}
+	if err := checkPositive("cone", "radius", c.Radius); err != nil {
+		return err
+	}
+	if err := checkPositive("cone", "height", c.Height); err != nil {
+		return err
+	}
+	return checkSweep("cone", c.PhiMax)
+}
+
+// BoundingBox returns the box around the cone
+func (c *Cone) BoundingBox() *AABB {
+	return NewAABB(c.Center.AddVector(NewVec3(-c.Radius, 0, -c.Radius)), c.Center.AddVector(NewVec3(c.Radius, c.Height, c.Radius)))
+}
+
+// crossings adds where the ray crosses the side and the base of the cone to the list. On the side, u turns around
+// the axis and v rises from the base to the tip.
+func (c *Cone) crossings(ray Ray, crossings *crossingList) {
+	o, d, ok := localRay(ray, c.Center)
+	if !ok {
+		return
+	}
+	phiMax := sweep(c.PhiMax)
+
+	// x^2 + z^2 = (k (h - y))^2 along the ray, where k is how much the radius shrinks as y rises
+	k := c.Radius / c.Height
+	k2 := k * k
+	a := d.X*d.X + d.Z*d.Z - k2*d.Y*d.Y
+	b := 2 * (o.X*d.X + o.Z*d.Z + k2*(c.Height-o.Y)*d.Y)
+	cc := o.X*o.X + o.Z*o.Z - k2*(c.Height-o.Y)*(c.Height-o.Y)
+	roots, n := solveQuadratic(a, b, cc)
+	for _, t := range roots[:n] {
+		x, y, z := o.X+t*d.X, o.Y+t*d.Y, o.Z+t*d.Z
+		phi := azimuth(x, z)
+		// the equation also describes the upside down cone above the tip, which is skipped
+		if y < 0 || y > c.Height || phi > phiMax {
+			continue
+		}
+		normal, err := NewVec3(x, k2*(c.Height-y), z).Unit()
+		if err != nil {
+			// the tip has no normal
+			continue
+		}
+		var dpdu, dpdv Vec3
+		if rho := math.Sqrt(x*x + z*z); rho > 1e-8 {
+			dpdu = aroundAxis(x, z, phiMax)
+			dpdv = NewVec3(-x*c.Radius/rho, c.Height, -z*c.Radius/rho)
+		}
+		setSurface(crossings.add(), ray, t, normal, dpdu, dpdv, phi/phiMax, y/c.Height, c.Material, c.ID)
+	}
+
+	if c.Capped {
+		base := &Disk{Center: c.Center, Radius: c.Radius, PhiMax: c.PhiMax, Material: c.Material, ID: c.ID}
+		base.crossing(ray, true, crossings)
+	}
+	crossings.sort()
+}
@@ -0,0 +1,239 @@
+package raytracer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Interval is a span of a ray that is inside of a solid. The normals of its hit records point out of the solid,
+// and have not been turned to face the ray.
+type Interval struct {
+	Enter, Exit HitRecord
+}
+
+// Solid is implemented by closed objects, which have an inside that can be combined with other solids by a CSG
+type Solid interface {
+	Hittable
+	// Intervals appends every span of the ray that is inside the object to intervals, in order along the ray, and
+	// returns the extended slice. The spans cover the whole line that the ray lies on, including the part behind its
+	// origin. Solids may use the room after the end of intervals as scratch space, so that tracing a CSG does not
+	// allocate once its buffer has grown large enough.
+	Intervals(ray Ray, intervals []Interval) []Interval
+}
+
+// intervalBuffers holds the buffers that CSGs find their intervals in, which are reused across rays
+var intervalBuffers = sync.Pool{New: func() interface{} { return new([]Interval) }}
+
+// CSGOperation is how a CSG combines its two solids
+type CSGOperation int
+
+const (
+	// CSGUnion is the space inside of either solid
+	CSGUnion CSGOperation = iota
+	// CSGIntersection is the space inside of both solids
+	CSGIntersection
+	// CSGDifference is the space inside of the left solid that is not inside of the right one
+	CSGDifference
+)
+
+var csgOperationNames = map[CSGOperation]string{
+	CSGUnion:        "union",
+	CSGIntersection: "intersection",
+	CSGDifference:   "difference",
+}
+
+// String returns the name of the operation
+func (op CSGOperation) String() string {
+	if name, ok := csgOperationNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("CSGOperation(%d)", int(op))
+}
+
+// ParseCSGOperation returns the operation with the passed-in name, ignoring case
+func ParseCSGOperation(name string) (CSGOperation, error) {
+	for op, n := range csgOperationNames {
+		if strings.EqualFold(n, name) {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown CSG operation %q: expected union, intersection or difference", name)
+}
+
+// contains returns whether a point that is or is not inside of each solid is inside of their combination
+func (op CSGOperation) contains(inLeft, inRight bool) bool {
+	switch op {
+	case CSGUnion:
+		return inLeft || inRight
+	case CSGIntersection:
+		return inLeft && inRight
+	default:
+		return inLeft && !inRight
+	}
+}
+
+// CSG is constructive solid geometry: a solid made by combining two other solids. Every surface keeps the material
+// of the solid that it came from.
+type CSG struct {
+	Operation   CSGOperation
+	Left, Right Solid
+}
+
+// NewCSG returns the combination of two objects, which must both be solids
+func NewCSG(op CSGOperation, left, right Hittable) (*CSG, error) {
+	if _, ok := csgOperationNames[op]; !ok {
+		return nil, fmt.Errorf("unknown CSG operation %s", op)
+	}
+	leftSolid, err := asSolid(left)
+	if err != nil {
+		return nil, fmt.Errorf("invalid left object: %s", err)
+	}
+	rightSolid, err := asSolid(right)
+	if err != nil {
+		return nil, fmt.Errorf("invalid right object: %s", err)
+	}
+	return &CSG{Operation: op, Left: leftSolid, Right: rightSolid}, nil
+}
+
+// asSolid returns the object as a solid, or an error if it does not have an inside
+func asSolid(object Hittable) (Solid, error) {
+	if t, ok := object.(*TransformedObject); ok {
+		// transformed objects are only solid when the object that they transform is
+		if _, err := asSolid(t.Object); err != nil {
+			return nil, err
+		}
+	}
+	solid, ok := object.(Solid)
+	if !ok {
+		return nil, fmt.Errorf("an object of type %T does not have an inside", object)
+	}
+	// some shapes are only closed with the right settings
+	if closer, ok := object.(interface{ Closed() bool }); ok && !closer.Closed() {
+		return nil, fmt.Errorf("an open %T does not have an inside", object)
+	}
+	return solid, nil
+}
+
+// Hit returns the first surface of the combined solid that the ray hits between tMin and tMax. The ray is not
+// tested against the bounding box first, since a CSG with a box is put in a BVH that has already tested it.
+func (c *CSG) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	buffer := intervalBuffers.Get().(*[]Interval)
+	intervals := c.Intervals(ray, (*buffer)[:0])
+	hit := false
+	for k := 0; k < 2*len(intervals) && !hit; k++ {
+		boundary := intervalBoundary(intervals, k)
+		if boundary.T < tMin || tMax < boundary.T {
+			continue
+		}
+		*hitRecord = *boundary
+		hitRecord.SetFaceNormal(ray, boundary.Normal)
+		hit = true
+	}
+	*buffer = intervals
+	intervalBuffers.Put(buffer)
+	return hit
+}
+
+// Validate returns an error if either of the solids cannot be traced
+func (c *CSG) Validate() error {
+	if err := validate(c.Left); err != nil {
+		return fmt.Errorf("invalid left object: %w", err)
+	}
+	if err := validate(c.Right); err != nil {
+		return fmt.Errorf("invalid right object: %w", err)
+	}
+	return nil
+}
+
+// Intervals appends the spans of the ray that are inside the combined solid to intervals
+func (c *CSG) Intervals(ray Ray, intervals []Interval) []Interval {
+	// the spans of both solids are appended after the ones that were passed in, followed by the combined spans,
+	// which are then moved down over the spans of the solids
+	start := len(intervals)
+	intervals = c.Left.Intervals(ray, intervals)
+	middle := len(intervals)
+	intervals = c.Right.Intervals(ray, intervals)
+	end := len(intervals)
+
+	// walk along the ray through the boundaries of both solids, keeping track of which ones it is inside. Every
+	// span has two boundaries, so boundary k is the enter or exit of span k/2.
+	var enter HitRecord
+	inLeft, inRight, inside := false, false, false
+	i, j := 2*start, 2*middle
+	for i < 2*middle || j < 2*end {
+		isLeft := j == 2*end || (i < 2*middle && intervalBoundary(intervals, i).T <= intervalBoundary(intervals, j).T)
+		k := j
+		if isLeft {
+			k = i
+			i++
+		} else {
+			j++
+		}
+		isEnter := k%2 == 0
+		if isLeft {
+			inLeft = isEnter
+		} else {
+			inRight = isEnter
+		}
+		if c.Operation.contains(inLeft, inRight) == inside {
+			continue
+		}
+		inside = !inside
+
+		record := *intervalBoundary(intervals, k)
+		if c.Operation == CSGDifference && !isLeft {
+			// the inside of the right solid is outside of the difference, so its surfaces face the other way
+			record.Normal = record.Normal.MultiplyFloat(-1)
+			if !record.GeometricNormal.IsZero() {
+				record.GeometricNormal = record.GeometricNormal.MultiplyFloat(-1)
+			}
+		}
+		if inside {
+			enter = record
+		} else {
+			intervals = append(intervals, Interval{Enter: enter, Exit: record})
+		}
+	}
+	combined := copy(intervals[start:], intervals[end:])
+	return intervals[:start+combined]
+}
+
+// intervalBoundary returns boundary k of a list of intervals, which is the enter of interval k/2 if k is even and
+// its exit if k is odd
+func intervalBoundary(intervals []Interval, k int) *HitRecord {
+	if k%2 == 0 {
+		return &intervals[k/2].Enter
+	}
+	return &intervals[k/2].Exit
+}
+
+// BoundingBox returns a box around the combined solid. It is nil if the solids that it needs do not have one.
+func (c *CSG) BoundingBox() *AABB {
+	left := boundingBoxOf(c.Left)
+	if c.Operation == CSGDifference {
+		// nothing outside of the left solid is left after the difference
+		return left
+	}
+	right := boundingBoxOf(c.Right)
+	if left == nil || right == nil {
+		return nil
+	}
+	if c.Operation == CSGUnion {
+		return left.Union(right)
+	}
+	// the intersection fits inside of both boxes
+	return &AABB{
+		Min: NewVec3(math.Max(left.Min.X, right.Min.X), math.Max(left.Min.Y, right.Min.Y), math.Max(left.Min.Z, right.Min.Z)),
+		Max: NewVec3(math.Min(left.Max.X, right.Max.X), math.Min(left.Max.Y, right.Max.Y), math.Min(left.Max.Z, right.Max.Z)),
+	}
+}
+
+// boundingBoxOf returns the bounding box of an object, or nil if it does not have one
+func boundingBoxOf(object Hittable) *AABB {
+	if bounded, ok := object.(Bounded); ok {
+		return bounded.BoundingBox()
+	}
+	return nil
+}
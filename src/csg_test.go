@@ -0,0 +1,126 @@
+package raytracer_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSG_Hit(t *testing.T) {
+	// along the -Z axis, a is inside from t=4 to t=6 and b from t=3 to t=5
+	a := &rt.Sphere{Center: rt.NewVec3(0, 0, -5), Radius: 1, ID: 1}
+	b := &rt.Sphere{Center: rt.NewVec3(0, 0, -4), Radius: 1, ID: 2}
+	big := &rt.Sphere{Center: rt.NewVec3(0, 0, -5), Radius: 3, ID: 3}
+	fromOrigin := rt.NewRay(rt.NewVec3(0, 0, 0), rt.NewVec3(0, 0, -1))
+	fromInside := rt.NewRay(rt.NewVec3(0, 0, -4.5), rt.NewVec3(0, 0, -1))
+
+	for _, tc := range []struct {
+		desc            string
+		op              rt.CSGOperation
+		left, right     rt.Hittable
+		ray             rt.Ray
+		wantHit         bool
+		wantT           float64
+		wantID          int
+		wantFrontFacing bool
+	}{
+		{desc: "union", op: rt.CSGUnion, left: a, right: b, ray: fromOrigin, wantHit: true, wantT: 3, wantID: 2, wantFrontFacing: true},
+		{desc: "intersection", op: rt.CSGIntersection, left: a, right: b, ray: fromOrigin, wantHit: true, wantT: 4, wantID: 1, wantFrontFacing: true},
+		{desc: "difference hits the inside of the cut", op: rt.CSGDifference, left: a, right: b, ray: fromOrigin, wantHit: true, wantT: 5, wantID: 2, wantFrontFacing: true},
+		{desc: "difference the other way", op: rt.CSGDifference, left: b, right: a, ray: fromOrigin, wantHit: true, wantT: 3, wantID: 2, wantFrontFacing: true},
+		{desc: "union from inside", op: rt.CSGUnion, left: a, right: b, ray: fromInside, wantHit: true, wantT: 1.5, wantID: 1, wantFrontFacing: false},
+		{desc: "intersection from inside", op: rt.CSGIntersection, left: a, right: b, ray: fromInside, wantHit: true, wantT: 0.5, wantID: 2, wantFrontFacing: false},
+		{desc: "difference from inside the cut", op: rt.CSGDifference, left: a, right: b, ray: fromInside, wantHit: true, wantT: 0.5, wantID: 2, wantFrontFacing: true},
+		{desc: "everything cut away", op: rt.CSGDifference, left: a, right: big, ray: fromOrigin},
+		{desc: "no overlap", op: rt.CSGIntersection, left: b, right: &rt.Sphere{Center: rt.NewVec3(0, 0, -9), Radius: 1}, ray: fromOrigin},
+		{desc: "nested", op: rt.CSGDifference, left: big, right: mustCSG(t, rt.CSGUnion, a, b), ray: fromOrigin, wantHit: true, wantT: 2, wantID: 3, wantFrontFacing: true},
+		{desc: "transformed solid", op: rt.CSGIntersection, left: a, right: mustTransform(t, b, rt.Translation(rt.NewVec3(0, 0, 0.5))), ray: fromOrigin, wantHit: true, wantT: 4, wantID: 1, wantFrontFacing: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			csg := mustCSG(t, tc.op, tc.left, tc.right)
+			hitRecord := &rt.HitRecord{}
+			didHit := csg.Hit(tc.ray, 0.001, math.Inf(1), hitRecord)
+			assert.Equal(t, tc.wantHit, didHit)
+			if !tc.wantHit || !didHit {
+				return
+			}
+			assert.InDelta(t, tc.wantT, hitRecord.T, 1e-9)
+			assert.Equal(t, tc.wantID, hitRecord.ObjectID)
+			assert.Equal(t, tc.wantFrontFacing, hitRecord.FrontFace)
+			assert.True(t, hitRecord.Normal.Dot(tc.ray.Direction()) < 0, "the normal should face the ray")
+			assert.Equal(t, hitRecord.Normal, hitRecord.GeometricNormal)
+		})
+	}
+}
+
+func mustCSG(t *testing.T, op rt.CSGOperation, left, right rt.Hittable) *rt.CSG {
+	csg, err := rt.NewCSG(op, left, right)
+	assert.Nil(t, err)
+	return csg
+}
+
+func mustTransform(t *testing.T, object rt.Hittable, m rt.Matrix4) *rt.TransformedObject {
+	transformed, err := rt.NewTransformedObject(object, m)
+	assert.Nil(t, err)
+	return transformed
+}
+
+func TestNewCSG(t *testing.T) {
+	sphere := rt.NewSphere(rt.NewVec3(0, 0, 0), 1)
+	_, err := rt.NewCSG(rt.CSGUnion, sphere, &rt.HittableList{})
+	assert.Error(t, err, "lists do not have an inside")
+	_, err = rt.NewCSG(rt.CSGUnion, mustTransform(t, &rt.HittableList{}, rt.Identity()), sphere)
+	assert.Error(t, err, "transformed lists do not have an inside either")
+	_, err = rt.NewCSG(rt.CSGOperation(7), sphere, sphere)
+	assert.Error(t, err)
+
+	op, err := rt.ParseCSGOperation("Difference")
+	assert.Nil(t, err)
+	assert.Equal(t, rt.CSGDifference, op)
+	_, err = rt.ParseCSGOperation("xor")
+	assert.Error(t, err)
+}
+
+func TestCSG_BoundingBox(t *testing.T) {
+	a := rt.NewSphere(rt.NewVec3(0, 0, 0), 1)
+	b := rt.NewSphere(rt.NewVec3(1, 0, 0), 1)
+	for _, tc := range []struct {
+		op       rt.CSGOperation
+		min, max rt.Vec3
+	}{
+		{op: rt.CSGUnion, min: rt.NewVec3(-1, -1, -1), max: rt.NewVec3(2, 1, 1)},
+		{op: rt.CSGIntersection, min: rt.NewVec3(0, -1, -1), max: rt.NewVec3(1, 1, 1)},
+		{op: rt.CSGDifference, min: rt.NewVec3(-1, -1, -1), max: rt.NewVec3(1, 1, 1)},
+	} {
+		t.Run(tc.op.String(), func(t *testing.T) {
+			box := mustCSG(t, tc.op, a, b).BoundingBox()
+			assert.Equal(t, tc.min, box.Min)
+			assert.Equal(t, tc.max, box.Max)
+		})
+	}
+}
+
+func TestSceneDescription_CSG(t *testing.T) {
+	description, err := rt.ParseSceneDescription(strings.NewReader(`{
+		"materials": {"cut": {"type": "lambertian", "albedo": [1, 0, 0]}},
+		"objects": [{"type": "csg", "operation": "difference",
+			"left": {"type": "sphere", "center": [0, 0, -5], "radius": 1},
+			"right": {"type": "sphere", "center": [0, 0, -4], "radius": 1, "material": "cut", "scale": [1.5, 1.5, 1.5]}}]
+	}`))
+	assert.Nil(t, err)
+	scene, _, err := description.Build()
+	assert.Nil(t, err)
+	hitRecord := &rt.HitRecord{}
+	didHit := scene.World.Hit(rt.NewRay(rt.NewVec3(0, 0, 0), rt.NewVec3(0, 0, -1)), 0.001, math.Inf(1), hitRecord)
+	assert.True(t, didHit)
+	assert.InDelta(t, 5.5, hitRecord.T, 1e-9, "the cut sphere is scaled about its center")
+	assert.Equal(t, 1, hitRecord.ObjectID)
+
+	description, err = rt.ParseSceneDescription(strings.NewReader(`{"objects": [{"type": "csg", "operation": "union", "left": {"type": "sphere", "radius": 1}}]}`))
+	assert.Nil(t, err)
+	_, _, err = description.Build()
+	assert.Error(t, err)
+}
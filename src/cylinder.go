@@ -0,0 +1,106 @@
+package raytracer
+
+import "math"
+
+// Cylinder is a cylinder that stands on the XZ plane and rises along +Y
+type Cylinder struct {
+	// Center is the middle of the bottom of the cylinder
+	Center         Vec3
+	Radius, Height float64
+	// PhiMax is the angle in degrees that the cylinder sweeps around its axis, starting from +X. 0 is a full turn.
+	PhiMax float64
+	// Capped closes the ends of the cylinder with disks
+	Capped bool
+	// Material is the material that the cylinder is made of. A nil material is a grey diffuse surface.
+	Material Material
+	// ID identifies the cylinder in the object ID pass. 0 is reserved for the background.
+	ID int
+}
+
+// NewCylinder returns a new open cylinder
+func NewCylinder(center Vec3, radius, height float64) *Cylinder {
+	return &Cylinder{Center: center, Radius: radius, Height: height}
+}
+
+// Hit returns whether the passed-in ray hits the cylinder
+func (c *Cylinder) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	var crossings crossingList
+	c.crossings(ray, &crossings)
+	return crossings.first(ray, tMin, tMax, hitRecord)
+}
+
+// Closed returns whether the cylinder has an inside, which it has when it is capped and sweeps a full turn
+func (c *Cylinder) Closed() bool {
+	return c.Capped && sweep(c.PhiMax) == 2*math.Pi
+}
+
+// Intervals returns the span of the ray that is inside the cylinder. It is empty if the cylinder is not closed.
+func (c *Cylinder) Intervals(ray Ray, intervals []Interval) []Interval {
+	if !c.Closed() {
+		return intervals
+	}
+	var crossings crossingList
+	c.crossings(ray, &crossings)
+	return crossings.intervals(intervals)
+}
+
+// Validate returns an error if the cylinder has no radius or height
+func (c *Cylinder) Validate() error {
+	if err := checkPoint("cylinder", "center", c.Center); err != nil {
+		return err
+	}
+	if err := checkPositive("cylinder", "radius", c.Radius); err != nil {
+		return err
+	}
+	if err := checkPositive("cylinder", "height", c.Height); err != nil {
+		return err
+	}
+	return checkSweep("cylinder", c.PhiMax)
+}
+
+// BoundingBox returns the box around the cylinder
+func (c *Cylinder) BoundingBox() *AABB {
+	return NewAABB(c.Center.AddVector(NewVec3(-c.Radius, 0, -c.Radius)), c.Center.AddVector(NewVec3(c.Radius, c.Height, c.Radius)))
+}
+
+// crossings adds where the ray crosses the side and the caps of the cylinder to the list. On the side, u turns
+// around the axis and v rises from the bottom to the top.
+func (c *Cylinder) crossings(ray Ray, crossings *crossingList) {
+	o, d, ok := localRay(ray, c.Center)
+	if !ok {
+		return
+	}
+	phiMax := sweep(c.PhiMax)
+
+	// x^2 + z^2 = r^2 along the ray
+	a := d.X*d.X + d.Z*d.Z
+	b := 2 * (o.X*d.X + o.Z*d.Z)
+	cc := o.X*o.X + o.Z*o.Z - c.Radius*c.Radius
+	roots, n := solveQuadratic(a, b, cc)
+	for _, t := range roots[:n] {
+		x, y, z := o.X+t*d.X, o.Y+t*d.Y, o.Z+t*d.Z
+		phi := azimuth(x, z)
+		if y < 0 || y > c.Height || phi > phiMax {
+			continue
+		}
+		normal := NewVec3(x/c.Radius, 0, z/c.Radius)
+		dpdv := NewVec3(0, c.Height, 0)
+		setSurface(crossings.add(), ray, t, normal, aroundAxis(x, z, phiMax), dpdv, phi/phiMax, y/c.Height, c.Material, c.ID)
+	}
+
+	if c.Capped {
+		bottom, top := c.cap(false), c.cap(true)
+		bottom.crossing(ray, true, crossings)
+		top.crossing(ray, false, crossings)
+	}
+	crossings.sort()
+}
+
+// cap returns the disk that closes the top or the bottom of the cylinder
+func (c *Cylinder) cap(top bool) Disk {
+	center := c.Center
+	if top {
+		center = center.AddVector(NewVec3(0, c.Height, 0))
+	}
+	return Disk{Center: center, Radius: c.Radius, PhiMax: c.PhiMax, Material: c.Material, ID: c.ID}
+}
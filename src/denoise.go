@@ -0,0 +1,311 @@
+package raytracer
+
+import (
+	"errors"
+	"math"
+)
+
+// denoiseEpsilon keeps the edge-stopping weights finite when a guide has no variation at all
+const denoiseEpsilon = 1e-10
+
+// atrousKernel is the 1D B3 spline used by every level of the à-trous wavelet transform
+var atrousKernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// DenoiseOptions configures the edge-avoiding à-trous filter
+type DenoiseOptions struct {
+	// Iterations is the number of wavelet levels. Level i samples neighbours 2^i pixels apart, so five levels cover
+	// a 125 pixel wide footprint.
+	Iterations int
+	// SigmaLuminance scales how many standard deviations of noise two pixels may differ by before they stop being
+	// averaged together. Larger values blur more.
+	SigmaLuminance float64
+	// SigmaNormal is the exponent applied to the cosine between normals. Larger values preserve creases better.
+	SigmaNormal float64
+	// SigmaDepth scales the depth difference allowed along the local depth gradient. Larger values blur more.
+	SigmaDepth float64
+	// SigmaAlbedo is the largest difference in albedo before two pixels stop being averaged together
+	SigmaAlbedo float64
+}
+
+// DefaultDenoiseOptions returns filter settings that work well for most renders
+func DefaultDenoiseOptions() DenoiseOptions {
+	return DenoiseOptions{
+		Iterations:     5,
+		SigmaLuminance: 4,
+		SigmaNormal:    128,
+		SigmaDepth:     1,
+		SigmaAlbedo:    0.1,
+	}
+}
+
+// denoiseGuides are the per-pixel features that decide where the filter may blur. A nil guide is not used.
+type denoiseGuides struct {
+	albedo, normal, depth []float64
+	// depthGradient is the largest change in depth to a neighbouring pixel
+	depthGradient []float64
+}
+
+// Denoise filters the noise out of the beauty pass of a framebuffer with an edge-avoiding à-trous wavelet filter
+// that is guided by the albedo, normal and depth passes and by the variance of each pixel. Guides that the
+// framebuffer did not record are skipped, but the result is best when all three are available.
+//
+// When the albedo pass is available, the filter works on the illumination, which is the color divided by the
+// albedo, so that texture detail is not blurred away, and multiplies the albedo back in at the end.
+func Denoise(fb *Framebuffer, opts DenoiseOptions) (*HDRImage, error) {
+	if opts.Iterations < 0 {
+		return nil, errors.New("the number of denoising iterations cannot be negative")
+	}
+	if opts.SigmaLuminance <= 0 || opts.SigmaDepth <= 0 || opts.SigmaAlbedo <= 0 || opts.SigmaNormal < 0 {
+		return nil, errors.New("denoising sigmas must be positive")
+	}
+
+	var guides denoiseGuides
+	var err error
+	if fb.HasAOV(AOVAlbedo) {
+		if guides.albedo, err = fb.Pass(AOVAlbedo); err != nil {
+			return nil, err
+		}
+	}
+	if fb.HasAOV(AOVNormal) {
+		if guides.normal, err = fb.Pass(AOVNormal); err != nil {
+			return nil, err
+		}
+	}
+	if fb.HasAOV(AOVDepth) {
+		if guides.depth, err = fb.Pass(AOVDepth); err != nil {
+			return nil, err
+		}
+		guides.depthGradient = depthGradient(guides.depth, fb.Width, fb.Height)
+	}
+
+	pixels := fb.Width * fb.Height
+	illumination := make([]float64, 3*pixels)
+	for y := 0; y < fb.Height; y++ {
+		for x := 0; x < fb.Width; x++ {
+			i := y*fb.Width + x
+			color := fb.Color(x, y)
+			illumination[3*i] = demodulate(color.X, guides.albedo, 3*i)
+			illumination[3*i+1] = demodulate(color.Y, guides.albedo, 3*i+1)
+			illumination[3*i+2] = demodulate(color.Z, guides.albedo, 3*i+2)
+		}
+	}
+	variance := illuminationVariance(fb, illumination, guides.albedo)
+
+	for level := 0; level < opts.Iterations; level++ {
+		illumination, variance = atrousLevel(illumination, variance, &guides, fb.Width, fb.Height, 1<<uint(level), opts)
+	}
+
+	img := NewHDRImage(fb.Width, fb.Height)
+	for i := 0; i < pixels; i++ {
+		for c := 0; c < 3; c++ {
+			img.Pixels[3*i+c] = float32(remodulate(illumination[3*i+c], guides.albedo, 3*i+c))
+		}
+	}
+	return img, nil
+}
+
+// demodulate divides a color channel by the albedo of the surface, if the albedo is known and not black
+func demodulate(value float64, albedo []float64, i int) float64 {
+	if albedo == nil || albedo[i] < 1e-3 {
+		return value
+	}
+	return value / albedo[i]
+}
+
+// remodulate multiplies a channel of the illumination by the albedo of the surface, undoing demodulate
+func remodulate(value float64, albedo []float64, i int) float64 {
+	if albedo == nil || albedo[i] < 1e-3 {
+		return value
+	}
+	return value * albedo[i]
+}
+
+// illuminationVariance estimates the variance of the luminance of the illumination in each pixel. Pixels with too
+// few samples to estimate their own variance use the spread of their 3x3 neighbourhood instead.
+func illuminationVariance(fb *Framebuffer, illumination, albedo []float64) []float64 {
+	pixels := fb.Width * fb.Height
+	luminance := make([]float64, pixels)
+	for i := range luminance {
+		luminance[i] = luminanceOf(illumination, i)
+	}
+
+	variance := make([]float64, pixels)
+	for y := 0; y < fb.Height; y++ {
+		for x := 0; x < fb.Width; x++ {
+			i := y*fb.Width + x
+			if v := fb.Variance(x, y); v >= 0 {
+				// the framebuffer tracks the variance of the color, which demodulation scales along with the mean
+				scale := 1.0
+				if albedo != nil {
+					if l := luminanceOf(albedo, i); l > 1e-3 {
+						scale = 1 / l
+					}
+				}
+				variance[i] = v * scale * scale
+				continue
+			}
+
+			var sum, sumSquared, count float64
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || nx >= fb.Width || ny < 0 || ny >= fb.Height {
+						continue
+					}
+					l := luminance[ny*fb.Width+nx]
+					sum += l
+					sumSquared += l * l
+					count++
+				}
+			}
+			mean := sum / count
+			variance[i] = math.Max(0, sumSquared/count-mean*mean)
+		}
+	}
+	return variance
+}
+
+// depthGradient returns the largest difference in depth between each pixel and its direct neighbours on the same
+// surface, which lets the depth weight accept slanted surfaces while rejecting discontinuities
+func depthGradient(depth []float64, width, height int) []float64 {
+	gradient := make([]float64, len(depth))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			if math.IsInf(depth[i], 1) {
+				continue
+			}
+			// use the smaller of the forward and backward differences, so that an edge does not widen the gradient
+			// of the pixels beside it
+			dx := minDepthDifference(depth, i, x > 0, i-1, x < width-1, i+1)
+			dy := minDepthDifference(depth, i, y > 0, i-width, y < height-1, i+width)
+			gradient[i] = math.Max(dx, dy)
+		}
+	}
+	return gradient
+}
+
+// minDepthDifference returns the smaller depth difference between pixel i and its two neighbours along one axis
+func minDepthDifference(depth []float64, i int, hasBefore bool, before int, hasAfter bool, after int) float64 {
+	difference := math.Inf(1)
+	if hasBefore && !math.IsInf(depth[before], 1) {
+		difference = math.Abs(depth[i] - depth[before])
+	}
+	if hasAfter && !math.IsInf(depth[after], 1) {
+		difference = math.Min(difference, math.Abs(depth[i]-depth[after]))
+	}
+	if math.IsInf(difference, 1) {
+		return 0
+	}
+	return difference
+}
+
+// atrousLevel applies one level of the filter with taps step pixels apart, returning the filtered illumination
+// and its variance
+func atrousLevel(illumination, variance []float64, guides *denoiseGuides, width, height, step int, opts DenoiseOptions) ([]float64, []float64) {
+	filtered := make([]float64, len(illumination))
+	filteredVariance := make([]float64, len(variance))
+	blurredVariance := blurVariance(variance, width, height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := y*width + x
+			luminanceP := luminanceOf(illumination, p)
+			luminanceScale := opts.SigmaLuminance*math.Sqrt(blurredVariance[p]) + denoiseEpsilon
+
+			var sum [3]float64
+			var weightSum, varianceSum float64
+			for ky := -2; ky <= 2; ky++ {
+				qy := y + ky*step
+				if qy < 0 || qy >= height {
+					continue
+				}
+				for kx := -2; kx <= 2; kx++ {
+					qx := x + kx*step
+					if qx < 0 || qx >= width {
+						continue
+					}
+					q := qy*width + qx
+
+					weight := atrousKernel[kx+2] * atrousKernel[ky+2]
+					if q != p {
+						weight *= math.Exp(-math.Abs(luminanceP-luminanceOf(illumination, q)) / luminanceScale)
+						weight *= guides.weight(p, q, float64(step)*math.Sqrt(float64(kx*kx+ky*ky)), opts)
+					}
+					if weight == 0 {
+						continue
+					}
+
+					sum[0] += weight * illumination[3*q]
+					sum[1] += weight * illumination[3*q+1]
+					sum[2] += weight * illumination[3*q+2]
+					weightSum += weight
+					varianceSum += weight * weight * variance[q]
+				}
+			}
+
+			// the center tap always has a positive weight, so weightSum is never zero
+			filtered[3*p] = sum[0] / weightSum
+			filtered[3*p+1] = sum[1] / weightSum
+			filtered[3*p+2] = sum[2] / weightSum
+			filteredVariance[p] = varianceSum / (weightSum * weightSum)
+		}
+	}
+	return filtered, filteredVariance
+}
+
+// weight returns the edge-stopping weight of the guides between pixels p and q, which are distance pixels apart
+func (g *denoiseGuides) weight(p, q int, distance float64, opts DenoiseOptions) float64 {
+	weight := 1.0
+	if g.depth != nil {
+		zp, zq := g.depth[p], g.depth[q]
+		pBackground, qBackground := math.IsInf(zp, 1), math.IsInf(zq, 1)
+		if pBackground != qBackground {
+			return 0
+		}
+		if !pBackground {
+			weight *= math.Exp(-math.Abs(zp-zq) / (opts.SigmaDepth*g.depthGradient[p]*distance + denoiseEpsilon))
+		}
+	}
+	if g.normal != nil {
+		cosine := g.normal[3*p]*g.normal[3*q] + g.normal[3*p+1]*g.normal[3*q+1] + g.normal[3*p+2]*g.normal[3*q+2]
+		weight *= math.Pow(math.Max(0, cosine), opts.SigmaNormal)
+	}
+	if g.albedo != nil {
+		difference := math.Abs(g.albedo[3*p]-g.albedo[3*q]) +
+			math.Abs(g.albedo[3*p+1]-g.albedo[3*q+1]) +
+			math.Abs(g.albedo[3*p+2]-g.albedo[3*q+2])
+		weight *= math.Exp(-difference / opts.SigmaAlbedo)
+	}
+	return weight
+}
+
+// blurVariance smooths the variance with a 3x3 gaussian, which makes the luminance weight more robust when the
+// variance itself is noisy
+func blurVariance(variance []float64, width, height int) []float64 {
+	kernel := [3]float64{0.25, 0.5, 0.25}
+	blurred := make([]float64, len(variance))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum, weightSum float64
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || nx >= width || ny < 0 || ny >= height {
+						continue
+					}
+					weight := kernel[dx+1] * kernel[dy+1]
+					sum += weight * variance[ny*width+nx]
+					weightSum += weight
+				}
+			}
+			blurred[y*width+x] = sum / weightSum
+		}
+	}
+	return blurred
+}
+
+// luminanceOf returns the luminance of the i-th RGB triplet in values
+func luminanceOf(values []float64, i int) float64 {
+	return Luminance(NewVec3(values[3*i], values[3*i+1], values[3*i+2]))
+}
@@ -0,0 +1,143 @@
+package raytracer_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+// noisyFramebuffer renders a synthetic image split down the middle into a dim wall facing the camera and a bright
+// wall facing to the side, with noisy samples whose average is the true color
+func noisyFramebuffer(width, height, samples int) (*rt.Framebuffer, func(x int) float64) {
+	truth := func(x int) float64 {
+		if x < width/2 {
+			return 0.2
+		}
+		return 0.8
+	}
+	rng := rand.New(rand.NewSource(1))
+	fb := rt.NewFramebuffer(width, height, []rt.AOV{rt.AOVAlbedo, rt.AOVNormal, rt.AOVDepth})
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			normal := rt.NewVec3(0, 0, 1)
+			if x >= width/2 {
+				normal = rt.NewVec3(1, 0, 0)
+			}
+			for s := 0; s < samples; s++ {
+				// uniform noise with a mean of one
+				value := truth(x) * 2 * rng.Float64()
+				fb.AddSample(x, y, rt.NewVec3(value, value, value))
+				fb.AddFirstHit(x, y, &rt.FirstHit{
+					Hit:      true,
+					Depth:    2,
+					Position: rt.NewVec3(0, 0, -2),
+					Normal:   normal,
+					Albedo:   rt.NewVec3(0.5, 0.5, 0.5),
+				})
+			}
+		}
+	}
+	return fb, truth
+}
+
+// meanSquaredError returns the mean squared error of the red channel of an image against the true color
+func meanSquaredError(img *rt.HDRImage, truth func(x int) float64) float64 {
+	var sum float64
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			difference := img.At(x, y).X - truth(x)
+			sum += difference * difference
+		}
+	}
+	return sum / float64(img.Width*img.Height)
+}
+
+func TestDenoise(t *testing.T) {
+	fb, truth := noisyFramebuffer(32, 16, 4)
+
+	denoised, err := rt.Denoise(fb, rt.DefaultDenoiseOptions())
+	assert.Nil(t, err)
+
+	noisyError := meanSquaredError(fb.Image(), truth)
+	denoisedError := meanSquaredError(denoised, truth)
+	assert.True(t, denoisedError < noisyError/10, "denoising should remove most of the noise: %f vs %f", denoisedError, noisyError)
+
+	// the normals differ across the middle of the image, so the two halves must not bleed into each other
+	for y := 0; y < denoised.Height; y++ {
+		assert.InDelta(t, 0.2, denoised.At(15, y).X, 0.05)
+		assert.InDelta(t, 0.8, denoised.At(16, y).X, 0.15)
+	}
+}
+
+func TestDenoise_WithoutGuides(t *testing.T) {
+	fb := rt.NewFramebuffer(8, 8, nil)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			// a single sample per pixel, so the variance comes from the neighbourhood
+			fb.AddSample(x, y, rt.NewVec3(float64((x+y)%2), 0, 0))
+		}
+	}
+	denoised, err := rt.Denoise(fb, rt.DefaultDenoiseOptions())
+	assert.Nil(t, err)
+	for _, value := range denoised.Pixels {
+		assert.False(t, math.IsNaN(float64(value)))
+	}
+	assert.InDelta(t, 0.5, denoised.At(4, 4).X, 0.25, "the checkerboard should be blurred towards its mean")
+}
+
+func TestDenoise_Background(t *testing.T) {
+	// the left half of the image sees the sky, and the right half a grey wall
+	sky, wall := rt.NewVec3(0.5, 0.7, 1), rt.NewVec3(0.25, 0.25, 0.25)
+	fb := rt.NewFramebuffer(16, 8, []rt.AOV{rt.AOVAlbedo, rt.AOVNormal, rt.AOVDepth})
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			for s := 0; s < 4; s++ {
+				if x < 8 {
+					fb.AddSample(x, y, sky)
+					fb.AddFirstHit(x, y, &rt.FirstHit{})
+					continue
+				}
+				fb.AddSample(x, y, wall)
+				fb.AddFirstHit(x, y, &rt.FirstHit{Hit: true, Depth: 2, Normal: rt.NewVec3(0, 0, 1), Albedo: rt.NewVec3(0.5, 0.5, 0.5)})
+			}
+		}
+	}
+
+	denoised, err := rt.Denoise(fb, rt.DefaultDenoiseOptions())
+	assert.Nil(t, err)
+	for y := 0; y < 8; y++ {
+		for _, x := range []int{0, 4} {
+			got := denoised.At(x, y)
+			assert.InDelta(t, 0, got.SubtractVector(sky).Length(), 0.01, "the sky at %d,%d should keep its color: %v", x, y, got)
+		}
+		got := denoised.At(12, y)
+		assert.InDelta(t, 0, got.SubtractVector(wall).Length(), 0.01, "the wall at 12,%d should keep its color: %v", y, got)
+	}
+}
+
+func TestDenoise_InvalidOptions(t *testing.T) {
+	fb := rt.NewFramebuffer(1, 1, nil)
+	options := rt.DefaultDenoiseOptions()
+	options.Iterations = -1
+	_, err := rt.Denoise(fb, options)
+	assert.Error(t, err)
+
+	options = rt.DefaultDenoiseOptions()
+	options.SigmaLuminance = 0
+	_, err = rt.Denoise(fb, options)
+	assert.Error(t, err)
+}
+
+func TestFramebuffer_Variance(t *testing.T) {
+	fb := rt.NewFramebuffer(1, 1, nil)
+	assert.True(t, fb.Variance(0, 0) < 0, "the variance of an empty pixel is unknown")
+
+	for _, value := range []float64{1, 3} {
+		fb.AddSample(0, 0, rt.NewVec3(value, value, value))
+	}
+	// the sample variance of 1 and 3 is 2, so the variance of their mean is 1
+	assert.InDelta(t, 1.0, fb.Variance(0, 0), 1e-9)
+}
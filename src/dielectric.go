@@ -0,0 +1,160 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// RoughDielectric is a transparent material, like glass, whose surface is made up of tiny facets oriented
+// according to a GGX distribution. Light is either reflected or refracted by each facet.
+type RoughDielectric struct {
+	// IOR is the index of refraction of the material relative to the medium outside of it
+	IOR          float64
+	Distribution GGX
+}
+
+// NewRoughDielectric returns a dielectric with the passed-in index of refraction. roughnessU and roughnessV are
+// the perceptual roughness along the tangent and bitangent; a roughness of 0 is perfectly smooth glass.
+func NewRoughDielectric(ior, roughnessU, roughnessV float64) *RoughDielectric {
+	return &RoughDielectric{
+		IOR: ior,
+		Distribution: GGX{
+			AlphaX: RoughnessToAlpha(roughnessU),
+			AlphaY: RoughnessToAlpha(roughnessV),
+		},
+	}
+}
+
+// relativeIOR returns the ratio of the index of refraction on the far side of the surface to the one on the side
+// that the ray arrived from
+func (d *RoughDielectric) relativeIOR(hitRecord *HitRecord) float64 {
+	if hitRecord.FrontFace {
+		return d.IOR
+	}
+	return 1 / d.IOR
+}
+
+// Scatter picks between reflection and refraction proportionally to the Fresnel reflectance
+func (d *RoughDielectric) Scatter(rayIn Ray, hitRecord *HitRecord, rng *rand.Rand) (ScatterRecord, bool) {
+	frame := shadingFrame(hitRecord)
+	wo, ok := localOutgoing(frame, rayIn)
+	if !ok {
+		return ScatterRecord{}, false
+	}
+	eta := d.relativeIOR(hitRecord)
+
+	if d.Distribution.IsSmooth() {
+		reflectance := FresnelDielectric(wo.Z, eta)
+		if rng.Float64() < reflectance {
+			return ScatterRecord{
+				Ray:         NewRay(hitRecord.P, frame.ToWorld(NewVec3(-wo.X, -wo.Y, wo.Z))),
+				Attenuation: NewVec3(1, 1, 1),
+				IsSpecular:  true,
+			}, true
+		}
+		wi, ok := refract(wo, NewVec3(0, 0, 1), eta)
+		if !ok {
+			return ScatterRecord{}, false
+		}
+		// radiance is compressed into a smaller solid angle when it enters a denser medium
+		scale := 1 / (eta * eta)
+		return ScatterRecord{
+			Ray:         NewRay(hitRecord.P, frame.ToWorld(wi)),
+			Attenuation: NewVec3(scale, scale, scale),
+			IsSpecular:  true,
+		}, true
+	}
+
+	wi, ok := d.sampleLocal(wo, eta, rng)
+	if !ok {
+		return ScatterRecord{}, false
+	}
+
+	value, pdf := d.evaluateLocal(wo, wi, eta)
+	if pdf == 0 {
+		return ScatterRecord{}, false
+	}
+	return ScatterRecord{
+		Ray:         NewRay(hitRecord.P, frame.ToWorld(wi)),
+		Attenuation: NewVec3(value/pdf, value/pdf, value/pdf),
+		Pdf:         pdf,
+	}, true
+}
+
+// Evaluate returns the microfacet BSDF of Walter et al., "Microfacet Models for Refraction through Rough
+// Surfaces", multiplied by the cosine term
+func (d *RoughDielectric) Evaluate(wo, wi Vec3, hitRecord *HitRecord) (Vec3, float64) {
+	if d.Distribution.IsSmooth() {
+		return NewVec3(0, 0, 0), 0
+	}
+	frame := shadingFrame(hitRecord)
+	value, pdf := d.evaluateLocal(frame.ToLocal(wo), frame.ToLocal(wi), d.relativeIOR(hitRecord))
+	return NewVec3(value, value, value), pdf
+}
+
+// sampleLocal picks the direction that light leaving along the local direction wo arrived from, by reflecting or
+// refracting it about a sampled visible microfacet normal
+func (d *RoughDielectric) sampleLocal(wo Vec3, eta float64, rng *rand.Rand) (Vec3, bool) {
+	u0, u1 := randomPair(rng)
+	wm := d.Distribution.SampleVisibleNormal(wo, u0, u1)
+	reflectance := FresnelDielectric(wo.Dot(wm), eta)
+
+	if rng.Float64() < reflectance {
+		wi := wo.Negate().Reflect(wm)
+		return wi, wi.Z > 0
+	}
+	wi, ok := refract(wo, wm, eta)
+	return wi, ok && wi.Z < 0
+}
+
+// evaluateLocal evaluates the BSDF multiplied by the cosine term, and its density, for local directions
+func (d *RoughDielectric) evaluateLocal(wo, wi Vec3, eta float64) (float64, float64) {
+	cosThetaO, cosThetaI := wo.Z, wi.Z
+	if cosThetaO <= 0 || cosThetaI == 0 {
+		return 0, 0
+	}
+	isReflection := cosThetaI > 0
+
+	// the generalized half vector points along the microfacet normal for both reflection and refraction
+	etaHalf := 1.0
+	if !isReflection {
+		etaHalf = eta
+	}
+	wm, err := wi.MultiplyFloat(etaHalf).AddVector(wo).Unit()
+	if err != nil {
+		return 0, 0
+	}
+	if wm.Z < 0 {
+		wm = wm.Negate()
+	}
+	// facets that face away from either direction cannot contribute
+	if wm.Dot(wi)*cosThetaI < 0 || wm.Dot(wo)*cosThetaO < 0 {
+		return 0, 0
+	}
+
+	reflectance := FresnelDielectric(wo.Dot(wm), eta)
+	transmittance := 1 - reflectance
+	g := d.Distribution.G(wo, wi)
+	visible := d.Distribution.VisibleD(wo, wm)
+
+	if isReflection {
+		bsdf := d.Distribution.D(wm) * g * reflectance / (4 * cosThetaO * cosThetaI)
+		pdf := visible / (4 * math.Abs(wo.Dot(wm))) * reflectance
+		return bsdf * cosThetaI, pdf
+	}
+
+	denominator := wi.Dot(wm) + wo.Dot(wm)/eta
+	denominator *= denominator
+	if denominator == 0 {
+		return 0, 0
+	}
+	bsdf := transmittance * d.Distribution.D(wm) * g *
+		math.Abs(wi.Dot(wm)*wo.Dot(wm)/(cosThetaI*cosThetaO*denominator)) / (eta * eta)
+	pdf := visible * math.Abs(wi.Dot(wm)) / denominator * transmittance
+	return bsdf * math.Abs(cosThetaI), pdf
+}
+
+// AlbedoAt returns white, as a dielectric lets all light through one way or another
+func (d *RoughDielectric) AlbedoAt(hitRecord *HitRecord) Vec3 {
+	return NewVec3(1, 1, 1)
+}
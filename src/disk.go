@@ -0,0 +1,83 @@
+package raytracer
+
+import "math"
+
+// Disk is a flat disk that lies in the XZ plane facing up along +Y. With an inner radius it is an annulus.
+type Disk struct {
+	Center Vec3
+	Radius float64
+	// InnerRadius is the radius of the hole in the middle of an annulus, and 0 for a disk
+	InnerRadius float64
+	// PhiMax is the angle in degrees that the disk sweeps around its center, starting from +X. 0 is a full turn.
+	PhiMax float64
+	// Material is the material that the disk is made of. A nil material is a grey diffuse surface.
+	Material Material
+	// ID identifies the disk in the object ID pass. 0 is reserved for the background.
+	ID int
+}
+
+// NewDisk returns a new disk
+func NewDisk(center Vec3, radius float64) *Disk {
+	return &Disk{Center: center, Radius: radius}
+}
+
+// Hit returns whether the passed-in ray hits the disk
+func (d *Disk) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	var crossings crossingList
+	d.crossing(ray, false, &crossings)
+	return crossings.first(ray, tMin, tMax, hitRecord)
+}
+
+// Validate returns an error if the disk has no area or its hole is at least as large as the disk
+func (d *Disk) Validate() error {
+	if err := checkPoint("disk", "center", d.Center); err != nil {
+		return err
+	}
+	if err := checkPositive("disk", "radius", d.Radius); err != nil {
+		return err
+	}
+	if err := checkFinite("disk", "inner radius", d.InnerRadius); err != nil {
+		return err
+	}
+	if d.InnerRadius < 0 || d.InnerRadius >= d.Radius {
+		return validationError("disk", "inner radius", ErrOutOfRange)
+	}
+	return checkSweep("disk", d.PhiMax)
+}
+
+// BoundingBox returns the flat box around the disk
+func (d *Disk) BoundingBox() *AABB {
+	extent := NewVec3(d.Radius, 0, d.Radius)
+	return NewAABB(d.Center.SubtractVector(extent), d.Center.AddVector(extent))
+}
+
+// crossing adds where the ray crosses the disk to the list, if it does not miss. The disk faces down instead of up
+// if facingDown is set, which is used for the bottom caps of other shapes.
+//
+// u turns around the center and v goes from the outer edge to the inner one.
+func (d *Disk) crossing(ray Ray, facingDown bool, crossings *crossingList) {
+	o, direction, ok := localRay(ray, d.Center)
+	if !ok || direction.Y == 0 {
+		return
+	}
+	t := -o.Y / direction.Y
+	x, z := o.X+t*direction.X, o.Z+t*direction.Z
+	rho := math.Sqrt(x*x + z*z)
+	phiMax := sweep(d.PhiMax)
+	phi := azimuth(x, z)
+	if rho > d.Radius || rho < d.InnerRadius || phi > phiMax {
+		return
+	}
+
+	normal := NewVec3(0, 1, 0)
+	if facingDown {
+		normal = NewVec3(0, -1, 0)
+	}
+	var dpdu, dpdv Vec3
+	if rho > 1e-8 {
+		dpdu = aroundAxis(x, z, phiMax)
+		dpdv = NewVec3(x, 0, z).MultiplyFloat(-(d.Radius - d.InnerRadius) / rho)
+	}
+	v := (d.Radius - rho) / (d.Radius - d.InnerRadius)
+	setSurface(crossings.add(), ray, t, normal, dpdu, dpdv, phi/phiMax, v, d.Material, d.ID)
+}
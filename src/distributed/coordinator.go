@@ -0,0 +1,282 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+)
+
+// Coordinator splits jobs into tiles and hands them out to workers
+type Coordinator struct {
+	// Workers are the TCP addresses of the worker processes
+	Workers []string
+	// TileSize is the width and height of the tiles, in pixels
+	TileSize int
+	// DialTimeout limits how long connecting to a worker may take
+	DialTimeout time.Duration
+	// TileTimeout, if positive, limits how long a worker may take to load the scene or render a tile before it is
+	// dropped and its tile is handed to another worker
+	TileTimeout time.Duration
+	// OnProgress, if set, is called after each tile is merged with the progress of the render. Its tiles are the
+	// tiles that are handed to workers, and its rays the ones that the workers traced.
+	OnProgress func(p rt.Progress)
+}
+
+// NewCoordinator returns a coordinator that uses the workers at the passed-in addresses, with 32 pixel tiles
+func NewCoordinator(workers []string) *Coordinator {
+	return &Coordinator{
+		Workers:     workers,
+		TileSize:    32,
+		DialTimeout: 5 * time.Second,
+	}
+}
+
+// Render renders a job on the workers and returns the merged framebuffer. Tiles that a worker fails to return
+// because it died, disconnected or timed out are handed to the other workers, and the render only fails once no
+// worker is left or a worker reports that the job itself cannot be rendered.
+//
+// If ctx is cancelled or its deadline passes, no more tiles are handed out and Render returns the framebuffer with
+// the tiles that were done so far, along with an error that wraps ctx.Err().
+func (c *Coordinator) Render(ctx context.Context, job Job) (*rt.Framebuffer, error) {
+	if len(c.Workers) == 0 {
+		return nil, errors.New("at least one worker is needed")
+	}
+	if c.TileSize <= 0 {
+		return nil, errors.New("the tile size must be positive")
+	}
+	if job.Width <= 0 || job.Height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", job.Width, job.Height)
+	}
+
+	tiles := splitTiles(job.Width, job.Height, c.TileSize)
+	r := &distributedRender{
+		coordinator: c,
+		job:         job,
+		fb:          rt.NewFramebuffer(job.Width, job.Height, job.AOVs),
+		tiles:       make(chan image.Rectangle, len(tiles)),
+		remaining:   len(tiles),
+		total:       len(tiles),
+		stop:        make(chan struct{}),
+		start:       time.Now(),
+	}
+	r.fb.Seed = job.Seed
+	r.fb.Passes = job.SamplesPerPixel
+	for _, tile := range tiles {
+		r.tiles <- tile
+	}
+
+	// cancelling ctx stops the workers like a job that cannot be rendered, but keeps the tiles that were done
+	finished, watched := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-ctx.Done():
+			r.abort(fmt.Errorf("render stopped: %w", ctx.Err()))
+		case <-finished:
+		}
+	}()
+
+	var workers sync.WaitGroup
+	for _, addr := range c.Workers {
+		workers.Add(1)
+		go func(addr string) {
+			defer workers.Done()
+			r.work(addr)
+		}(addr)
+	}
+	workers.Wait()
+	close(finished)
+	<-watched
+
+	if r.fatal != nil {
+		if ctx.Err() != nil && errors.Is(r.fatal, ctx.Err()) {
+			return r.fb, r.fatal
+		}
+		return nil, r.fatal
+	}
+	if r.remaining > 0 {
+		return nil, fmt.Errorf("every worker failed with %d of %d tiles left, last error: %s", r.remaining, r.total, r.lastError)
+	}
+	return r.fb, nil
+}
+
+// distributedRender is the state of a job that is being rendered by workers
+type distributedRender struct {
+	coordinator *Coordinator
+	job         Job
+	// tiles holds the tiles that still need a worker. It is closed once every tile is done.
+	tiles chan image.Rectangle
+	// stop is closed when the job cannot be rendered or the render is cancelled, to stop every worker
+	stop chan struct{}
+
+	mu               sync.Mutex
+	fb               *rt.Framebuffer
+	remaining, total int
+	fatal, lastError error
+	// start is when the render started, and samples and rays count the camera rays and all of the rays traced for
+	// the tiles that were merged
+	start         time.Time
+	samples, rays int64
+}
+
+// work renders tiles on one worker until there are none left or the worker fails
+func (r *distributedRender) work(addr string) {
+	conn, err := net.DialTimeout("tcp", addr, r.coordinator.DialTimeout)
+	if err != nil {
+		r.workerFailed(fmt.Errorf("could not connect to worker %s: %s", addr, err))
+		return
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	if err := r.call(client, "Load", r.job, &struct{}{}); err != nil {
+		r.failed(addr, err)
+		return
+	}
+	// workers that are still healthy at the end are told to free the scene
+	unload := func() {
+		r.call(client, "Unload", r.job.ID, &struct{}{})
+	}
+
+	for {
+		var tile image.Rectangle
+		select {
+		case <-r.stop:
+			unload()
+			return
+		case t, ok := <-r.tiles:
+			if !ok {
+				unload()
+				return
+			}
+			tile = t
+		}
+
+		var reply TileReply
+		if err := r.call(client, "RenderTile", TileArgs{JobID: r.job.ID, Tile: tile}, &reply); err != nil {
+			// there is always room to put the tile back, as it was taken from the same channel
+			r.tiles <- tile
+			r.failed(addr, err)
+			return
+		}
+		if err := r.merge(tile, &reply); err != nil {
+			r.abort(fmt.Errorf("worker %s returned a bad tile: %s", addr, err))
+			return
+		}
+	}
+}
+
+// call calls a worker method, giving up after the tile timeout or once the render is stopped
+func (r *distributedRender) call(client *rpc.Client, method string, args, reply interface{}) error {
+	call := client.Go(ServiceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	var timeout <-chan time.Time
+	if r.coordinator.TileTimeout > 0 {
+		timer := time.NewTimer(r.coordinator.TileTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timeout:
+		return fmt.Errorf("%s timed out after %s", method, r.coordinator.TileTimeout)
+	case <-r.stop:
+		return fmt.Errorf("%s was abandoned because the render stopped", method)
+	}
+}
+
+// failed handles an error from a worker. Errors returned by the worker's own code mean that the job cannot be
+// rendered anywhere, while any other error only takes that worker out of the render.
+func (r *distributedRender) failed(addr string, err error) {
+	if serverError, ok := err.(rpc.ServerError); ok {
+		r.abort(fmt.Errorf("worker %s: %s", addr, string(serverError)))
+		return
+	}
+	r.workerFailed(fmt.Errorf("worker %s: %s", addr, err))
+}
+
+// workerFailed records the error of a worker that dropped out of the render
+func (r *distributedRender) workerFailed(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastError = err
+}
+
+// abort stops every worker because the job cannot be rendered or the render was cancelled
+func (r *distributedRender) abort(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fatal == nil {
+		r.fatal = err
+		close(r.stop)
+	}
+}
+
+// merge pastes a rendered tile into the framebuffer. Every pixel belongs to exactly one tile, so the result does
+// not depend on the order that tiles finish in.
+func (r *distributedRender) merge(tile image.Rectangle, reply *TileReply) error {
+	fb, err := rt.ReadCheckpoint(bytes.NewReader(reply.Framebuffer))
+	if err != nil {
+		return err
+	}
+	if fb.Width != tile.Dx() || fb.Height != tile.Dy() {
+		return fmt.Errorf("expected a %dx%d tile, got %dx%d", tile.Dx(), tile.Dy(), fb.Width, fb.Height)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fb.Paste(fb, tile.Min); err != nil {
+		return err
+	}
+	r.remaining--
+	r.samples += int64(tile.Dx() * tile.Dy() * r.job.SamplesPerPixel)
+	r.rays += reply.Rays
+	if r.coordinator.OnProgress != nil {
+		r.coordinator.OnProgress(r.progress())
+	}
+	if r.remaining == 0 {
+		close(r.tiles)
+	}
+	return nil
+}
+
+// progress returns the progress of the render with the tiles that were merged so far
+func (r *distributedRender) progress() rt.Progress {
+	p := rt.Progress{
+		TilesDone:    r.total - r.remaining,
+		TotalTiles:   r.total,
+		SamplesDone:  r.samples,
+		TotalSamples: int64(r.job.Width * r.job.Height * r.job.SamplesPerPixel),
+		Rays:         r.rays,
+		Elapsed:      time.Since(r.start),
+	}
+	if seconds := p.Elapsed.Seconds(); seconds > 0 {
+		p.RaysPerSecond = float64(p.Rays) / seconds
+	}
+	if p.SamplesDone > 0 {
+		perSample := float64(p.Elapsed) / float64(p.SamplesDone)
+		p.Remaining = time.Duration(math.Round(perSample * float64(p.TotalSamples-p.SamplesDone)))
+	}
+	return p
+}
+
+// splitTiles covers a width x height image with square tiles, row by row from the top left
+func splitTiles(width, height, size int) []image.Rectangle {
+	var tiles []image.Rectangle
+	bounds := image.Rect(0, 0, width, height)
+	for y := 0; y < height; y += size {
+		for x := 0; x < width; x += size {
+			tiles = append(tiles, image.Rect(x, y, x+size, y+size).Intersect(bounds))
+		}
+	}
+	return tiles
+}
@@ -0,0 +1,235 @@
+package distributed_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/andrewzlchen/raytracer/src/distributed"
+	"github.com/stretchr/testify/assert"
+)
+
+const testScene = `{
+  "camera": {"origin": [0, 0, 0]},
+  "materials": {"glass": {"type": "dielectric", "ior": 1.5, "roughness": 0.3}},
+  "objects": [
+    {"type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "glass"},
+    {"type": "sphere", "center": [0, -100.5, -1], "radius": 100}
+  ]
+}`
+
+// workerEnv makes the test binary run as a worker process instead of running the tests. Its value is the number of
+// tiles that the worker renders before it crashes, or "forever".
+const workerEnv = "RAYTRACER_TEST_WORKER"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(workerEnv); mode != "" {
+		runWorker(mode)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runWorker serves tiles on a free local port, printing the port's address so that the test can connect to it
+func runWorker(mode string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(listener.Addr())
+
+	worker := distributed.NewWorker("")
+	if mode == "forever" {
+		worker.Serve(listener)
+		return
+	}
+	tiles, err := strconv.Atoi(mode)
+	if err != nil {
+		panic(err)
+	}
+	server := rpc.NewServer()
+	server.RegisterName(distributed.ServiceName, &crashingWorker{Worker: worker, tilesLeft: int32(tiles)})
+	server.Accept(listener)
+}
+
+// crashingWorker exits the process in the middle of a tile once it has rendered its share of tiles
+type crashingWorker struct {
+	*distributed.Worker
+	tilesLeft int32
+}
+
+// RenderTile renders a tile, unless the worker is out of tiles
+func (w *crashingWorker) RenderTile(args distributed.TileArgs, reply *distributed.TileReply) error {
+	if atomic.AddInt32(&w.tilesLeft, -1) < 0 {
+		os.Exit(1)
+	}
+	return w.Worker.RenderTile(args, reply)
+}
+
+// startWorker starts a worker process and returns its address. tiles is the number of tiles it renders before it
+// crashes, or -1 for a worker that never crashes.
+func startWorker(t *testing.T, tiles int) string {
+	mode := "forever"
+	if tiles >= 0 {
+		mode = strconv.Itoa(tiles)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), workerEnv+"="+mode)
+	stdout, err := cmd.StdoutPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	assert.Nil(t, err)
+	return addr[:len(addr)-1]
+}
+
+// testJob returns a small job of the test scene
+func testJob() distributed.Job {
+	return distributed.Job{
+		ID:              "test",
+		Scene:           []byte(testScene),
+		Width:           20,
+		Height:          12,
+		SamplesPerPixel: 2,
+		MaxDepth:        8,
+		Seed:            5,
+		AOVs:            []rt.AOV{rt.AOVDepth, rt.AOVObjectID},
+	}
+}
+
+// renderLocally renders a job in this process, for comparison
+func renderLocally(t *testing.T, job distributed.Job) *rt.Framebuffer {
+	description, err := rt.ParseSceneDescription(bytes.NewReader(job.Scene))
+	assert.Nil(t, err)
+	scene, camera, err := description.Build()
+	assert.Nil(t, err)
+	fb, err := rt.Render(context.Background(), scene, camera, rt.RenderOptions{
+		Width:           job.Width,
+		Height:          job.Height,
+		SamplesPerPixel: job.SamplesPerPixel,
+		MaxDepth:        job.MaxDepth,
+		AOVs:            job.AOVs,
+		Seed:            job.Seed,
+	})
+	assert.Nil(t, err)
+	return fb
+}
+
+// assertSameRender checks that two framebuffers hold exactly the same samples
+func assertSameRender(t *testing.T, want, got *rt.Framebuffer) {
+	assert.Equal(t, want.Image().Pixels, got.Image().Pixels)
+	assert.Equal(t, want.SampleCount, got.SampleCount)
+	for _, aov := range want.AOVs() {
+		wantPass, _ := want.Pass(aov)
+		gotPass, _ := got.Pass(aov)
+		assert.Equal(t, wantPass, gotPass, "%s pass", aov)
+	}
+}
+
+func TestCoordinator_MatchesLocalRender(t *testing.T) {
+	coordinator := distributed.NewCoordinator([]string{startWorker(t, -1), startWorker(t, -1), startWorker(t, -1)})
+	coordinator.TileSize = 5
+	var progress rt.Progress
+	coordinator.OnProgress = func(p rt.Progress) {
+		progress = p
+	}
+
+	job := testJob()
+	fb, err := coordinator.Render(context.Background(), job)
+	assert.Nil(t, err)
+	assert.Equal(t, 12, progress.TilesDone)
+	assert.Equal(t, 12, progress.TotalTiles)
+	assert.Equal(t, int64(20*12*2), progress.SamplesDone)
+	assert.Equal(t, 1.0, progress.Fraction())
+	assert.True(t, progress.Rays >= progress.SamplesDone, "every camera ray should be counted, got %d rays", progress.Rays)
+	assertSameRender(t, renderLocally(t, job), fb)
+}
+
+func TestCoordinator_ReassignsTilesOfDeadWorkers(t *testing.T) {
+	// one worker is not running at all, and two crash after a few tiles
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	unreachable := listener.Addr().String()
+	listener.Close()
+	coordinator := distributed.NewCoordinator([]string{unreachable, startWorker(t, 0), startWorker(t, 2), startWorker(t, -1)})
+	coordinator.TileSize = 4
+
+	job := testJob()
+	fb, err := coordinator.Render(context.Background(), job)
+	assert.Nil(t, err)
+	assertSameRender(t, renderLocally(t, job), fb)
+}
+
+func TestCoordinator_Cancelled(t *testing.T) {
+	coordinator := distributed.NewCoordinator([]string{startWorker(t, -1)})
+	coordinator.TileSize = 4
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var tilesDone int
+	coordinator.OnProgress = func(p rt.Progress) {
+		tilesDone = p.TilesDone
+		cancel()
+	}
+
+	job := testJob()
+	fb, err := coordinator.Render(ctx, job)
+	assert.True(t, errors.Is(err, context.Canceled), "the error should wrap the context's: %v", err)
+	assert.NotNil(t, fb, "the tiles done before the render was cancelled should be returned")
+	assert.True(t, tilesDone > 0 && tilesDone < 15, "the render should stop early, after %d tiles", tilesDone)
+
+	// the first tile is in the top left corner, and was merged before the render stopped
+	want := renderLocally(t, job)
+	assert.Equal(t, want.Color(0, 0), fb.Color(0, 0))
+}
+
+func TestCoordinator_AllWorkersDead(t *testing.T) {
+	coordinator := distributed.NewCoordinator([]string{startWorker(t, 0), startWorker(t, 1)})
+	coordinator.TileSize = 4
+
+	_, err := coordinator.Render(context.Background(), testJob())
+	assert.Error(t, err)
+}
+
+func TestCoordinator_InvalidScene(t *testing.T) {
+	coordinator := distributed.NewCoordinator([]string{startWorker(t, -1)})
+	job := testJob()
+	job.Scene = []byte(`{"objects": [{"type": "cube"}]}`)
+
+	_, err := coordinator.Render(context.Background(), job)
+	assert.Error(t, err)
+}
+
+func TestWorker_ForgetsUnusedJobs(t *testing.T) {
+	worker := distributed.NewWorker("")
+	worker.JobTTL = 100 * time.Millisecond
+	job := testJob()
+	assert.Nil(t, worker.Load(job, &struct{}{}))
+	args := distributed.TileArgs{JobID: job.ID, Tile: image.Rect(0, 0, 4, 4)}
+
+	// a job that keeps getting tiles outlives its TTL
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, worker.RenderTile(args, &distributed.TileReply{}), "tile %d", i)
+		time.Sleep(worker.JobTTL / 4)
+	}
+
+	// and is forgotten once its coordinator stops asking for them
+	time.Sleep(3 * worker.JobTTL)
+	assert.Error(t, worker.RenderTile(args, &distributed.TileReply{}))
+}
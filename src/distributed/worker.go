@@ -0,0 +1,202 @@
+// Package distributed splits a render into tiles and renders them on worker processes over TCP with net/rpc.
+//
+// A coordinator sends the scene to every worker, hands out tiles until they are all done and pastes each finished
+// tile into place. Tiles from workers that die or stop responding are handed to the remaining workers. The random
+// numbers of every sample only depend on the seed and the position of the pixel in the whole image, so the merged
+// image is identical to a render on a single machine, no matter which worker rendered which tile.
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+)
+
+// ServiceName is the name that workers register their RPC methods under
+const ServiceName = "Worker"
+
+// Job describes a render that is split between workers
+type Job struct {
+	// ID identifies the job on the workers, which may serve several coordinators at once
+	ID string
+	// Scene is a JSON scene description, whose relative paths are resolved against each worker's asset directory
+	Scene []byte
+	// Width and Height are the size of the whole image in pixels
+	Width, Height   int
+	SamplesPerPixel int
+	MaxDepth        int
+	Seed            int64
+	AOVs            []rt.AOV
+}
+
+// renderOptions returns the options that render one tile of the job
+func (j *Job) renderOptions(tile image.Rectangle) rt.RenderOptions {
+	return rt.RenderOptions{
+		Width:           j.Width,
+		Height:          j.Height,
+		SamplesPerPixel: j.SamplesPerPixel,
+		MaxDepth:        j.MaxDepth,
+		AOVs:            j.AOVs,
+		Seed:            j.Seed,
+		Region:          tile,
+	}
+}
+
+// TileArgs asks a worker to render one tile of a job that it has loaded
+type TileArgs struct {
+	JobID string
+	Tile  image.Rectangle
+}
+
+// TileReply holds a rendered tile, encoded as a checkpoint, and the number of rays that were traced to render it
+type TileReply struct {
+	Framebuffer []byte
+	Rays        int64
+}
+
+// Worker renders tiles for coordinators. Its exported methods are called over RPC.
+type Worker struct {
+	// AssetDir is the directory that file paths in scenes are resolved against. Scenes cannot read files outside
+	// of it.
+	AssetDir string
+	// JobTTL is how long a loaded job is kept for after its last tile, so that the scenes of coordinators that
+	// disconnect without unloading them are freed. 0 keeps jobs until they are unloaded.
+	JobTTL time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*loadedJob
+}
+
+// loadedJob is a job whose scene has been built by a worker
+type loadedJob struct {
+	job    Job
+	scene  *rt.Scene
+	camera rt.Camera
+	// rendering is the number of its tiles that are being rendered, and lastUsed is when the last one started or
+	// finished
+	rendering int
+	lastUsed  time.Time
+	// expiry forgets the job once it has been unused for JobTTL. It is nil if jobs do not expire.
+	expiry *time.Timer
+}
+
+// NewWorker returns a worker that resolves the paths in scenes against assetDir and forgets jobs that have not been
+// used for 10 minutes
+func NewWorker(assetDir string) *Worker {
+	return &Worker{AssetDir: assetDir, JobTTL: 10 * time.Minute, jobs: map[string]*loadedJob{}}
+}
+
+// Serve registers the worker with an RPC server and answers the coordinators that connect to listener until it is
+// closed
+func (w *Worker) Serve(listener net.Listener) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(ServiceName, w); err != nil {
+		return err
+	}
+	server.Accept(listener)
+	return nil
+}
+
+// Load builds the scene of a job so that its tiles can be rendered
+func (w *Worker) Load(job Job, reply *struct{}) error {
+	description, err := rt.ParseSceneDescription(bytes.NewReader(job.Scene))
+	if err != nil {
+		return err
+	}
+	description.BaseDir = w.AssetDir
+	description.RestrictPaths = true
+	scene, camera, err := description.Build()
+	if err != nil {
+		return fmt.Errorf("could not build scene: %s", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.forget(job.ID)
+	loaded := &loadedJob{job: job, scene: scene, camera: camera, lastUsed: time.Now()}
+	if w.JobTTL > 0 {
+		loaded.expiry = time.AfterFunc(w.JobTTL, func() { w.expire(loaded) })
+	}
+	w.jobs[job.ID] = loaded
+	return nil
+}
+
+// Unload forgets a job once its coordinator is done with it
+func (w *Worker) Unload(jobID string, reply *struct{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.forget(jobID)
+	return nil
+}
+
+// forget drops a job and stops its expiry timer. w.mu must be held.
+func (w *Worker) forget(jobID string) {
+	if loaded, ok := w.jobs[jobID]; ok && loaded.expiry != nil {
+		loaded.expiry.Stop()
+	}
+	delete(w.jobs, jobID)
+}
+
+// expire forgets a job that has not been used for JobTTL. Jobs that were used since the timer was set, or that are
+// still rendering a tile, are checked again later.
+func (w *Worker) expire(loaded *loadedJob) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.jobs[loaded.job.ID] != loaded {
+		// the job was unloaded or loaded again
+		return
+	}
+	idle := time.Since(loaded.lastUsed)
+	if loaded.rendering > 0 || idle < w.JobTTL {
+		wait := w.JobTTL
+		if loaded.rendering == 0 {
+			wait -= idle
+		}
+		loaded.expiry.Reset(wait)
+		return
+	}
+	delete(w.jobs, loaded.job.ID)
+}
+
+// RenderTile renders every sample of one tile of a loaded job
+func (w *Worker) RenderTile(args TileArgs, reply *TileReply) error {
+	w.mu.Lock()
+	loaded, ok := w.jobs[args.JobID]
+	if ok {
+		loaded.rendering++
+		loaded.lastUsed = time.Now()
+	}
+	w.mu.Unlock()
+	if !ok {
+		return errors.New("job " + args.JobID + " has not been loaded")
+	}
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		loaded.rendering--
+		loaded.lastUsed = time.Now()
+	}()
+
+	opts := loaded.job.renderOptions(args.Tile)
+	opts.OnProgress = func(p rt.Progress) {
+		reply.Rays = p.Rays
+	}
+	fb, err := rt.Render(context.Background(), loaded.scene, loaded.camera, opts)
+	if err != nil {
+		return fmt.Errorf("could not render tile %v: %s", args.Tile, err)
+	}
+	var buf bytes.Buffer
+	if err := rt.WriteCheckpoint(&buf, fb); err != nil {
+		return err
+	}
+	reply.Framebuffer = buf.Bytes()
+	return nil
+}
@@ -0,0 +1,132 @@
+package raytracer
+
+import "sort"
+
+// Distribution1D is a piecewise-constant probability distribution over [0, 1) built from a tabulated function.
+// Sampling it with a uniform random number returns values proportionally to the function's magnitude.
+type Distribution1D struct {
+	function []float64
+	cdf      []float64
+	integral float64
+}
+
+// NewDistribution1D returns a distribution whose density is proportional to the passed-in function values.
+// Negative values are treated as their absolute value and an all-zero function falls back to a uniform distribution.
+func NewDistribution1D(function []float64) *Distribution1D {
+	n := len(function)
+	d := &Distribution1D{
+		function: make([]float64, n),
+		cdf:      make([]float64, n+1),
+	}
+	for i, f := range function {
+		if f < 0 {
+			f = -f
+		}
+		d.function[i] = f
+	}
+
+	// integrate the step function: each of the n steps is 1/n wide
+	for i := 1; i <= n; i++ {
+		d.cdf[i] = d.cdf[i-1] + d.function[i-1]/float64(n)
+	}
+	d.integral = d.cdf[n]
+
+	if d.integral == 0 {
+		for i := 1; i <= n; i++ {
+			d.cdf[i] = float64(i) / float64(n)
+		}
+	} else {
+		for i := 1; i <= n; i++ {
+			d.cdf[i] /= d.integral
+		}
+	}
+	return d
+}
+
+// Count returns the number of steps in the distribution
+func (d *Distribution1D) Count() int {
+	return len(d.function)
+}
+
+// Integral returns the integral of the tabulated function over [0, 1)
+func (d *Distribution1D) Integral() float64 {
+	return d.integral
+}
+
+// SampleContinuous maps a uniform random number u in [0, 1) to a value x in [0, 1) distributed according to the
+// function. It also returns the density at x and the index of the step that x falls in.
+func (d *Distribution1D) SampleContinuous(u float64) (x, pdf float64, offset int) {
+	n := d.Count()
+	// find the last cdf entry that is <= u
+	offset = sort.Search(len(d.cdf), func(i int) bool { return d.cdf[i] > u }) - 1
+	if offset < 0 {
+		offset = 0
+	} else if offset > n-1 {
+		offset = n - 1
+	}
+
+	// how far u is between the two cdf entries that bound it
+	du := u - d.cdf[offset]
+	if width := d.cdf[offset+1] - d.cdf[offset]; width > 0 {
+		du /= width
+	}
+
+	pdf = d.Pdf(offset)
+	x = (float64(offset) + du) / float64(n)
+	return x, pdf, offset
+}
+
+// Pdf returns the density of the distribution inside of the step at the passed-in index
+func (d *Distribution1D) Pdf(offset int) float64 {
+	if d.integral == 0 {
+		return 1
+	}
+	return d.function[offset] / d.integral
+}
+
+// Distribution2D is a piecewise-constant probability distribution over [0, 1)^2. It is made up of a marginal
+// distribution that picks a row, and one conditional distribution per row that picks a column within that row.
+type Distribution2D struct {
+	conditional []*Distribution1D
+	marginal    *Distribution1D
+}
+
+// NewDistribution2D returns a distribution that is proportional to a function tabulated as nv rows of nu values
+func NewDistribution2D(function []float64, nu, nv int) *Distribution2D {
+	d := &Distribution2D{conditional: make([]*Distribution1D, nv)}
+	marginalFunction := make([]float64, nv)
+	for v := 0; v < nv; v++ {
+		d.conditional[v] = NewDistribution1D(function[v*nu : (v+1)*nu])
+		marginalFunction[v] = d.conditional[v].Integral()
+	}
+	d.marginal = NewDistribution1D(marginalFunction)
+	return d
+}
+
+// SampleContinuous maps two uniform random numbers to a point (u, v) in [0, 1)^2 and returns the density of
+// that point
+func (d *Distribution2D) SampleContinuous(u0, u1 float64) (u, v, pdf float64) {
+	v, pdfV, row := d.marginal.SampleContinuous(u1)
+	u, pdfU, _ := d.conditional[row].SampleContinuous(u0)
+	return u, v, pdfU * pdfV
+}
+
+// Pdf returns the density of the distribution at the point (u, v)
+func (d *Distribution2D) Pdf(u, v float64) float64 {
+	column := clampIndex(int(u*float64(d.conditional[0].Count())), d.conditional[0].Count())
+	row := clampIndex(int(v*float64(d.marginal.Count())), d.marginal.Count())
+	if d.marginal.Integral() == 0 {
+		return 1
+	}
+	return d.conditional[row].function[column] / d.marginal.Integral()
+}
+
+// clampIndex keeps an index in the range [0, n)
+func clampIndex(i, n int) int {
+	if i < 0 {
+		return 0
+	} else if i >= n {
+		return n - 1
+	}
+	return i
+}
@@ -0,0 +1,67 @@
+package raytracer_test
+
+import (
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistribution1D(t *testing.T) {
+	t.Run("sampling follows the tabulated function", func(t *testing.T) {
+		d := rt.NewDistribution1D([]float64{1, 3})
+		assert.InDelta(t, 2.0, d.Integral(), 1e-9)
+
+		for _, tc := range []struct {
+			desc       string
+			u          float64
+			wantOffset int
+			wantPdf    float64
+		}{
+			{desc: "small u lands in the dim step", u: 0.1, wantOffset: 0, wantPdf: 0.5},
+			{desc: "large u lands in the bright step", u: 0.9, wantOffset: 1, wantPdf: 1.5},
+		} {
+			t.Run(tc.desc, func(t *testing.T) {
+				x, pdf, offset := d.SampleContinuous(tc.u)
+				assert.Equal(t, tc.wantOffset, offset)
+				assert.InDelta(t, tc.wantPdf, pdf, 1e-9)
+				assert.True(t, x >= 0 && x < 1, "sample should be in [0, 1)")
+			})
+		}
+	})
+
+	t.Run("an all zero function is sampled uniformly", func(t *testing.T) {
+		d := rt.NewDistribution1D([]float64{0, 0, 0, 0})
+		x, pdf, offset := d.SampleContinuous(0.6)
+		assert.InDelta(t, 0.6, x, 1e-9)
+		assert.Equal(t, 1.0, pdf)
+		assert.Equal(t, 2, offset)
+	})
+}
+
+func TestDistribution2D(t *testing.T) {
+	t.Run("sampled densities match Pdf", func(t *testing.T) {
+		function := []float64{
+			1, 2, 0, 4,
+			0, 0, 8, 1,
+		}
+		d := rt.NewDistribution2D(function, 4, 2)
+		for _, u := range [][2]float64{{0.1, 0.2}, {0.5, 0.5}, {0.9, 0.95}, {0.3, 0.7}} {
+			x, y, pdf := d.SampleContinuous(u[0], u[1])
+			assert.InDelta(t, d.Pdf(x, y), pdf, 1e-9)
+			assert.NotZero(t, pdf, "zero valued cells should never be sampled")
+		}
+	})
+
+	t.Run("the density integrates to one", func(t *testing.T) {
+		function := []float64{3, 1, 0, 2, 5, 1}
+		d := rt.NewDistribution2D(function, 3, 2)
+		total := 0.0
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 3; x++ {
+				total += d.Pdf((float64(x)+0.5)/3, (float64(y)+0.5)/2) / 6
+			}
+		}
+		assert.InDelta(t, 1.0, total, 1e-9)
+	})
+}
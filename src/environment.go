@@ -0,0 +1,105 @@
+package raytracer
+
+import (
+	"errors"
+	"math"
+)
+
+// EnvironmentLight is an infinitely distant light that surrounds the scene. Its radiance is looked up from an
+// equirectangular (latitude-longitude) image, where the top row of the image is straight up (+Y) and the
+// horizontal axis sweeps once around the Y axis.
+type EnvironmentLight struct {
+	image *HDRImage
+	// rotation is the angle in radians that the map is rotated about the Y axis
+	rotation float64
+	// scale multiplies the radiance of every pixel in the map
+	scale float64
+	// distribution is used to pick directions proportionally to how bright they are
+	distribution *Distribution2D
+}
+
+// NewEnvironmentLight returns an environment light that uses the passed-in equirectangular image. The image is
+// rotated counter-clockwise about the Y axis by rotationDegrees and its radiance is multiplied by scale.
+func NewEnvironmentLight(image *HDRImage, rotationDegrees, scale float64) (*EnvironmentLight, error) {
+	if image == nil || image.Width == 0 || image.Height == 0 {
+		return nil, errors.New("an environment light needs a non-empty image")
+	}
+
+	// Build a sampling distribution over the image from each pixel's luminance. Rows close to the poles cover
+	// less of the sphere than the ones at the equator, so they are weighted by sin(theta).
+	function := make([]float64, image.Width*image.Height)
+	for y := 0; y < image.Height; y++ {
+		sinTheta := math.Sin(math.Pi * (float64(y) + 0.5) / float64(image.Height))
+		for x := 0; x < image.Width; x++ {
+			function[y*image.Width+x] = Luminance(image.At(x, y)) * sinTheta
+		}
+	}
+
+	return &EnvironmentLight{
+		image:        image,
+		rotation:     degreesToRadians(rotationDegrees),
+		scale:        scale,
+		distribution: NewDistribution2D(function, image.Width, image.Height),
+	}, nil
+}
+
+// Radiance returns the light arriving from the environment along the passed-in direction
+func (e *EnvironmentLight) Radiance(direction Vec3) Vec3 {
+	u, v, ok := e.directionToUV(direction)
+	if !ok {
+		return NewVec3(0, 0, 0)
+	}
+	x := clampIndex(int(u*float64(e.image.Width)), e.image.Width)
+	y := clampIndex(int(v*float64(e.image.Height)), e.image.Height)
+	return e.image.At(x, y).MultiplyFloat(e.scale)
+}
+
+// Sample picks a direction towards the environment with a probability proportional to its brightness, using two
+// uniform random numbers. It returns the unit direction, the radiance arriving from it and its solid angle
+// density. A density of 0 means that no direction could be sampled.
+func (e *EnvironmentLight) Sample(u0, u1 float64) (direction, radiance Vec3, pdf float64) {
+	u, v, mapPdf := e.distribution.SampleContinuous(u0, u1)
+	if mapPdf == 0 {
+		return Vec3{}, Vec3{}, 0
+	}
+
+	theta := v * math.Pi
+	phi := u*2*math.Pi + e.rotation
+	sinTheta := math.Sin(theta)
+	if sinTheta == 0 {
+		return Vec3{}, Vec3{}, 0
+	}
+	direction = NewVec3(sinTheta*math.Cos(phi), math.Cos(theta), sinTheta*math.Sin(phi))
+
+	// convert the density over the image to a density over solid angle
+	pdf = mapPdf / (2 * math.Pi * math.Pi * sinTheta)
+	return direction, e.Radiance(direction), pdf
+}
+
+// Pdf returns the solid angle density with which Sample returns the passed-in direction
+func (e *EnvironmentLight) Pdf(direction Vec3) float64 {
+	u, v, ok := e.directionToUV(direction)
+	if !ok {
+		return 0
+	}
+	sinTheta := math.Sin(v * math.Pi)
+	if sinTheta == 0 {
+		return 0
+	}
+	return e.distribution.Pdf(u, v) / (2 * math.Pi * math.Pi * sinTheta)
+}
+
+// directionToUV maps a direction to its [0, 1) coordinates in the equirectangular image
+func (e *EnvironmentLight) directionToUV(direction Vec3) (u, v float64, ok bool) {
+	unit, err := direction.Unit()
+	if err != nil {
+		return 0, 0, false
+	}
+	theta := math.Acos(clamp(unit.Y, -1, 1))
+	phi := math.Atan2(unit.Z, unit.X) - e.rotation
+
+	u = phi / (2 * math.Pi)
+	u -= math.Floor(u)
+	v = theta / math.Pi
+	return u, v, true
+}
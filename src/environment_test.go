@@ -0,0 +1,117 @@
+package raytracer_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodePFM(t *testing.T) {
+	t.Run("little endian color map is flipped to top to bottom order", func(t *testing.T) {
+		var buf bytes.Buffer
+		buf.WriteString("PF\n2 2\n-1.0\n")
+		// bottom row first
+		binary.Write(&buf, binary.LittleEndian, []float32{
+			1, 0, 0, 0, 1, 0,
+			0, 0, 1, 2, 2, 2,
+		})
+
+		img, err := rt.DecodePFM(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, rt.NewVec3(0, 0, 1), img.At(0, 0))
+		assert.Equal(t, rt.NewVec3(2, 2, 2), img.At(1, 0))
+		assert.Equal(t, rt.NewVec3(1, 0, 0), img.At(0, 1))
+	})
+
+	t.Run("greyscale maps fill every channel", func(t *testing.T) {
+		var buf bytes.Buffer
+		buf.WriteString("Pf\n1 1\n1.0\n")
+		binary.Write(&buf, binary.BigEndian, []float32{0.5})
+
+		img, err := rt.DecodePFM(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, rt.NewVec3(0.5, 0.5, 0.5), img.At(0, 0))
+	})
+
+	t.Run("other formats are rejected", func(t *testing.T) {
+		_, err := rt.DecodePFM(bytes.NewBufferString("P3\n1 1\n255\n"))
+		assert.Error(t, err)
+	})
+}
+
+func TestDecodeRadianceHDR(t *testing.T) {
+	t.Run("run-length encoded scanlines", func(t *testing.T) {
+		var buf bytes.Buffer
+		buf.WriteString("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 1 +X 8\n")
+		buf.Write([]byte{2, 2, 0, 8})
+		// red, green and blue are runs of 128, the exponent is a literal run
+		buf.Write([]byte{128 + 8, 128})
+		buf.Write([]byte{128 + 8, 128})
+		buf.Write([]byte{128 + 8, 128})
+		buf.Write([]byte{8, 129, 129, 129, 129, 129, 129, 129, 130})
+
+		img, err := rt.DecodeRadianceHDR(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, 8, img.Width)
+		assert.InDelta(t, 128.5/128, img.At(0, 0).X, 1e-6)
+		assert.InDelta(t, 2*128.5/128, img.At(7, 0).Z, 1e-6)
+	})
+}
+
+func TestEnvironmentLight(t *testing.T) {
+	// a dim map with a single bright pixel just above the horizon
+	img := rt.NewHDRImage(8, 4)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			img.Set(x, y, rt.NewVec3(0.1, 0.1, 0.1))
+		}
+	}
+	img.Set(2, 1, rt.NewVec3(100, 100, 100))
+
+	t.Run("sampled directions agree with Pdf and Radiance", func(t *testing.T) {
+		env, err := rt.NewEnvironmentLight(img, 30, 2)
+		assert.Nil(t, err)
+		for _, u := range [][2]float64{{0.1, 0.4}, {0.27, 0.3}, {0.8, 0.9}} {
+			direction, radiance, pdf := env.Sample(u[0], u[1])
+			assert.InDelta(t, 1.0, direction.Length(), 1e-9)
+			assert.InDelta(t, env.Pdf(direction), pdf, 1e-6*pdf)
+			assert.Equal(t, env.Radiance(direction), radiance)
+		}
+	})
+
+	t.Run("most samples head towards the bright pixel", func(t *testing.T) {
+		env, err := rt.NewEnvironmentLight(img, 0, 1)
+		assert.Nil(t, err)
+		bright := 0
+		for i := 0; i < 100; i++ {
+			_, radiance, _ := env.Sample((float64(i)+0.5)/100, math.Mod(float64(i)*0.618+0.005, 1))
+			if radiance.X > 1 {
+				bright++
+			}
+		}
+		assert.True(t, bright > 90, "only %d of 100 samples hit the bright pixel", bright)
+	})
+
+	t.Run("rotation and scale change the radiance lookup", func(t *testing.T) {
+		env, err := rt.NewEnvironmentLight(img, 0, 1)
+		assert.Nil(t, err)
+		rotated, err := rt.NewEnvironmentLight(img, 90, 3)
+		assert.Nil(t, err)
+
+		direction, radiance, _ := env.Sample(0.3, 0.3)
+		// rotating the map by 90 degrees moves the bright pixel a quarter turn about +Y
+		phi := math.Atan2(direction.Z, direction.X) + math.Pi/2
+		horizontal := math.Hypot(direction.X, direction.Z)
+		turned := rt.NewVec3(horizontal*math.Cos(phi), direction.Y, horizontal*math.Sin(phi))
+		assert.InDelta(t, 3*radiance.X, rotated.Radiance(turned).X, 1e-6)
+	})
+
+	t.Run("an empty image is rejected", func(t *testing.T) {
+		_, err := rt.NewEnvironmentLight(rt.NewHDRImage(0, 0), 0, 1)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,156 @@
+package raytracer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// EXRChannel is one channel of a multi-layer OpenEXR image. Layers are expressed with dotted names, such as
+// "normal.X".
+type EXRChannel struct {
+	Name string
+	// Values holds one value per pixel, row by row from the top of the image
+	Values []float32
+}
+
+// exrMagic starts every OpenEXR file
+var exrMagic = []byte{0x76, 0x2f, 0x31, 0x01}
+
+// WriteEXR writes an uncompressed scanline OpenEXR image with 32-bit float channels
+func WriteEXR(w io.Writer, width, height int, channels []EXRChannel) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+	if len(channels) == 0 {
+		return errors.New("an image needs at least one channel")
+	}
+	for _, c := range channels {
+		if len(c.Values) != width*height {
+			return fmt.Errorf("channel %q has %d values but the image has %d pixels", c.Name, len(c.Values), width*height)
+		}
+	}
+
+	// readers expect the channels to be sorted by name
+	channels = append([]EXRChannel(nil), channels...)
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+
+	var header bytes.Buffer
+	header.Write(exrMagic)
+	// version 2, single part scanline image
+	writeLE(&header, uint32(2))
+
+	var chlist bytes.Buffer
+	for _, c := range channels {
+		chlist.WriteString(c.Name)
+		chlist.WriteByte(0)
+		// pixel type FLOAT, not perceptually linear, three reserved bytes, and no subsampling
+		writeLE(&chlist, int32(2))
+		chlist.Write([]byte{0, 0, 0, 0})
+		writeLE(&chlist, int32(1))
+		writeLE(&chlist, int32(1))
+	}
+	chlist.WriteByte(0)
+	writeEXRAttribute(&header, "channels", "chlist", chlist.Bytes())
+
+	writeEXRAttribute(&header, "compression", "compression", []byte{0})
+	window := exrBox(width, height)
+	writeEXRAttribute(&header, "dataWindow", "box2i", window)
+	writeEXRAttribute(&header, "displayWindow", "box2i", window)
+	writeEXRAttribute(&header, "lineOrder", "lineOrder", []byte{0})
+	writeEXRAttribute(&header, "pixelAspectRatio", "float", float32Bytes(1))
+	writeEXRAttribute(&header, "screenWindowCenter", "v2f", append(float32Bytes(0), float32Bytes(0)...))
+	writeEXRAttribute(&header, "screenWindowWidth", "float", float32Bytes(1))
+	header.WriteByte(0)
+
+	// each scanline is its own block, preceded by its row number and size
+	blockSize := 8 + 4*width*len(channels)
+	tableStart := header.Len()
+	firstBlock := tableStart + 8*height
+	for y := 0; y < height; y++ {
+		writeLE(&header, uint64(firstBlock+y*blockSize))
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	block := bytes.NewBuffer(make([]byte, 0, blockSize))
+	for y := 0; y < height; y++ {
+		block.Reset()
+		writeLE(block, int32(y))
+		writeLE(block, int32(blockSize-8))
+		for _, c := range channels {
+			writeLE(block, c.Values[y*width:(y+1)*width])
+		}
+		if _, err := w.Write(block.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEXRAttribute writes a header attribute: its name, type, size and value
+func writeEXRAttribute(buf *bytes.Buffer, name, kind string, value []byte) {
+	buf.WriteString(name)
+	buf.WriteByte(0)
+	buf.WriteString(kind)
+	buf.WriteByte(0)
+	writeLE(buf, int32(len(value)))
+	buf.Write(value)
+}
+
+// exrBox returns a box2i that covers an image of the passed-in size
+func exrBox(width, height int) []byte {
+	var buf bytes.Buffer
+	writeLE(&buf, []int32{0, 0, int32(width - 1), int32(height - 1)})
+	return buf.Bytes()
+}
+
+func float32Bytes(f float32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, math.Float32bits(f))
+	return b
+}
+
+// writeLE writes fixed size data in little endian order to a buffer, which cannot fail
+func writeLE(buf *bytes.Buffer, data interface{}) {
+	_ = binary.Write(buf, binary.LittleEndian, data)
+}
+
+// WriteFramebufferEXR writes the beauty pass and every auxiliary pass of a framebuffer to one multi-layer
+// OpenEXR image. The beauty pass is stored in the R, G and B channels, and each auxiliary pass becomes a layer
+// named after it.
+func WriteFramebufferEXR(w io.Writer, fb *Framebuffer) error {
+	beauty := fb.Image()
+	channels := imageChannels("", []string{"R", "G", "B"}, beauty.Pixels, 3)
+	for _, aov := range fb.AOVs() {
+		values, err := fb.Pass(aov)
+		if err != nil {
+			return err
+		}
+		pixels := make([]float32, len(values))
+		for i, v := range values {
+			pixels[i] = float32(v)
+		}
+		channels = append(channels, imageChannels(aov.String()+".", aov.Channels(), pixels, len(aov.Channels()))...)
+	}
+	return WriteEXR(w, fb.Width, fb.Height, channels)
+}
+
+// imageChannels splits interleaved pixel values into named channels
+func imageChannels(prefix string, names []string, pixels []float32, stride int) []EXRChannel {
+	channels := make([]EXRChannel, len(names))
+	count := len(pixels) / stride
+	for c, name := range names {
+		values := make([]float32, count)
+		for i := range values {
+			values[i] = pixels[i*stride+c]
+		}
+		channels[c] = EXRChannel{Name: prefix + name, Values: values}
+	}
+	return channels
+}
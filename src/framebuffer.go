@@ -0,0 +1,339 @@
+package raytracer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+)
+
+// AOV is an arbitrary output variable: an auxiliary render pass that records information about the first surface
+// seen through each pixel, for compositing and denoising
+type AOV int
+
+const (
+	// AOVDepth is the distance from the camera to the first hit
+	AOVDepth AOV = iota
+	// AOVNormal is the world space shading normal at the first hit
+	AOVNormal
+	// AOVAlbedo is the surface color at the first hit
+	AOVAlbedo
+	// AOVPosition is the world space position of the first hit
+	AOVPosition
+	// AOVUV is the surface coordinates of the first hit
+	AOVUV
+	// AOVObjectID identifies the object seen through each pixel. 0 is the background.
+	AOVObjectID
+	// AOVMaterialID identifies the material seen through each pixel. 0 is the background.
+	AOVMaterialID
+)
+
+// AllAOVs lists every auxiliary pass
+var AllAOVs = []AOV{AOVDepth, AOVNormal, AOVAlbedo, AOVPosition, AOVUV, AOVObjectID, AOVMaterialID}
+
+var aovNames = map[AOV]string{
+	AOVDepth:      "depth",
+	AOVNormal:     "normal",
+	AOVAlbedo:     "albedo",
+	AOVPosition:   "position",
+	AOVUV:         "uv",
+	AOVObjectID:   "objectID",
+	AOVMaterialID: "materialID",
+}
+
+// String returns the name of the pass
+func (a AOV) String() string {
+	if name, ok := aovNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("AOV(%d)", int(a))
+}
+
+// Channels returns the names of the channels of the pass
+func (a AOV) Channels() []string {
+	switch a {
+	case AOVDepth:
+		return []string{"Z"}
+	case AOVNormal, AOVPosition:
+		return []string{"X", "Y", "Z"}
+	case AOVAlbedo:
+		return []string{"R", "G", "B"}
+	case AOVUV:
+		return []string{"U", "V"}
+	default:
+		return []string{"id"}
+	}
+}
+
+// ParseAOV returns the pass with the passed-in name, ignoring case
+func ParseAOV(name string) (AOV, error) {
+	for aov, n := range aovNames {
+		if strings.EqualFold(n, name) {
+			return aov, nil
+		}
+	}
+	names := make([]string, 0, len(aovNames))
+	for _, aov := range AllAOVs {
+		names = append(names, aov.String())
+	}
+	return 0, fmt.Errorf("unknown render pass %q: expected one of %s", name, strings.Join(names, ", "))
+}
+
+// FirstHit is what a camera ray found at the first surface that it hit
+type FirstHit struct {
+	// Hit is false when the ray escaped the scene, in which case the other fields are unset
+	Hit                  bool
+	Depth                float64
+	Position, Normal     Vec3
+	Albedo               Vec3
+	U, V                 float64
+	ObjectID, MaterialID int
+}
+
+// Framebuffer accumulates the samples of a render. Pixels are stored row by row, starting at the top left of the
+// image.
+type Framebuffer struct {
+	Width, Height int
+	// Seed is the seed of the random numbers used to render the samples
+	Seed int64
+	// Passes is the number of passes rendered into the framebuffer, each of which adds a sample to every pixel
+	Passes int
+	// SampleCount is the number of samples accumulated into each pixel
+	SampleCount []int
+	// color is the sum of the radiance of every sample, three values per pixel
+	color []float64
+	// luminanceSquared is the sum of the squared luminance of every sample, for estimating variance
+	luminanceSquared []float64
+	aovs             map[AOV]*aovBuffer
+}
+
+// aovBuffer accumulates the samples of an auxiliary pass
+type aovBuffer struct {
+	// sum is the sum of every sample's values, or for ID passes the ID of the first sample that hit something
+	sum []float64
+	// hits is the number of samples that hit a surface in each pixel
+	hits []int
+}
+
+// NewFramebuffer returns an empty framebuffer that also records the passed-in auxiliary passes
+func NewFramebuffer(width, height int, aovs []AOV) *Framebuffer {
+	fb := &Framebuffer{
+		Width:            width,
+		Height:           height,
+		SampleCount:      make([]int, width*height),
+		color:            make([]float64, 3*width*height),
+		luminanceSquared: make([]float64, width*height),
+		aovs:             map[AOV]*aovBuffer{},
+	}
+	for _, aov := range aovs {
+		fb.aovs[aov] = &aovBuffer{
+			sum:  make([]float64, len(aov.Channels())*width*height),
+			hits: make([]int, width*height),
+		}
+	}
+	return fb
+}
+
+// AOVs returns the auxiliary passes that the framebuffer records, in a stable order
+func (fb *Framebuffer) AOVs() []AOV {
+	aovs := make([]AOV, 0, len(fb.aovs))
+	for aov := range fb.aovs {
+		aovs = append(aovs, aov)
+	}
+	sort.Slice(aovs, func(i, j int) bool { return aovs[i] < aovs[j] })
+	return aovs
+}
+
+// HasAOV returns whether the framebuffer records the passed-in pass
+func (fb *Framebuffer) HasAOV(aov AOV) bool {
+	_, ok := fb.aovs[aov]
+	return ok
+}
+
+// AddSample adds the radiance of one sample to the pixel at column x and row y
+func (fb *Framebuffer) AddSample(x, y int, color Vec3) {
+	i := y*fb.Width + x
+	fb.SampleCount[i]++
+	fb.color[3*i] += color.X
+	fb.color[3*i+1] += color.Y
+	fb.color[3*i+2] += color.Z
+	luminance := Luminance(color)
+	fb.luminanceSquared[i] += luminance * luminance
+}
+
+// addSplat adds light to the pixel at column x and row y without adding a sample, for light that was traced from
+// the lights and reached the camera through the pixel rather than being sampled through it. It is averaged over the
+// pixel's samples along with their radiance, but is left out of the pixel's variance.
+func (fb *Framebuffer) addSplat(x, y int, color Vec3) {
+	i := y*fb.Width + x
+	fb.color[3*i] += color.X
+	fb.color[3*i+1] += color.Y
+	fb.color[3*i+2] += color.Z
+}
+
+// AddFirstHit adds what one camera ray saw to the auxiliary passes of the pixel at column x and row y
+func (fb *Framebuffer) AddFirstHit(x, y int, hit *FirstHit) {
+	if !hit.Hit {
+		return
+	}
+	i := y*fb.Width + x
+	for aov, buffer := range fb.aovs {
+		channels := len(aov.Channels())
+		values := buffer.sum[channels*i : channels*(i+1)]
+		buffer.hits[i]++
+		switch aov {
+		case AOVDepth:
+			values[0] += hit.Depth
+		case AOVNormal:
+			addVec3(values, hit.Normal)
+		case AOVAlbedo:
+			addVec3(values, hit.Albedo)
+		case AOVPosition:
+			addVec3(values, hit.Position)
+		case AOVUV:
+			values[0] += hit.U
+			values[1] += hit.V
+		case AOVObjectID:
+			// IDs cannot be averaged, so the first sample to hit something decides
+			if buffer.hits[i] == 1 {
+				values[0] = float64(hit.ObjectID)
+			}
+		case AOVMaterialID:
+			if buffer.hits[i] == 1 {
+				values[0] = float64(hit.MaterialID)
+			}
+		}
+	}
+}
+
+// Paste copies the samples of a framebuffer that was rendered for a region of a larger image into place, with the
+// top left pixel of tile at the pixel at. Both framebuffers must record the same auxiliary passes.
+func (fb *Framebuffer) Paste(tile *Framebuffer, at image.Point) error {
+	bounds := image.Rect(at.X, at.Y, at.X+tile.Width, at.Y+tile.Height)
+	if !bounds.In(image.Rect(0, 0, fb.Width, fb.Height)) {
+		return fmt.Errorf("a %dx%d tile at %v does not fit in a %dx%d framebuffer", tile.Width, tile.Height, at, fb.Width, fb.Height)
+	}
+	if len(tile.aovs) != len(fb.aovs) {
+		return errors.New("the tile has different render passes")
+	}
+	for aov := range fb.aovs {
+		if !tile.HasAOV(aov) {
+			return fmt.Errorf("the tile is missing the %s pass", aov)
+		}
+	}
+
+	for y := 0; y < tile.Height; y++ {
+		// copy a row at a time, since rows are contiguous in both framebuffers
+		src := y * tile.Width
+		dst := (at.Y+y)*fb.Width + at.X
+		copy(fb.SampleCount[dst:dst+tile.Width], tile.SampleCount[src:src+tile.Width])
+		copy(fb.color[3*dst:3*(dst+tile.Width)], tile.color[3*src:3*(src+tile.Width)])
+		copy(fb.luminanceSquared[dst:dst+tile.Width], tile.luminanceSquared[src:src+tile.Width])
+		for aov, buffer := range fb.aovs {
+			from := tile.aovs[aov]
+			channels := len(aov.Channels())
+			copy(buffer.sum[channels*dst:channels*(dst+tile.Width)], from.sum[channels*src:channels*(src+tile.Width)])
+			copy(buffer.hits[dst:dst+tile.Width], from.hits[src:src+tile.Width])
+		}
+	}
+	return nil
+}
+
+func addVec3(values []float64, v Vec3) {
+	values[0] += v.X
+	values[1] += v.Y
+	values[2] += v.Z
+}
+
+// Color returns the average radiance of the samples in the pixel at column x and row y
+func (fb *Framebuffer) Color(x, y int) Vec3 {
+	i := y*fb.Width + x
+	if fb.SampleCount[i] == 0 {
+		return NewVec3(0, 0, 0)
+	}
+	scale := 1 / float64(fb.SampleCount[i])
+	return NewVec3(fb.color[3*i]*scale, fb.color[3*i+1]*scale, fb.color[3*i+2]*scale)
+}
+
+// Variance returns the estimated variance of the average luminance of the pixel at column x and row y. It is
+// negative when the pixel has fewer than two samples and its variance is unknown.
+func (fb *Framebuffer) Variance(x, y int) float64 {
+	i := y*fb.Width + x
+	n := float64(fb.SampleCount[i])
+	if n < 2 {
+		return -1
+	}
+	mean := Luminance(fb.Color(x, y))
+	// the unbiased sample variance, divided by n for the variance of the mean
+	sampleVariance := (fb.luminanceSquared[i] - n*mean*mean) / (n - 1)
+	return math.Max(0, sampleVariance) / n
+}
+
+// Image returns the beauty pass as an image of average radiance
+func (fb *Framebuffer) Image() *HDRImage {
+	img := NewHDRImage(fb.Width, fb.Height)
+	for y := 0; y < fb.Height; y++ {
+		for x := 0; x < fb.Width; x++ {
+			img.Set(x, y, fb.Color(x, y))
+		}
+	}
+	return img
+}
+
+// Pass returns the values of an auxiliary pass, with len(aov.Channels()) values per pixel. Depth, normal,
+// position and UV values are averaged over the samples that hit a surface, and pixels that saw only the
+// background have an infinite depth and zero everywhere else. Albedo is averaged over all samples.
+func (fb *Framebuffer) Pass(aov AOV) ([]float64, error) {
+	buffer, ok := fb.aovs[aov]
+	if !ok {
+		return nil, fmt.Errorf("the %s pass was not rendered", aov)
+	}
+
+	channels := len(aov.Channels())
+	values := make([]float64, len(buffer.sum))
+	for i, hits := range buffer.hits {
+		for c := 0; c < channels; c++ {
+			sum := buffer.sum[channels*i+c]
+			switch {
+			case aov == AOVObjectID || aov == AOVMaterialID:
+				values[channels*i+c] = sum
+			case aov == AOVAlbedo:
+				if fb.SampleCount[i] > 0 {
+					values[channels*i+c] = sum / float64(fb.SampleCount[i])
+				}
+			case hits == 0:
+				if aov == AOVDepth {
+					values[channels*i+c] = math.Inf(1)
+				}
+			default:
+				values[channels*i+c] = sum / float64(hits)
+			}
+		}
+	}
+	return values, nil
+}
+
+// PassImage returns an auxiliary pass as an image. Passes with fewer than three channels leave the remaining
+// channels of each pixel at zero, except for single channel passes which are copied into all three.
+func (fb *Framebuffer) PassImage(aov AOV) (*HDRImage, error) {
+	values, err := fb.Pass(aov)
+	if err != nil {
+		return nil, err
+	}
+	channels := len(aov.Channels())
+	img := NewHDRImage(fb.Width, fb.Height)
+	for i := 0; i < fb.Width*fb.Height; i++ {
+		for c := 0; c < 3; c++ {
+			source := c
+			if channels == 1 {
+				source = 0
+			} else if c >= channels {
+				continue
+			}
+			img.Pixels[3*i+c] = float32(values[channels*i+source])
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,240 @@
+package raytracer_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFramebuffer_Pass(t *testing.T) {
+	fb := rt.NewFramebuffer(2, 1, []rt.AOV{rt.AOVDepth, rt.AOVNormal, rt.AOVAlbedo, rt.AOVObjectID})
+	hit := func(depth float64, id int) *rt.FirstHit {
+		return &rt.FirstHit{
+			Hit:      true,
+			Depth:    depth,
+			Position: rt.NewVec3(0, 0, -depth),
+			Normal:   rt.NewVec3(0, 0, 1),
+			Albedo:   rt.NewVec3(1, 0.5, 0),
+			ObjectID: id,
+		}
+	}
+
+	// the left pixel is split between two objects, the right pixel only sees the background
+	fb.AddSample(0, 0, rt.NewVec3(1, 1, 1))
+	fb.AddFirstHit(0, 0, hit(2, 7))
+	fb.AddSample(0, 0, rt.NewVec3(3, 3, 3))
+	fb.AddFirstHit(0, 0, hit(4, 9))
+	fb.AddSample(1, 0, rt.NewVec3(0.5, 0.5, 0.5))
+	fb.AddFirstHit(1, 0, &rt.FirstHit{})
+
+	assert.Equal(t, rt.NewVec3(2, 2, 2), fb.Color(0, 0))
+	assert.Equal(t, []rt.AOV{rt.AOVDepth, rt.AOVNormal, rt.AOVAlbedo, rt.AOVObjectID}, fb.AOVs())
+
+	depth, err := fb.Pass(rt.AOVDepth)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, depth[0])
+	assert.True(t, math.IsInf(depth[1], 1), "the background should be infinitely far away")
+
+	normal, err := fb.Pass(rt.AOVNormal)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{0, 0, 1, 0, 0, 0}, normal)
+
+	albedo, err := fb.Pass(rt.AOVAlbedo)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{1, 0.5, 0}, albedo[:3])
+
+	ids, err := fb.Pass(rt.AOVObjectID)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{7, 0}, ids, "IDs are not averaged")
+
+	_, err = fb.Pass(rt.AOVUV)
+	assert.Error(t, err)
+}
+
+func TestParseAOV(t *testing.T) {
+	for _, aov := range rt.AllAOVs {
+		parsed, err := rt.ParseAOV(aov.String())
+		assert.Nil(t, err)
+		assert.Equal(t, aov, parsed)
+	}
+	parsed, err := rt.ParseAOV("MATERIALID")
+	assert.Nil(t, err)
+	assert.Equal(t, rt.AOVMaterialID, parsed)
+
+	_, err = rt.ParseAOV("motion")
+	assert.Error(t, err)
+}
+
+func TestRender_AOVs(t *testing.T) {
+	// a large sphere fills the middle of the frame
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -3), Radius: 2, ID: 4, Material: rt.NewLambertian(rt.NewVec3(0.2, 0.4, 0.6))})
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+
+	fb, err := rt.Render(context.Background(), &rt.Scene{World: world}, camera, rt.RenderOptions{
+		Width:           9,
+		Height:          5,
+		SamplesPerPixel: 4,
+		MaxDepth:        5,
+		AOVs:            rt.AllAOVs,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, fb.SampleCount[0])
+
+	center := 2*9 + 4
+	depth, _ := fb.Pass(rt.AOVDepth)
+	assert.InDelta(t, 1.1, depth[center], 0.15)
+	ids, _ := fb.Pass(rt.AOVObjectID)
+	assert.Equal(t, 4.0, ids[center])
+	assert.Equal(t, 0.0, ids[0], "the corners see the sky")
+	albedo, _ := fb.Pass(rt.AOVAlbedo)
+	assert.InDelta(t, 0.4, albedo[3*center+1], 1e-9)
+	normal, _ := fb.Pass(rt.AOVNormal)
+	assert.InDelta(t, 1.0, normal[3*center+2], 0.2)
+}
+
+func TestRender_Region(t *testing.T) {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5, ID: 1, Material: rt.NewRoughDielectric(1.5, 0.3, 0.3)})
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, -100.5, -1), Radius: 100, ID: 2})
+	scene := &rt.Scene{World: world}
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+	opts := rt.RenderOptions{Width: 7, Height: 5, SamplesPerPixel: 3, MaxDepth: 8, AOVs: []rt.AOV{rt.AOVDepth}, Seed: 3}
+	whole, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+
+	// render the image as two uneven tiles and put them back together
+	merged := rt.NewFramebuffer(7, 5, opts.AOVs)
+	for _, region := range []image.Rectangle{image.Rect(0, 0, 7, 2), image.Rect(0, 2, 7, 5)} {
+		opts.Region = region
+		tile, err := rt.Render(context.Background(), scene, camera, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, region.Dx(), tile.Width)
+		assert.Equal(t, region.Dy(), tile.Height)
+		assert.Nil(t, merged.Paste(tile, region.Min))
+	}
+	assert.Equal(t, whole.Image().Pixels, merged.Image().Pixels)
+	wantDepth, _ := whole.Pass(rt.AOVDepth)
+	gotDepth, _ := merged.Pass(rt.AOVDepth)
+	assert.Equal(t, wantDepth, gotDepth)
+
+	opts.Region = image.Rect(5, 0, 9, 2)
+	_, err = rt.Render(context.Background(), scene, camera, opts)
+	assert.Error(t, err, "the region must be inside the image")
+	assert.Error(t, merged.Paste(rt.NewFramebuffer(2, 2, opts.AOVs), image.Pt(6, 0)))
+	assert.Error(t, merged.Paste(rt.NewFramebuffer(2, 2, nil), image.Pt(0, 0)))
+}
+
+func TestRender_Cancel(t *testing.T) {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5, ID: 1})
+	scene := &rt.Scene{World: world}
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+
+	// cancel the render once two of its passes are done
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := rt.RenderOptions{Width: 6, Height: 4, SamplesPerPixel: 10, MaxDepth: 4, Seed: 2}
+	opts.OnPass = func(fb *rt.Framebuffer) error {
+		if fb.Passes == 2 {
+			cancel()
+		}
+		return nil
+	}
+	fb, err := rt.Render(ctx, scene, camera, opts)
+	assert.True(t, errors.Is(err, context.Canceled), "the error should say that the render was cancelled")
+	assert.Equal(t, 2, fb.Passes)
+	for _, count := range fb.SampleCount {
+		assert.Equal(t, 2, count)
+	}
+
+	// the partial framebuffer has the same samples as a render that was asked for two passes
+	opts.SamplesPerPixel = 2
+	opts.OnPass = nil
+	want, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, want.Image().Pixels, fb.Image().Pixels)
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	fb, err = rt.Render(expired, scene, camera, opts)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "the error should say that the deadline passed")
+	assert.Equal(t, 0, fb.Passes)
+}
+
+func TestRender_Progress(t *testing.T) {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5, ID: 1})
+	scene := &rt.Scene{World: world}
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+
+	var reports []rt.Progress
+	opts := rt.RenderOptions{Width: 6, Height: 4, SamplesPerPixel: 3, MaxDepth: 4}
+	opts.OnProgress = func(p rt.Progress) { reports = append(reports, p) }
+	_, err = rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 12, len(reports), "there is a report for every row of every pass")
+	for i, p := range reports {
+		assert.Equal(t, i+1, p.TilesDone)
+		assert.Equal(t, 12, p.TotalTiles)
+		assert.Equal(t, int64(6*(i+1)), p.SamplesDone)
+		assert.True(t, p.Rays >= p.SamplesDone, "every sample traces at least one ray")
+	}
+	last := reports[len(reports)-1]
+	assert.Equal(t, int64(6*4*3), last.TotalSamples)
+	assert.Equal(t, 1.0, last.Fraction())
+	assert.Equal(t, time.Duration(0), last.Remaining)
+
+	// a resumed render starts from the samples that were already done
+	opts.SamplesPerPixel = 2
+	opts.OnProgress = nil
+	fb, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+	reports = nil
+	opts.SamplesPerPixel = 3
+	opts.Resume = fb
+	opts.OnProgress = func(p rt.Progress) { reports = append(reports, p) }
+	_, err = rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(reports))
+	assert.Equal(t, int64(6*4*2+6), reports[0].SamplesDone)
+}
+
+func TestWriteFramebufferEXR(t *testing.T) {
+	fb := rt.NewFramebuffer(3, 2, []rt.AOV{rt.AOVDepth, rt.AOVUV})
+	fb.AddSample(0, 0, rt.NewVec3(1, 2, 3))
+
+	var buf bytes.Buffer
+	assert.Nil(t, rt.WriteFramebufferEXR(&buf, fb))
+	data := buf.Bytes()
+
+	assert.Equal(t, []byte{0x76, 0x2f, 0x31, 0x01}, data[:4])
+	for _, channel := range []string{"B\x00", "G\x00", "R\x00", "depth.Z\x00", "uv.U\x00", "uv.V\x00"} {
+		assert.Contains(t, string(data), channel)
+	}
+
+	// the offset table points at each scanline, which holds a float for each of the 6 channels of 3 pixels
+	headerEnd := bytes.Index(data, []byte("screenWindowWidth\x00float\x00")) + len("screenWindowWidth\x00float\x00") + 8 + 1
+	first := binary.LittleEndian.Uint64(data[headerEnd:])
+	second := binary.LittleEndian.Uint64(data[headerEnd+8:])
+	assert.Equal(t, uint64(8+6*3*4), second-first)
+	assert.Equal(t, len(data), int(second)+8+6*3*4)
+
+	// channels are sorted, so B comes first and the red value of the top left pixel is the third channel
+	scanline := data[first+8:]
+	assert.Equal(t, float32(3), math.Float32frombits(binary.LittleEndian.Uint32(scanline[0:])))
+	assert.Equal(t, float32(1), math.Float32frombits(binary.LittleEndian.Uint32(scanline[2*3*4:])))
+}
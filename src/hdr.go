@@ -0,0 +1,287 @@
+package raytracer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// HDRImage is a high dynamic range image that stores linear RGB radiance values as floats.
+// Rows are stored from top to bottom.
+type HDRImage struct {
+	Width, Height int
+	// Pixels holds Width*Height RGB triplets
+	Pixels []float32
+}
+
+// NewHDRImage returns a black HDR image of the given size
+func NewHDRImage(width, height int) *HDRImage {
+	return &HDRImage{
+		Width:  width,
+		Height: height,
+		Pixels: make([]float32, width*height*3),
+	}
+}
+
+// At returns the color of the pixel at column x and row y, where row 0 is the top of the image
+func (img *HDRImage) At(x, y int) Vec3 {
+	i := 3 * (y*img.Width + x)
+	return NewVec3(float64(img.Pixels[i]), float64(img.Pixels[i+1]), float64(img.Pixels[i+2]))
+}
+
+// Set sets the color of the pixel at column x and row y, where row 0 is the top of the image
+func (img *HDRImage) Set(x, y int, color Vec3) {
+	i := 3 * (y*img.Width + x)
+	img.Pixels[i] = float32(color.X)
+	img.Pixels[i+1] = float32(color.Y)
+	img.Pixels[i+2] = float32(color.Z)
+}
+
+// LoadHDRImage reads a Radiance .hdr or a .pfm image from disk, choosing the decoder from the file extension
+func LoadHDRImage(path string) (*HDRImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open image: %s", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hdr", ".pic":
+		return DecodeRadianceHDR(f)
+	case ".pfm":
+		return DecodePFM(f)
+	default:
+		return nil, fmt.Errorf("unsupported high dynamic range image format: %q", filepath.Ext(path))
+	}
+}
+
+// DecodeRadianceHDR decodes an image in the Radiance RGBE format, supporting both flat and run-length encoded
+// scanlines
+func DecodeRadianceHDR(r io.Reader) (*HDRImage, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("could not read header: %s", err)
+	}
+	if !strings.HasPrefix(magic, "#?") {
+		return nil, errors.New("not a radiance hdr image")
+	}
+
+	// the header is a list of variables terminated by an empty line
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("could not read header: %s", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("unsupported pixel format: %q", line)
+		}
+	}
+
+	// only the standard orientation of top to bottom, left to right is supported
+	resolution, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("could not read resolution: %s", err)
+	}
+	var width, height int
+	if _, err := fmt.Sscanf(resolution, "-Y %d +X %d", &height, &width); err != nil {
+		return nil, fmt.Errorf("unsupported resolution line %q: %s", strings.TrimSpace(resolution), err)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+
+	img := NewHDRImage(width, height)
+	scanline := make([]byte, 4*width)
+	for y := 0; y < height; y++ {
+		if err := readRGBEScanline(br, scanline, width); err != nil {
+			return nil, fmt.Errorf("could not read scanline %d: %s", y, err)
+		}
+		for x := 0; x < width; x++ {
+			rgbe := scanline[4*x : 4*x+4]
+			img.Set(x, y, rgbeToVec3(rgbe))
+		}
+	}
+	return img, nil
+}
+
+// readRGBEScanline reads one scanline of RGBE pixels into the passed-in buffer
+func readRGBEScanline(br *bufio.Reader, scanline []byte, width int) error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return err
+	}
+
+	// new-style run-length encoding starts with two 2 bytes followed by the scanline width
+	isRLE := width >= 8 && width < 0x8000 && header[0] == 2 && header[1] == 2 && header[2]&0x80 == 0
+	if !isRLE {
+		copy(scanline, header)
+		_, err := io.ReadFull(br, scanline[4:])
+		return err
+	}
+	if int(header[2])<<8|int(header[3]) != width {
+		return errors.New("scanline width does not match image width")
+	}
+
+	// each of the four components is stored one after the other, with its own runs
+	for component := 0; component < 4; component++ {
+		for x := 0; x < width; {
+			count, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				// a run of the same value
+				run := int(count) - 128
+				if x+run > width {
+					return errors.New("run-length encoded run overflows scanline")
+				}
+				value, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				for ; run > 0; run-- {
+					scanline[4*x+component] = value
+					x++
+				}
+				continue
+			}
+			// a run of distinct values
+			run := int(count)
+			if run == 0 || x+run > width {
+				return errors.New("invalid run-length encoded run")
+			}
+			for ; run > 0; run-- {
+				value, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				scanline[4*x+component] = value
+				x++
+			}
+		}
+	}
+	return nil
+}
+
+// rgbeToVec3 converts a pixel with a shared exponent into linear floating point values
+func rgbeToVec3(rgbe []byte) Vec3 {
+	if rgbe[3] == 0 {
+		return NewVec3(0, 0, 0)
+	}
+	scale := math.Ldexp(1, int(rgbe[3])-(128+8))
+	return NewVec3(
+		(float64(rgbe[0])+0.5)*scale,
+		(float64(rgbe[1])+0.5)*scale,
+		(float64(rgbe[2])+0.5)*scale,
+	)
+}
+
+// DecodePFM decodes an image in the portable float map format. Both color (PF) and greyscale (Pf) maps are
+// supported, and greyscale values are copied into all three channels.
+func DecodePFM(r io.Reader) (*HDRImage, error) {
+	br := bufio.NewReader(r)
+
+	tokens := make([]string, 0, 4)
+	for len(tokens) < 4 {
+		token, err := readPFMToken(br)
+		if err != nil {
+			return nil, fmt.Errorf("could not read header: %s", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	var channels int
+	switch tokens[0] {
+	case "PF":
+		channels = 3
+	case "Pf":
+		channels = 1
+	default:
+		return nil, errors.New("not a portable float map")
+	}
+	width, err := strconv.Atoi(tokens[1])
+	if err != nil || width <= 0 {
+		return nil, fmt.Errorf("invalid width %q", tokens[1])
+	}
+	height, err := strconv.Atoi(tokens[2])
+	if err != nil || height <= 0 {
+		return nil, fmt.Errorf("invalid height %q", tokens[2])
+	}
+	scale, err := strconv.ParseFloat(tokens[3], 64)
+	if err != nil || scale == 0 {
+		return nil, fmt.Errorf("invalid scale %q", tokens[3])
+	}
+
+	// a negative scale marks little endian data
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	img := NewHDRImage(width, height)
+	row := make([]float32, width*channels)
+	// rows are stored from the bottom of the image to the top
+	for y := height - 1; y >= 0; y-- {
+		if err := binary.Read(br, order, row); err != nil {
+			return nil, fmt.Errorf("could not read pixel data: %s", err)
+		}
+		for x := 0; x < width; x++ {
+			i := 3 * (y*width + x)
+			if channels == 1 {
+				img.Pixels[i], img.Pixels[i+1], img.Pixels[i+2] = row[x], row[x], row[x]
+			} else {
+				copy(img.Pixels[i:i+3], row[3*x:3*x+3])
+			}
+		}
+	}
+	return img, nil
+}
+
+// readPFMToken reads a whitespace-separated header token. The whitespace after the last token is a single
+// character so that binary data starting with a whitespace byte is not consumed.
+func readPFMToken(br *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		isSpace := c == ' ' || c == '\n' || c == '\r' || c == '\t'
+		if isSpace {
+			if sb.Len() > 0 {
+				return sb.String(), nil
+			}
+			continue
+		}
+		sb.WriteByte(c)
+	}
+}
+
+// EncodePFM writes an image in the color portable float map format, with little endian values
+func EncodePFM(w io.Writer, img *HDRImage) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", img.Width, img.Height); err != nil {
+		return err
+	}
+	// rows are stored from the bottom of the image to the top
+	for y := img.Height - 1; y >= 0; y-- {
+		row := img.Pixels[3*y*img.Width : 3*(y+1)*img.Width]
+		if err := binary.Write(bw, binary.LittleEndian, row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -6,23 +6,40 @@ import (
 
 // HitRecord is a struct that stores information relevant to a ray hitting a Hittable
 type HitRecord struct {
-	P, Normal *Vec3
-	T         float64
+	// P is the hit point and Normal is the shading normal. Normal always faces against the incoming ray.
+	P, Normal Vec3
+	// GeometricNormal is the true normal of the surface, on the same side as Normal. It only differs from Normal
+	// when a bump or normal map has perturbed the shading normal.
+	GeometricNormal Vec3
+	// Tangent and Bitangent are the partial derivatives of P with respect to U and V. They are zero if the
+	// surface does not have a parameterization.
+	Tangent, Bitangent Vec3
+	T                  float64
+	// U and V are the surface coordinates of the hit point, used to look up textures
+	U, V      float64
 	FrontFace bool
+	// Material is the material of the surface that was hit
+	Material Material
+	// ObjectID identifies the object that was hit in the object ID pass
+	ObjectID int
 }
 
 // SetFaceNormal sets whether the surface normal should face outwards or inwards
-func (hr *HitRecord) SetFaceNormal(ray *Ray, outwardNormal *Vec3) {
-	if ray.Direction().Dot(outwardNormal) < 0 {
+func (hr *HitRecord) SetFaceNormal(ray Ray, outwardNormal Vec3) {
+	hr.FrontFace = ray.Direction().Dot(outwardNormal) < 0
+	if hr.FrontFace {
 		hr.Normal = outwardNormal
 	} else {
 		hr.Normal = outwardNormal.MultiplyFloat(-1.0)
 	}
+	hr.GeometricNormal = hr.Normal
 }
 
 // Hittable is an interface that types will interface if they are able to be hit by a ray
 type Hittable interface {
-	Hit(ray *Ray, tMin, tMax float64) (*HitRecord, bool, error)
+	// Hit returns whether the ray hits the object between tMin and tMax. On a hit, it fills in hitRecord, which
+	// the caller owns. On a miss, hitRecord is left as it was.
+	Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool
 }
 
 // HittableList is a list of hittable objects
@@ -41,22 +58,27 @@ func (hl *HittableList) Add(obj Hittable) {
 }
 
 // Hit determines whether the input ray intersects anything
-func (hl *HittableList) Hit(ray *Ray, tMin, tMax float64) (*HitRecord, bool, error) {
-	hitRecord := &HitRecord{}
+func (hl *HittableList) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
 	hitAnything := false
 	closestSoFar := tMax
 
 	for _, object := range hl.Objects {
-		tmpRecord, didHit, err := object.Hit(ray, tMin, closestSoFar)
-		if err != nil {
-			return nil, false, fmt.Errorf("could not determine if object was hit: %s", err)
-		}
-		if didHit {
+		// objects only fill in the record when they are hit closer than everything before them
+		if object.Hit(ray, tMin, closestSoFar, hitRecord) {
 			hitAnything = true
-			closestSoFar = tmpRecord.T
-			hitRecord = tmpRecord
+			closestSoFar = hitRecord.T
 		}
 	}
 
-	return hitRecord, hitAnything, nil
+	return hitAnything
+}
+
+// Validate returns an error if any object in the list cannot be traced
+func (hl *HittableList) Validate() error {
+	for i, object := range hl.Objects {
+		if err := validate(object); err != nil {
+			return fmt.Errorf("invalid object %d: %w", i, err)
+		}
+	}
+	return nil
 }
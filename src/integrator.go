@@ -0,0 +1,388 @@
+package raytracer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+// Integrator computes the light that travels back along a camera ray, which is the light transport algorithm of a
+// render
+type Integrator interface {
+	// Radiance returns the light that arrives at the ray's origin from along the ray, drawing random numbers from
+	// rng. hitRecord is scratch space for intersections, which the caller owns so that tracing does not allocate.
+	// Its contents are overwritten. The ray must have a direction, which every ray from a validated camera does.
+	Radiance(ray Ray, scene *Scene, rng *rand.Rand, hitRecord *HitRecord) Vec3
+}
+
+// lightTracer is implemented by integrators that also trace light from the lights, which needs to be set up for the
+// whole render rather than for each ray, and can reach the camera on any pixel of the image rather than just the
+// one being sampled
+type lightTracer interface {
+	// begin returns the function that Render calls in place of Radiance for every sample of a render of the scene.
+	// The function may add the light that it traces to the camera to film as it goes.
+	begin(scene *Scene, film *film) func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3
+}
+
+// tracerCache holds the function that a lightTracer's Radiance uses for the scene it was last called with, since
+// setting the tracer up again for every ray would be far too slow
+type tracerCache struct {
+	mu       sync.Mutex
+	scene    *Scene
+	radiance func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3
+}
+
+// get returns the cached function for the scene, calling begin to make one if the scene has changed
+func (c *tracerCache) get(scene *Scene, begin func() func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3) func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.scene != scene || c.radiance == nil {
+		c.scene = scene
+		c.radiance = begin()
+	}
+	return c.radiance
+}
+
+// DefaultRouletteDepth is the number of bounces after which Russian roulette starts, unless a PathIntegrator says
+// otherwise
+const DefaultRouletteDepth = 3
+
+// PathIntegrator is a unidirectional path tracer. It follows each ray as it bounces around the scene, gathering the
+// light from the lights and the environment at every bounce.
+type PathIntegrator struct {
+	// MaxDepth is the maximum number of times that a path may bounce
+	MaxDepth int
+	// MaxDiffuse, MaxSpecular and MaxTransmission cap the number of bounces of each kind along a path, on top of
+	// MaxDepth. 0 leaves the kind of bounce capped by MaxDepth alone. Specular bounces reflect like a perfect mirror,
+	// transmission bounces pass through the surface, and diffuse bounces are every other reflection, including
+	// glossy ones.
+	MaxDiffuse, MaxSpecular, MaxTransmission int
+	// RouletteDepth is the number of bounces after which paths that carry little light are randomly ended, with
+	// the paths that survive weighted up to make up for them. 0 uses DefaultRouletteDepth, and a negative depth
+	// never ends paths early.
+	RouletteDepth int
+}
+
+// bounceKind is the kind of a bounce that is capped by a PathIntegrator
+type bounceKind int
+
+const (
+	diffuseBounce bounceKind = iota
+	specularBounce
+	transmissionBounce
+)
+
+// Radiance follows the path of the ray in a loop that carries its throughput, the fraction of the light at the
+// current bounce that reaches the camera
+func (p *PathIntegrator) Radiance(r Ray, scene *Scene, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	rouletteDepth := p.RouletteDepth
+	if rouletteDepth == 0 {
+		rouletteDepth = DefaultRouletteDepth
+	}
+	caps := [...]int{diffuseBounce: p.MaxDiffuse, specularBounce: p.MaxSpecular, transmissionBounce: p.MaxTransmission}
+	var bounces [len(caps)]int
+
+	radiance := Vec3{}
+	throughput := NewVec3(1, 1, 1)
+	// scatterPdf is the solid angle density with which the previous bounce picked the ray's direction, or 0 if the
+	// ray was not scattered off of a surface or was scattered specularly
+	scatterPdf := 0.0
+	for depth := 0; depth < p.MaxDepth; depth++ {
+		if !scene.World.Hit(r, 0.001, math.Inf(1), hitRecord) {
+			return radiance.AddVector(throughput.MultiplyVector(r.background(scene, scatterPdf)))
+		}
+
+		// The direction that the material scatters the ray in is picked first, since gathering the light that
+		// arrives straight from the lights and the environment traces shadow rays that reuse the hit record.
+		scatter, didScatter := hitRecord.Material.Scatter(r, hitRecord, rng)
+		kind := scatter.kind(hitRecord)
+		direct := r.directLight(scene, hitRecord, rng)
+		radiance = radiance.AddVector(throughput.MultiplyVector(direct))
+		if !didScatter {
+			return radiance
+		}
+		bounces[kind]++
+		if caps[kind] > 0 && bounces[kind] > caps[kind] {
+			return radiance
+		}
+
+		throughput = throughput.MultiplyVector(scatter.Attenuation)
+		if rouletteDepth > 0 && depth+1 >= rouletteDepth {
+			survival := math.Min(throughput.MaxComponent(), 1)
+			if rng.Float64() >= survival {
+				return radiance
+			}
+			throughput = throughput.MultiplyFloat(1 / survival)
+		}
+
+		scatterPdf = scatter.Pdf
+		if scatter.IsSpecular {
+			scatterPdf = 0
+		}
+		r = scatter.Ray
+	}
+	return radiance
+}
+
+// kind returns the kind of bounce that the scattered ray makes off of the surface that hitRecord describes
+func (s ScatterRecord) kind(hitRecord *HitRecord) bounceKind {
+	// the geometric normal faces the incoming ray, so rays that pass through the surface head away from it
+	if s.Ray.Direction().Dot(hitRecord.GeometricNormal) < 0 {
+		return transmissionBounce
+	}
+	if s.IsSpecular {
+		return specularBounce
+	}
+	return diffuseBounce
+}
+
+// WhittedIntegrator is a fast integrator for previews. It follows rays through mirrors and glass, like a path
+// tracer, but stops at the first rough surface and lights it with shadow rays instead of bouncing on.
+type WhittedIntegrator struct {
+	// MaxDepth is the maximum number of mirror and glass surfaces that a ray may pass through
+	MaxDepth int
+}
+
+// Radiance follows the ray through specular surfaces, and returns the direct light at the first rough one
+func (w *WhittedIntegrator) Radiance(r Ray, scene *Scene, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	throughput := NewVec3(1, 1, 1)
+	for depth := 0; depth < w.MaxDepth; depth++ {
+		if !scene.World.Hit(r, 0.001, math.Inf(1), hitRecord) {
+			return throughput.MultiplyVector(r.background(scene, 0))
+		}
+		scatter, didScatter := hitRecord.Material.Scatter(r, hitRecord, rng)
+		if didScatter && scatter.IsSpecular {
+			throughput = throughput.MultiplyVector(scatter.Attenuation)
+			r = scatter.Ray
+			continue
+		}
+		return throughput.MultiplyVector(r.shadowedLight(scene, hitRecord, rng))
+	}
+	return Vec3{}
+}
+
+// shadowedLight returns the light reflected at a hit point from a shadow ray towards each light, and one more
+// towards the environment. With an environment map, that shadow ray samples the map. Otherwise it heads straight
+// out along the normal, and a visible sky lights the surface's albedo. The environment's shadow ray overwrites the
+// hit record.
+func (r Ray) shadowedLight(scene *Scene, hitRecord *HitRecord, rng *rand.Rand) Vec3 {
+	wo, _ := r.Direction().Unit()
+	lights := scene.sampleLights(scene.Lights, wo.Negate(), hitRecord, rng)
+	return lights.AddVector(r.shadowedEnvironmentLight(scene, hitRecord, rng))
+}
+
+// shadowedEnvironmentLight returns the light reflected at a hit point from the environment's shadow ray
+func (r Ray) shadowedEnvironmentLight(scene *Scene, hitRecord *HitRecord, rng *rand.Rand) Vec3 {
+	if scene.Environment != nil {
+		direction, radiance, lightPdf := scene.Environment.Sample(rng.Float64(), rng.Float64())
+		if lightPdf == 0 {
+			return Vec3{}
+		}
+		wo, _ := r.Direction().Unit()
+		bsdf, _ := hitRecord.Material.Evaluate(wo.Negate(), direction, hitRecord)
+		if bsdf.IsZero() || scene.World.Hit(NewRay(hitRecord.P, direction), 0.001, math.Inf(1), hitRecord) {
+			return Vec3{}
+		}
+		return radiance.MultiplyVector(bsdf).MultiplyFloat(1 / lightPdf)
+	}
+
+	albedo := materialAlbedo(hitRecord.Material, hitRecord)
+	shadow := NewRay(hitRecord.P, hitRecord.Normal)
+	if scene.World.Hit(shadow, 0.001, math.Inf(1), hitRecord) {
+		return Vec3{}
+	}
+	return albedo.MultiplyVector(shadow.linearBlueGradient())
+}
+
+// AmbientOcclusionIntegrator shades surfaces by how much of the sky around them is not blocked by nearby objects,
+// from white where nothing is in the way to black in creases. Materials and lights are ignored.
+type AmbientOcclusionIntegrator struct {
+	// Samples is the number of rays traced around each hit point. 0 traces one.
+	Samples int
+	// Distance is how far away objects still block the sky. 0 counts objects at any distance.
+	Distance float64
+}
+
+// Radiance returns the fraction of cosine-weighted rays around the first hit that escape, or white if the ray
+// misses everything
+func (a *AmbientOcclusionIntegrator) Radiance(r Ray, scene *Scene, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	if !scene.World.Hit(r, 0.001, math.Inf(1), hitRecord) {
+		return NewVec3(1, 1, 1)
+	}
+	samples := a.Samples
+	if samples <= 0 {
+		samples = 1
+	}
+	distance := a.Distance
+	if distance <= 0 {
+		distance = math.Inf(1)
+	}
+
+	// the occlusion rays overwrite the hit record
+	p, frame := hitRecord.P, NewONB(hitRecord.Normal)
+	open := 0
+	for i := 0; i < samples; i++ {
+		direction := frame.ToWorld(cosineSampleHemisphere(randomPair(rng)))
+		if !scene.World.Hit(NewRay(p, direction), 0.001, distance, hitRecord) {
+			open++
+		}
+	}
+	visibility := float64(open) / float64(samples)
+	return NewVec3(visibility, visibility, visibility)
+}
+
+// DebugMode is what a DebugIntegrator shows
+type DebugMode int
+
+const (
+	// DebugNormal shows the world space shading normal, mapped from -1 to 1 onto 0 to 1
+	DebugNormal DebugMode = iota
+	// DebugUV shows the surface coordinates in the red and green channels
+	DebugUV
+	// DebugDepth shows the distance to the first hit, from white up close to black at the integrator's Scale
+	DebugDepth
+	// DebugFacingRatio shows how directly surfaces face the camera, from white when head on to black when edge on
+	DebugFacingRatio
+	// DebugBVHCost shows the number of bounding boxes and objects that the ray was tested against, as a heat map
+	// from blue to red at the integrator's Scale
+	DebugBVHCost
+)
+
+var debugModeNames = map[DebugMode]string{
+	DebugNormal:      "normal",
+	DebugUV:          "uv",
+	DebugDepth:       "depth",
+	DebugFacingRatio: "facing",
+	DebugBVHCost:     "bvh",
+}
+
+// String returns the name of the mode
+func (m DebugMode) String() string {
+	if name, ok := debugModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("DebugMode(%d)", int(m))
+}
+
+// ParseDebugMode returns the mode with the passed-in name, ignoring case
+func ParseDebugMode(name string) (DebugMode, error) {
+	for mode, n := range debugModeNames {
+		if strings.EqualFold(n, name) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown debug mode %q: expected normal, uv, depth, facing or bvh", name)
+}
+
+// DebugIntegrator shows a property of the first surface that each ray hits, for finding problems with scenes
+type DebugIntegrator struct {
+	Mode DebugMode
+	// Scale is the depth that is shown as black by DebugDepth, 10 by default, and the number of tests that is shown
+	// as red by DebugBVHCost, 100 by default
+	Scale float64
+}
+
+// Radiance returns the color that shows the debugged property of the first hit, or black if the ray misses
+func (d *DebugIntegrator) Radiance(r Ray, scene *Scene, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	if d.Mode == DebugBVHCost {
+		_, cost := traversalCost(scene.World, r, 0.001, math.Inf(1), hitRecord)
+		return heatMap(float64(cost) / d.scale(100))
+	}
+	if !scene.World.Hit(r, 0.001, math.Inf(1), hitRecord) {
+		return Vec3{}
+	}
+
+	switch d.Mode {
+	case DebugNormal:
+		normal := hitRecord.Normal
+		if !hitRecord.FrontFace {
+			normal = normal.Negate()
+		}
+		return normal.AddVector(NewVec3(1, 1, 1)).MultiplyFloat(0.5)
+	case DebugUV:
+		return NewVec3(hitRecord.U, hitRecord.V, 0)
+	case DebugDepth:
+		depth := hitRecord.T * r.Direction().Length()
+		gray := math.Max(0, 1-depth/d.scale(10))
+		return NewVec3(gray, gray, gray)
+	case DebugFacingRatio:
+		wo, _ := r.Direction().Unit()
+		facing := math.Abs(wo.Dot(hitRecord.Normal))
+		return NewVec3(facing, facing, facing)
+	default:
+		return Vec3{}
+	}
+}
+
+// scale returns the scale of the integrator, or the passed-in default if it is not set
+func (d *DebugIntegrator) scale(defaultScale float64) float64 {
+	if d.Scale <= 0 {
+		return defaultScale
+	}
+	return d.Scale
+}
+
+// heatMap returns a color that goes from blue at 0 through green at 0.5 to red at 1 and above
+func heatMap(t float64) Vec3 {
+	t = math.Max(0, math.Min(t, 1))
+	if t < 0.5 {
+		return NewVec3(0, 2*t, 1-2*t)
+	}
+	return NewVec3(2*t-1, 2-2*t, 0)
+}
+
+// costCounter is implemented by objects that can count the tests that a ray makes while it is traced through them
+type costCounter interface {
+	// hitCost returns whether the ray hits the object like Hit does, along with the number of bounding boxes and
+	// objects that the ray was tested against
+	hitCost(ray Ray, tMin, tMax float64, hitRecord *HitRecord) (bool, int)
+}
+
+// traversalCost returns whether the ray hits the object, along with the number of bounding boxes and objects that
+// the ray was tested against. Objects that cannot count their tests count as one.
+func traversalCost(object Hittable, ray Ray, tMin, tMax float64, hitRecord *HitRecord) (bool, int) {
+	if counter, ok := object.(costCounter); ok {
+		return counter.hitCost(ray, tMin, tMax, hitRecord)
+	}
+	return object.Hit(ray, tMin, tMax, hitRecord), 1
+}
+
+// hitCost tests the ray against the box, and then against the children it might hit
+func (b *BVH) hitCost(ray Ray, tMin, tMax float64, hitRecord *HitRecord) (bool, int) {
+	cost := 1
+	if !b.box.Hit(ray, tMin, tMax) {
+		return false, cost
+	}
+	didHit, leftCost := traversalCost(b.left, ray, tMin, tMax, hitRecord)
+	cost += leftCost
+	if b.right == nil {
+		return didHit, cost
+	}
+	if didHit {
+		tMax = hitRecord.T
+	}
+	hitRight, rightCost := traversalCost(b.right, ray, tMin, tMax, hitRecord)
+	return hitRight || didHit, cost + rightCost
+}
+
+// hitCost tests the ray against every object in the list
+func (hl *HittableList) hitCost(ray Ray, tMin, tMax float64, hitRecord *HitRecord) (bool, int) {
+	hitAnything, cost := false, 0
+	for _, object := range hl.Objects {
+		didHit, objectCost := traversalCost(object, ray, tMin, tMax, hitRecord)
+		cost += objectCost
+		if didHit {
+			hitAnything = true
+			tMax = hitRecord.T
+		}
+	}
+	return hitAnything, cost
+}
+
+// hitCost counts the ray and tests it against the world
+func (w *countingWorld) hitCost(ray Ray, tMin, tMax float64, hitRecord *HitRecord) (bool, int) {
+	w.rays++
+	return traversalCost(w.Hittable, ray, tMin, tMax, hitRecord)
+}
@@ -0,0 +1,305 @@
+package raytracer_test
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+// benchmarkScene returns a scene of spheres made of every kind of material, along with a disk, a torus and a CSG,
+// lit by an environment map
+func benchmarkScene(t testing.TB) *rt.Scene {
+	gold, err := rt.NewConductorPreset("gold", 0.2, 0.2)
+	assert.Nil(t, err)
+	plastic := rt.NewPrincipledBSDF()
+	plastic.BaseColor = rt.NewSolidColor(rt.NewVec3(0.7, 0.1, 0.1))
+	plastic.Clearcoat = rt.NewConstantTexture(1)
+	materials := []rt.Material{
+		rt.NewLambertian(rt.NewVec3(0.5, 0.5, 0.5)),
+		gold,
+		rt.NewRoughDielectric(1.5, 0, 0),
+		plastic,
+	}
+
+	var objects []rt.Hittable
+	ground := rt.NewSphere(rt.NewVec3(0, -1000, 0), 999.5)
+	ground.Material = materials[0]
+	objects = append(objects, ground)
+	for i := 0; i < 16; i++ {
+		sphere := rt.NewSphere(rt.NewVec3(float64(i%4)-1.5, 0, -1-float64(i/4)), 0.4)
+		sphere.Material = materials[i%len(materials)]
+		objects = append(objects, sphere)
+	}
+	disk := &rt.Disk{Center: rt.NewVec3(-1, 1.2, -2), Radius: 0.4, InnerRadius: 0.1, Material: materials[1]}
+	torus := &rt.Torus{Center: rt.NewVec3(0, 1.2, -2), MajorRadius: 0.3, MinorRadius: 0.1, Material: materials[3]}
+	bitten, err := rt.NewCSG(rt.CSGDifference, rt.NewSphere(rt.NewVec3(1, 1.2, -2), 0.3), &rt.Cylinder{Center: rt.NewVec3(1, 0.9, -2), Radius: 0.15, Height: 0.6, Capped: true})
+	assert.Nil(t, err)
+	objects = append(objects, disk, torus, bitten)
+	bvh, err := rt.NewBVH(objects)
+	assert.Nil(t, err)
+
+	img := rt.NewHDRImage(16, 8)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			img.Set(x, y, rt.NewVec3(1, 1, float64(y+1)))
+		}
+	}
+	environment, err := rt.NewEnvironmentLight(img, 0, 1)
+	assert.Nil(t, err)
+	return &rt.Scene{World: bvh, Environment: environment}
+}
+
+// countingWorld counts the rays traced against a world
+type countingWorld struct {
+	rt.Hittable
+	rays int
+}
+
+func (w *countingWorld) Hit(ray rt.Ray, tMin, tMax float64, hitRecord *rt.HitRecord) bool {
+	w.rays++
+	return w.Hittable.Hit(ray, tMin, tMax, hitRecord)
+}
+
+// furnaceScene returns a grey sphere inside of a grey tube that is open at both ends, lit evenly from every
+// direction, where paths bounce many times before they escape
+func furnaceScene(t *testing.T) (*rt.Scene, *countingWorld) {
+	grey := rt.NewLambertian(rt.NewVec3(0.8, 0.8, 0.8))
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5, Material: grey})
+	world.Add(&rt.Cylinder{Center: rt.NewVec3(0, -1, -1), Radius: 1, Height: 2, Material: grey})
+	img := rt.NewHDRImage(4, 2)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			img.Set(x, y, rt.NewVec3(1, 1, 1))
+		}
+	}
+	environment, err := rt.NewEnvironmentLight(img, 0, 1)
+	assert.Nil(t, err)
+	counter := &countingWorld{Hittable: world}
+	return &rt.Scene{World: counter, Environment: environment}, counter
+}
+
+func TestPathIntegrator_RussianRoulette(t *testing.T) {
+	scene, counter := furnaceScene(t)
+	ray := rt.NewRay(rt.NewVec3(0, 0.9, -1), rt.NewVec3(1, -0.5, 0.2))
+	mean := func(integrator *rt.PathIntegrator) (float64, int) {
+		rng := rand.New(rand.NewSource(7))
+		var hitRecord rt.HitRecord
+		counter.rays = 0
+		sum := 0.0
+		const samples = 40000
+		for i := 0; i < samples; i++ {
+			sum += integrator.Radiance(ray, scene, rng, &hitRecord).Y
+		}
+		return sum / samples, counter.rays
+	}
+
+	always, alwaysRays := mean(&rt.PathIntegrator{MaxDepth: 50, RouletteDepth: -1})
+	roulette, rouletteRays := mean(&rt.PathIntegrator{MaxDepth: 50, RouletteDepth: 1})
+	assert.InDelta(t, always, roulette, 0.02*always, "roulette should not change the average")
+	assert.True(t, rouletteRays < alwaysRays*3/4, "roulette should trace fewer rays, but traced %d instead of %d", rouletteRays, alwaysRays)
+
+	capped, _ := mean(&rt.PathIntegrator{MaxDepth: 50, MaxDiffuse: 1, RouletteDepth: -1})
+	assert.True(t, capped < always*0.9, "one diffuse bounce should miss the light of the others")
+}
+
+func TestPathIntegrator_TransmissionCap(t *testing.T) {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -2), Radius: 0.5, Material: rt.NewRoughDielectric(1.5, 0, 0)})
+	scene := &rt.Scene{World: world}
+	ray := rt.NewRay(rt.NewVec3(0, 0, 0), rt.NewVec3(0, 0, -1))
+	rng := rand.New(rand.NewSource(1))
+	var hitRecord rt.HitRecord
+
+	through, blocked := 0.0, 0.0
+	for i := 0; i < 200; i++ {
+		through += (&rt.PathIntegrator{MaxDepth: 50}).Radiance(ray, scene, rng, &hitRecord).Y
+		blocked += (&rt.PathIntegrator{MaxDepth: 50, MaxTransmission: 1}).Radiance(ray, scene, rng, &hitRecord).Y
+	}
+	// the light through the middle of a glass ball has to pass through two surfaces
+	assert.True(t, through > 100, "glass should let the sky through, but got %v", through/200)
+	assert.True(t, blocked < through/5, "one transmission should not get through glass, but got %v", blocked/200)
+}
+
+func TestPathIntegrator_Allocations(t *testing.T) {
+	scene := benchmarkScene(t)
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 1))
+	assert.Nil(t, err)
+	integrator := &rt.PathIntegrator{MaxDepth: 50}
+	rng := rand.New(rand.NewSource(1))
+	var hitRecord rt.HitRecord
+	allocations := testing.AllocsPerRun(100, func() {
+		integrator.Radiance(camera.GetRay(rng.Float64(), rng.Float64()), scene, rng, &hitRecord)
+	})
+	assert.Equal(t, 0.0, allocations)
+
+	// few of the camera's rays hit the shapes above the spheres, so rays are also aimed straight at each of them
+	origin := rt.NewVec3(0, 0, 1)
+	for _, tc := range []struct {
+		desc   string
+		target rt.Vec3
+	}{
+		{desc: "a sphere", target: rt.NewVec3(0.5, 0, -1)},
+		{desc: "a disk", target: rt.NewVec3(-1.25, 1.2, -2)},
+		{desc: "a torus", target: rt.NewVec3(0.3, 1.2, -2)},
+		{desc: "a CSG", target: rt.NewVec3(1.2, 1.2, -2)},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ray := rt.NewRay(origin, tc.target.SubtractVector(origin))
+			assert.True(t, scene.World.Hit(ray, 0.001, math.Inf(1), &hitRecord))
+			assert.InDelta(t, 0, hitRecord.P.SubtractVector(tc.target).Length(), 0.5, "the ray should hit %s", tc.desc)
+			allocations := testing.AllocsPerRun(100, func() {
+				integrator.Radiance(ray, scene, rng, &hitRecord)
+			})
+			assert.Equal(t, 0.0, allocations)
+		})
+	}
+}
+
+func BenchmarkPathIntegrator(b *testing.B) {
+	scene := benchmarkScene(b)
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	integrator := &rt.PathIntegrator{MaxDepth: 50}
+	rng := rand.New(rand.NewSource(1))
+	var hitRecord rt.HitRecord
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		integrator.Radiance(camera.GetRay(rng.Float64(), rng.Float64()), scene, rng, &hitRecord)
+	}
+}
+
+// radiance returns the light that the integrator gathers along a ray from the origin in the passed-in direction
+func radiance(integrator rt.Integrator, world rt.Hittable, direction rt.Vec3) rt.Vec3 {
+	var hitRecord rt.HitRecord
+	ray := rt.NewRay(rt.NewVec3(0, 0, 0), direction)
+	return integrator.Radiance(ray, &rt.Scene{World: world}, rand.New(rand.NewSource(1)), &hitRecord)
+}
+
+func TestDebugIntegrator_Radiance(t *testing.T) {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -2), Radius: 1})
+	ahead := rt.NewVec3(0, 0, -1)
+
+	for _, tc := range []struct {
+		desc       string
+		integrator *rt.DebugIntegrator
+		direction  rt.Vec3
+		want       rt.Vec3
+	}{
+		{desc: "the normal facing the camera is blue", integrator: &rt.DebugIntegrator{Mode: rt.DebugNormal}, direction: ahead, want: rt.NewVec3(0.5, 0.5, 1)},
+		{desc: "depth fades to black at the default scale", integrator: &rt.DebugIntegrator{Mode: rt.DebugDepth}, direction: ahead, want: rt.NewVec3(0.9, 0.9, 0.9)},
+		{desc: "depth fades to black at the passed-in scale", integrator: &rt.DebugIntegrator{Mode: rt.DebugDepth, Scale: 2}, direction: ahead, want: rt.NewVec3(0.5, 0.5, 0.5)},
+		{desc: "depth does not depend on the length of the ray's direction", integrator: &rt.DebugIntegrator{Mode: rt.DebugDepth}, direction: rt.NewVec3(0, 0, -4), want: rt.NewVec3(0.9, 0.9, 0.9)},
+		{desc: "a surface seen head on faces the camera fully", integrator: &rt.DebugIntegrator{Mode: rt.DebugFacingRatio}, direction: ahead, want: rt.NewVec3(1, 1, 1)},
+		{desc: "a miss is black", integrator: &rt.DebugIntegrator{Mode: rt.DebugNormal}, direction: rt.NewVec3(0, 1, 0), want: rt.NewVec3(0, 0, 0)},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := radiance(tc.integrator, world, tc.direction)
+			assert.InDelta(t, 0, got.SubtractVector(tc.want).Length(), 1e-9, "got %v", got)
+		})
+	}
+
+	// a surface seen at an angle faces the camera less
+	grazing := radiance(&rt.DebugIntegrator{Mode: rt.DebugFacingRatio}, world, rt.NewVec3(0.45, 0, -1))
+	assert.True(t, grazing.X > 0 && grazing.X < 1, "facing ratio %v", grazing.X)
+	uv := radiance(&rt.DebugIntegrator{Mode: rt.DebugUV}, world, ahead)
+	assert.True(t, uv.X >= 0 && uv.X <= 1 && uv.Y >= 0 && uv.Y <= 1 && uv.Z == 0, "uv %v", uv)
+}
+
+func TestDebugIntegrator_BVHCost(t *testing.T) {
+	list := &rt.HittableList{}
+	for i := 0; i < 16; i++ {
+		list.Add(rt.NewSphere(rt.NewVec3(float64(i)-7.5, 0, -5), 0.4))
+	}
+	bvh, err := rt.NewBVH(list.Objects)
+	assert.Nil(t, err)
+
+	// the heat map is linear in the cost up to half of the scale, so the cost can be read back from the green
+	integrator := &rt.DebugIntegrator{Mode: rt.DebugBVHCost, Scale: 1000}
+	cost := func(world rt.Hittable, direction rt.Vec3) float64 {
+		return radiance(integrator, world, direction).Y * integrator.Scale / 2
+	}
+	ahead := rt.NewVec3(-0.5, 0, -5)
+	assert.InDelta(t, 16, cost(list, ahead), 1e-9, "a list tests every object")
+	assert.True(t, cost(bvh, ahead) < 16, "a BVH skips the objects that the ray is far from, cost %v", cost(bvh, ahead))
+	assert.True(t, cost(bvh, ahead) > 1, "a BVH tests boxes on the way to the object, cost %v", cost(bvh, ahead))
+	assert.InDelta(t, 1, cost(bvh, rt.NewVec3(0, 1, 0)), 1e-9, "a miss of the whole BVH costs one box test")
+}
+
+func TestAmbientOcclusionIntegrator_Radiance(t *testing.T) {
+	ground := &rt.Sphere{Center: rt.NewVec3(0, -101, 0), Radius: 100}
+	open := &rt.HittableList{}
+	open.Add(ground)
+	covered := &rt.HittableList{}
+	covered.Add(ground)
+	covered.Add(&rt.Sphere{Center: rt.NewVec3(0, 0.5, 0), Radius: 1})
+	down := rt.NewVec3(0, -1, 0)
+
+	integrator := &rt.AmbientOcclusionIntegrator{Samples: 64}
+	assert.Equal(t, rt.NewVec3(1, 1, 1), radiance(integrator, open, down), "nothing blocks the sky")
+	assert.Equal(t, rt.NewVec3(1, 1, 1), radiance(integrator, open, rt.NewVec3(0, 1, 0)), "a miss is white")
+	occluded := radiance(integrator, covered, rt.NewVec3(0, -1, 0.8))
+	assert.True(t, occluded.X < 1, "a sphere above the ground blocks some of the sky, visibility %v", occluded.X)
+	near := &rt.AmbientOcclusionIntegrator{Samples: 64, Distance: 0.1}
+	assert.Equal(t, rt.NewVec3(1, 1, 1), radiance(near, covered, rt.NewVec3(0, -1, 0.8)), "the sphere is too far away to count")
+}
+
+func TestWhittedIntegrator_Radiance(t *testing.T) {
+	up := rt.NewVec3(0, 1, 0)
+	sky := radiance(&rt.WhittedIntegrator{MaxDepth: 5}, &rt.HittableList{}, up)
+
+	grey := &rt.HittableList{}
+	grey.Add(&rt.Sphere{Center: rt.NewVec3(0, -101, 0), Radius: 100, Material: rt.NewLambertian(rt.NewVec3(0.5, 0.5, 0.5))})
+	got := radiance(&rt.WhittedIntegrator{MaxDepth: 5}, grey, rt.NewVec3(0, -1, -1))
+	assert.InDelta(t, 0, got.SubtractVector(sky.MultiplyFloat(0.5)).Length(), 1e-4, "a rough surface is lit by the sky above it")
+
+	mirror, err := rt.NewConductorPreset("silver", 0, 0)
+	assert.Nil(t, err)
+	shiny := &rt.HittableList{}
+	shiny.Add(&rt.Sphere{Center: rt.NewVec3(0, -101, 0), Radius: 100, Material: mirror})
+	reflected := radiance(&rt.WhittedIntegrator{MaxDepth: 5}, shiny, rt.NewVec3(0, -1, -1))
+	assert.True(t, reflected.Y > 0 && reflected.Length() < sky.Length(), "a mirror reflects some of the sky, got %v", reflected)
+	assert.Equal(t, rt.Vec3{}, radiance(&rt.WhittedIntegrator{MaxDepth: 1}, shiny, rt.NewVec3(0, -1, -1)), "the reflection is past the maximum depth")
+
+	covered := &rt.HittableList{}
+	covered.Add(grey.Objects[0])
+	covered.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5})
+	assert.Equal(t, rt.Vec3{}, radiance(&rt.WhittedIntegrator{MaxDepth: 5}, covered, rt.NewVec3(0, -1, -1)), "the sphere shadows the ground")
+}
+
+func TestRender_Integrator(t *testing.T) {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5})
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+	opts := rt.RenderOptions{Width: 9, Height: 5, SamplesPerPixel: 4, MaxDepth: 4, Integrator: &rt.DebugIntegrator{Mode: rt.DebugFacingRatio}}
+	fb, err := rt.Render(context.Background(), &rt.Scene{World: world}, camera, opts)
+	assert.Nil(t, err)
+
+	img := fb.Image()
+	middle := img.At(4, 2)
+	assert.True(t, middle.X > 0.7 && middle.X == middle.Y && middle.Y == middle.Z, "the middle of the sphere faces the camera, got %v", middle)
+	assert.Equal(t, rt.Vec3{}, img.At(0, 0), "the corners miss the sphere")
+}
+
+func TestParseDebugMode(t *testing.T) {
+	for _, mode := range []rt.DebugMode{rt.DebugNormal, rt.DebugUV, rt.DebugDepth, rt.DebugFacingRatio, rt.DebugBVHCost} {
+		got, err := rt.ParseDebugMode(mode.String())
+		assert.Nil(t, err)
+		assert.Equal(t, mode, got)
+	}
+	got, err := rt.ParseDebugMode("BVH")
+	assert.Nil(t, err)
+	assert.Equal(t, rt.DebugBVHCost, got)
+	_, err = rt.ParseDebugMode("wireframe")
+	assert.Error(t, err)
+	assert.Equal(t, "DebugMode(9)", rt.DebugMode(9).String())
+}
@@ -0,0 +1,315 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Light is a light source inside of the scene. Lights are too small to be hit by the rays that bounce around the
+// scene, so they are only found by tracing shadow rays towards them, and are not seen by the camera.
+type Light interface {
+	// Sample picks a unit direction from the point p towards the light, drawing random numbers from rng. It
+	// returns the direction, the distance to the light along it, which is infinite for lights that are infinitely
+	// far away, and the light arriving at p from that direction per unit area facing it. The arriving light is
+	// zero if the light does not shine towards p.
+	Sample(p Vec3, rng *rand.Rand) (direction Vec3, distance float64, irradiance Vec3)
+}
+
+// emitter is implemented by lights that photons and the light paths of a BDPTIntegrator can start from
+type emitter interface {
+	Light
+	// emit picks a ray of light that leaves the light, drawing random numbers from rng, and returns it along with
+	// the power that it carries divided by the density of picking it. center and radius describe a sphere around
+	// the whole world, which rays from lights that are infinitely far away start from just outside of.
+	emit(rng *rand.Rand, center Vec3, radius float64) (Ray, Vec3)
+	// emitPdf returns the solid angle density with which emit picks a ray that travels along the unit direction.
+	// It is 0 for directions that are picked from a delta distribution.
+	emitPdf(direction Vec3) float64
+	// infinite returns whether the light is infinitely far away, so that its rays start evenly spread over a disk
+	// as wide as the world rather than at the light
+	infinite() bool
+}
+
+// PointLight shines equally in every direction from a single point, and fades with the square of the distance
+// from it
+type PointLight struct {
+	Position Vec3
+	// Intensity is the light that the point sends out per unit solid angle, which is the light that arrives on a
+	// surface facing it at a distance of 1
+	Intensity Vec3
+}
+
+// Sample returns the direction towards the point, and its intensity divided by the square of the distance to it
+func (l *PointLight) Sample(p Vec3, rng *rand.Rand) (Vec3, float64, Vec3) {
+	return towardsPoint(p, l.Position, l.Intensity)
+}
+
+// emit shoots light in a random direction from the point
+func (l *PointLight) emit(rng *rand.Rand, center Vec3, radius float64) (Ray, Vec3) {
+	direction := uniformSampleSphere(randomPair(rng))
+	return NewRay(l.Position, direction), l.Intensity.MultiplyFloat(4 * math.Pi)
+}
+
+// emitPdf returns the density of every direction, which are all as likely
+func (l *PointLight) emitPdf(direction Vec3) float64 {
+	return 1 / (4 * math.Pi)
+}
+
+// infinite returns false, since the point is inside of the scene
+func (l *PointLight) infinite() bool {
+	return false
+}
+
+// Validate returns an error if the light's position or intensity is not finite
+func (l *PointLight) Validate() error {
+	if err := checkPoint("point light", "position", l.Position); err != nil {
+		return err
+	}
+	return checkPoint("point light", "intensity", l.Intensity)
+}
+
+// SpotLight is a point light that only shines within a cone. Its light fades out towards the edge of the cone.
+type SpotLight struct {
+	Position Vec3
+	// Direction is the axis of the cone, which the light points along
+	Direction Vec3
+	// Intensity is the light that the spot sends out per unit solid angle along its axis
+	Intensity Vec3
+	// Angle is the angle between the axis and the edge of the cone in degrees, up to 180
+	Angle float64
+	// Softness, between 0 and 1, is the fraction of the cone's angle towards its edge over which the light fades
+	// out. 0 gives the spot a hard edge.
+	Softness float64
+}
+
+// Sample returns the direction towards the spot, and the light that it sends towards p divided by the square of
+// the distance to it
+func (l *SpotLight) Sample(p Vec3, rng *rand.Rand) (Vec3, float64, Vec3) {
+	direction, distance, irradiance := towardsPoint(p, l.Position, l.Intensity)
+	return direction, distance, irradiance.MultiplyFloat(l.falloff(direction.Negate()))
+}
+
+// falloff returns the fraction of the spot's intensity that it sends along a unit direction
+func (l *SpotLight) falloff(direction Vec3) float64 {
+	axis, err := l.Direction.Unit()
+	if err != nil {
+		return 0
+	}
+	cosOuter := math.Cos(degreesToRadians(l.Angle))
+	cosInner := math.Cos(degreesToRadians(l.Angle * (1 - clamp(l.Softness, 0, 1))))
+	cosine := direction.Dot(axis)
+	if cosine < cosOuter {
+		return 0
+	}
+	if cosine >= cosInner {
+		return 1
+	}
+	// a smoothstep between the edge of the cone and where it is fully lit
+	x := (cosine - cosOuter) / (cosInner - cosOuter)
+	return x * x * (3 - 2*x)
+}
+
+// emit shoots light in a random direction within the cone
+func (l *SpotLight) emit(rng *rand.Rand, center Vec3, radius float64) (Ray, Vec3) {
+	axis, err := l.Direction.Unit()
+	if err != nil {
+		return Ray{}, Vec3{}
+	}
+	cosOuter := math.Cos(degreesToRadians(l.Angle))
+	u0, u1 := randomPair(rng)
+	direction := NewONB(axis).ToWorld(uniformSampleCone(u0, u1, cosOuter))
+	solidAngle := 2 * math.Pi * (1 - cosOuter)
+	return NewRay(l.Position, direction), l.Intensity.MultiplyFloat(l.falloff(direction) * solidAngle)
+}
+
+// emitPdf returns the density of the directions inside of the cone, which are all as likely
+func (l *SpotLight) emitPdf(direction Vec3) float64 {
+	axis, err := l.Direction.Unit()
+	if err != nil {
+		return 0
+	}
+	cosOuter := math.Cos(degreesToRadians(l.Angle))
+	if direction.Dot(axis) < cosOuter {
+		return 0
+	}
+	return 1 / (2 * math.Pi * (1 - cosOuter))
+}
+
+// infinite returns false, since the spot is inside of the scene
+func (l *SpotLight) infinite() bool {
+	return false
+}
+
+// Validate returns an error if the spot has no direction, or its cone is not between 0 and 180 degrees
+func (l *SpotLight) Validate() error {
+	if err := checkPoint("spot light", "position", l.Position); err != nil {
+		return err
+	}
+	if err := checkPoint("spot light", "direction", l.Direction); err != nil {
+		return err
+	}
+	if l.Direction.IsZero() {
+		return validationError("spot light", "direction", ErrZero)
+	}
+	if err := checkPoint("spot light", "intensity", l.Intensity); err != nil {
+		return err
+	}
+	if err := checkFinite("spot light", "angle", l.Angle); err != nil {
+		return err
+	}
+	if l.Angle <= 0 || l.Angle > 180 {
+		return validationError("spot light", "angle", ErrOutOfRange)
+	}
+	if err := checkFinite("spot light", "softness", l.Softness); err != nil {
+		return err
+	}
+	if l.Softness < 0 || l.Softness > 1 {
+		return validationError("spot light", "softness", ErrOutOfRange)
+	}
+	return nil
+}
+
+// SunLight is infinitely far away, so its light arrives everywhere from the same direction. Like the real sun, it
+// can cover a small disk of the sky, which softens the edges of its shadows.
+type SunLight struct {
+	// Direction is the direction that sunlight travels in, from the sun towards the scene
+	Direction Vec3
+	// Irradiance is the light that arrives on a surface facing the sun
+	Irradiance Vec3
+	// AngularDiameter is the angle that the sun's disk covers in degrees, like 0.53 for the real sun. 0 casts
+	// perfectly sharp shadows.
+	AngularDiameter float64
+}
+
+// Sample returns a direction towards a random point on the sun's disk, and its irradiance
+func (l *SunLight) Sample(p Vec3, rng *rand.Rand) (Vec3, float64, Vec3) {
+	direction, ok := l.direction(rng)
+	if !ok {
+		return Vec3{}, 0, Vec3{}
+	}
+	return direction.Negate(), math.Inf(1), l.Irradiance
+}
+
+// direction returns a random direction that sunlight travels in, from a point on the sun's disk
+func (l *SunLight) direction(rng *rand.Rand) (Vec3, bool) {
+	axis, err := l.Direction.Unit()
+	if err != nil {
+		return Vec3{}, false
+	}
+	if l.AngularDiameter <= 0 {
+		return axis, true
+	}
+	// every point on the disk is as bright as the others
+	u0, u1 := randomPair(rng)
+	cosMax := math.Cos(degreesToRadians(l.AngularDiameter / 2))
+	return NewONB(axis).ToWorld(uniformSampleCone(u0, u1, cosMax)), true
+}
+
+// emit shoots sunlight from a random point on a disk facing the sun just outside of the world, which is as wide as
+// the world
+func (l *SunLight) emit(rng *rand.Rand, center Vec3, radius float64) (Ray, Vec3) {
+	direction, ok := l.direction(rng)
+	if !ok {
+		return Ray{}, Vec3{}
+	}
+	x, y := uniformSampleDisk(randomPair(rng))
+	origin := center.
+		SubtractVector(direction.MultiplyFloat(radius)).
+		AddVector(NewONB(direction).ToWorld(NewVec3(x*radius, y*radius, 0)))
+	return NewRay(origin, direction), l.Irradiance.MultiplyFloat(math.Pi * radius * radius)
+}
+
+// emitPdf returns the density of the directions that come from the sun's disk, which are all as likely, or 0 if the
+// sun is a single point in the sky
+func (l *SunLight) emitPdf(direction Vec3) float64 {
+	axis, err := l.Direction.Unit()
+	if err != nil || l.AngularDiameter <= 0 {
+		return 0
+	}
+	cosMax := math.Cos(degreesToRadians(l.AngularDiameter / 2))
+	if direction.Dot(axis) < cosMax {
+		return 0
+	}
+	return 1 / (2 * math.Pi * (1 - cosMax))
+}
+
+// infinite returns true, since the sun is infinitely far away
+func (l *SunLight) infinite() bool {
+	return true
+}
+
+// Validate returns an error if the sun has no direction, or its disk is not smaller than half of the sky
+func (l *SunLight) Validate() error {
+	if err := checkPoint("sun light", "direction", l.Direction); err != nil {
+		return err
+	}
+	if l.Direction.IsZero() {
+		return validationError("sun light", "direction", ErrZero)
+	}
+	if err := checkPoint("sun light", "irradiance", l.Irradiance); err != nil {
+		return err
+	}
+	if err := checkFinite("sun light", "angular diameter", l.AngularDiameter); err != nil {
+		return err
+	}
+	if l.AngularDiameter < 0 || l.AngularDiameter >= 180 {
+		return validationError("sun light", "angular diameter", ErrOutOfRange)
+	}
+	return nil
+}
+
+// towardsPoint returns the direction and distance from p to a point light at position, and the light arriving at
+// p from one that sends intensity towards it
+func towardsPoint(p, position, intensity Vec3) (Vec3, float64, Vec3) {
+	offset := position.SubtractVector(p)
+	distanceSquared := offset.LengthSquared()
+	if distanceSquared == 0 {
+		return Vec3{}, 0, Vec3{}
+	}
+	distance := math.Sqrt(distanceSquared)
+	return offset.MultiplyFloat(1 / distance), distance, intensity.MultiplyFloat(1 / distanceSquared)
+}
+
+// uniformSampleCone returns a unit direction about the Z axis within the cone whose edge has the passed-in cosine,
+// with every direction in the cone equally likely
+func uniformSampleCone(u0, u1, cosMax float64) Vec3 {
+	z := 1 - u0*(1-cosMax)
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * math.Pi * u1
+	return NewVec3(r*math.Cos(phi), r*math.Sin(phi), z)
+}
+
+// directLight estimates the light reflected at a hit point that arrives straight from the scene's lights and its
+// environment. The environment's shadow ray overwrites the hit record.
+func (r Ray) directLight(scene *Scene, hitRecord *HitRecord, rng *rand.Rand) Vec3 {
+	wo, _ := r.Direction().Unit()
+	lights := scene.sampleLights(scene.Lights, wo.Negate(), hitRecord, rng)
+	return lights.AddVector(r.directEnvironmentLight(scene, hitRecord, rng))
+}
+
+// sampleLights returns the light reflected towards wo at a hit point that arrives straight from the passed-in
+// lights of the scene, tracing a shadow ray towards each of them. The shadow rays use the hit record as scratch
+// space, but it is restored afterwards.
+func (s *Scene) sampleLights(lights []Light, wo Vec3, hitRecord *HitRecord, rng *rand.Rand) Vec3 {
+	radiance := Vec3{}
+	if len(lights) == 0 {
+		return radiance
+	}
+	saved := *hitRecord
+	for _, light := range lights {
+		wi, distance, irradiance := light.Sample(saved.P, rng)
+		if irradiance.IsZero() {
+			continue
+		}
+		bsdf, _ := saved.Material.Evaluate(wo, wi, hitRecord)
+		if bsdf.IsZero() {
+			continue
+		}
+		occluded := s.World.Hit(NewRay(saved.P, wi), 0.001, distance-0.001, hitRecord)
+		*hitRecord = saved
+		if !occluded {
+			radiance = radiance.AddVector(bsdf.MultiplyVector(irradiance))
+		}
+	}
+	return radiance
+}
@@ -0,0 +1,81 @@
+package raytracer_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLights_Radiance(t *testing.T) {
+	// a grey floor below the camera, under a black sky so that only the lights light it
+	darkness, err := rt.NewEnvironmentLight(rt.NewHDRImage(1, 1), 0, 1)
+	assert.Nil(t, err)
+	white := rt.NewVec3(1, 1, 1)
+	down := rt.NewVec3(0, -1, 0)
+	lit := 0.5 / math.Pi
+
+	for _, tc := range []struct {
+		desc    string
+		light   rt.Light
+		blocker rt.Hittable
+		want    float64
+	}{
+		{desc: "a point light fades with the square of its distance", light: &rt.PointLight{Position: rt.NewVec3(0, 1, 0), Intensity: white.MultiplyFloat(4)}, want: lit},
+		{desc: "a point light at an angle", light: &rt.PointLight{Position: rt.NewVec3(math.Sqrt(3), 0, 0), Intensity: white.MultiplyFloat(4)}, want: lit * 0.5},
+		{desc: "a point light below the floor", light: &rt.PointLight{Position: rt.NewVec3(0, -2, 0), Intensity: white}, want: 0},
+		{desc: "a point light beside an object", light: &rt.PointLight{Position: rt.NewVec3(0, 1, 0), Intensity: white.MultiplyFloat(4)}, blocker: rt.NewSphere(rt.NewVec3(0, 0.5, 0.5), 0.2), want: lit},
+		{desc: "a point light behind an object in the way", light: &rt.PointLight{Position: rt.NewVec3(0, 1, 0), Intensity: white.MultiplyFloat(4)}, blocker: rt.NewSphere(rt.NewVec3(0, 0.5, 0), 0.2), want: 0},
+		{desc: "a spot light pointing at the floor", light: &rt.SpotLight{Position: rt.NewVec3(0, 1, 0), Direction: down, Intensity: white.MultiplyFloat(4), Angle: 10}, want: lit},
+		{desc: "a spot light pointing away", light: &rt.SpotLight{Position: rt.NewVec3(0, 1, 0), Direction: rt.NewVec3(1, 0, 0), Intensity: white.MultiplyFloat(4), Angle: 30}, want: 0},
+		{desc: "a spot light with the floor on the edge of its cone", light: &rt.SpotLight{Position: rt.NewVec3(0, 1, 0), Direction: rt.NewVec3(math.Sin(0.3), -math.Cos(0.3), 0), Intensity: white.MultiplyFloat(4), Angle: 0.3 * 180 / math.Pi, Softness: 1}, want: 0},
+		{desc: "the sun overhead", light: &rt.SunLight{Direction: down, Irradiance: white}, want: lit},
+		{desc: "the sun low in the sky", light: &rt.SunLight{Direction: rt.NewVec3(math.Sqrt(3), -1, 0), Irradiance: white}, want: lit * 0.5},
+		{desc: "a wide sun overhead", light: &rt.SunLight{Direction: down, Irradiance: white, AngularDiameter: 2}, want: lit},
+		{desc: "the sun below the horizon", light: &rt.SunLight{Direction: rt.NewVec3(0, 1, 0), Irradiance: white}, want: 0},
+	} {
+		world := &rt.HittableList{}
+		world.Add(&rt.Disk{Center: rt.NewVec3(0, -1, 0), Radius: 10, Material: rt.NewLambertian(rt.NewVec3(0.5, 0.5, 0.5))})
+		if tc.blocker != nil {
+			world.Add(tc.blocker)
+		}
+		scene := &rt.Scene{World: world, Environment: darkness, Lights: []rt.Light{tc.light}}
+
+		for _, integrator := range []rt.Integrator{
+			&rt.PathIntegrator{MaxDepth: 4},
+			&rt.WhittedIntegrator{MaxDepth: 4},
+			&rt.BDPTIntegrator{MaxDepth: 4},
+			&rt.PhotonMapIntegrator{MaxDepth: 4, Photons: 100},
+			&rt.ProgressivePhotonMapIntegrator{MaxDepth: 4, Photons: 100},
+		} {
+			t.Run(tc.desc, func(t *testing.T) {
+				var hitRecord rt.HitRecord
+				got := integrator.Radiance(rt.NewRay(rt.NewVec3(0, 0, 0), down), scene, rand.New(rand.NewSource(1)), &hitRecord)
+				assert.InDelta(t, tc.want, got.X, 1e-3, "%T", integrator)
+			})
+		}
+	}
+}
+
+func TestSpotLight_Falloff(t *testing.T) {
+	spot := &rt.SpotLight{Direction: rt.NewVec3(0, -1, 0), Intensity: rt.NewVec3(1, 1, 1), Angle: 40, Softness: 0.5}
+	// points on the floor at increasing angles from the spot's axis
+	previous := 2.0
+	for _, degrees := range []float64{0, 15, 20, 25, 30, 35, 40, 45} {
+		radians := degrees * math.Pi / 180
+		p := rt.NewVec3(math.Tan(radians), -1, 0)
+		_, distance, irradiance := spot.Sample(p, rand.New(rand.NewSource(1)))
+		falloff := irradiance.X * distance * distance
+		switch {
+		case degrees <= 20:
+			assert.InDelta(t, 1, falloff, 1e-9, "inside of the soft edge at %v degrees", degrees)
+		case degrees >= 40:
+			assert.Equal(t, 0.0, falloff, "outside of the cone at %v degrees", degrees)
+		default:
+			assert.True(t, falloff > 0 && falloff < previous, "fading out at %v degrees, got %v after %v", degrees, falloff, previous)
+		}
+		previous = falloff
+	}
+}
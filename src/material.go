@@ -0,0 +1,139 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Material describes how light interacts with a surface. Directions passed to and returned from a material are
+// unit vectors in world space that point away from the hit point.
+type Material interface {
+	// Scatter picks the direction that light arriving along rayIn continues in after hitting the surface, drawing
+	// random numbers from rng
+	Scatter(rayIn Ray, hitRecord *HitRecord, rng *rand.Rand) (ScatterRecord, bool)
+	// Evaluate returns the BSDF multiplied by the cosine of the angle between wi and the normal for light arriving
+	// from wi and leaving towards wo. It also returns the solid angle density with which Scatter would pick wi.
+	// Perfectly specular materials always return a zero value, as they cannot be reached by sampling a light.
+	Evaluate(wo, wi Vec3, hitRecord *HitRecord) (value Vec3, pdf float64)
+}
+
+// ScatterRecord describes a direction sampled by a material
+type ScatterRecord struct {
+	// Ray is the scattered ray leaving the hit point
+	Ray Ray
+	// Attenuation is the BSDF multiplied by the cosine term and divided by Pdf
+	Attenuation Vec3
+	// Pdf is the solid angle density of the scattered direction. It is 0 for specular scattering.
+	Pdf float64
+	// IsSpecular is true when the direction was picked from a delta distribution, like a perfect mirror
+	IsSpecular bool
+}
+
+// defaultMaterial is used for objects that have not been assigned a material
+var defaultMaterial Material = NewLambertian(NewVec3(0.5, 0.5, 0.5))
+
+// Lambertian is a perfectly diffuse material that reflects light equally in every direction
+type Lambertian struct {
+	Albedo Vec3
+	// Texture, if it is set, replaces Albedo with a color that varies over the surface
+	Texture Texture
+}
+
+// NewLambertian returns a diffuse material that reflects the passed-in fraction of each color channel
+func NewLambertian(albedo Vec3) *Lambertian {
+	return &Lambertian{Albedo: albedo}
+}
+
+// NewTexturedLambertian returns a diffuse material whose albedo is looked up in a texture at each hit point
+func NewTexturedLambertian(albedo Texture) *Lambertian {
+	return &Lambertian{Texture: albedo}
+}
+
+// albedo returns the fraction of each color channel that the material reflects at the hit point
+func (l *Lambertian) albedo(hitRecord *HitRecord) Vec3 {
+	if l.Texture == nil {
+		return l.Albedo
+	}
+	return l.Texture.Value(hitRecord.U, hitRecord.V, hitRecord.P)
+}
+
+// Scatter bounces the ray in a cosine-weighted random direction about the normal
+func (l *Lambertian) Scatter(rayIn Ray, hitRecord *HitRecord, rng *rand.Rand) (ScatterRecord, bool) {
+	unitDirection, err := NewONB(hitRecord.Normal).ToWorld(cosineSampleHemisphere(randomPair(rng))).Unit()
+	if err != nil {
+		return ScatterRecord{}, false
+	}
+
+	cosine := hitRecord.Normal.Dot(unitDirection)
+	if cosine <= 0 {
+		return ScatterRecord{}, false
+	}
+	return ScatterRecord{
+		Ray:         NewRay(hitRecord.P, unitDirection),
+		Attenuation: l.albedo(hitRecord),
+		Pdf:         cosine / math.Pi,
+	}, true
+}
+
+// Evaluate returns the lambertian BRDF, albedo / pi, multiplied by the cosine term
+func (l *Lambertian) Evaluate(wo, wi Vec3, hitRecord *HitRecord) (Vec3, float64) {
+	cosine := hitRecord.Normal.Dot(wi)
+	if cosine <= 0 {
+		return NewVec3(0, 0, 0), 0
+	}
+	return l.albedo(hitRecord).MultiplyFloat(cosine / math.Pi), cosine / math.Pi
+}
+
+// randomPair returns two uniform random numbers for sampling two dimensional distributions
+func randomPair(rng *rand.Rand) (float64, float64) {
+	return rng.Float64(), rng.Float64()
+}
+
+// shadingFrame returns the basis that materials use to express directions relative to the surface. The first
+// axis follows the surface's tangent when it has one, so that anisotropic materials line up with the
+// parameterization.
+func shadingFrame(hitRecord *HitRecord) ONB {
+	if hitRecord.Tangent.IsZero() {
+		return NewONB(hitRecord.Normal)
+	}
+	n := hitRecord.Normal
+	// remove the part of the tangent that is along the normal
+	tangent, err := hitRecord.Tangent.SubtractVector(n.MultiplyFloat(n.Dot(hitRecord.Tangent))).Unit()
+	if err != nil {
+		return NewONB(n)
+	}
+	return ONB{U: tangent, V: n.Cross(tangent), W: n}
+}
+
+// localOutgoing returns the direction that points back along the incoming ray, in the local shading frame
+func localOutgoing(frame ONB, rayIn Ray) (Vec3, bool) {
+	unitDirection, err := rayIn.Direction().Unit()
+	if err != nil {
+		return Vec3{}, false
+	}
+	wo := frame.ToLocal(unitDirection.Negate())
+	if wo.Z <= 0 {
+		return Vec3{}, false
+	}
+	return wo, true
+}
+
+// AlbedoReporter is implemented by materials that can report the overall color of their surface, for the albedo
+// pass
+type AlbedoReporter interface {
+	// AlbedoAt returns the fraction of light that the surface reflects at the hit point, ignoring its roughness
+	AlbedoAt(hitRecord *HitRecord) Vec3
+}
+
+// AlbedoAt returns the albedo of the material at the hit point
+func (l *Lambertian) AlbedoAt(hitRecord *HitRecord) Vec3 {
+	return l.albedo(hitRecord)
+}
+
+// materialAlbedo returns the albedo of a material, or white for materials that cannot report one
+func materialAlbedo(m Material, hitRecord *HitRecord) Vec3 {
+	if reporter, ok := m.(AlbedoReporter); ok {
+		return reporter.AlbedoAt(hitRecord)
+	}
+	return NewVec3(1, 1, 1)
+}
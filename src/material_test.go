@@ -0,0 +1,164 @@
+package raytracer_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaterial_ScatterMatchesEvaluate(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	gold, err := rt.NewConductorPreset("gold", 0.4, 0.4)
+	assert.Nil(t, err)
+	brushed, err := rt.NewConductorPreset("Aluminium", 0.2, 0.6)
+	assert.Nil(t, err)
+	plastic := rt.NewPrincipledBSDF()
+	plastic.Clearcoat = rt.NewConstantTexture(1)
+	plastic.Sheen = rt.NewConstantTexture(0.5)
+	metal := rt.NewPrincipledBSDF()
+	metal.Metallic = rt.NewConstantTexture(1)
+	metal.Roughness = rt.NewConstantTexture(0.3)
+	glass := rt.NewPrincipledBSDF()
+	glass.Transmission = rt.NewConstantTexture(1)
+	glass.Roughness = rt.NewConstantTexture(0.2)
+
+	for _, tc := range []struct {
+		desc      string
+		material  rt.Material
+		frontFace bool
+	}{
+		{desc: "lambertian", material: rt.NewLambertian(rt.NewVec3(0.8, 0.5, 0.2)), frontFace: true},
+		{desc: "textured lambertian", material: rt.NewTexturedLambertian(rt.NewSolidColor(rt.NewVec3(0.3, 0.6, 0.9))), frontFace: true},
+		{desc: "rough gold", material: gold, frontFace: true},
+		{desc: "anisotropic aluminium", material: brushed, frontFace: true},
+		{desc: "rough glass entering", material: rt.NewRoughDielectric(1.5, 0.5, 0.5), frontFace: true},
+		{desc: "rough glass exiting", material: rt.NewRoughDielectric(1.5, 0.3, 0.7), frontFace: false},
+		{desc: "principled clear coated plastic", material: plastic, frontFace: true},
+		{desc: "principled metal", material: metal, frontFace: true},
+		{desc: "principled glass", material: glass, frontFace: false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			hitRecord := &rt.HitRecord{
+				P:         rt.NewVec3(0, 0, 0),
+				Normal:    rt.NewVec3(0, 1, 0),
+				FrontFace: tc.frontFace,
+				Material:  tc.material,
+			}
+			rayIn := rt.NewRay(rt.NewVec3(-1, 1, 0.5), rt.NewVec3(1, -1, -0.5))
+			wo, _ := rayIn.Direction().Unit()
+			wo = wo.Negate()
+
+			scattered := 0
+			for i := 0; i < 200; i++ {
+				scatter, ok := tc.material.Scatter(rayIn, hitRecord, rng)
+				if !ok {
+					continue
+				}
+				scattered++
+				assert.False(t, scatter.IsSpecular)
+
+				value, pdf := tc.material.Evaluate(wo, scatter.Ray.Direction(), hitRecord)
+				assert.InDelta(t, pdf, scatter.Pdf, 1e-6*pdf)
+				assert.InDelta(t, value.X/pdf, scatter.Attenuation.X, 1e-6)
+				assert.InDelta(t, value.Z/pdf, scatter.Attenuation.Z, 1e-6)
+			}
+			assert.True(t, scattered > 100, "only %d of 200 rays scattered", scattered)
+		})
+	}
+}
+
+func TestMaterial_EnergyConservation(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// A furnace test: with a white conductor every bit of light should be reflected or lost to masking, but
+	// never created
+	white := rt.NewRoughConductor(rt.NewVec3(0, 0, 0), rt.NewVec3(1e6, 1e6, 1e6), 0.5, 0.5)
+	hitRecord := &rt.HitRecord{P: rt.NewVec3(0, 0, 0), Normal: rt.NewVec3(0, 0, 1), FrontFace: true}
+	rayIn := rt.NewRay(rt.NewVec3(0, 1, 1), rt.NewVec3(0, -1, -1))
+
+	total := 0.0
+	const samples = 5000
+	for i := 0; i < samples; i++ {
+		if scatter, ok := white.Scatter(rayIn, hitRecord, rng); ok {
+			total += scatter.Attenuation.Y
+		}
+	}
+	albedo := total / samples
+	assert.True(t, albedo <= 1.0 && albedo > 0.8, "albedo of a white rough conductor was %f", albedo)
+}
+
+func TestPrincipledBSDF_EnergyConservation(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	hitRecord := &rt.HitRecord{P: rt.NewVec3(0, 0, 0), Normal: rt.NewVec3(0, 0, 1), FrontFace: true}
+	rayIn := rt.NewRay(rt.NewVec3(0, 1, 2), rt.NewVec3(0, -1, -2))
+
+	for _, tc := range []struct {
+		desc      string
+		parameter func(m *rt.PrincipledBSDF)
+	}{
+		{desc: "white diffuse", parameter: func(m *rt.PrincipledBSDF) { m.BaseColor = rt.NewConstantTexture(1) }},
+		{desc: "white metal", parameter: func(m *rt.PrincipledBSDF) {
+			m.BaseColor = rt.NewConstantTexture(1)
+			m.Metallic = rt.NewConstantTexture(1)
+		}},
+		{desc: "clear glass", parameter: func(m *rt.PrincipledBSDF) {
+			m.BaseColor = rt.NewConstantTexture(1)
+			m.Transmission = rt.NewConstantTexture(1)
+		}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			m := rt.NewPrincipledBSDF()
+			tc.parameter(m)
+			total := 0.0
+			const samples = 20000
+			for i := 0; i < samples; i++ {
+				if scatter, ok := m.Scatter(rayIn, hitRecord, rng); ok {
+					total += scatter.Attenuation.Y
+				}
+			}
+			albedo := total / samples
+			assert.True(t, albedo < 1.05, "albedo was %f", albedo)
+		})
+	}
+}
+
+func TestMaterial_SmoothSurfacesAreSpecular(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	hitRecord := &rt.HitRecord{P: rt.NewVec3(0, 0, 0), Normal: rt.NewVec3(0, 0, 1), FrontFace: true}
+	rayIn := rt.NewRay(rt.NewVec3(-1, 0, 1), rt.NewVec3(1, 0, -1))
+
+	mirror, err := rt.NewConductorPreset("silver", 0, 0)
+	assert.Nil(t, err)
+	scatter, ok := mirror.Scatter(rayIn, hitRecord, rng)
+	assert.True(t, ok)
+	assert.True(t, scatter.IsSpecular)
+	assert.InDelta(t, 1/math.Sqrt2, scatter.Ray.Direction().X, 1e-9)
+	assert.InDelta(t, 1/math.Sqrt2, scatter.Ray.Direction().Z, 1e-9)
+
+	value, pdf := mirror.Evaluate(rt.NewVec3(-1, 0, 1), rt.NewVec3(1, 0, 1), hitRecord)
+	assert.Equal(t, 0.0, pdf)
+	assert.True(t, value.NearZero())
+
+	glass := rt.NewRoughDielectric(1.5, 0, 0)
+	scatter, ok = glass.Scatter(rayIn, hitRecord, rng)
+	assert.True(t, ok)
+	assert.True(t, scatter.IsSpecular)
+}
+
+func TestNewConductorPreset(t *testing.T) {
+	_, err := rt.NewConductorPreset("unobtainium", 0, 0)
+	assert.Error(t, err)
+
+	// gold reflects more red than blue at normal incidence
+	gold := rt.ConductorPresets["gold"]
+	reflectance := rt.FresnelConductor(1, gold.Eta, gold.K)
+	assert.True(t, reflectance.X > reflectance.Z)
+}
+
+func TestFresnelDielectric(t *testing.T) {
+	assert.InDelta(t, 0.04, rt.FresnelDielectric(1, 1.5), 1e-9)
+	assert.Equal(t, 1.0, rt.FresnelDielectric(0.1, 1/1.5), "grazing light inside glass is totally reflected")
+	assert.InDelta(t, rt.FresnelDielectric(0.7, 1.5), rt.FresnelDielectric(-0.7, 1/1.5), 1e-12)
+}
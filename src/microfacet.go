@@ -0,0 +1,187 @@
+package raytracer
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// The functions in this file work in a local shading space where the surface normal is +Z, so that the cosine of
+// a direction's angle with the normal is simply its Z component.
+
+// smoothAlpha is the roughness below which a microfacet surface is treated as perfectly smooth
+const smoothAlpha = 1e-3
+
+// RoughnessToAlpha maps a perceptually linear roughness in [0, 1] to the alpha parameter of the GGX distribution
+func RoughnessToAlpha(roughness float64) float64 {
+	roughness = clamp(roughness, 0, 1)
+	return roughness * roughness
+}
+
+// GGX is the GGX (Trowbridge-Reitz) microfacet distribution with separate roughness along the tangent (X) and
+// bitangent (Y) directions. Masking and shadowing use the Smith height-correlated form.
+type GGX struct {
+	AlphaX, AlphaY float64
+}
+
+// IsSmooth returns whether the distribution is so narrow that it should be treated as a perfect mirror
+func (g GGX) IsSmooth() bool {
+	return math.Max(g.AlphaX, g.AlphaY) < smoothAlpha
+}
+
+// D returns the density of microfacets oriented along the normal wm
+func (g GGX) D(wm Vec3) float64 {
+	cos2Theta := wm.Z * wm.Z
+	if cos2Theta == 0 {
+		return 0
+	}
+	tan2Theta := (wm.X*wm.X + wm.Y*wm.Y) / cos2Theta
+	if math.IsInf(tan2Theta, 0) {
+		return 0
+	}
+	cos4Theta := cos2Theta * cos2Theta
+	e := tan2Theta * (cos2Phi(wm)/(g.AlphaX*g.AlphaX) + sin2Phi(wm)/(g.AlphaY*g.AlphaY))
+	return 1 / (math.Pi * g.AlphaX * g.AlphaY * cos4Theta * (1 + e) * (1 + e))
+}
+
+// Lambda is the Smith auxiliary function that measures how much of the microsurface is hidden from w
+func (g GGX) Lambda(w Vec3) float64 {
+	cos2Theta := w.Z * w.Z
+	if cos2Theta == 0 {
+		return math.Inf(1)
+	}
+	tan2Theta := (w.X*w.X + w.Y*w.Y) / cos2Theta
+	alpha2 := cos2Phi(w)*g.AlphaX*g.AlphaX + sin2Phi(w)*g.AlphaY*g.AlphaY
+	return (math.Sqrt(1+alpha2*tan2Theta) - 1) / 2
+}
+
+// G1 returns the fraction of microfacets that are visible from w
+func (g GGX) G1(w Vec3) float64 {
+	return 1 / (1 + g.Lambda(w))
+}
+
+// G returns the fraction of microfacets that are visible from both wo and wi
+func (g GGX) G(wo, wi Vec3) float64 {
+	return 1 / (1 + g.Lambda(wo) + g.Lambda(wi))
+}
+
+// VisibleD returns the density of microfacet normals wm that are visible from w
+func (g GGX) VisibleD(w, wm Vec3) float64 {
+	if w.Z == 0 {
+		return 0
+	}
+	return g.G1(w) / math.Abs(w.Z) * g.D(wm) * math.Abs(w.Dot(wm))
+}
+
+// SampleVisibleNormal picks a microfacet normal from the ones visible from w using two uniform random numbers,
+// following Heitz, "Sampling the GGX Distribution of Visible Normals". The density of the returned normal is
+// VisibleD(w, wm).
+func (g GGX) SampleVisibleNormal(w Vec3, u0, u1 float64) Vec3 {
+	// transform w to the hemispherical configuration where the distribution is a unit hemisphere
+	wh, _ := NewVec3(g.AlphaX*w.X, g.AlphaY*w.Y, w.Z).Unit()
+	if wh.Z < 0 {
+		wh = wh.Negate()
+	}
+
+	// build a basis around wh
+	t1 := NewVec3(1, 0, 0)
+	if wh.Z < 0.99999 {
+		t1, _ = NewVec3(0, 0, 1).Cross(wh).Unit()
+	}
+	t2 := wh.Cross(t1)
+
+	// uniformly sample a disk and warp it to the projected area of the visible hemisphere
+	r := math.Sqrt(u0)
+	phi := 2 * math.Pi * u1
+	px, py := r*math.Cos(phi), r*math.Sin(phi)
+	h := math.Sqrt(1 - px*px)
+	s := (1 + wh.Z) / 2
+	py = (1-s)*h + s*py
+
+	// reproject onto the hemisphere and transform the normal back to the ellipsoid configuration
+	pz := math.Sqrt(math.Max(0, 1-px*px-py*py))
+	nh := t1.MultiplyFloat(px).AddVector(t2.MultiplyFloat(py)).AddVector(wh.MultiplyFloat(pz))
+	wm, _ := NewVec3(g.AlphaX*nh.X, g.AlphaY*nh.Y, math.Max(1e-6, nh.Z)).Unit()
+	return wm
+}
+
+func cos2Phi(w Vec3) float64 {
+	sin2Theta := w.X*w.X + w.Y*w.Y
+	if sin2Theta == 0 {
+		return 1
+	}
+	return w.X * w.X / sin2Theta
+}
+
+func sin2Phi(w Vec3) float64 {
+	sin2Theta := w.X*w.X + w.Y*w.Y
+	if sin2Theta == 0 {
+		return 0
+	}
+	return w.Y * w.Y / sin2Theta
+}
+
+// FresnelDielectric returns the fraction of unpolarized light reflected at the boundary between two dielectrics.
+// cosThetaI is the cosine of the incident angle and eta is the ratio of the refractive index on the far side of
+// the boundary to the one on the incident side.
+func FresnelDielectric(cosThetaI, eta float64) float64 {
+	cosThetaI = clamp(cosThetaI, -1, 1)
+	if cosThetaI < 0 {
+		// the light arrives from the other side of the boundary
+		eta = 1 / eta
+		cosThetaI = -cosThetaI
+	}
+
+	sin2ThetaI := 1 - cosThetaI*cosThetaI
+	sin2ThetaT := sin2ThetaI / (eta * eta)
+	if sin2ThetaT >= 1 {
+		// total internal reflection
+		return 1
+	}
+	cosThetaT := math.Sqrt(1 - sin2ThetaT)
+
+	rParallel := (eta*cosThetaI - cosThetaT) / (eta*cosThetaI + cosThetaT)
+	rPerpendicular := (cosThetaI - eta*cosThetaT) / (cosThetaI + eta*cosThetaT)
+	return (rParallel*rParallel + rPerpendicular*rPerpendicular) / 2
+}
+
+// FresnelConductor returns the fraction of light reflected by a conductor for each color channel, given the real
+// (eta) and imaginary (k) parts of its complex index of refraction
+func FresnelConductor(cosThetaI float64, eta, k Vec3) Vec3 {
+	return NewVec3(
+		fresnelComplex(cosThetaI, complex(eta.X, k.X)),
+		fresnelComplex(cosThetaI, complex(eta.Y, k.Y)),
+		fresnelComplex(cosThetaI, complex(eta.Z, k.Z)),
+	)
+}
+
+// fresnelComplex evaluates the Fresnel equations for a single wavelength with a complex index of refraction
+func fresnelComplex(cosThetaI float64, eta complex128) float64 {
+	cosThetaI = clamp(cosThetaI, 0, 1)
+	sin2ThetaI := complex(1-cosThetaI*cosThetaI, 0)
+	sin2ThetaT := sin2ThetaI / (eta * eta)
+	cosThetaT := cmplx.Sqrt(1 - sin2ThetaT)
+	cosI := complex(cosThetaI, 0)
+
+	rParallel := (eta*cosI - cosThetaT) / (eta*cosI + cosThetaT)
+	rPerpendicular := (cosI - eta*cosThetaT) / (cosI + eta*cosThetaT)
+	return (norm(rParallel) + norm(rPerpendicular)) / 2
+}
+
+// norm returns the squared magnitude of a complex number
+func norm(c complex128) float64 {
+	return real(c)*real(c) + imag(c)*imag(c)
+}
+
+// refract bends the unit direction wi through a boundary with the surface normal n, which must be on the same
+// side as wi. eta is the ratio of the refractive index on the far side to the one on wi's side. It returns false
+// on total internal reflection.
+func refract(wi, n Vec3, eta float64) (Vec3, bool) {
+	cosThetaI := n.Dot(wi)
+	sin2ThetaI := math.Max(0, 1-cosThetaI*cosThetaI)
+	sin2ThetaT := sin2ThetaI / (eta * eta)
+	if sin2ThetaT >= 1 {
+		return Vec3{}, false
+	}
+	cosThetaT := math.Sqrt(1 - sin2ThetaT)
+	return wi.Negate().MultiplyFloat(1 / eta).AddVector(n.MultiplyFloat(cosThetaI/eta - cosThetaT)), true
+}
@@ -0,0 +1,202 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// minShadingCosine is the smallest cosine allowed between a perturbed shading normal and the directions that it
+// must stay above
+const minShadingCosine = 0.01
+
+// bumpDelta is the step in surface coordinates used to estimate the slope of a bump map
+const bumpDelta = 0.0005
+
+// NormalPerturbation changes the shading normal of a surface to add detail that is not in its geometry
+type NormalPerturbation interface {
+	// Perturb returns the new unit shading normal for a hit point. The returned normal is on the same side of
+	// the surface as hitRecord.Normal.
+	Perturb(hitRecord *HitRecord) Vec3
+}
+
+// BumpMap perturbs normals as if the surface were displaced along its normal by a scalar height texture
+type BumpMap struct {
+	// Height is the displacement of the surface, read from the first channel
+	Height Texture
+	// Scale multiplies the height
+	Scale float64
+}
+
+// NewBumpMap returns a bump map that displaces the surface by scale times the height texture
+func NewBumpMap(height Texture, scale float64) *BumpMap {
+	return &BumpMap{Height: height, Scale: scale}
+}
+
+// Perturb tilts the normal along the slope of the height texture, which is estimated with finite differences
+func (b *BumpMap) Perturb(hitRecord *HitRecord) Vec3 {
+	if hitRecord.Tangent.IsZero() || hitRecord.Bitangent.IsZero() {
+		return hitRecord.Normal
+	}
+
+	height := func(u, v float64) float64 {
+		return b.Scale * b.Height.Value(u, v, hitRecord.P).X
+	}
+	h := height(hitRecord.U, hitRecord.V)
+	dhdu := (height(hitRecord.U+bumpDelta, hitRecord.V) - h) / bumpDelta
+	dhdv := (height(hitRecord.U, hitRecord.V+bumpDelta) - h) / bumpDelta
+
+	// displace along the outward normal so that positive heights always raise the surface
+	outward := hitRecord.Normal
+	if !hitRecord.FrontFace {
+		outward = outward.Negate()
+	}
+	dpdu := hitRecord.Tangent.AddVector(outward.MultiplyFloat(dhdu))
+	dpdv := hitRecord.Bitangent.AddVector(outward.MultiplyFloat(dhdv))
+
+	normal, err := dpdu.Cross(dpdv).Unit()
+	if err != nil {
+		return hitRecord.Normal
+	}
+	return faceForward(normal, hitRecord.Normal)
+}
+
+// NormalMap replaces normals with ones read from a tangent-space normal map. Each texel stores a normal as
+// (x, y, z) * 0.5 + 0.5, where x points along the tangent, y along the bitangent and z along the surface normal.
+type NormalMap struct {
+	// Map is the normal map texture. Images should be loaded without sRGB conversion.
+	Map Texture
+	// Strength scales the tilt of the mapped normals, where 1 uses them unchanged and 0 disables the map
+	Strength float64
+}
+
+// NewNormalMap returns a normal map that reads tangent-space normals from the passed-in texture
+func NewNormalMap(normals Texture, strength float64) *NormalMap {
+	return &NormalMap{Map: normals, Strength: strength}
+}
+
+// Perturb transforms the normal stored in the map from tangent space to world space
+func (m *NormalMap) Perturb(hitRecord *HitRecord) Vec3 {
+	if hitRecord.Tangent.IsZero() {
+		return hitRecord.Normal
+	}
+
+	texel := m.Map.Value(hitRecord.U, hitRecord.V, hitRecord.P)
+	local := NewVec3(
+		(2*texel.X-1)*m.Strength,
+		(2*texel.Y-1)*m.Strength,
+		2*texel.Z-1,
+	)
+
+	// tangent space is built around the outward normal, and follows the direction of increasing v
+	outward := hitRecord.Normal
+	if !hitRecord.FrontFace {
+		outward = outward.Negate()
+	}
+	tangent, err := hitRecord.Tangent.SubtractVector(outward.MultiplyFloat(outward.Dot(hitRecord.Tangent))).Unit()
+	if err != nil {
+		return hitRecord.Normal
+	}
+	bitangent := outward.Cross(tangent)
+	if !hitRecord.Bitangent.IsZero() && bitangent.Dot(hitRecord.Bitangent) < 0 {
+		bitangent = bitangent.Negate()
+	}
+
+	frame := ONB{U: tangent, V: bitangent, W: outward}
+	normal, err := frame.ToWorld(local).Unit()
+	if err != nil {
+		return hitRecord.Normal
+	}
+	return faceForward(normal, hitRecord.Normal)
+}
+
+// PerturbedMaterial applies a bump or normal map to the hit point before handing it to its base material
+type PerturbedMaterial struct {
+	Base         Material
+	Perturbation NormalPerturbation
+}
+
+// NewPerturbedMaterial returns a material that shades like base with normals changed by perturbation
+func NewPerturbedMaterial(base Material, perturbation NormalPerturbation) *PerturbedMaterial {
+	return &PerturbedMaterial{Base: base, Perturbation: perturbation}
+}
+
+// Scatter scatters the ray off of the base material with the perturbed shading normal
+func (m *PerturbedMaterial) Scatter(rayIn Ray, hitRecord *HitRecord, rng *rand.Rand) (ScatterRecord, bool) {
+	unitDirection, err := rayIn.Direction().Unit()
+	if err != nil {
+		return ScatterRecord{}, false
+	}
+	perturbed := m.perturb(unitDirection.Negate(), hitRecord)
+	scatter, ok := m.Base.Scatter(rayIn, perturbed, rng)
+	if !ok || !sameSideOfSurface(scatter.Ray.Direction(), perturbed) {
+		return ScatterRecord{}, false
+	}
+	return scatter, true
+}
+
+// Evaluate evaluates the base material with the perturbed shading normal
+func (m *PerturbedMaterial) Evaluate(wo, wi Vec3, hitRecord *HitRecord) (Vec3, float64) {
+	perturbed := m.perturb(wo, hitRecord)
+	if !sameSideOfSurface(wi, perturbed) {
+		return NewVec3(0, 0, 0), 0
+	}
+	return m.Base.Evaluate(wo, wi, perturbed)
+}
+
+// perturb returns a copy of the hit record with a perturbed shading normal. Shading normals can end up facing
+// away from the viewer or below the real surface, which makes materials return black or leak light, so the
+// normal is bent back until both wo and the geometric normal are above its tangent plane.
+func (m *PerturbedMaterial) perturb(wo Vec3, hitRecord *HitRecord) *HitRecord {
+	perturbed := *hitRecord
+	geometric := hitRecord.GeometricNormal
+	if geometric.IsZero() {
+		geometric = hitRecord.Normal
+	}
+	perturbed.GeometricNormal = geometric
+
+	normal := m.Perturbation.Perturb(hitRecord)
+	normal = bendTowards(normal, geometric)
+	normal = bendTowards(normal, wo)
+	perturbed.Normal = normal
+	return &perturbed
+}
+
+// bendTowards tilts the unit normal n towards the unit direction d until their cosine is at least
+// minShadingCosine
+func bendTowards(n, d Vec3) Vec3 {
+	cosine := n.Dot(d)
+	if cosine >= minShadingCosine {
+		return n
+	}
+	bent, err := n.AddVector(d.MultiplyFloat(minShadingCosine - cosine)).Unit()
+	if err != nil {
+		return d
+	}
+	if bent.Dot(d) < minShadingCosine {
+		// when n points almost straight away from d there is nothing left to keep, so fall back to d
+		return d
+	}
+	return bent
+}
+
+// sameSideOfSurface returns whether a direction is on the same side of the geometric surface as it is of the
+// shading surface. Directions that are reflected according to the shading normal but would pass through the real
+// surface, or the other way around, are discarded.
+func sameSideOfSurface(direction Vec3, hitRecord *HitRecord) bool {
+	shading := direction.Dot(hitRecord.Normal)
+	geometric := direction.Dot(hitRecord.GeometricNormal)
+	return math.Signbit(shading) == math.Signbit(geometric)
+}
+
+// faceForward flips n so that it is on the same side as reference
+func faceForward(n, reference Vec3) Vec3 {
+	if n.Dot(reference) < 0 {
+		return n.Negate()
+	}
+	return n
+}
+
+// AlbedoAt returns the albedo of the base material
+func (m *PerturbedMaterial) AlbedoAt(hitRecord *HitRecord) Vec3 {
+	return materialAlbedo(m.Base, hitRecord)
+}
@@ -0,0 +1,102 @@
+package raytracer_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+// rampTexture rises linearly along u
+type rampTexture struct{}
+
+func (rampTexture) Value(u, v float64, p rt.Vec3) rt.Vec3 {
+	return rt.NewVec3(u, u, u)
+}
+
+// flatHitRecord is a hit on the z = 0 plane, parameterized so that u runs along +X and v along +Y
+func flatHitRecord() *rt.HitRecord {
+	return &rt.HitRecord{
+		P:               rt.NewVec3(0, 0, 0),
+		Normal:          rt.NewVec3(0, 0, 1),
+		GeometricNormal: rt.NewVec3(0, 0, 1),
+		Tangent:         rt.NewVec3(1, 0, 0),
+		Bitangent:       rt.NewVec3(0, 1, 0),
+		U:               0.5,
+		V:               0.5,
+		FrontFace:       true,
+	}
+}
+
+func TestBumpMap_Perturb(t *testing.T) {
+	t.Run("a constant height does not change the normal", func(t *testing.T) {
+		bump := rt.NewBumpMap(rt.NewConstantTexture(0.7), 2)
+		normal := bump.Perturb(flatHitRecord())
+		assert.InDelta(t, 1.0, normal.Z, 1e-9)
+	})
+
+	t.Run("a slope tilts the normal downhill", func(t *testing.T) {
+		bump := rt.NewBumpMap(rampTexture{}, 1)
+		normal := bump.Perturb(flatHitRecord())
+		// the surface rises by 1 for every 1 along x, so the normal leans 45 degrees towards -x
+		assert.InDelta(t, -1/math.Sqrt2, normal.X, 1e-6)
+		assert.InDelta(t, 1/math.Sqrt2, normal.Z, 1e-6)
+	})
+
+	t.Run("surfaces without tangents are left alone", func(t *testing.T) {
+		hitRecord := flatHitRecord()
+		hitRecord.Tangent = rt.Vec3{}
+		normal := rt.NewBumpMap(rampTexture{}, 1).Perturb(hitRecord)
+		assert.Equal(t, hitRecord.Normal, normal)
+	})
+}
+
+func TestNormalMap_Perturb(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		texel    rt.Vec3
+		strength float64
+		want     rt.Vec3
+	}{
+		{desc: "the flat color keeps the normal", texel: rt.NewVec3(0.5, 0.5, 1), strength: 1, want: rt.NewVec3(0, 0, 1)},
+		{desc: "red leans along the tangent", texel: rt.NewVec3(1, 0.5, 0.5), strength: 1, want: rt.NewVec3(1, 0, 0)},
+		{desc: "green leans along the bitangent", texel: rt.NewVec3(0.5, 1, 1), strength: 1, want: rt.NewVec3(0, 1/math.Sqrt2, 1/math.Sqrt2)},
+		{desc: "zero strength disables the map", texel: rt.NewVec3(1, 1, 0.5), strength: 0, want: rt.NewVec3(0, 0, 1)},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			normal := rt.NewNormalMap(rt.NewSolidColor(tc.texel), tc.strength).Perturb(flatHitRecord())
+			assert.InDelta(t, tc.want.X, normal.X, 1e-9)
+			assert.InDelta(t, tc.want.Y, normal.Y, 1e-9)
+			assert.InDelta(t, tc.want.Z, normal.Z, 1e-9)
+		})
+	}
+}
+
+func TestPerturbedMaterial(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// a normal map that tilts the shading normal almost into the surface
+	steep := rt.NewNormalMap(rt.NewSolidColor(rt.NewVec3(1, 0.5, 0.51)), 1)
+	material := rt.NewPerturbedMaterial(rt.NewLambertian(rt.NewVec3(1, 1, 1)), steep)
+	hitRecord := flatHitRecord()
+	// the viewer is on the side that the shading normal leans away from
+	rayIn := rt.NewRay(rt.NewVec3(-1, 0, 0.2), rt.NewVec3(1, 0, -0.2))
+
+	for i := 0; i < 200; i++ {
+		scatter, ok := material.Scatter(rayIn, hitRecord, rng)
+		if !ok {
+			continue
+		}
+		assert.True(t, scatter.Ray.Direction().Z > 0, "scattered ray went below the geometric surface")
+	}
+
+	wo := rt.NewVec3(-1, 0, 0.2)
+	value, pdf := material.Evaluate(wo, rt.NewVec3(0.9, 0, -0.1), hitRecord)
+	assert.Equal(t, 0.0, pdf, "light from below the geometric surface should not be reflected")
+	assert.True(t, value.NearZero())
+
+	value, pdf = material.Evaluate(wo, rt.NewVec3(0, 0, 1), hitRecord)
+	assert.True(t, pdf > 0)
+	assert.False(t, value.NearZero())
+}
@@ -0,0 +1,34 @@
+package raytracer
+
+import "math"
+
+// ONB is an orthonormal basis. It is used to move directions between world space and a surface's local shading
+// space, where W is the surface normal and U and V lie in the tangent plane.
+type ONB struct {
+	U, V, W Vec3
+}
+
+// NewONB returns an orthonormal basis around the passed-in unit normal with an arbitrary tangent
+func NewONB(normal Vec3) ONB {
+	// Duff et al., "Building an Orthonormal Basis, Revisited"
+	sign := math.Copysign(1, normal.Z)
+	a := -1 / (sign + normal.Z)
+	b := normal.X * normal.Y * a
+	return ONB{
+		U: NewVec3(1+sign*normal.X*normal.X*a, sign*b, -sign*normal.X),
+		V: NewVec3(b, sign+normal.Y*normal.Y*a, -normal.Y),
+		W: normal,
+	}
+}
+
+// ToLocal expresses a world space direction in the basis
+func (o ONB) ToLocal(v Vec3) Vec3 {
+	return NewVec3(v.Dot(o.U), v.Dot(o.V), v.Dot(o.W))
+}
+
+// ToWorld converts a direction expressed in the basis back to world space
+func (o ONB) ToWorld(v Vec3) Vec3 {
+	return o.U.MultiplyFloat(v.X).
+		AddVector(o.V.MultiplyFloat(v.Y)).
+		AddVector(o.W.MultiplyFloat(v.Z))
+}
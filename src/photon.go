@@ -0,0 +1,472 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// DefaultPhotons is the number of photons shot into the scene for each photon map, unless an integrator says
+// otherwise
+const DefaultPhotons = 100000
+
+// DefaultPhotonRadius is the distance around a point within which photons are gathered, unless an integrator says
+// otherwise. It suits scenes about the size of the command line renderer's.
+const DefaultPhotonRadius = 0.05
+
+// DefaultProgressiveAlpha is the fraction of the photons of each pass that a ProgressivePhotonMapIntegrator keeps
+// as its radius shrinks, unless it says otherwise
+const DefaultProgressiveAlpha = 2.0 / 3
+
+// PhotonMapIntegrator renders in two passes. It first shoots photons from the environment and the lights into the
+// scene and stores where they land on surfaces that are not perfectly specular. Camera rays then follow mirrors and
+// glass to the first other surface, where the light arriving straight from the lights and the environment is
+// sampled with shadow rays, the light focused onto it by mirrors and glass is estimated from the density of the
+// photons around it, and the rest is gathered from the photons around wherever a ray scattered off of it lands.
+// Caustics, which a PathIntegrator barely finds, are resolved with few samples, at the cost of blurring them by the
+// photons' radius.
+//
+// Photons from the environment and the sun are shot from a disk as wide as the world, so worlds that are not
+// bounded are rendered by a PathIntegrator instead.
+type PhotonMapIntegrator struct {
+	// MaxDepth is the maximum number of surfaces that a photon, or a camera ray on its way to where photons are
+	// gathered, may hit
+	MaxDepth int
+	// Photons is the number of photons shot into the scene, or 0 for DefaultPhotons
+	Photons int
+	// Radius is the distance around a point within which photons are gathered, or 0 for DefaultPhotonRadius
+	Radius float64
+
+	cache tracerCache
+}
+
+// Radiance returns the light that arrives along the ray. The photons are shot the first time it is called with a
+// scene, and reused for later calls with the same scene.
+func (p *PhotonMapIntegrator) Radiance(r Ray, scene *Scene, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	return p.cache.get(scene, func() func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+		return p.begin(scene, nil)
+	})(r, rng, hitRecord)
+}
+
+// begin shoots the photons once for the whole render
+func (p *PhotonMapIntegrator) begin(scene *Scene, film *film) func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	t, ok := newPhotonTracer(scene, p.MaxDepth, p.Radius)
+	if !ok {
+		path := &PathIntegrator{MaxDepth: p.MaxDepth}
+		return func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+			return path.Radiance(ray, scene, rng, hitRecord)
+		}
+	}
+	photons := t.shoot(photonCount(p.Photons), film.seed(), 0)
+	var caustics []photon
+	for _, photon := range photons {
+		if photon.kind == causticPhoton {
+			caustics = append(caustics, photon)
+		}
+	}
+	t.lookup = newPhotonMap(caustics)
+	t.gather = newPhotonMap(photons)
+	return t.radiance
+}
+
+// ProgressivePhotonMapIntegrator is a progressive photon mapper. Every pass of a render shoots a new set of photons,
+// and estimates the light that arrives at the first surface behind mirrors and glass from the density of the
+// photons that bounced at least once around it. The radius that photons are gathered from shrinks from pass to
+// pass, so that unlike a PhotonMapIntegrator, the blur of its estimates fades away and the render converges to the
+// same image as a PathIntegrator's, while caustics still take far fewer samples.
+//
+// The radius follows one schedule for the whole image, which only depends on the pass, rather than shrinking
+// around each point by the number of photons that it has found as stochastic progressive photon mapping does.
+// Points that few photons reach are left noisier than they would be with a radius of their own, and points that
+// many photons reach blurrier.
+//
+// Photons from the environment and the sun are shot from a disk as wide as the world, so worlds that are not
+// bounded are rendered by a PathIntegrator instead.
+type ProgressivePhotonMapIntegrator struct {
+	// MaxDepth is the maximum number of surfaces that a photon, or a camera ray on its way to where photons are
+	// gathered, may hit
+	MaxDepth int
+	// Photons is the number of photons shot into the scene in each pass, or 0 for DefaultPhotons
+	Photons int
+	// Radius is the distance around a point within which photons are gathered in the first pass, or 0 for
+	// DefaultPhotonRadius
+	Radius float64
+	// Alpha, between 0 and 1, is how quickly the radius shrinks, as the fraction of the photons within it that each
+	// pass keeps. Lower values shrink the radius faster, which blurs less but leaves more noise. 0 uses
+	// DefaultProgressiveAlpha.
+	Alpha float64
+
+	cache tracerCache
+}
+
+// Radiance returns the light that arrives along the ray, using the photons and radius of a render's first pass.
+// The photons are shot the first time it is called with a scene, and reused for later calls with the same scene.
+func (s *ProgressivePhotonMapIntegrator) Radiance(r Ray, scene *Scene, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	return s.cache.get(scene, func() func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+		return s.begin(scene, nil)
+	})(r, rng, hitRecord)
+}
+
+// begin shoots the photons of the render's current pass, and returns a function that shoots new ones whenever
+// another pass starts
+func (s *ProgressivePhotonMapIntegrator) begin(scene *Scene, film *film) func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	t, ok := newPhotonTracer(scene, s.MaxDepth, s.Radius)
+	if !ok {
+		path := &PathIntegrator{MaxDepth: s.MaxDepth}
+		return func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+			return path.Radiance(ray, scene, rng, hitRecord)
+		}
+	}
+	alpha := s.Alpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = DefaultProgressiveAlpha
+	}
+	initialRadius := t.radius
+
+	pass := film.passes()
+	shoot := func() {
+		t.radius = initialRadius * progressiveRadiusScale(pass, alpha)
+		photons := t.shoot(photonCount(s.Photons), film.seed(), pass)
+		// light that reaches the camera's surface straight from the lights and the environment is sampled instead
+		bounced := photons[:0]
+		for _, photon := range photons {
+			if photon.kind != directPhoton {
+				bounced = append(bounced, photon)
+			}
+		}
+		t.lookup = newPhotonMap(bounced)
+	}
+	shoot()
+	return func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+		if current := film.passes(); current != pass {
+			pass = current
+			shoot()
+		}
+		return t.radiance(ray, rng, hitRecord)
+	}
+}
+
+// progressiveRadiusScale returns how much the radius that photons are gathered from has shrunk by the passed-in
+// pass, counted from 0. Each pass shrinks the area of the disk around every point so that it would hold alpha times
+// the photons that the last pass's disk held, on top of the ones that it kept from the passes before, if photons
+// landed evenly everywhere. This makes the average of the passes converge.
+func progressiveRadiusScale(pass int, alpha float64) float64 {
+	areaScale := 1.0
+	for i := 1; i <= pass; i++ {
+		areaScale *= (float64(i) + alpha) / float64(i+1)
+	}
+	return math.Sqrt(areaScale)
+}
+
+// photonCount returns the number of photons to shoot when an integrator asks for count
+func photonCount(count int) int {
+	if count <= 0 {
+		return DefaultPhotons
+	}
+	return count
+}
+
+// photonKind is what a photon went through before it landed
+type photonKind int
+
+const (
+	// directPhoton came straight from the environment or a light
+	directPhoton photonKind = iota
+	// causticPhoton was only reflected or refracted by perfectly specular surfaces
+	causticPhoton
+	// indirectPhoton bounced off of at least one surface that is not perfectly specular
+	indirectPhoton
+)
+
+// photon is a packet of light that was traced from the environment or a light and landed on a surface
+type photon struct {
+	p Vec3
+	// wi is the unit direction that the photon arrived from
+	wi Vec3
+	// power is the light that the photon carries
+	power Vec3
+	kind  photonKind
+	// axis is the axis along which the photon splits the photons of its subtree in a photon map
+	axis int
+}
+
+// photonTracer shoots photons into a scene, and estimates the light that arrives at the camera from them
+type photonTracer struct {
+	scene *Scene
+	light *infiniteLight
+	// emitters are the lights inside of the scene that photons are shot from, along with the environment
+	emitters []emitter
+	maxDepth int
+	radius   float64
+	// lookup holds the photons whose light is estimated right where the camera's rays land, and gather, if not nil,
+	// the photons whose light is estimated where rays scattered off of those surfaces land
+	lookup, gather *photonMap
+}
+
+// newPhotonTracer returns a tracer for the scene, or false if its world is not bounded
+func newPhotonTracer(scene *Scene, maxDepth int, radius float64) (*photonTracer, bool) {
+	light, ok := newInfiniteLight(scene)
+	if !ok {
+		return nil, false
+	}
+	if radius <= 0 {
+		radius = DefaultPhotonRadius
+	}
+	t := &photonTracer{scene: scene, light: light, maxDepth: maxDepth, radius: radius}
+	for _, light := range scene.Lights {
+		if e, ok := light.(emitter); ok {
+			t.emitters = append(t.emitters, e)
+		}
+	}
+	return t, true
+}
+
+// shoot traces count photons from the environment and the lights into the scene, and returns every time one of
+// them lands on a surface that is not perfectly specular. The random numbers of each photon only depend on the
+// seed, the pass and the photon.
+func (t *photonTracer) shoot(count int, seed int64, pass int) []photon {
+	var photons []photon
+	rng := rand.New(&splitMix64{})
+	var hitRecord HitRecord
+	for i := 0; i < count; i++ {
+		// photons are numbered after the pixels so that they do not share their random numbers
+		rng.Seed(sampleSeed(seed, pass, -1-i))
+		r, power := t.emit(rng)
+		if power.IsZero() {
+			continue
+		}
+		power = power.MultiplyFloat(1 / float64(count))
+		kind := directPhoton
+		for depth := 0; depth < t.maxDepth; depth++ {
+			if !t.scene.World.Hit(r, 0.001, math.Inf(1), &hitRecord) {
+				break
+			}
+			wo, _ := r.Direction().Unit()
+			wo = wo.Negate()
+			scatter, ok := hitRecord.Material.Scatter(r, &hitRecord, rng)
+			if !scatter.IsSpecular {
+				photons = append(photons, photon{p: hitRecord.P, wi: wo, power: power, kind: kind})
+				kind = indirectPhoton
+			} else if kind == directPhoton {
+				kind = causticPhoton
+			}
+			if !ok {
+				break
+			}
+
+			wi, _ := scatter.Ray.Direction().Unit()
+			next := power.MultiplyVector(scatter.Attenuation).MultiplyFloat(adjoint(&hitRecord, wo, wi))
+			// photons that lose light are ended at random rather than dimmed, so that every photon carries about
+			// as much light as it started with
+			survival := math.Min(1, next.MaxComponent()/power.MaxComponent())
+			if !(rng.Float64() < survival) {
+				break
+			}
+			power = next.MultiplyFloat(1 / survival)
+			r = scatter.Ray
+		}
+	}
+	return photons
+}
+
+// emit picks a ray of light that leaves the environment or one of the lights, which are all equally likely to be
+// picked, and returns it along with the power that it carries divided by the density of picking it
+func (t *photonTracer) emit(rng *rand.Rand) (Ray, Vec3) {
+	if len(t.emitters) > 0 {
+		sources := len(t.emitters) + 1
+		if source := rng.Intn(sources); source < len(t.emitters) {
+			r, power := t.emitters[source].emit(rng, t.light.center, t.light.radius)
+			return r, power.MultiplyFloat(float64(sources))
+		}
+		r, power := t.emitEnvironment(rng)
+		return r, power.MultiplyFloat(float64(sources))
+	}
+	return t.emitEnvironment(rng)
+}
+
+// emitEnvironment picks a ray of light that leaves the environment, and returns it along with the power that it
+// carries divided by the density of picking it
+func (t *photonTracer) emitEnvironment(rng *rand.Rand) (Ray, Vec3) {
+	r, radiance, pdfPos, pdfDir := t.light.emit(rng)
+	if pdfPos == 0 || pdfDir == 0 {
+		return Ray{}, Vec3{}
+	}
+	return r, radiance.MultiplyFloat(1 / (pdfPos * pdfDir))
+}
+
+// radiance follows the camera ray through perfectly specular surfaces to the first one that is not, and returns
+// the light that leaves it towards the camera
+func (t *photonTracer) radiance(r Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	throughput := NewVec3(1, 1, 1)
+	for depth := 0; depth < t.maxDepth; depth++ {
+		if !t.scene.World.Hit(r, 0.001, math.Inf(1), hitRecord) {
+			return throughput.MultiplyVector(r.background(t.scene, 0))
+		}
+		scatter, ok := hitRecord.Material.Scatter(r, hitRecord, rng)
+		if ok && scatter.IsSpecular {
+			throughput = throughput.MultiplyVector(scatter.Attenuation)
+			r = scatter.Ray
+			continue
+		}
+
+		// the shadow ray overwrites the hit record, which the photons are still looked up with
+		visible := *hitRecord
+		wo, _ := r.Direction().Unit()
+		wo = wo.Negate()
+		radiance := r.directLight(t.scene, hitRecord, rng)
+		radiance = radiance.AddVector(t.lookup.estimate(&visible, wo, t.radius))
+		if ok {
+			scattered := t.follow(scatter.Ray, scatter.Pdf, t.maxDepth-depth-1, rng, hitRecord)
+			radiance = radiance.AddVector(scatter.Attenuation.MultiplyVector(scattered))
+		}
+		return throughput.MultiplyVector(radiance)
+	}
+	return Vec3{}
+}
+
+// follow returns the light that arrives along a ray scattered off of the surface that the camera sees, with
+// scatterPdf the density of its direction, and which may hit at most maxDepth surfaces. Light that it finds
+// straight on the environment was also sampled by the surface's shadow ray, and is weighted to match. If there is
+// a map for final gathering, the light leaving the first surface behind mirrors and glass that the ray lands on is
+// estimated from its photons. Light that the ray finds on the environment behind mirrors and glass is left out,
+// since it is a caustic that the surface's own photons already account for.
+func (t *photonTracer) follow(r Ray, scatterPdf float64, maxDepth int, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+	throughput := NewVec3(1, 1, 1)
+	for depth := 0; depth < maxDepth; depth++ {
+		if !t.scene.World.Hit(r, 0.001, math.Inf(1), hitRecord) {
+			if depth > 0 {
+				return Vec3{}
+			}
+			return r.background(t.scene, scatterPdf)
+		}
+		if t.gather == nil {
+			return Vec3{}
+		}
+		scatter, ok := hitRecord.Material.Scatter(r, hitRecord, rng)
+		if ok && scatter.IsSpecular {
+			throughput = throughput.MultiplyVector(scatter.Attenuation)
+			r = scatter.Ray
+			continue
+		}
+		wo, _ := r.Direction().Unit()
+		return throughput.MultiplyVector(t.gather.estimate(hitRecord, wo.Negate(), t.radius))
+	}
+	return Vec3{}
+}
+
+// photonMap is a balanced kd-tree of photons. The photons are stored in a slice in which the root of every subtree
+// is the middle photon of the subtree's range, with the photons on either side of it in the two halves.
+type photonMap struct {
+	photons []photon
+}
+
+// newPhotonMap builds a map of the photons, which are reordered in place
+func newPhotonMap(photons []photon) *photonMap {
+	buildPhotonMap(photons)
+	return &photonMap{photons: photons}
+}
+
+func buildPhotonMap(photons []photon) {
+	if len(photons) <= 1 {
+		return
+	}
+
+	// split along the axis where the photons are the most spread out
+	bounds := NewAABB(photons[0].p, photons[0].p)
+	for _, photon := range photons[1:] {
+		bounds = bounds.Union(NewAABB(photon.p, photon.p))
+	}
+	extent := bounds.Max.SubtractVector(bounds.Min)
+	axis := 0
+	if extent.Y > extent.X && extent.Y >= extent.Z {
+		axis = 1
+	} else if extent.Z > extent.X && extent.Z > extent.Y {
+		axis = 2
+	}
+
+	middle := len(photons) / 2
+	selectPhoton(photons, middle, axis)
+	photons[middle].axis = axis
+	buildPhotonMap(photons[:middle])
+	buildPhotonMap(photons[middle+1:])
+}
+
+// selectPhoton reorders the photons so that the one at index k is the one that would be there if they were sorted
+// along the axis, with none of the photons before it further along the axis and none of the ones after it less
+// far
+func selectPhoton(photons []photon, k, axis int) {
+	low, high := 0, len(photons)-1
+	for low < high {
+		pivot := coordinate(photons[(low+high)/2].p, axis)
+		i, j := low, high
+		for i <= j {
+			for coordinate(photons[i].p, axis) < pivot {
+				i++
+			}
+			for coordinate(photons[j].p, axis) > pivot {
+				j--
+			}
+			if i <= j {
+				photons[i], photons[j] = photons[j], photons[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case k <= j:
+			high = j
+		case k >= i:
+			low = i
+		default:
+			return
+		}
+	}
+}
+
+// coordinate returns the component of v along an axis, where 0 is X, 1 is Y and 2 is Z
+func coordinate(v Vec3, axis int) float64 {
+	switch axis {
+	case 1:
+		return v.Y
+	case 2:
+		return v.Z
+	}
+	return v.X
+}
+
+// estimate returns the light that leaves the surface that hitRecord describes towards wo, estimated from the
+// density of the photons within radius of the hit point
+func (m *photonMap) estimate(hitRecord *HitRecord, wo Vec3, radius float64) Vec3 {
+	sum := m.sum(m.photons, hitRecord, wo, radius*radius)
+	return sum.MultiplyFloat(1 / (math.Pi * radius * radius))
+}
+
+// sum adds up the light that the photons of a subtree within the square root of radiusSquared of the hit point
+// reflect towards wo
+func (m *photonMap) sum(photons []photon, hitRecord *HitRecord, wo Vec3, radiusSquared float64) Vec3 {
+	if len(photons) == 0 {
+		return Vec3{}
+	}
+	middle := len(photons) / 2
+	node := &photons[middle]
+
+	// the side of the splitting plane that the point is on is searched first, and the other only if the disk
+	// around the point crosses the plane
+	offset := coordinate(hitRecord.P, node.axis) - coordinate(node.p, node.axis)
+	near, far := photons[:middle], photons[middle+1:]
+	if offset > 0 {
+		near, far = far, near
+	}
+	sum := m.sum(near, hitRecord, wo, radiusSquared)
+	if offset*offset < radiusSquared {
+		sum = sum.AddVector(m.sum(far, hitRecord, wo, radiusSquared))
+	}
+
+	if node.p.SubtractVector(hitRecord.P).LengthSquared() < radiusSquared {
+		// the photon's power is spread over the surface, so the BSDF's cosine is already accounted for
+		value, _ := hitRecord.Material.Evaluate(wo, node.wi, hitRecord)
+		if cosine := math.Abs(node.wi.Dot(hitRecord.Normal)); cosine > 0 {
+			sum = sum.AddVector(value.MultiplyVector(node.power).MultiplyFloat(1 / cosine))
+		}
+	}
+	return sum
+}
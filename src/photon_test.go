@@ -0,0 +1,85 @@
+package raytracer_test
+
+import (
+	"context"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhotonIntegrators_Converge(t *testing.T) {
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+	// the disk keeps the world small, so that enough photons land in view
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -1), Radius: 0.5, Material: rt.NewLambertian(rt.NewVec3(0.7, 0.3, 0.3))})
+	world.Add(&rt.Disk{Center: rt.NewVec3(0, -0.5, -1), Radius: 1.5, Material: rt.NewLambertian(rt.NewVec3(0.8, 0.8, 0.8))})
+	diffuse := &rt.Scene{World: world}
+	// the low sun only reaches the ceiling by bouncing off of the floor, in the dark
+	room := &rt.HittableList{}
+	room.Add(&rt.Disk{Center: rt.NewVec3(0, -0.5, -1), Radius: 1.5, Material: rt.NewLambertian(rt.NewVec3(0.8, 0.8, 0.8))})
+	room.Add(&rt.Disk{Center: rt.NewVec3(0, 0.5, -1), Radius: 1.5, Material: rt.NewLambertian(rt.NewVec3(0.8, 0.8, 0.8))})
+	darkness, err := rt.NewEnvironmentLight(rt.NewHDRImage(1, 1), 0, 1)
+	assert.Nil(t, err)
+	sunlit := &rt.Scene{World: room, Environment: darkness, Lights: []rt.Light{&rt.SunLight{Direction: rt.NewVec3(-1, -0.3, 0), Irradiance: rt.NewVec3(4, 4, 4), AngularDiameter: 0.53}}}
+
+	for _, tc := range []struct {
+		desc       string
+		scene      *rt.Scene
+		integrator rt.Integrator
+	}{
+		{desc: "photon mapping a diffuse sphere under the sky", scene: diffuse, integrator: &rt.PhotonMapIntegrator{MaxDepth: 16, Photons: 100000}},
+		{desc: "photon mapping a ceiling lit by the sun", scene: sunlit, integrator: &rt.PhotonMapIntegrator{MaxDepth: 16, Photons: 100000}},
+		{desc: "photon mapping a caustic", scene: causticScene(t), integrator: &rt.PhotonMapIntegrator{MaxDepth: 16, Photons: 100000}},
+		{desc: "progressive photon mapping a diffuse sphere under the sky", scene: diffuse, integrator: &rt.ProgressivePhotonMapIntegrator{MaxDepth: 16, Photons: 5000, Radius: 0.1}},
+		{desc: "progressive photon mapping a ceiling lit by the sun", scene: sunlit, integrator: &rt.ProgressivePhotonMapIntegrator{MaxDepth: 16, Photons: 5000, Radius: 0.1}},
+		{desc: "progressive photon mapping a caustic", scene: causticScene(t), integrator: &rt.ProgressivePhotonMapIntegrator{MaxDepth: 16, Photons: 5000, Radius: 0.1}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := rt.RenderOptions{Width: 32, Height: 18, SamplesPerPixel: 256, Seed: 1}
+			opts.Integrator = &rt.PathIntegrator{MaxDepth: 16, RouletteDepth: -1}
+			reference, err := rt.Render(context.Background(), tc.scene, camera, opts)
+			assert.Nil(t, err)
+			opts.Integrator = tc.integrator
+			opts.Seed = 2
+			photons, err := rt.Render(context.Background(), tc.scene, camera, opts)
+			assert.Nil(t, err)
+
+			want, wantQuarters := meanLuminance(reference)
+			got, gotQuarters := meanLuminance(photons)
+			assert.InDelta(t, 1, got/want, 0.01, "mean luminance %v, want %v", got, want)
+			for i := range wantQuarters {
+				assert.InDelta(t, 1, gotQuarters[i]/wantQuarters[i], 0.03, "quarter %d: %v, want %v", i, gotQuarters[i], wantQuarters[i])
+			}
+		})
+	}
+}
+
+func TestProgressivePhotonMapIntegrator_Resume(t *testing.T) {
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+	scene := causticScene(t)
+	opts := rt.RenderOptions{Width: 8, Height: 6, SamplesPerPixel: 4, Seed: 3, Integrator: &rt.ProgressivePhotonMapIntegrator{MaxDepth: 8, Photons: 1000}}
+	uninterrupted, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+
+	// every pass shoots its own photons, which only depend on the seed and the pass
+	opts.SamplesPerPixel = 2
+	interrupted, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+	opts.SamplesPerPixel = 4
+	opts.Resume = interrupted
+	resumed, err := rt.Render(context.Background(), scene, camera, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, uninterrupted.Image(), resumed.Image())
+}
+
+func TestPhotonMapIntegrator_Radiance(t *testing.T) {
+	world := &rt.HittableList{}
+	world.Add(&rt.Sphere{Center: rt.NewVec3(0, 0, -2), Radius: 1})
+	integrator := &rt.PhotonMapIntegrator{MaxDepth: 4, Photons: 1000}
+	first := radiance(integrator, world, rt.NewVec3(0, 0, -1))
+	assert.True(t, first.MaxComponent() > 0, "the sphere is lit by the sky, got %v", first)
+	assert.Equal(t, first, radiance(integrator, world, rt.NewVec3(0, 0, -1)), "the photons only depend on the scene")
+}
@@ -0,0 +1,135 @@
+package raytracer
+
+import "math"
+
+// maxDegree is the highest degree of the polynomials that are solved for the roots where rays cross surfaces
+const maxDegree = 4
+
+// solveQuadratic returns the real roots of a*t^2 + b*t + c = 0 in increasing order, as the first n of the array. A
+// repeated root is left out, because it is where a ray only grazes a surface. When a is zero the equation is solved
+// as a linear one.
+func solveQuadratic(a, b, c float64) (roots [2]float64, n int) {
+	if a == 0 {
+		if b == 0 {
+			return roots, 0
+		}
+		roots[0] = -c / b
+		return roots, 1
+	}
+	discriminant := b*b - 4*a*c
+	if discriminant <= 0 {
+		return roots, 0
+	}
+	// this form avoids subtracting two nearly equal numbers, which loses precision
+	q := -0.5 * (b + math.Copysign(math.Sqrt(discriminant), b))
+	t0, t1 := q/a, c/q
+	if t0 > t1 {
+		t0, t1 = t1, t0
+	}
+	roots[0], roots[1] = t0, t1
+	return roots, 2
+}
+
+// solveQuartic returns the real roots of a*t^4 + b*t^3 + c*t^2 + d*t + e = 0 in increasing order, as the first n
+// of the array
+func solveQuartic(a, b, c, d, e float64) (roots [4]float64, n int) {
+	coefficients := [5]float64{a, b, c, d, e}
+	return polynomialRoots(coefficients[:])
+}
+
+// polynomialRoots returns the real roots of the polynomial with the passed-in coefficients, from the highest power
+// down, in increasing order, as the first n of the array. Roots where the polynomial touches zero without crossing
+// it are left out. The polynomial may be at most of degree maxDegree.
+//
+// The roots of the derivative split the line into pieces where the polynomial only rises or only falls, so each
+// piece holds at most one root, which is then found by Newton's method kept inside the piece by bisection. Unlike
+// closed-form solutions, this stays accurate when roots are close together.
+func polynomialRoots(coefficients []float64) (roots [maxDegree]float64, n int) {
+	for len(coefficients) > 0 && coefficients[0] == 0 {
+		coefficients = coefficients[1:]
+	}
+	if len(coefficients) <= 3 {
+		switch len(coefficients) {
+		case 2:
+			roots[0] = -coefficients[1] / coefficients[0]
+			return roots, 1
+		case 3:
+			quadratic, n := solveQuadratic(coefficients[0], coefficients[1], coefficients[2])
+			copy(roots[:], quadratic[:n])
+			return roots, n
+		}
+		return roots, 0
+	}
+
+	degree := len(coefficients) - 1
+	var derivativeBuffer [maxDegree]float64
+	derivative := derivativeBuffer[:degree]
+	for i := range derivative {
+		derivative[i] = coefficients[i] * float64(degree-i)
+	}
+
+	// every root is within the Cauchy bound of the origin
+	bound := 0.0
+	for _, c := range coefficients[1:] {
+		bound = math.Max(bound, math.Abs(c/coefficients[0]))
+	}
+	bound++
+	// the pieces run between the edges, which are the bounds and the roots of the derivative between them
+	var edgeBuffer [maxDegree + 1]float64
+	edges := append(edgeBuffer[:0], -bound)
+	critical, criticalCount := polynomialRoots(derivative)
+	for _, x := range critical[:criticalCount] {
+		if x > -bound && x < bound {
+			edges = append(edges, x)
+		}
+	}
+	edges = append(edges, bound)
+
+	for i := 0; i+1 < len(edges); i++ {
+		lo, hi := edges[i], edges[i+1]
+		pLo, pHi := evaluatePolynomial(coefficients, lo), evaluatePolynomial(coefficients, hi)
+		if pLo*pHi >= 0 {
+			continue
+		}
+		roots[n] = refineRoot(coefficients, derivative, lo, hi, pLo)
+		n++
+	}
+	return roots, n
+}
+
+// evaluatePolynomial returns the value of the polynomial at x, using Horner's method
+func evaluatePolynomial(coefficients []float64, x float64) float64 {
+	value := 0.0
+	for _, c := range coefficients {
+		value = value*x + c
+	}
+	return value
+}
+
+// refineRoot finds the root of a polynomial between lo and hi, where it has the value pLo at lo and the opposite
+// sign at hi
+func refineRoot(coefficients, derivative []float64, lo, hi, pLo float64) float64 {
+	x := 0.5 * (lo + hi)
+	for i := 0; i < 100; i++ {
+		p := evaluatePolynomial(coefficients, x)
+		if p == 0 {
+			return x
+		}
+		// keep the root between lo and hi
+		if (p < 0) == (pLo < 0) {
+			lo, pLo = x, p
+		} else {
+			hi = x
+		}
+
+		next := x - p/evaluatePolynomial(derivative, x)
+		if math.IsNaN(next) || next <= lo || next >= hi {
+			next = 0.5 * (lo + hi)
+		}
+		if math.Abs(next-x) <= 1e-15*math.Max(1, math.Abs(x)) {
+			return next
+		}
+		x = next
+	}
+	return x
+}
@@ -0,0 +1,310 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// PrincipledBSDF is an artist friendly uber material modelled after the Disney principled BSDF. It layers a
+// diffuse base with sheen, a GGX specular lobe, rough dielectric transmission and a clear coat. Every parameter is
+// a texture so that it can vary over the surface; scalar parameters are read from the first channel.
+type PrincipledBSDF struct {
+	// BaseColor is the diffuse color of dielectrics and the specular color of metals
+	BaseColor Texture
+	// Metallic blends between a dielectric (0) and a metal (1)
+	Metallic Texture
+	// Roughness controls the spread of the specular and transmission lobes
+	Roughness Texture
+	// Specular scales the reflectance of dielectrics at normal incidence, where 0.5 is 4%
+	Specular Texture
+	// SpecularTint tints dielectric reflections towards the base color
+	SpecularTint Texture
+	// Sheen adds a soft reflection at grazing angles, for cloth
+	Sheen Texture
+	// SheenTint tints the sheen towards the base color
+	SheenTint Texture
+	// Clearcoat is the strength of a second, colorless specular layer
+	Clearcoat Texture
+	// ClearcoatGloss controls how sharp the clear coat is
+	ClearcoatGloss Texture
+	// Transmission blends between an opaque (0) and a fully transmissive (1) dielectric
+	Transmission Texture
+	// IOR is the index of refraction used for transmission
+	IOR Texture
+}
+
+// NewPrincipledBSDF returns a principled material with the default parameters of a grey, semi-rough plastic
+func NewPrincipledBSDF() *PrincipledBSDF {
+	return &PrincipledBSDF{
+		BaseColor:      NewSolidColor(NewVec3(0.8, 0.8, 0.8)),
+		Metallic:       NewConstantTexture(0),
+		Roughness:      NewConstantTexture(0.5),
+		Specular:       NewConstantTexture(0.5),
+		SpecularTint:   NewConstantTexture(0),
+		Sheen:          NewConstantTexture(0),
+		SheenTint:      NewConstantTexture(0.5),
+		Clearcoat:      NewConstantTexture(0),
+		ClearcoatGloss: NewConstantTexture(1),
+		Transmission:   NewConstantTexture(0),
+		IOR:            NewConstantTexture(1.5),
+	}
+}
+
+// Scatter picks one of the lobes of the material and samples a direction from it
+func (m *PrincipledBSDF) Scatter(rayIn Ray, hitRecord *HitRecord, rng *rand.Rand) (ScatterRecord, bool) {
+	frame := shadingFrame(hitRecord)
+	wo, ok := localOutgoing(frame, rayIn)
+	if !ok {
+		return ScatterRecord{}, false
+	}
+	lobes, ok := m.lobes(hitRecord, wo)
+	if !ok {
+		return ScatterRecord{}, false
+	}
+
+	wi, ok := lobes.sample(wo, rng)
+	if !ok {
+		return ScatterRecord{}, false
+	}
+	value, pdf := lobes.evaluate(wo, wi)
+	if pdf == 0 {
+		return ScatterRecord{}, false
+	}
+	return ScatterRecord{
+		Ray:         NewRay(hitRecord.P, frame.ToWorld(wi)),
+		Attenuation: value.MultiplyFloat(1 / pdf),
+		Pdf:         pdf,
+	}, true
+}
+
+// Evaluate returns the sum of all lobes multiplied by the cosine term, and the density of sampling wi
+func (m *PrincipledBSDF) Evaluate(wo, wi Vec3, hitRecord *HitRecord) (Vec3, float64) {
+	frame := shadingFrame(hitRecord)
+	woLocal, wiLocal := frame.ToLocal(wo), frame.ToLocal(wi)
+	if woLocal.Z <= 0 {
+		return NewVec3(0, 0, 0), 0
+	}
+	lobes, ok := m.lobes(hitRecord, woLocal)
+	if !ok {
+		return NewVec3(0, 0, 0), 0
+	}
+	return lobes.evaluate(woLocal, wiLocal)
+}
+
+// principledLobes holds the parameters of a principled material looked up at a single hit point
+type principledLobes struct {
+	baseColor, tint                                    Vec3
+	metallic, specular, specularTint, sheen, sheenTint float64
+	clearcoat, clearcoatAlpha, transmission            float64
+	specularDistribution                               GGX
+	dielectric                                         RoughDielectric
+	eta                                                float64
+	pDiffuse, pSpecular, pTransmission, pClearcoat     float64
+}
+
+// clearcoatDistribution is the fixed distribution used to mask and shadow the clear coat
+var clearcoatDistribution = GGX{AlphaX: 0.25, AlphaY: 0.25}
+
+// lobes evaluates the textures of the material at the hit point and works out how likely each lobe is to be
+// sampled, proportionally to how much light it is expected to reflect towards wo
+func (m *PrincipledBSDF) lobes(hitRecord *HitRecord, wo Vec3) (principledLobes, bool) {
+	scalar := func(t Texture) float64 {
+		return t.Value(hitRecord.U, hitRecord.V, hitRecord.P).X
+	}
+
+	l := principledLobes{
+		baseColor:    m.BaseColor.Value(hitRecord.U, hitRecord.V, hitRecord.P),
+		metallic:     clamp(scalar(m.Metallic), 0, 1),
+		specular:     math.Max(0, scalar(m.Specular)),
+		specularTint: clamp(scalar(m.SpecularTint), 0, 1),
+		sheen:        math.Max(0, scalar(m.Sheen)),
+		sheenTint:    clamp(scalar(m.SheenTint), 0, 1),
+		clearcoat:    math.Max(0, scalar(m.Clearcoat)),
+		transmission: clamp(scalar(m.Transmission), 0, 1),
+	}
+	// the clear coat's gloss maps to the alpha of its GTR1 distribution
+	gloss := clamp(scalar(m.ClearcoatGloss), 0, 1)
+	l.clearcoatAlpha = (1-gloss)*0.1 + gloss*0.001
+
+	// never let the lobes become perfectly specular so that every lobe can be evaluated for any pair of directions
+	alpha := math.Max(RoughnessToAlpha(scalar(m.Roughness)), smoothAlpha)
+	l.specularDistribution = GGX{AlphaX: alpha, AlphaY: alpha}
+	l.dielectric = RoughDielectric{IOR: m.ior(hitRecord), Distribution: l.specularDistribution}
+	l.eta = l.dielectric.relativeIOR(hitRecord)
+
+	l.tint = NewVec3(1, 1, 1)
+	if luminance := Luminance(l.baseColor); luminance > 0 {
+		l.tint = l.baseColor.MultiplyFloat(1 / luminance)
+	}
+
+	wDiffuse := l.diffuseWeight() * Luminance(l.baseColor)
+	wSpecular := (1 - l.transmissionWeight()) * Luminance(schlickFresnel(l.specularF0(), wo.Z))
+	wTransmission := l.transmissionWeight()
+	wClearcoat := 0.25 * l.clearcoat * schlickWeight(wo.Z, 0.04)
+	total := wDiffuse + wSpecular + wTransmission + wClearcoat
+	if total <= 0 {
+		return principledLobes{}, false
+	}
+	l.pDiffuse = wDiffuse / total
+	l.pSpecular = wSpecular / total
+	l.pTransmission = wTransmission / total
+	l.pClearcoat = wClearcoat / total
+	return l, true
+}
+
+// ior returns the index of refraction at the hit point, or 1.5 if the IOR texture is not positive there
+func (m *PrincipledBSDF) ior(hitRecord *HitRecord) float64 {
+	ior := m.IOR.Value(hitRecord.U, hitRecord.V, hitRecord.P).X
+	if ior <= 0 {
+		return 1.5
+	}
+	return ior
+}
+
+// relativeIOR returns the ratio of the index of refraction on the far side of the surface to the one on the side
+// that the ray arrived from
+func (m *PrincipledBSDF) relativeIOR(hitRecord *HitRecord) float64 {
+	dielectric := RoughDielectric{IOR: m.ior(hitRecord)}
+	return dielectric.relativeIOR(hitRecord)
+}
+
+// diffuseWeight is how much of the material is an opaque dielectric
+func (l *principledLobes) diffuseWeight() float64 {
+	return (1 - l.metallic) * (1 - l.transmission)
+}
+
+// transmissionWeight is how much of the material is a transparent dielectric
+func (l *principledLobes) transmissionWeight() float64 {
+	return (1 - l.metallic) * l.transmission
+}
+
+// specularF0 is the reflectance of the specular lobe at normal incidence, blended between dielectric and metal
+func (l *principledLobes) specularF0() Vec3 {
+	white := NewVec3(1, 1, 1)
+	dielectric := lerpVec3(white, l.tint, l.specularTint).MultiplyFloat(0.08 * l.specular)
+	return lerpVec3(dielectric, l.baseColor, l.metallic)
+}
+
+// sample picks a lobe and samples an incoming direction from it
+func (l *principledLobes) sample(wo Vec3, rng *rand.Rand) (Vec3, bool) {
+	u := rng.Float64()
+	u0, u1 := randomPair(rng)
+	switch {
+	case u < l.pDiffuse:
+		wi := cosineSampleHemisphere(u0, u1)
+		return wi, wi.Z > 0
+	case u < l.pDiffuse+l.pSpecular:
+		wm := l.specularDistribution.SampleVisibleNormal(wo, u0, u1)
+		wi := wo.Negate().Reflect(wm)
+		return wi, wi.Z > 0
+	case u < l.pDiffuse+l.pSpecular+l.pTransmission:
+		return l.dielectric.sampleLocal(wo, l.eta, rng)
+	default:
+		wm := sampleGTR1(l.clearcoatAlpha, u0, u1)
+		wi := wo.Negate().Reflect(wm)
+		return wi, wi.Z > 0
+	}
+}
+
+// evaluate returns the sum of every lobe multiplied by the cosine term for local directions, along with the
+// combined density of picking wi through any of the lobes
+func (l *principledLobes) evaluate(wo, wi Vec3) (Vec3, float64) {
+	cosThetaO, cosThetaI := wo.Z, wi.Z
+	if cosThetaO <= 0 || cosThetaI == 0 {
+		return NewVec3(0, 0, 0), 0
+	}
+
+	transmissionValue, transmissionPdf := l.dielectric.evaluateLocal(wo, wi, l.eta)
+	if cosThetaI < 0 {
+		// only the transmission lobe lets light through the surface
+		value := l.baseColor.MultiplyFloat(l.transmissionWeight() * transmissionValue)
+		return value, l.pTransmission * transmissionPdf
+	}
+
+	wm, err := wo.AddVector(wi).Unit()
+	if err != nil {
+		return NewVec3(0, 0, 0), 0
+	}
+	cosThetaD := wi.Dot(wm)
+
+	// diffuse with retro-reflection at grazing angles for rough surfaces, plus sheen
+	roughness := math.Sqrt(l.specularDistribution.AlphaX)
+	fd90 := 0.5 + 2*roughness*cosThetaD*cosThetaD
+	fd := (1 + (fd90-1)*schlickWeight(cosThetaI, 0)) * (1 + (fd90-1)*schlickWeight(cosThetaO, 0))
+	diffuse := l.baseColor.MultiplyFloat(fd / math.Pi)
+	sheenColor := lerpVec3(NewVec3(1, 1, 1), l.tint, l.sheenTint)
+	sheen := sheenColor.MultiplyFloat(l.sheen * schlickWeight(cosThetaD, 0))
+	value := diffuse.AddVector(sheen).MultiplyFloat(l.diffuseWeight())
+
+	// specular reflection
+	fresnel := schlickFresnel(l.specularF0(), wo.Dot(wm))
+	specular := l.specularDistribution.D(wm) * l.specularDistribution.G(wo, wi) / (4 * cosThetaO * cosThetaI)
+	value = value.AddVector(fresnel.MultiplyFloat(specular * (1 - l.transmissionWeight())))
+
+	// the transmission lobe also reflects some light off of its surface
+	value = value.AddVector(NewVec3(1, 1, 1).MultiplyFloat(l.transmissionWeight() * transmissionValue / cosThetaI))
+
+	// clear coat
+	clearcoatD := gtr1(wm.Z, l.clearcoatAlpha)
+	clearcoatG := clearcoatDistribution.G1(wo) * clearcoatDistribution.G1(wi)
+	clearcoat := 0.25 * l.clearcoat * clearcoatD * clearcoatG * schlickWeight(wo.Dot(wm), 0.04) /
+		(4 * cosThetaO * cosThetaI)
+	value = value.AddVector(NewVec3(clearcoat, clearcoat, clearcoat))
+
+	cosOM := math.Abs(wo.Dot(wm))
+	pdf := l.pDiffuse*cosThetaI/math.Pi +
+		l.pSpecular*l.specularDistribution.VisibleD(wo, wm)/(4*cosOM) +
+		l.pTransmission*transmissionPdf +
+		l.pClearcoat*clearcoatD*wm.Z/(4*cosOM)
+	return value.MultiplyFloat(cosThetaI), pdf
+}
+
+// gtr1 is the generalized Trowbridge-Reitz distribution with an exponent of 1, used by the clear coat
+func gtr1(cosThetaM, alpha float64) float64 {
+	a2 := alpha * alpha
+	t := 1 + (a2-1)*cosThetaM*cosThetaM
+	return (a2 - 1) / (math.Pi * math.Log(a2) * t)
+}
+
+// sampleGTR1 picks a microfacet normal with a density of gtr1(cos(theta)) * cos(theta)
+func sampleGTR1(alpha, u0, u1 float64) Vec3 {
+	a2 := alpha * alpha
+	cosTheta := math.Sqrt(math.Max(0, (1-math.Pow(a2, 1-u0))/(1-a2)))
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * u1
+	return NewVec3(sinTheta*math.Cos(phi), sinTheta*math.Sin(phi), cosTheta)
+}
+
+// schlickWeight returns Schlick's approximation of the Fresnel reflectance for a reflectance of f0 at normal
+// incidence
+func schlickWeight(cosTheta, f0 float64) float64 {
+	m := clamp(1-cosTheta, 0, 1)
+	m2 := m * m
+	return f0 + (1-f0)*m2*m2*m
+}
+
+// schlickFresnel applies schlickWeight to every color channel
+func schlickFresnel(f0 Vec3, cosTheta float64) Vec3 {
+	return NewVec3(schlickWeight(cosTheta, f0.X), schlickWeight(cosTheta, f0.Y), schlickWeight(cosTheta, f0.Z))
+}
+
+// lerpVec3 linearly interpolates between a (t = 0) and b (t = 1)
+func lerpVec3(a, b Vec3, t float64) Vec3 {
+	return a.MultiplyFloat(1 - t).AddVector(b.MultiplyFloat(t))
+}
+
+// cosineSampleHemisphere returns a local direction about +Z with a density of cos(theta) / pi
+func cosineSampleHemisphere(u0, u1 float64) Vec3 {
+	r := math.Sqrt(u0)
+	phi := 2 * math.Pi * u1
+	x, y := r*math.Cos(phi), r*math.Sin(phi)
+	return NewVec3(x, y, math.Sqrt(math.Max(0, 1-x*x-y*y)))
+}
+
+// AlbedoAt returns the base color blended towards white for the transparent part of the material
+func (m *PrincipledBSDF) AlbedoAt(hitRecord *HitRecord) Vec3 {
+	baseColor := m.BaseColor.Value(hitRecord.U, hitRecord.V, hitRecord.P)
+	metallic := clamp(m.Metallic.Value(hitRecord.U, hitRecord.V, hitRecord.P).X, 0, 1)
+	transmission := clamp(m.Transmission.Value(hitRecord.U, hitRecord.V, hitRecord.P).X, 0, 1)
+	return lerpVec3(baseColor, NewVec3(1, 1, 1), (1-metallic)*transmission)
+}
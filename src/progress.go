@@ -0,0 +1,89 @@
+package raytracer
+
+import (
+	"math"
+	"time"
+)
+
+// Progress reports how far along a render is
+type Progress struct {
+	// TilesDone and TotalTiles count the tiles of the render, where a tile is one row of pixels in one pass
+	TilesDone, TotalTiles int
+	// SamplesDone and TotalSamples count the camera rays traced through the pixels of the render. A resumed render
+	// starts with the samples of the framebuffer it continues.
+	SamplesDone, TotalSamples int64
+	// Rays is the number of rays traced so far by this render, counting every bounce and shadow ray
+	Rays int64
+	// Elapsed is the time since the render started
+	Elapsed time.Duration
+	// RaysPerSecond is the average number of rays traced per second since the render started
+	RaysPerSecond float64
+	// Remaining estimates the time left until the render is done, from the rate of samples so far
+	Remaining time.Duration
+}
+
+// Fraction returns the fraction of the samples that have been rendered, from 0 to 1
+func (p Progress) Fraction() float64 {
+	if p.TotalSamples == 0 {
+		return 0
+	}
+	return float64(p.SamplesDone) / float64(p.TotalSamples)
+}
+
+// progressMeter keeps track of the progress of a render
+type progressMeter struct {
+	start        time.Time
+	width        int
+	rows         int
+	passes       int
+	startSamples int64
+	world        *countingWorld
+	onProgress   func(Progress)
+}
+
+// newProgressMeter returns a meter for a render of passes passes over a region that is width x rows pixels, which
+// starts after the passes of a resumed framebuffer. The meter counts the rays traced against world.
+func newProgressMeter(width, rows, passes, resumedPasses int, world *countingWorld, onProgress func(Progress)) *progressMeter {
+	return &progressMeter{
+		start:        time.Now(),
+		width:        width,
+		rows:         rows,
+		passes:       passes,
+		startSamples: int64(resumedPasses * rows * width),
+		world:        world,
+		onProgress:   onProgress,
+	}
+}
+
+// tileDone reports the progress once row rows of pass pass are done, where both count from 0
+func (m *progressMeter) tileDone(pass, row int) {
+	tiles := pass*m.rows + row + 1
+	p := Progress{
+		TilesDone:    tiles,
+		TotalTiles:   m.passes * m.rows,
+		SamplesDone:  int64(tiles * m.width),
+		TotalSamples: int64(m.passes * m.rows * m.width),
+		Rays:         m.world.rays,
+		Elapsed:      time.Since(m.start),
+	}
+	if seconds := p.Elapsed.Seconds(); seconds > 0 {
+		p.RaysPerSecond = float64(p.Rays) / seconds
+	}
+	if rendered := p.SamplesDone - m.startSamples; rendered > 0 {
+		perSample := float64(p.Elapsed) / float64(rendered)
+		p.Remaining = time.Duration(math.Round(perSample * float64(p.TotalSamples-p.SamplesDone)))
+	}
+	m.onProgress(p)
+}
+
+// countingWorld counts the rays that are traced against the objects of a scene
+type countingWorld struct {
+	Hittable
+	rays int64
+}
+
+// Hit counts the ray and returns whether it hits the world
+func (w *countingWorld) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	w.rays++
+	return w.Hittable.Hit(ray, tMin, tMax, hitRecord)
+}
@@ -0,0 +1,144 @@
+package raytracer
+
+import "math"
+
+// cameraAxes returns the directions to the right of, above and in front of a camera that is turned by rotation
+// from looking down the negative Z axis
+func cameraAxes(rotation Matrix4) (right, up, forward Vec3) {
+	return rotation.TransformVector(NewVec3(1, 0, 0)),
+		rotation.TransformVector(NewVec3(0, 1, 0)),
+		rotation.TransformVector(NewVec3(0, 0, -1))
+}
+
+// OrthographicCamera is a camera whose rays are all parallel, so that objects do not shrink with distance
+type OrthographicCamera struct {
+	origin             Vec3
+	right, up, forward Vec3
+	viewportHeight     float64
+}
+
+// NewOrthographicCamera returns an orthographic camera centered on origin that is turned by rotation from looking
+// down the negative Z axis. height is the height of the part of the scene that it sees.
+func NewOrthographicCamera(origin Vec3, rotation Matrix4, height float64) (*OrthographicCamera, error) {
+	c := &OrthographicCamera{origin: origin, viewportHeight: height}
+	c.right, c.up, c.forward = cameraAxes(rotation)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the camera sees nothing or its rotation collapses space
+func (c *OrthographicCamera) Validate() error {
+	if err := checkPoint("orthographic camera", "origin", c.origin); err != nil {
+		return err
+	}
+	if err := checkPositive("orthographic camera", "height", c.viewportHeight); err != nil {
+		return err
+	}
+	return checkBasis("orthographic camera", "rotation", c.right, c.up, c.forward)
+}
+
+// GetRay returns the ray that starts at the (u,v) point of the viewport and heads straight ahead
+func (c *OrthographicCamera) GetRay(u, v float64) Ray {
+	halfHeight := c.viewportHeight / 2
+	origin := c.origin.
+		AddVector(c.right.MultiplyFloat((2*u - 1) * aspectRatio * halfHeight)).
+		AddVector(c.up.MultiplyFloat((2*v - 1) * halfHeight))
+	return NewRay(origin, c.forward)
+}
+
+// FisheyeCamera is an equidistant fisheye camera, where the angle between a ray and the middle of the image grows
+// in step with the distance of its pixel from the middle of the image
+type FisheyeCamera struct {
+	origin             Vec3
+	right, up, forward Vec3
+	// fieldOfView is the angle between the rays through the top and bottom middle of the image, in degrees
+	fieldOfView float64
+}
+
+// NewFisheyeCamera returns a fisheye camera at origin that is turned by rotation from looking down the negative Z
+// axis. fieldOfView is the angle in degrees between the top and bottom of the image, up to 360. The mapping goes on
+// past the field of view towards the corners of the wider image, up to looking straight backwards.
+func NewFisheyeCamera(origin Vec3, rotation Matrix4, fieldOfView float64) (*FisheyeCamera, error) {
+	c := &FisheyeCamera{origin: origin, fieldOfView: fieldOfView}
+	c.right, c.up, c.forward = cameraAxes(rotation)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the camera's field of view is not between 0 and 360 degrees, or its rotation
+// collapses space
+func (c *FisheyeCamera) Validate() error {
+	if err := checkPoint("fisheye camera", "origin", c.origin); err != nil {
+		return err
+	}
+	if err := checkPositive("fisheye camera", "field of view", c.fieldOfView); err != nil {
+		return err
+	}
+	if c.fieldOfView > 360 {
+		return validationError("fisheye camera", "field of view", ErrOutOfRange)
+	}
+	return checkBasis("fisheye camera", "rotation", c.right, c.up, c.forward)
+}
+
+// GetRay returns the ray through the (u,v) point of the image
+func (c *FisheyeCamera) GetRay(u, v float64) Ray {
+	x, y := (2*u-1)*aspectRatio, 2*v-1
+	r := math.Hypot(x, y)
+	if r == 0 {
+		return NewRay(c.origin, c.forward)
+	}
+	theta := math.Min(r*degreesToRadians(c.fieldOfView)/2, math.Pi)
+	sinTheta, cosTheta := math.Sincos(theta)
+	direction := c.forward.MultiplyFloat(cosTheta).
+		AddVector(c.right.MultiplyFloat(sinTheta * x / r)).
+		AddVector(c.up.MultiplyFloat(sinTheta * y / r))
+	return NewRay(c.origin, direction)
+}
+
+// EquirectangularCamera sees all around itself, with longitude across the image and latitude up it. The middle of
+// the image looks straight ahead, and its left and right edges meet behind the camera.
+type EquirectangularCamera struct {
+	origin             Vec3
+	right, up, forward Vec3
+}
+
+// NewEquirectangularCamera returns a 360° panorama camera at origin that is turned by rotation from looking down
+// the negative Z axis
+func NewEquirectangularCamera(origin Vec3, rotation Matrix4) (*EquirectangularCamera, error) {
+	c := &EquirectangularCamera{origin: origin}
+	c.right, c.up, c.forward = cameraAxes(rotation)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the camera's rotation collapses space
+func (c *EquirectangularCamera) Validate() error {
+	if err := checkPoint("equirectangular camera", "origin", c.origin); err != nil {
+		return err
+	}
+	return checkBasis("equirectangular camera", "rotation", c.right, c.up, c.forward)
+}
+
+// GetRay returns the ray through the (u,v) point of the panorama
+func (c *EquirectangularCamera) GetRay(u, v float64) Ray {
+	direction, _ := c.look(u, v)
+	return NewRay(c.origin, direction)
+}
+
+// look returns the direction that the (u,v) point of the panorama looks in, along with the horizontal direction to
+// its right
+func (c *EquirectangularCamera) look(u, v float64) (direction, right Vec3) {
+	sinLongitude, cosLongitude := math.Sincos((u - 0.5) * 2 * math.Pi)
+	sinLatitude, cosLatitude := math.Sincos((v - 0.5) * math.Pi)
+	direction = c.right.MultiplyFloat(cosLatitude * sinLongitude).
+		AddVector(c.up.MultiplyFloat(sinLatitude)).
+		AddVector(c.forward.MultiplyFloat(cosLatitude * cosLongitude))
+	right = c.right.MultiplyFloat(cosLongitude).SubtractVector(c.forward.MultiplyFloat(sinLongitude))
+	return direction, right
+}
@@ -0,0 +1,119 @@
+package raytracer
+
+import "math"
+
+// sweep returns the angle in radians that a surface with the passed-in phiMax in degrees sweeps around its axis.
+// Zero, or anything outside of (0, 360), is a full turn.
+func sweep(phiMax float64) float64 {
+	if phiMax <= 0 || phiMax >= 360 {
+		return 2 * math.Pi
+	}
+	return degreesToRadians(phiMax)
+}
+
+// azimuth returns the angle of a point around the Y axis, starting from +X and turning towards -Z, in [0, 2π)
+func azimuth(x, z float64) float64 {
+	phi := math.Atan2(-z, x)
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	return phi
+}
+
+// maxCrossings is the most times that the line that a ray lies on can cross one of the quadric shapes or a torus
+const maxCrossings = 4
+
+// crossingList holds every point where the line that a ray lies on crosses the surface of a shape, with outward
+// normals and including the ones behind the ray's origin. The records are kept in an array rather than a slice so
+// that a shape can fill in a list on its caller's stack without allocating.
+type crossingList struct {
+	records [maxCrossings]HitRecord
+	count   int
+}
+
+// add returns the next record of the list, for the shape to fill in
+func (l *crossingList) add() *HitRecord {
+	l.count++
+	return &l.records[l.count-1]
+}
+
+// sort puts the crossings in order along the ray. There are only a few of them, so an insertion sort is enough.
+func (l *crossingList) sort() {
+	for i := 1; i < l.count; i++ {
+		for j := i; j > 0 && l.records[j].T < l.records[j-1].T; j-- {
+			l.records[j], l.records[j-1] = l.records[j-1], l.records[j]
+		}
+	}
+}
+
+// first fills in the hit record of the closest crossing between tMin and tMax, which must be in order along the ray
+func (l *crossingList) first(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	for i := 0; i < l.count; i++ {
+		crossing := &l.records[i]
+		if crossing.T < tMin || tMax < crossing.T {
+			continue
+		}
+		*hitRecord = *crossing
+		hitRecord.SetFaceNormal(ray, crossing.Normal)
+		return true
+	}
+	return false
+}
+
+// intervals appends the spans between the crossings of a closed shape, which alternate between entering and
+// leaving it, to intervals. A line that grazes an edge of the shape can cross it an odd number of times, and is
+// treated as a miss.
+func (l *crossingList) intervals(intervals []Interval) []Interval {
+	if l.count%2 != 0 {
+		return intervals
+	}
+	for i := 0; i < l.count; i += 2 {
+		intervals = append(intervals, Interval{Enter: l.records[i], Exit: l.records[i+1]})
+	}
+	return intervals
+}
+
+// localRay returns the origin of the ray relative to the center of a shape, and the ray's direction. It returns
+// false for a ray with no direction, which cannot cross anything.
+func localRay(ray Ray, center Vec3) (Vec3, Vec3, bool) {
+	if ray.Direction().LengthSquared() == 0 {
+		return Vec3{}, Vec3{}, false
+	}
+	return ray.Origin().SubtractVector(center), ray.Direction(), true
+}
+
+// checkSweep returns an error if the angle in degrees that a shape sweeps around its axis is not between 0 and 360
+func checkSweep(object string, phiMax float64) error {
+	if err := checkFinite(object, "phiMax", phiMax); err != nil {
+		return err
+	}
+	if phiMax < 0 || phiMax > 360 {
+		return validationError(object, "phiMax", ErrOutOfRange)
+	}
+	return nil
+}
+
+// setSurface fills in the hit record of a point on a shape. dpdu and dpdv may be zero where the parameterization of
+// the surface is degenerate.
+func setSurface(hitRecord *HitRecord, ray Ray, t float64, normal, dpdu, dpdv Vec3, u, v float64, material Material, id int) {
+	if material == nil {
+		material = defaultMaterial
+	}
+	*hitRecord = HitRecord{
+		T:               t,
+		P:               ray.At(t),
+		Normal:          normal,
+		GeometricNormal: normal,
+		Tangent:         dpdu,
+		Bitangent:       dpdv,
+		U:               u,
+		V:               v,
+		Material:        material,
+		ObjectID:        id,
+	}
+}
+
+// aroundAxis returns how a point at (x, z) moves as it turns around the Y axis by phiMax times u
+func aroundAxis(x, z, phiMax float64) Vec3 {
+	return NewVec3(z, 0, -x).MultiplyFloat(phiMax)
+}
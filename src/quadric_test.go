@@ -0,0 +1,176 @@
+package raytracer_test
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShapes_Hit(t *testing.T) {
+	down := func(x, z float64) rt.Ray { return rt.NewRay(rt.NewVec3(x, 10, z), rt.NewVec3(0, -1, 0)) }
+	along := func(y float64) rt.Ray { return rt.NewRay(rt.NewVec3(-10, y, 0), rt.NewVec3(1, 0, 0)) }
+	origin := rt.NewVec3(0, 0, 0)
+
+	for _, tc := range []struct {
+		desc       string
+		shape      rt.Hittable
+		ray        rt.Ray
+		wantHit    bool
+		wantT      float64
+		wantNormal rt.Vec3
+	}{
+		{desc: "cylinder side", shape: rt.NewCylinder(origin, 1, 2), ray: along(1), wantHit: true, wantT: 9, wantNormal: rt.NewVec3(-1, 0, 0)},
+		{desc: "cylinder above", shape: rt.NewCylinder(origin, 1, 2), ray: along(2.5)},
+		{desc: "open cylinder from the top", shape: rt.NewCylinder(origin, 1, 2), ray: down(0, 0)},
+		{desc: "open cylinder from the top hits the inside", shape: rt.NewCylinder(origin, 1, 2), ray: rt.NewRay(rt.NewVec3(0, 10, 0), rt.NewVec3(0.1, -1, 0)), wantHit: true, wantT: 10, wantNormal: rt.NewVec3(-1, 0, 0)},
+		{desc: "capped cylinder from the top", shape: &rt.Cylinder{Center: origin, Radius: 1, Height: 2, Capped: true}, ray: down(0.5, 0), wantHit: true, wantT: 8, wantNormal: rt.NewVec3(0, 1, 0)},
+		{desc: "half cylinder front", shape: &rt.Cylinder{Center: origin, Radius: 1, Height: 2, PhiMax: 180}, ray: rt.NewRay(rt.NewVec3(0, 1, 10), rt.NewVec3(0, 0, -1)), wantHit: true, wantT: 11, wantNormal: rt.NewVec3(0, 0, 1)},
+		{desc: "cone side", shape: rt.NewCone(origin, 1, 2), ray: along(1), wantHit: true, wantT: 9.5, wantNormal: rt.NewVec3(-2, 1, 0)},
+		{desc: "cone above the tip", shape: rt.NewCone(origin, 1, 2), ray: along(3)},
+		{desc: "cone from the tip", shape: rt.NewCone(origin, 1, 2), ray: down(0.25, 0), wantHit: true, wantT: 8.5, wantNormal: rt.NewVec3(2, 1, 0)},
+		{desc: "capped cone from below", shape: &rt.Cone{Center: origin, Radius: 1, Height: 2, Capped: true}, ray: rt.NewRay(rt.NewVec3(0.5, -10, 0), rt.NewVec3(0, 1, 0)), wantHit: true, wantT: 10, wantNormal: rt.NewVec3(0, -1, 0)},
+		{desc: "disk", shape: rt.NewDisk(origin, 1), ray: down(0.5, 0.5), wantHit: true, wantT: 10, wantNormal: rt.NewVec3(0, 1, 0)},
+		{desc: "disk edge", shape: rt.NewDisk(origin, 1), ray: down(1, 0.5)},
+		{desc: "annulus hole", shape: &rt.Disk{Center: origin, Radius: 1, InnerRadius: 0.5}, ray: down(0.2, 0)},
+		{desc: "annulus", shape: &rt.Disk{Center: origin, Radius: 1, InnerRadius: 0.5}, ray: down(0.7, 0), wantHit: true, wantT: 10, wantNormal: rt.NewVec3(0, 1, 0)},
+		{desc: "quarter disk", shape: &rt.Disk{Center: origin, Radius: 1, PhiMax: 90}, ray: down(0.5, 0.5)},
+		{desc: "torus tube", shape: rt.NewTorus(origin, 2, 0.5), ray: down(2, 0), wantHit: true, wantT: 9.5, wantNormal: rt.NewVec3(0, 1, 0)},
+		{desc: "torus hole", shape: rt.NewTorus(origin, 2, 0.5), ray: down(0, 0)},
+		{desc: "torus across", shape: rt.NewTorus(origin, 2, 0.5), ray: along(0), wantHit: true, wantT: 7.5, wantNormal: rt.NewVec3(-1, 0, 0)},
+		// the ray runs through the plane of the ring and meets the outside of the tube, where the ring is 2.5 wide
+		{desc: "torus from far away", shape: rt.NewTorus(rt.NewVec3(0, 0, -1e5), 2, 0.5), ray: rt.NewRay(rt.NewVec3(2.25, 0, 0), rt.NewVec3(0, 0, -1)), wantHit: true, wantT: 1e5 - math.Sqrt(2.5*2.5-2.25*2.25), wantNormal: rt.NewVec3(2.25, 0, math.Sqrt(2.5*2.5-2.25*2.25))},
+		// the ray crosses the tube four times, in two pairs that are close together
+		{desc: "torus near the top of the tube", shape: rt.NewTorus(origin, 2, 0.5), ray: along(0.49), wantHit: true, wantT: 10 - 2 - math.Sqrt(0.25-0.49*0.49), wantNormal: rt.NewVec3(-math.Sqrt(0.25-0.49*0.49), 0.49, 0)},
+		{desc: "half torus", shape: &rt.Torus{Center: origin, MajorRadius: 2, MinorRadius: 0.5, PhiMax: 180}, ray: along(0), wantHit: true, wantT: 7.5, wantNormal: rt.NewVec3(-1, 0, 0)},
+		{desc: "half torus skips the missing half", shape: &rt.Torus{Center: origin, MajorRadius: 2, MinorRadius: 0.5, PhiMax: 180}, ray: rt.NewRay(rt.NewVec3(0, 0, 10), rt.NewVec3(0, 0, -1)), wantHit: true, wantT: 11.5, wantNormal: rt.NewVec3(0, 0, 1)},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			hitRecord := &rt.HitRecord{}
+			didHit := tc.shape.Hit(tc.ray, 0.001, math.Inf(1), hitRecord)
+			assert.Equal(t, tc.wantHit, didHit)
+			if !tc.wantHit || !didHit {
+				return
+			}
+			assert.InDelta(t, tc.wantT, hitRecord.T, 1e-6)
+			want, _ := tc.wantNormal.Unit()
+			assert.InDelta(t, want.X, hitRecord.Normal.X, 1e-6)
+			assert.InDelta(t, want.Y, hitRecord.Normal.Y, 1e-6)
+			assert.InDelta(t, want.Z, hitRecord.Normal.Z, 1e-6)
+		})
+	}
+}
+
+func TestShapes_Surface(t *testing.T) {
+	// every hit is inside the bounding box, with UVs in [0, 1] and tangents that lie in the surface
+	rng := rand.New(rand.NewSource(1))
+	origin := rt.NewVec3(1, -2, 3)
+	for name, shape := range map[string]rt.Hittable{
+		"cylinder": &rt.Cylinder{Center: origin, Radius: 1, Height: 2, PhiMax: 270, Capped: true},
+		"cone":     &rt.Cone{Center: origin, Radius: 1, Height: 2, PhiMax: 300, Capped: true},
+		"annulus":  &rt.Disk{Center: origin, Radius: 1, InnerRadius: 0.3, PhiMax: 200},
+		"torus":    &rt.Torus{Center: origin, MajorRadius: 1, MinorRadius: 0.4, PhiMax: 250},
+	} {
+		t.Run(name, func(t *testing.T) {
+			box := shape.(rt.Bounded).BoundingBox()
+			hits := 0
+			for i := 0; i < 500; i++ {
+				from := origin.AddVector(rt.NewVec3(rng.Float64()*8-4, rng.Float64()*8-4, rng.Float64()*8-4))
+				to := origin.AddVector(rt.NewVec3(rng.Float64()*2-1, rng.Float64()*2, rng.Float64()*2-1))
+				hitRecord := &rt.HitRecord{}
+				didHit := shape.Hit(rt.NewRay(from, to.SubtractVector(from)), 0.001, math.Inf(1), hitRecord)
+				if !didHit {
+					continue
+				}
+				hits++
+				p := hitRecord.P
+				assert.True(t, p.X >= box.Min.X-1e-9 && p.Y >= box.Min.Y-1e-9 && p.Z >= box.Min.Z-1e-9, "%v is below %v", p, box.Min)
+				assert.True(t, p.X <= box.Max.X+1e-9 && p.Y <= box.Max.Y+1e-9 && p.Z <= box.Max.Z+1e-9, "%v is above %v", p, box.Max)
+				assert.True(t, hitRecord.U >= 0 && hitRecord.U <= 1 && hitRecord.V >= 0 && hitRecord.V <= 1, "uv %g %g", hitRecord.U, hitRecord.V)
+				assert.InDelta(t, 1, hitRecord.Normal.Length(), 1e-9)
+				if !hitRecord.Tangent.IsZero() {
+					assert.InDelta(t, 0, hitRecord.Tangent.Dot(hitRecord.Normal), 1e-6)
+					assert.InDelta(t, 0, hitRecord.Bitangent.Dot(hitRecord.Normal), 1e-6)
+				}
+			}
+			assert.True(t, hits > 50, "only %d rays hit", hits)
+		})
+	}
+}
+
+func TestShapes_CSG(t *testing.T) {
+	// a block of a capped cylinder with a hole drilled down its middle, and a torus around it
+	block := &rt.Cylinder{Center: rt.NewVec3(0, 0, 0), Radius: 2, Height: 1, Capped: true, ID: 1}
+	hole := &rt.Cylinder{Center: rt.NewVec3(0, -1, 0), Radius: 0.5, Height: 3, Capped: true, ID: 2}
+	drilled := mustCSG(t, rt.CSGDifference, block, hole)
+	withRing := mustCSG(t, rt.CSGUnion, drilled, rt.NewTorus(rt.NewVec3(0, 0.5, 0), 2, 0.25))
+
+	for _, tc := range []struct {
+		desc  string
+		ray   rt.Ray
+		wantT float64
+	}{
+		{desc: "through the hole", ray: rt.NewRay(rt.NewVec3(0, 10, 0), rt.NewVec3(0, -1, 0)), wantT: -1},
+		{desc: "onto the block", ray: rt.NewRay(rt.NewVec3(1, 10, 0), rt.NewVec3(0, -1, 0)), wantT: 9},
+		{desc: "into the wall of the hole", ray: rt.NewRay(rt.NewVec3(-10, 0.5, 0), rt.NewVec3(1, 0, 0)), wantT: 7.75},
+		{desc: "across the hole", ray: rt.NewRay(rt.NewVec3(0, 0.5, 0), rt.NewVec3(1, 0, 0)), wantT: 0.5},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			hitRecord := &rt.HitRecord{}
+			didHit := withRing.Hit(tc.ray, 0.001, math.Inf(1), hitRecord)
+			assert.Equal(t, tc.wantT >= 0, didHit)
+			if didHit {
+				assert.InDelta(t, tc.wantT, hitRecord.T, 1e-6)
+				assert.True(t, hitRecord.Normal.Dot(tc.ray.Direction()) < 0)
+			}
+		})
+	}
+
+	_, err := rt.NewCSG(rt.CSGUnion, block, rt.NewCylinder(rt.NewVec3(0, 0, 0), 1, 1))
+	assert.Error(t, err, "open cylinders do not have an inside")
+	_, err = rt.NewCSG(rt.CSGUnion, block, &rt.Torus{MajorRadius: 1, MinorRadius: 0.5, PhiMax: 90})
+	assert.Error(t, err, "partial tori do not have an inside")
+	_, err = rt.NewCSG(rt.CSGUnion, block, rt.NewDisk(rt.NewVec3(0, 0, 0), 1))
+	assert.Error(t, err, "disks do not have an inside")
+}
+
+func TestSceneDescription_Shapes(t *testing.T) {
+	description, err := rt.ParseSceneDescription(strings.NewReader(`{"objects": [
+		{"type": "cylinder", "center": [0, 0, -3], "radius": 1, "height": 2, "capped": true, "phiMax": 270},
+		{"type": "cone", "center": [0, 0, -3], "radius": 1, "height": 2},
+		{"type": "disk", "center": [0, 0, -3], "radius": 1, "innerRadius": 0.5},
+		{"type": "torus", "center": [0, 0, -3], "radius": 1, "minorRadius": 0.25}
+	]}`))
+	assert.Nil(t, err)
+	scene, _, err := description.Build()
+	assert.Nil(t, err)
+	world := scene.World.(*rt.HittableList)
+	assert.Equal(t, &rt.Cylinder{Center: rt.NewVec3(0, 0, -3), Radius: 1, Height: 2, Capped: true, PhiMax: 270, ID: 1}, world.Objects[0])
+	assert.IsType(t, &rt.Cone{}, world.Objects[1])
+	assert.Equal(t, 0.5, world.Objects[2].(*rt.Disk).InnerRadius)
+	assert.Equal(t, 0.25, world.Objects[3].(*rt.Torus).MinorRadius)
+
+	for _, tc := range []struct {
+		desc, input, wantError string
+	}{
+		{desc: "no height", input: `{"type": "cylinder", "radius": 1}`, wantError: "height of a cylinder"},
+		{desc: "no radius", input: `{"type": "cone", "height": 1}`, wantError: "radius of a cone"},
+		{desc: "bad sweep", input: `{"type": "torus", "radius": 1, "minorRadius": 0.5, "phiMax": 400}`, wantError: "phiMax"},
+		{desc: "no tube", input: `{"type": "torus", "radius": 1}`, wantError: "minor radius"},
+		{desc: "hole too big", input: `{"type": "disk", "radius": 1, "innerRadius": 1}`, wantError: "inner radius"},
+		{desc: "open solid", input: `{"type": "csg", "operation": "union", "left": {"type": "cylinder", "radius": 1, "height": 1}, "right": {"type": "sphere", "radius": 1}}`, wantError: "does not have an inside"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			description, err := rt.ParseSceneDescription(strings.NewReader(`{"objects": [` + tc.input + `]}`))
+			assert.Nil(t, err)
+			_, _, err = description.Build()
+			assert.Error(t, err)
+			if err != nil {
+				assert.Contains(t, err.Error(), tc.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package raytracer
+
+// splitMix64 is a small random number source whose whole state is one integer, which makes it cheap to reseed
+// for every sample so that each sample's random numbers do not depend on the samples traced before it
+type splitMix64 struct {
+	state uint64
+}
+
+// Seed resets the source to a new state
+func (s *splitMix64) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// Uint64 returns the next 64 random bits
+func (s *splitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	return mix64(s.state)
+}
+
+// Int63 returns a non-negative random 63-bit integer
+func (s *splitMix64) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// mix64 scrambles the bits of an integer so that nearby inputs give unrelated outputs
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// sampleSeed returns the seed of the random numbers used by one sample of a pixel, where pixel is the index of the
+// pixel in the framebuffer and pass counts the samples already taken in every pixel
+func sampleSeed(seed int64, pass, pixel int) int64 {
+	return int64(mix64(mix64(uint64(seed)+uint64(pass)*0x9e3779b97f4a7c15) + uint64(pixel)))
+}
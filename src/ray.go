@@ -1,8 +1,8 @@
 package raytracer
 
 import (
-	"fmt"
 	"math"
+	"math/rand"
 )
 
 // Ray is a struc that contains a origin and a direction and can be described the formula
@@ -12,31 +12,31 @@ import (
 // - b is a vector that represents the direction that the ray is facing
 type Ray struct {
 	// Origin is the location of a point in 3 dimensional space, denoted by a Vec3
-	origin *Vec3
+	origin Vec3
 	// Direction is a Vec3 that represents the direction of the ray
-	direction *Vec3
+	direction Vec3
 }
 
 // NewRay constructs a new ray from an origin and direction vector
-func NewRay(origin, direction *Vec3) *Ray {
-	return &Ray{
+func NewRay(origin, direction Vec3) Ray {
+	return Ray{
 		origin:    origin,
 		direction: direction,
 	}
 }
 
 // Origin returns a vector representing the origin of the ray
-func (r *Ray) Origin() *Vec3 {
+func (r Ray) Origin() Vec3 {
 	return r.origin
 }
 
 // Direction returns a vector representing the direction of the ray
-func (r *Ray) Direction() *Vec3 {
+func (r Ray) Direction() Vec3 {
 	return r.direction
 }
 
 // At returns the point on the ray given the coefficient, t
-func (r *Ray) At(t float64) *Vec3 {
+func (r Ray) At(t float64) Vec3 {
 	return r.Origin().
 		AddVector(
 			r.Direction().
@@ -44,36 +44,56 @@ func (r *Ray) At(t float64) *Vec3 {
 		)
 }
 
-// Color computes the color of the ray.
-func (r *Ray) Color(world Hittable, depth int) (*Vec3, error) {
-	if depth <= 0 {
-		// fmt.Fprintf(os.Stderr, "maximum recursion depth reached: returning default vec\ndepth: %d\n", depth)
-		return NewVec3(0, 0, 0), nil
+// background returns the light that arrives along a ray that escapes the scene
+func (r Ray) background(scene *Scene, scatterPdf float64) Vec3 {
+	if scene.Environment == nil {
+		return r.linearBlueGradient()
 	}
 
-	hitRecord, didHit, err := world.Hit(r, 0.001, math.Inf(1))
-	if err != nil {
-		return nil, fmt.Errorf("could not compute collision: %s", err)
+	radiance := scene.Environment.Radiance(r.Direction())
+	if scatterPdf == 0 {
+		return radiance
 	}
-	if didHit {
-		// lambertian formula
-		// randomUnitVec, err := RandomUnitVector()
-		// if err != nil {
-		// 	return nil, fmt.Errorf("could not generate random unit vector: %s", err)
-		// }
-		// target := hitRecord.P.AddVector(hitRecord.Normal).AddVector(randomUnitVec)
-
-		// more intuitive approach, but less desireable
-		target := hitRecord.P.AddVector(RandomInHemisphere(hitRecord.Normal))
-		randomRay := NewRay(hitRecord.P, target.SubtractVector(hitRecord.P))
-		doubleColor, err := randomRay.Color(world, depth-1)
-		if err != nil {
-			return nil, fmt.Errorf("could not calculate color of random normal: %s", err)
-		}
-		return doubleColor.MultiplyFloat(0.5), nil
+	// this light was also reachable by sampling the environment directly from the previous bounce
+	weight := powerHeuristic(scatterPdf, scene.Environment.Pdf(r.Direction()))
+	return radiance.MultiplyFloat(weight)
+}
+
+// directEnvironmentLight estimates the light reflected at a hit point that arrives straight from the environment
+// by importance sampling the environment map. The shadow ray overwrites the hit record.
+func (r Ray) directEnvironmentLight(scene *Scene, hitRecord *HitRecord, rng *rand.Rand) Vec3 {
+	if scene.Environment == nil {
+		return NewVec3(0, 0, 0)
+	}
+
+	direction, radiance, lightPdf := scene.Environment.Sample(rng.Float64(), rng.Float64())
+	if lightPdf == 0 {
+		return NewVec3(0, 0, 0)
+	}
+	wo, _ := r.Direction().Unit()
+	bsdf, scatterPdf := hitRecord.Material.Evaluate(wo.Negate(), direction, hitRecord)
+	if scatterPdf == 0 {
+		// specular materials and directions the material cannot scatter in receive no direct light
+		return NewVec3(0, 0, 0)
+	}
+
+	if scene.World.Hit(NewRay(hitRecord.P, direction), 0.001, math.Inf(1), hitRecord) {
+		return NewVec3(0, 0, 0)
+	}
+
+	// the same direction could also have been reached by scattering off of the material
+	weight := powerHeuristic(lightPdf, scatterPdf)
+	return radiance.MultiplyVector(bsdf).MultiplyFloat(weight / lightPdf)
+}
+
+// powerHeuristic returns the multiple importance sampling weight of a sample drawn with density pdfA when the
+// same sample could also have been drawn with density pdfB
+func powerHeuristic(pdfA, pdfB float64) float64 {
+	a, b := pdfA*pdfA, pdfB*pdfB
+	if a+b == 0 {
+		return 0
 	}
-	// there is no intersection
-	return r.linearBlueGradient()
+	return a / (a + b)
 }
 
 // linearBlueGradient blends color to be a linear gradient on the Y direction.
@@ -81,11 +101,8 @@ func (r *Ray) Color(world Hittable, depth int) (*Vec3, error) {
 // We then add 1 and divide by 2 to scale the values to be from 0 to 1.
 // 0 = white
 // 1 = blue
-func (r *Ray) linearBlueGradient() (*Vec3, error) {
-	unitDirection, err := r.Direction().Unit()
-	if err != nil {
-		return nil, fmt.Errorf("cannot get unit vector of vector: %s", err)
-	}
+func (r Ray) linearBlueGradient() Vec3 {
+	unitDirection, _ := r.Direction().Unit()
 
 	// scale unit vector values to be 0 < x < 1 to determine what color from white to blue to choose
 	blueness := 0.5 * (unitDirection.Y + 1.0)
@@ -96,7 +113,7 @@ func (r *Ray) linearBlueGradient() (*Vec3, error) {
 	// This is similar to a seed in a RNG to determine the base level of blueness
 	baseBlue := NewVec3(0.5, 0.7, 1.0).MultiplyFloat(blueness)
 
-	return shadeOfBlue.AddVector(baseBlue), nil
+	return shadeOfBlue.AddVector(baseBlue)
 }
 
 // hitsSphere determines whether or not the ray, will at some point, given P(t) = A +tb, where P is some point on the ray,
@@ -123,7 +140,7 @@ func (r *Ray) linearBlueGradient() (*Vec3, error) {
 // but if we utilize the fact that if b = 2h, the formula becomes:
 //
 // (-h +- sqrt(h^2 - ac)) / a
-func (r *Ray) hitsSphere(center *Vec3, radius float64) float64 {
+func (r Ray) hitsSphere(center Vec3, radius float64) float64 {
 	oc := r.Origin().SubtractVector(center)
 	a := r.Direction().LengthSquared()
 	halfB := oc.Dot(r.Direction())
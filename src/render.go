@@ -0,0 +1,245 @@
+package raytracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+)
+
+// RenderOptions configures a render
+type RenderOptions struct {
+	// Width and Height are the size of the image in pixels
+	Width, Height int
+	// SamplesPerPixel is the number of rays traced through each pixel. The image is rendered progressively, in
+	// passes that each add one sample to every pixel.
+	SamplesPerPixel int
+	// Integrator computes the light along each camera ray. If it is nil, a PathIntegrator is used, which follows
+	// paths as far as the depth options allow.
+	Integrator Integrator
+	// MaxDepth is the maximum number of times a ray may bounce
+	MaxDepth int
+	// MaxDiffuse, MaxSpecular, MaxTransmission and RouletteDepth control how far paths are followed, as described by
+	// PathIntegrator
+	MaxDiffuse, MaxSpecular, MaxTransmission int
+	RouletteDepth                            int
+	// AOVs lists the auxiliary passes to record alongside the beauty pass
+	AOVs []AOV
+	// Region, if not empty, limits rendering to the pixels of the Width x Height image inside it, where (0, 0) is
+	// the top left pixel. The returned framebuffer is the size of the region, and its pixels get exactly the
+	// samples that they would in a render of the whole image.
+	Region image.Rectangle
+	// Seed picks the random numbers of the render. Renders of the same scene with the same options and seed are
+	// identical.
+	Seed int64
+	// Resume, if set, continues rendering into a framebuffer from an earlier render, such as one read from a
+	// checkpoint, until it has SamplesPerPixel passes. It must have the same size and auxiliary passes, and the
+	// scene and integrator must match the earlier render for the result to match an uninterrupted one. The
+	// framebuffer's seed is used instead of Seed.
+	Resume *Framebuffer
+	// OnPass, if set, is called after each pass with the framebuffer so far, which is a good time to save a
+	// checkpoint. Returning an error stops the render.
+	OnPass func(fb *Framebuffer) error
+	// OnProgress, if set, is called after every tile with the progress of the render
+	OnProgress func(p Progress)
+}
+
+// Render traces the scene through the camera and returns the accumulated samples. It checks ctx between rows of
+// pixels, and if ctx is cancelled or its deadline passes, it stops and returns the partially converged framebuffer
+// along with an error that wraps ctx.Err(). Only complete passes are counted in the partial framebuffer's Passes,
+// but the pixels of the unfinished pass keep the samples they got.
+func Render(ctx context.Context, scene *Scene, camera Camera, opts RenderOptions) (*Framebuffer, error) {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", opts.Width, opts.Height)
+	}
+	if opts.SamplesPerPixel <= 0 {
+		return nil, errors.New("at least one sample per pixel is needed")
+	}
+	// intersecting and shading cannot fail, so everything that could make them fail is checked up front
+	if err := scene.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scene: %w", err)
+	}
+	if err := camera.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid camera: %w", err)
+	}
+
+	region := image.Rect(0, 0, opts.Width, opts.Height)
+	if !opts.Region.Empty() {
+		if !opts.Region.In(region) {
+			return nil, fmt.Errorf("region %v is outside of the %dx%d image", opts.Region, opts.Width, opts.Height)
+		}
+		region = opts.Region
+	}
+
+	fb := opts.Resume
+	if fb == nil {
+		fb = NewFramebuffer(region.Dx(), region.Dy(), opts.AOVs)
+		fb.Seed = opts.Seed
+	} else if err := checkResumable(fb, region, opts); err != nil {
+		return nil, err
+	}
+
+	integrator := opts.Integrator
+	if integrator == nil {
+		integrator = &PathIntegrator{
+			MaxDepth:        opts.MaxDepth,
+			MaxDiffuse:      opts.MaxDiffuse,
+			MaxSpecular:     opts.MaxSpecular,
+			MaxTransmission: opts.MaxTransmission,
+			RouletteDepth:   opts.RouletteDepth,
+		}
+	}
+	var meter *progressMeter
+	if opts.OnProgress != nil {
+		world := &countingWorld{Hittable: scene.World}
+		counted := *scene
+		counted.World = world
+		scene = &counted
+		meter = newProgressMeter(region.Dx(), region.Dy(), opts.SamplesPerPixel, fb.Passes, world, opts.OnProgress)
+	}
+
+	radiance := func(ray Ray, rng *rand.Rand, hitRecord *HitRecord) Vec3 {
+		return integrator.Radiance(ray, scene, rng, hitRecord)
+	}
+	if tracer, ok := integrator.(lightTracer); ok {
+		radiance = tracer.begin(scene, &film{camera: camera, fb: fb, width: opts.Width, height: opts.Height, region: region})
+	}
+
+	// the random numbers of each sample only depend on the seed, the pass and the pixel, so a resumed render
+	// picks up exactly where the interrupted one stopped
+	rng := rand.New(&splitMix64{})
+	var hitRecord HitRecord
+	for fb.Passes < opts.SamplesPerPixel {
+		for y := region.Min.Y; y < region.Max.Y; y++ {
+			if err := ctx.Err(); err != nil {
+				return fb, fmt.Errorf("stopped after %d passes: %w", fb.Passes, err)
+			}
+			// rows are counted from the bottom of the image, but stored from the top
+			j := opts.Height - 1 - y
+			for i := region.Min.X; i < region.Max.X; i++ {
+				rng.Seed(sampleSeed(fb.Seed, fb.Passes, y*opts.Width+i))
+				u := (float64(i) + rng.Float64()) / float64(opts.Width-1)
+				v := (float64(j) + rng.Float64()) / float64(opts.Height-1)
+
+				ray := camera.GetRay(u, v)
+				fb.AddSample(i-region.Min.X, y-region.Min.Y, radiance(ray, rng, &hitRecord))
+				if len(opts.AOVs) > 0 {
+					fb.AddFirstHit(i-region.Min.X, y-region.Min.Y, scene.firstHit(ray, &hitRecord))
+				}
+			}
+			if meter != nil {
+				meter.tileDone(fb.Passes, y-region.Min.Y)
+			}
+		}
+		fb.Passes++
+		if opts.OnPass != nil {
+			if err := opts.OnPass(fb); err != nil {
+				return nil, fmt.Errorf("stopped after pass %d: %s", fb.Passes, err)
+			}
+		}
+	}
+	return fb, nil
+}
+
+// film is the region of the image that a render adds samples to, for integrators that trace light to the camera
+type film struct {
+	camera Camera
+	fb     *Framebuffer
+	// width and height are the size of the whole image, and region is the part of it that fb holds
+	width, height int
+	region        image.Rectangle
+}
+
+// area returns the area of the region in the (u,v) coordinates that the camera's rays are traced through
+func (f *film) area() float64 {
+	return float64(f.region.Dx()*f.region.Dy()) / float64((f.width-1)*(f.height-1))
+}
+
+// pixel returns the pixel of the framebuffer that camera rays through the (u,v) point of the image are traced
+// for, or false if the point is outside of the region
+func (f *film) pixel(u, v float64) (x, y int, ok bool) {
+	if math.IsNaN(u) || math.IsNaN(v) {
+		return 0, 0, false
+	}
+	// this undoes the mapping from pixels to (u,v) points in Render
+	i := math.Floor(u * float64(f.width-1))
+	j := math.Floor(v * float64(f.height-1))
+	if i < float64(f.region.Min.X) || i >= float64(f.region.Max.X) {
+		return 0, 0, false
+	}
+	row := float64(f.height-1) - j
+	if row < float64(f.region.Min.Y) || row >= float64(f.region.Max.Y) {
+		return 0, 0, false
+	}
+	return int(i) - f.region.Min.X, int(row) - f.region.Min.Y, true
+}
+
+// splat adds light that reached the camera through the (u,v) point of the image to the pixel there, if it is in
+// the region
+func (f *film) splat(u, v float64, color Vec3) {
+	if x, y, ok := f.pixel(u, v); ok {
+		f.fb.addSplat(x, y, color)
+	}
+}
+
+// seed returns the seed of the render's random numbers, or 0 for a nil film, when an integrator is used outside of
+// a render
+func (f *film) seed() int64 {
+	if f == nil {
+		return 0
+	}
+	return f.fb.Seed
+}
+
+// passes returns the number of passes that the render has finished, or 0 for a nil film
+func (f *film) passes() int {
+	if f == nil {
+		return 0
+	}
+	return f.fb.Passes
+}
+
+// checkResumable returns an error if a render of the region with the passed-in options cannot continue into fb
+func checkResumable(fb *Framebuffer, region image.Rectangle, opts RenderOptions) error {
+	if fb.Width != region.Dx() || fb.Height != region.Dy() {
+		return fmt.Errorf("cannot resume a %dx%d render at %dx%d", fb.Width, fb.Height, region.Dx(), region.Dy())
+	}
+	if fb.Passes > opts.SamplesPerPixel {
+		return fmt.Errorf("cannot resume a render with %d samples per pixel to %d samples per pixel", fb.Passes, opts.SamplesPerPixel)
+	}
+	if len(fb.aovs) != len(opts.AOVs) {
+		return errors.New("cannot resume a render with different render passes")
+	}
+	for _, aov := range opts.AOVs {
+		if !fb.HasAOV(aov) {
+			return fmt.Errorf("cannot resume a render without the %s pass", aov)
+		}
+	}
+	return nil
+}
+
+// firstHit finds what a camera ray sees for the auxiliary render passes, using hitRecord as scratch space
+func (s *Scene) firstHit(ray Ray, hitRecord *HitRecord) *FirstHit {
+	if !s.World.Hit(ray, 0.001, math.Inf(1), hitRecord) {
+		return &FirstHit{}
+	}
+
+	// the world normal pass shows the outward facing normal, regardless of which side the camera is on
+	normal := hitRecord.Normal
+	if !hitRecord.FrontFace {
+		normal = normal.Negate()
+	}
+	return &FirstHit{
+		Hit:        true,
+		Depth:      hitRecord.T * ray.Direction().Length(),
+		Position:   hitRecord.P,
+		Normal:     normal,
+		Albedo:     materialAlbedo(hitRecord.Material, hitRecord),
+		U:          hitRecord.U,
+		V:          hitRecord.V,
+		ObjectID:   hitRecord.ObjectID,
+		MaterialID: s.MaterialIDs[hitRecord.Material],
+	}
+}
@@ -0,0 +1,13 @@
+package raytracer
+
+// Scene groups together everything that a ray can interact with while it is being traced
+type Scene struct {
+	// World contains all of the objects in the scene
+	World Hittable
+	// Environment lights rays that escape the scene. If it is nil, the sky is a white to blue gradient.
+	Environment *EnvironmentLight
+	// Lights are the light sources inside of the scene, which light it on top of the environment
+	Lights []Light
+	// MaterialIDs identifies materials in the material ID pass. Materials that are not in the map get the ID 0.
+	MaterialIDs map[Material]int
+}
@@ -0,0 +1,750 @@
+package raytracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SceneDescription is a JSON document that describes a scene to render. For example:
+//
+//	{
+//	  "camera": {"origin": [0, 0, 0]},
+//	  "environment": {"path": "studio.hdr", "rotation": 90, "scale": 1.5},
+//	  "lights": [{"type": "sun", "direction": [-1, -2, -1], "intensity": 3}],
+//	  "materials": {
+//	    "red plastic": {"type": "principled", "baseColor": [0.8, 0.1, 0.1], "roughness": 0.3, "clearcoat": 1},
+//	    "worn gold": {"type": "principled", "baseColor": {"texture": "gold.png"}, "metallic": 1}
+//	  },
+//	  "objects": [
+//	    {"type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "red plastic"}
+//	  ]
+//	}
+//
+// The camera, objects and materials can be animated with keyframes, and Frames sets the frames of the animation
+// that are rendered. For example, to slide the sphere to the right over a second at 24 frames per second:
+//
+//	"frames": {"start": 0, "end": 24},
+//	"objects": [
+//	  {"type": "sphere", "center": [0, 0, -1], "radius": 0.5, "animation": {
+//	    "position": {"interpolation": "catmull-rom", "keys": [{"frame": 0, "value": [0, 0, 0]}, {"frame": 24, "value": [1, 0, 0]}]}
+//	  }}
+//	]
+type SceneDescription struct {
+	Camera      CameraDescription              `json:"camera"`
+	Environment *EnvironmentDescription        `json:"environment,omitempty"`
+	Lights      []LightDescription             `json:"lights,omitempty"`
+	Materials   map[string]MaterialDescription `json:"materials,omitempty"`
+	Objects     []ObjectDescription            `json:"objects"`
+	Frames      *FrameRange                    `json:"frames,omitempty"`
+
+	// BaseDir is the directory that relative file paths in the description are resolved against
+	BaseDir string `json:"-"`
+	// RestrictPaths refuses absolute file paths and relative ones that lead outside of BaseDir, so that
+	// descriptions from untrusted sources can only read the files inside of it
+	RestrictPaths bool `json:"-"`
+}
+
+// CameraDescription describes the camera that the scene is viewed through. Type is one of "perspective", which is
+// the default, "orthographic", "fisheye", "equirectangular", "stereo" or "ods". Rotation turns the camera about the
+// X, then the Y, then the Z axis, in degrees. Height is the height of the part of the scene that an orthographic
+// camera sees, 2 by default, and FieldOfView is the angle between the top and bottom of a fisheye camera's image in
+// degrees, 180 by default. Animation can animate the "origin" and "rotation".
+//
+// Stereo cameras render the left and right eyes into one image, arranged by Layout: "side-by-side", the default for
+// stereo cameras, or "top-bottom", the default for omni-directional stereo ("ods") cameras. Interocular is the
+// distance between the eyes, 0.064 by default, and Convergence is the distance at which a stereo camera's eyes see
+// objects at the depth of the screen, 1 by default.
+type CameraDescription struct {
+	Type        string                      `json:"type,omitempty"`
+	Height      float64                     `json:"height,omitempty"`
+	FieldOfView float64                     `json:"fov,omitempty"`
+	Interocular float64                     `json:"interocular,omitempty"`
+	Convergence float64                     `json:"convergence,omitempty"`
+	Layout      string                      `json:"layout,omitempty"`
+	Origin      [3]float64                  `json:"origin"`
+	Rotation    [3]float64                  `json:"rotation"`
+	Animation   map[string]TrackDescription `json:"animation,omitempty"`
+}
+
+// EnvironmentDescription describes an equirectangular environment map that lights the scene
+type EnvironmentDescription struct {
+	Path     string   `json:"path"`
+	Rotation float64  `json:"rotation"`
+	Scale    *float64 `json:"scale,omitempty"`
+}
+
+// LightDescription describes a light inside of the scene. Type is one of "point", "spot" or "sun". Color, white by
+// default, is multiplied by Intensity, which is the light that a point or spot light sends out per unit solid
+// angle, or the light that the sun shines onto a surface facing it.
+//
+// Point and spot lights are at Position. Spot lights point along Direction, with Angle the angle between their axis
+// and the edge of their cone in degrees, 30 by default, and Softness the fraction of the cone towards its edge over
+// which their light fades out. For the sun, Direction is the direction that sunlight travels in, and
+// AngularDiameter is the size of the sun's disk in degrees, which softens its shadows, 0.53 by default like the
+// real sun's.
+type LightDescription struct {
+	Type            string      `json:"type"`
+	Position        [3]float64  `json:"position"`
+	Direction       [3]float64  `json:"direction"`
+	Color           *[3]float64 `json:"color,omitempty"`
+	Intensity       float64     `json:"intensity"`
+	Angle           float64     `json:"angle,omitempty"`
+	Softness        float64     `json:"softness,omitempty"`
+	AngularDiameter *float64    `json:"angularDiameter,omitempty"`
+}
+
+// MaterialDescription describes a material. Type is one of "lambertian", "conductor", "dielectric" or
+// "principled", and only the parameters that apply to that type are used.
+type MaterialDescription struct {
+	Type string `json:"type"`
+
+	// lambertian
+	Albedo *TextureDescription `json:"albedo,omitempty"`
+
+	// conductor: either a preset name or a complex index of refraction
+	Preset string      `json:"preset,omitempty"`
+	Eta    *[3]float64 `json:"eta,omitempty"`
+	K      *[3]float64 `json:"k,omitempty"`
+
+	// conductor and dielectric. RoughnessV defaults to Roughness for isotropic surfaces.
+	RoughnessU *float64 `json:"roughnessU,omitempty"`
+	RoughnessV *float64 `json:"roughnessV,omitempty"`
+
+	// principled. Roughness and IOR are also used by conductors and dielectrics.
+	BaseColor      *TextureDescription `json:"baseColor,omitempty"`
+	Metallic       *TextureDescription `json:"metallic,omitempty"`
+	Roughness      *TextureDescription `json:"roughness,omitempty"`
+	Specular       *TextureDescription `json:"specular,omitempty"`
+	SpecularTint   *TextureDescription `json:"specularTint,omitempty"`
+	Sheen          *TextureDescription `json:"sheen,omitempty"`
+	SheenTint      *TextureDescription `json:"sheenTint,omitempty"`
+	Clearcoat      *TextureDescription `json:"clearcoat,omitempty"`
+	ClearcoatGloss *TextureDescription `json:"clearcoatGloss,omitempty"`
+	Transmission   *TextureDescription `json:"transmission,omitempty"`
+	IOR            *TextureDescription `json:"ior,omitempty"`
+
+	// any type. At most one of them may be set.
+	Bump      *BumpDescription      `json:"bump,omitempty"`
+	NormalMap *NormalMapDescription `json:"normalMap,omitempty"`
+
+	// Animation animates parameters by their names, for example "roughness" or "baseColor"
+	Animation map[string]TrackDescription `json:"animation,omitempty"`
+}
+
+// BumpDescription describes a bump map that displaces a surface by Scale times a height texture
+type BumpDescription struct {
+	Height TextureDescription `json:"height"`
+	Scale  *float64           `json:"scale,omitempty"`
+}
+
+// NormalMapDescription describes a tangent-space normal map image
+type NormalMapDescription struct {
+	Texture  string   `json:"texture"`
+	Strength *float64 `json:"strength,omitempty"`
+}
+
+// ObjectDescription describes an object in the scene. Material names one of the scene's materials.
+//
+// Type is one of "sphere", "cylinder", "cone", "disk", "torus", "sdf" or "csg". Cylinders and cones stand on Center and
+// rise along the Y axis by Height, and disks and tori lie flat around Center. Radius is the major radius of a torus,
+// and InnerRadius cuts a hole out of a disk. PhiMax sweeps cylinders, cones, disks and tori part of the way around
+// their axis, in degrees, and Capped closes the ends of cylinders and the bases of cones. An "sdf" object is the
+// surface of the distance function in SDF, traced with at most MaxSteps steps to within Epsilon of the surface.
+//
+// A "csg" object combines its Left and Right objects, which must be closed, with an Operation of "union",
+// "intersection" or "difference". For example, a sphere with a bite taken out of it:
+//
+//	{"type": "csg", "operation": "difference",
+//	  "left": {"type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "red plastic"},
+//	  "right": {"type": "sphere", "center": [0.4, 0.3, -0.7], "radius": 0.3, "material": "gold"}}
+//
+// The object is scaled and then rotated about its center, in degrees about the X, then the Y, then the Z axis, and
+// then moved by Position. Animation can animate the "position", "rotation" and "scale".
+type ObjectDescription struct {
+	Type     string     `json:"type"`
+	Center   [3]float64 `json:"center"`
+	Radius   float64    `json:"radius"`
+	Material string     `json:"material,omitempty"`
+
+	Height      float64 `json:"height,omitempty"`
+	InnerRadius float64 `json:"innerRadius,omitempty"`
+	MinorRadius float64 `json:"minorRadius,omitempty"`
+	PhiMax      float64 `json:"phiMax,omitempty"`
+	Capped      bool    `json:"capped,omitempty"`
+
+	SDF      *SDFDescription `json:"sdf,omitempty"`
+	MaxSteps int             `json:"maxSteps,omitempty"`
+	Epsilon  float64         `json:"epsilon,omitempty"`
+
+	Operation string             `json:"operation,omitempty"`
+	Left      *ObjectDescription `json:"left,omitempty"`
+	Right     *ObjectDescription `json:"right,omitempty"`
+
+	Position  [3]float64                  `json:"position"`
+	Rotation  [3]float64                  `json:"rotation"`
+	Scale     *[3]float64                 `json:"scale,omitempty"`
+	Animation map[string]TrackDescription `json:"animation,omitempty"`
+}
+
+// TextureDescription is a material parameter. In JSON it is either a number, an [r, g, b] color, or an object
+// like {"texture": "path/to/image.png"}. Image textures of color parameters are decoded as sRGB unless
+// "linear" is set.
+type TextureDescription struct {
+	Value   *[3]float64
+	Texture string
+	Linear  bool
+}
+
+// UnmarshalJSON decodes any of the forms that a texture parameter can take
+func (t *TextureDescription) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return errors.New("empty texture parameter")
+	}
+
+	switch data[0] {
+	case '[':
+		var color [3]float64
+		if err := json.Unmarshal(data, &color); err != nil {
+			return fmt.Errorf("invalid color: %s", err)
+		}
+		t.Value = &color
+	case '{':
+		var image struct {
+			Texture string `json:"texture"`
+			Linear  bool   `json:"linear"`
+		}
+		if err := json.Unmarshal(data, &image); err != nil {
+			return fmt.Errorf("invalid texture: %s", err)
+		}
+		if image.Texture == "" {
+			return errors.New("texture parameter is missing an image path")
+		}
+		t.Texture, t.Linear = image.Texture, image.Linear
+	default:
+		var value float64
+		if err := json.Unmarshal(data, &value); err != nil {
+			return fmt.Errorf("invalid texture parameter: %s", err)
+		}
+		t.Value = &[3]float64{value, value, value}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the parameter in its most compact form
+func (t TextureDescription) MarshalJSON() ([]byte, error) {
+	if t.Texture != "" {
+		return json.Marshal(struct {
+			Texture string `json:"texture"`
+			Linear  bool   `json:"linear,omitempty"`
+		}{t.Texture, t.Linear})
+	}
+	if t.Value == nil {
+		return []byte("null"), nil
+	}
+	if v := *t.Value; v[0] == v[1] && v[1] == v[2] {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal(*t.Value)
+}
+
+// ParseSceneDescription decodes a JSON scene description. Relative paths are resolved against the working
+// directory unless BaseDir is set afterwards.
+func ParseSceneDescription(r io.Reader) (*SceneDescription, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	d := &SceneDescription{}
+	if err := decoder.Decode(d); err != nil {
+		return nil, fmt.Errorf("could not decode scene description: %s", err)
+	}
+	return d, nil
+}
+
+// LoadSceneDescription reads a JSON scene description from disk. Relative paths inside of it are resolved
+// against the directory that the file is in.
+func LoadSceneDescription(path string) (*SceneDescription, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open scene description: %s", err)
+	}
+	defer f.Close()
+
+	d, err := ParseSceneDescription(f)
+	if err != nil {
+		return nil, err
+	}
+	d.BaseDir = filepath.Dir(path)
+	return d, nil
+}
+
+// Build creates the scene and the camera that the description describes, at the first frame of its animation
+func (d *SceneDescription) Build() (*Scene, Camera, error) {
+	return d.BuildFrame(d.firstFrame())
+}
+
+// BuildFrame creates the scene and the camera at a frame of the animation. The frame does not need to be a whole
+// number, or to be in the description's frame range.
+func (d *SceneDescription) BuildFrame(frame float64) (*Scene, Camera, error) {
+	b := newSceneBuilder(d)
+	for name, md := range d.Materials {
+		material, err := b.animatedMaterial(md, frame)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not build material %q: %s", name, err)
+		}
+		b.materials[name] = material
+	}
+
+	world := &HittableList{}
+	for i, od := range d.Objects {
+		// IDs start at 1 so that 0 can stand for the background
+		object, err := b.object(od, i+1, frame)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not build object %d: %w", i, err)
+		}
+		world.Add(object)
+	}
+
+	environment, err := b.environment()
+	if err != nil {
+		return nil, nil, err
+	}
+	lights, err := b.lights()
+	if err != nil {
+		return nil, nil, err
+	}
+	camera, err := d.Camera.at(frame)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not set up the camera: %w", err)
+	}
+	return &Scene{World: world, Environment: environment, Lights: lights, MaterialIDs: b.materialIDs()}, camera, nil
+}
+
+// firstFrame returns the frame that a still image of the scene shows
+func (d *SceneDescription) firstFrame() float64 {
+	if d.Frames == nil {
+		return 0
+	}
+	return float64(d.Frames.Start)
+}
+
+// sceneBuilder turns the parts of a scene description into the objects that they describe
+type sceneBuilder struct {
+	description *SceneDescription
+	materials   map[string]Material
+	// textures caches image textures by path so that each image is only loaded once
+	textures map[string]Texture
+}
+
+func newSceneBuilder(d *SceneDescription) *sceneBuilder {
+	return &sceneBuilder{
+		description: d,
+		materials:   map[string]Material{},
+		textures:    map[string]Texture{},
+	}
+}
+
+// path resolves a path from the description, returning an error if the description's paths are restricted and it
+// leads outside of the base directory
+func (b *sceneBuilder) path(p string) (string, error) {
+	d := b.description
+	if !d.RestrictPaths {
+		if filepath.IsAbs(p) || d.BaseDir == "" {
+			return p, nil
+		}
+		return filepath.Join(d.BaseDir, p), nil
+	}
+
+	if filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", fmt.Errorf("path %q must be relative", p)
+	}
+	base := d.BaseDir
+	if base == "" {
+		base = "."
+	}
+	resolved := filepath.Join(base, filepath.Clean(p))
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q leads outside of the asset directory", p)
+	}
+	return resolved, nil
+}
+
+// materialIDs numbers materials in the order of their names so that IDs are the same on every build
+func (b *sceneBuilder) materialIDs() map[Material]int {
+	names := make([]string, 0, len(b.materials))
+	for name := range b.materials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ids := make(map[Material]int, len(names))
+	for i, name := range names {
+		ids[b.materials[name]] = i + 1
+	}
+	return ids
+}
+
+// environment builds the environment light of the scene, or returns nil if it does not have one
+func (b *sceneBuilder) environment() (*EnvironmentLight, error) {
+	d := b.description
+	if d.Environment == nil {
+		return nil, nil
+	}
+	path, err := b.path(d.Environment.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load environment map: %s", err)
+	}
+	image, err := LoadHDRImage(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load environment map: %s", err)
+	}
+	scale := 1.0
+	if d.Environment.Scale != nil {
+		scale = *d.Environment.Scale
+	}
+	environment, err := NewEnvironmentLight(image, d.Environment.Rotation, scale)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up environment light: %s", err)
+	}
+	return environment, nil
+}
+
+// lights builds the lights of the scene
+func (b *sceneBuilder) lights() ([]Light, error) {
+	var lights []Light
+	for i, ld := range b.description.Lights {
+		light, err := ld.light()
+		if err != nil {
+			return nil, fmt.Errorf("could not build light %d: %s", i, err)
+		}
+		lights = append(lights, light)
+	}
+	return lights, nil
+}
+
+// light builds the light that the description describes
+func (ld LightDescription) light() (Light, error) {
+	color := NewVec3(1, 1, 1)
+	if ld.Color != nil {
+		color = vec3FromArray(*ld.Color)
+	}
+	intensity := color.MultiplyFloat(ld.Intensity)
+
+	switch strings.ToLower(ld.Type) {
+	case "point":
+		return &PointLight{Position: vec3FromArray(ld.Position), Intensity: intensity}, nil
+	case "spot":
+		angle := ld.Angle
+		if angle == 0 {
+			angle = 30
+		}
+		return &SpotLight{
+			Position:  vec3FromArray(ld.Position),
+			Direction: vec3FromArray(ld.Direction),
+			Intensity: intensity,
+			Angle:     angle,
+			Softness:  ld.Softness,
+		}, nil
+	case "sun":
+		angularDiameter := 0.53
+		if ld.AngularDiameter != nil {
+			angularDiameter = *ld.AngularDiameter
+		}
+		return &SunLight{Direction: vec3FromArray(ld.Direction), Irradiance: intensity, AngularDiameter: angularDiameter}, nil
+	}
+	return nil, fmt.Errorf("unknown light type %q", ld.Type)
+}
+
+// object builds an object and places it where it is at a frame of the animation
+func (b *sceneBuilder) object(od ObjectDescription, id int, frame float64) (Hittable, error) {
+	shape, err := b.shape(od, id, frame)
+	if err != nil {
+		return nil, err
+	}
+	matrix, err := od.matrix(frame)
+	if err != nil {
+		return nil, err
+	}
+	if matrix == Identity() {
+		return shape, nil
+	}
+	return NewTransformedObject(shape, matrix)
+}
+
+// shape builds an object where its description puts it, before it is transformed
+func (b *sceneBuilder) shape(od ObjectDescription, id int, frame float64) (Hittable, error) {
+	var material Material
+	if od.Material != "" {
+		var ok bool
+		material, ok = b.materials[od.Material]
+		if !ok {
+			return nil, fmt.Errorf("unknown material %q", od.Material)
+		}
+	}
+
+	var shape Hittable
+	switch strings.ToLower(od.Type) {
+	case "sphere":
+		shape = &Sphere{Center: vec3FromArray(od.Center), Radius: od.Radius, Material: material, ID: id}
+	case "cylinder":
+		shape = &Cylinder{Center: vec3FromArray(od.Center), Radius: od.Radius, Height: od.Height, PhiMax: od.PhiMax, Capped: od.Capped, Material: material, ID: id}
+	case "cone":
+		shape = &Cone{Center: vec3FromArray(od.Center), Radius: od.Radius, Height: od.Height, PhiMax: od.PhiMax, Capped: od.Capped, Material: material, ID: id}
+	case "disk":
+		shape = &Disk{Center: vec3FromArray(od.Center), Radius: od.Radius, InnerRadius: od.InnerRadius, PhiMax: od.PhiMax, Material: material, ID: id}
+	case "torus":
+		shape = &Torus{Center: vec3FromArray(od.Center), MajorRadius: od.Radius, MinorRadius: od.MinorRadius, PhiMax: od.PhiMax, Material: material, ID: id}
+	case "sdf":
+		sdf, err := od.sdf(material, id)
+		if err != nil {
+			return nil, err
+		}
+		shape = sdf
+	case "csg":
+		// the objects of a CSG are validated as they are built
+		return b.csg(od, id, frame)
+	default:
+		return nil, fmt.Errorf("unknown object type %q", od.Type)
+	}
+	if err := validate(shape); err != nil {
+		return nil, err
+	}
+	return shape, nil
+}
+
+// animatedMaterial builds a material, along with its bump or normal map, with its parameters at a frame of the
+// animation
+func (b *sceneBuilder) animatedMaterial(md MaterialDescription, frame float64) (Material, error) {
+	md, err := md.at(frame)
+	if err != nil {
+		return nil, err
+	}
+	material, err := b.material(md)
+	if err != nil {
+		return nil, err
+	}
+	return b.perturbation(md, material)
+}
+
+// sdf builds the surface of a distance function
+func (od ObjectDescription) sdf(material Material, id int) (Hittable, error) {
+	if od.SDF == nil {
+		return nil, errors.New("an sdf object needs an sdf")
+	}
+	if od.MaxSteps < 0 || od.Epsilon < 0 {
+		return nil, errors.New("maxSteps and epsilon cannot be negative")
+	}
+	distance, bounds, err := od.SDF.Build()
+	if err != nil {
+		return nil, err
+	}
+	sdf := NewSDF(distance, bounds)
+	if od.MaxSteps > 0 {
+		sdf.MaxSteps = od.MaxSteps
+	}
+	if od.Epsilon > 0 {
+		sdf.Epsilon = od.Epsilon
+	}
+	sdf.Material = material
+	sdf.ID = id
+	return sdf, nil
+}
+
+// csg builds the combination of two objects. Both of them share the ID of the CSG, so that it is a single object
+// in the object ID pass.
+func (b *sceneBuilder) csg(od ObjectDescription, id int, frame float64) (Hittable, error) {
+	if od.Left == nil || od.Right == nil {
+		return nil, errors.New("a csg needs both a left and a right object")
+	}
+	op, err := ParseCSGOperation(od.Operation)
+	if err != nil {
+		return nil, err
+	}
+	left, err := b.object(*od.Left, id, frame)
+	if err != nil {
+		return nil, fmt.Errorf("invalid left object: %w", err)
+	}
+	right, err := b.object(*od.Right, id, frame)
+	if err != nil {
+		return nil, fmt.Errorf("invalid right object: %w", err)
+	}
+	return NewCSG(op, left, right)
+}
+
+func (b *sceneBuilder) material(md MaterialDescription) (Material, error) {
+	switch strings.ToLower(md.Type) {
+	case "lambertian":
+		albedo, err := b.texture(md.Albedo, NewVec3(0.5, 0.5, 0.5), true)
+		if err != nil {
+			return nil, err
+		}
+		if solid, ok := albedo.(*SolidColor); ok {
+			return NewLambertian(solid.Color), nil
+		}
+		return NewTexturedLambertian(albedo), nil
+
+	case "conductor":
+		roughnessU, roughnessV, err := md.anisotropicRoughness()
+		if err != nil {
+			return nil, err
+		}
+		if md.Preset != "" {
+			return NewConductorPreset(md.Preset, roughnessU, roughnessV)
+		}
+		if md.Eta == nil || md.K == nil {
+			return nil, errors.New("a conductor needs either a preset or both eta and k")
+		}
+		return NewRoughConductor(vec3FromArray(*md.Eta), vec3FromArray(*md.K), roughnessU, roughnessV), nil
+
+	case "dielectric":
+		roughnessU, roughnessV, err := md.anisotropicRoughness()
+		if err != nil {
+			return nil, err
+		}
+		ior := 1.5
+		if md.IOR != nil {
+			if md.IOR.Value == nil {
+				return nil, errors.New("the ior of a dielectric must be a number")
+			}
+			ior = md.IOR.Value[0]
+		}
+		return NewRoughDielectric(ior, roughnessU, roughnessV), nil
+
+	case "principled":
+		return b.principled(md)
+
+	default:
+		return nil, fmt.Errorf("unknown material type %q", md.Type)
+	}
+}
+
+// perturbation wraps a material with its bump or normal map, if it has one
+func (b *sceneBuilder) perturbation(md MaterialDescription, material Material) (Material, error) {
+	switch {
+	case md.Bump != nil && md.NormalMap != nil:
+		return nil, errors.New("a material cannot have both a bump map and a normal map")
+
+	case md.Bump != nil:
+		height, err := b.texture(&md.Bump.Height, Vec3{}, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bump height: %s", err)
+		}
+		scale := 1.0
+		if md.Bump.Scale != nil {
+			scale = *md.Bump.Scale
+		}
+		return NewPerturbedMaterial(material, NewBumpMap(height, scale)), nil
+
+	case md.NormalMap != nil:
+		if md.NormalMap.Texture == "" {
+			return nil, errors.New("a normal map needs a texture")
+		}
+		// normal maps store directions, not colors, so they are never decoded as sRGB
+		normals, err := b.texture(&TextureDescription{Texture: md.NormalMap.Texture}, Vec3{}, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid normal map: %s", err)
+		}
+		strength := 1.0
+		if md.NormalMap.Strength != nil {
+			strength = *md.NormalMap.Strength
+		}
+		return NewPerturbedMaterial(material, NewNormalMap(normals, strength)), nil
+
+	default:
+		return material, nil
+	}
+}
+
+// anisotropicRoughness returns the constant roughness of conductors and dielectrics along the tangent and
+// bitangent
+func (md MaterialDescription) anisotropicRoughness() (float64, float64, error) {
+	roughness := 0.0
+	if md.Roughness != nil {
+		if md.Roughness.Value == nil {
+			return 0, 0, errors.New("the roughness of this material type must be a number")
+		}
+		roughness = md.Roughness.Value[0]
+	}
+	roughnessU, roughnessV := roughness, roughness
+	if md.RoughnessU != nil {
+		roughnessU = *md.RoughnessU
+	}
+	if md.RoughnessV != nil {
+		roughnessV = *md.RoughnessV
+	} else if md.RoughnessU != nil {
+		roughnessV = roughnessU
+	}
+	return roughnessU, roughnessV, nil
+}
+
+func (b *sceneBuilder) principled(md MaterialDescription) (Material, error) {
+	m := NewPrincipledBSDF()
+	for _, p := range []struct {
+		name        string
+		description *TextureDescription
+		target      *Texture
+		isColor     bool
+	}{
+		{"baseColor", md.BaseColor, &m.BaseColor, true},
+		{"metallic", md.Metallic, &m.Metallic, false},
+		{"roughness", md.Roughness, &m.Roughness, false},
+		{"specular", md.Specular, &m.Specular, false},
+		{"specularTint", md.SpecularTint, &m.SpecularTint, false},
+		{"sheen", md.Sheen, &m.Sheen, false},
+		{"sheenTint", md.SheenTint, &m.SheenTint, false},
+		{"clearcoat", md.Clearcoat, &m.Clearcoat, false},
+		{"clearcoatGloss", md.ClearcoatGloss, &m.ClearcoatGloss, false},
+		{"transmission", md.Transmission, &m.Transmission, false},
+		{"ior", md.IOR, &m.IOR, false},
+	} {
+		if p.description == nil {
+			continue
+		}
+		texture, err := b.texture(p.description, Vec3{}, p.isColor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", p.name, err)
+		}
+		*p.target = texture
+	}
+	return m, nil
+}
+
+// texture builds the texture of a parameter. Missing parameters use the fallback color.
+func (b *sceneBuilder) texture(td *TextureDescription, fallback Vec3, isColor bool) (Texture, error) {
+	if td == nil {
+		return NewSolidColor(fallback), nil
+	}
+	if td.Texture == "" {
+		if td.Value == nil {
+			return nil, errors.New("texture parameter has no value")
+		}
+		return NewSolidColor(vec3FromArray(*td.Value)), nil
+	}
+
+	srgb := isColor && !td.Linear
+	key := fmt.Sprintf("%s|%t", td.Texture, srgb)
+	if texture, ok := b.textures[key]; ok {
+		return texture, nil
+	}
+	path, err := b.path(td.Texture)
+	if err != nil {
+		return nil, err
+	}
+	texture, err := LoadImageTexture(path, srgb)
+	if err != nil {
+		return nil, err
+	}
+	b.textures[key] = texture
+	return texture, nil
+}
+
+// vec3FromArray converts a JSON array to a vector
+func vec3FromArray(a [3]float64) Vec3 {
+	return NewVec3(a[0], a[1], a[2])
+}
@@ -0,0 +1,126 @@
+package raytracer_test
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextureDescription_UnmarshalJSON(t *testing.T) {
+	for _, tc := range []struct {
+		desc, input string
+		want        rt.TextureDescription
+		isError     bool
+	}{
+		{desc: "a number", input: `0.25`, want: rt.TextureDescription{Value: &[3]float64{0.25, 0.25, 0.25}}},
+		{desc: "a color", input: `[1, 0.5, 0]`, want: rt.TextureDescription{Value: &[3]float64{1, 0.5, 0}}},
+		{desc: "an image", input: `{"texture": "rough.png", "linear": true}`, want: rt.TextureDescription{Texture: "rough.png", Linear: true}},
+		{desc: "an image without a path", input: `{"linear": true}`, isError: true},
+		{desc: "a string", input: `"red"`, isError: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var td rt.TextureDescription
+			err := json.Unmarshal([]byte(tc.input), &td)
+			if tc.isError {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, td)
+		})
+	}
+}
+
+func TestSceneDescription_Build(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scene")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// a 2x1 texture that is black on the left and white on the right
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{0, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{255, 255, 255, 255})
+	f, err := os.Create(filepath.Join(dir, "stripes.png"))
+	assert.Nil(t, err)
+	assert.Nil(t, png.Encode(f, img))
+	f.Close()
+
+	scenePath := filepath.Join(dir, "scene.json")
+	assert.Nil(t, ioutil.WriteFile(scenePath, []byte(`{
+		"camera": {"origin": [0, 0, 0]},
+		"materials": {
+			"striped": {"type": "principled", "baseColor": {"texture": "stripes.png"}, "roughness": 0.2, "clearcoat": 1},
+			"gold": {"type": "conductor", "preset": "gold", "roughness": 0.3},
+			"brushed": {"type": "conductor", "eta": [1, 1, 1], "k": [3, 3, 3], "roughnessU": 0.1, "roughnessV": 0.5},
+			"glass": {"type": "dielectric", "ior": 1.33},
+			"matte": {"type": "lambertian", "albedo": [0.2, 0.4, 0.6]},
+			"chalk": {"type": "lambertian", "albedo": {"texture": "stripes.png"}}
+		},
+		"lights": [
+			{"type": "point", "position": [0, 2, 0], "color": [1, 0.5, 0.5], "intensity": 2},
+			{"type": "spot", "position": [1, 2, 0], "direction": [0, -1, 0], "intensity": 3, "softness": 0.2},
+			{"type": "sun", "direction": [-1, -2, -1], "intensity": 4}
+		],
+		"objects": [
+			{"type": "sphere", "center": [0, 0, -1], "radius": 0.5, "material": "striped"},
+			{"type": "sphere", "center": [0, -100.5, -1], "radius": 100},
+			{"type": "sphere", "center": [1, 0, -1], "radius": 0.5, "material": "chalk"}
+		]
+	}`), 0644))
+
+	description, err := rt.LoadSceneDescription(scenePath)
+	assert.Nil(t, err)
+	scene, camera, err := description.Build()
+	assert.Nil(t, err)
+	assert.NotNil(t, camera)
+
+	world := scene.World.(*rt.HittableList)
+	assert.Len(t, world.Objects, 3)
+	striped := world.Objects[0].(*rt.Sphere).Material.(*rt.PrincipledBSDF)
+	assert.Equal(t, rt.NewVec3(0, 0, 0), striped.BaseColor.Value(0.25, 0.5, rt.Vec3{}))
+	assert.Equal(t, rt.NewVec3(1, 1, 1), striped.BaseColor.Value(0.75, 0.5, rt.Vec3{}))
+	assert.Equal(t, rt.NewVec3(0.2, 0.2, 0.2), striped.Roughness.Value(0, 0, rt.Vec3{}))
+	assert.Nil(t, world.Objects[1].(*rt.Sphere).Material)
+	chalk := world.Objects[2].(*rt.Sphere).Material.(*rt.Lambertian)
+	assert.Equal(t, rt.NewVec3(0, 0, 0), chalk.AlbedoAt(&rt.HitRecord{U: 0.25, V: 0.5}))
+	assert.Equal(t, rt.NewVec3(1, 1, 1), chalk.AlbedoAt(&rt.HitRecord{U: 0.75, V: 0.5}))
+	assert.Equal(t, []rt.Light{
+		&rt.PointLight{Position: rt.NewVec3(0, 2, 0), Intensity: rt.NewVec3(2, 1, 1)},
+		&rt.SpotLight{Position: rt.NewVec3(1, 2, 0), Direction: rt.NewVec3(0, -1, 0), Intensity: rt.NewVec3(3, 3, 3), Angle: 30, Softness: 0.2},
+		&rt.SunLight{Direction: rt.NewVec3(-1, -2, -1), Irradiance: rt.NewVec3(4, 4, 4), AngularDiameter: 0.53},
+	}, scene.Lights)
+
+	t.Run("errors name the broken part", func(t *testing.T) {
+		for _, tc := range []struct {
+			desc, input, wantError string
+		}{
+			{desc: "unknown material", input: `{"objects": [{"type": "sphere", "radius": 1, "material": "wood"}]}`, wantError: `unknown material "wood"`},
+			{desc: "unknown object", input: `{"objects": [{"type": "teapot"}]}`, wantError: `unknown object type "teapot"`},
+			{desc: "unknown light", input: `{"lights": [{"type": "area"}], "objects": []}`, wantError: `could not build light 0: unknown light type "area"`},
+			{desc: "unknown preset", input: `{"materials": {"m": {"type": "conductor", "preset": "tin"}}, "objects": []}`, wantError: `unknown conductor "tin"`},
+			{desc: "textured dielectric roughness", input: `{"materials": {"m": {"type": "dielectric", "roughness": {"texture": "a.png"}}}, "objects": []}`, wantError: "must be a number"},
+		} {
+			t.Run(tc.desc, func(t *testing.T) {
+				description, err := rt.ParseSceneDescription(strings.NewReader(tc.input))
+				assert.Nil(t, err)
+				_, _, err = description.Build()
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantError)
+			})
+		}
+	})
+
+	t.Run("unknown fields are rejected", func(t *testing.T) {
+		_, err := rt.ParseSceneDescription(strings.NewReader(`{"objects": [], "fog": []}`))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,257 @@
+package raytracer
+
+import "math"
+
+// DistanceFunc is a signed distance function: it returns the distance from a point to the closest point on a
+// surface, which is negative inside of the surface. Functions that are not exact, like the distance estimate of a
+// fractal, must never return more than the true distance.
+type DistanceFunc func(p Vec3) float64
+
+// SDF is a surface described by a signed distance function, which rays find by sphere tracing: stepping along the
+// ray by the distance to the surface until they are within Epsilon of it
+type SDF struct {
+	Distance DistanceFunc
+	// Bounds is a box around the surface, which keeps rays that miss it from being traced. A nil box traces rays up
+	// to MaxDistance.
+	Bounds *AABB
+	// MaxSteps is the most steps that a ray takes before it is considered to have missed the surface
+	MaxSteps int
+	// Epsilon is how close to the surface a ray has to get to hit it, and the spacing of the samples that estimate
+	// the normal
+	Epsilon float64
+	// MaxDistance is how far rays are traced when there is no bounding box
+	MaxDistance float64
+	// Material is the material that the surface is made of. A nil material is a grey diffuse surface.
+	Material Material
+	// ID identifies the surface in the object ID pass. 0 is reserved for the background.
+	ID int
+}
+
+// NewSDF returns the surface of a distance function, with a step budget and epsilon that suit surfaces about as
+// large as a unit sphere
+func NewSDF(distance DistanceFunc, bounds *AABB) *SDF {
+	return &SDF{Distance: distance, Bounds: bounds, MaxSteps: 256, Epsilon: 1e-4, MaxDistance: 100}
+}
+
+// Hit sphere traces the ray between tMin and tMax
+func (s *SDF) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	length := ray.Direction().Length()
+	if length == 0 {
+		// a ray with no direction cannot intersect anything
+		return false
+	}
+	if s.Bounds != nil {
+		// the box is padded by epsilon, since surfaces that touch their box are only reached to within epsilon
+		padding := NewVec3(s.Epsilon, s.Epsilon, s.Epsilon)
+		var ok bool
+		if tMin, tMax, ok = NewAABB(s.Bounds.Min.SubtractVector(padding), s.Bounds.Max.AddVector(padding)).Intersect(ray, tMin, tMax); !ok {
+			return false
+		}
+	} else {
+		tMax = math.Min(tMax, tMin+s.MaxDistance/length)
+	}
+
+	// rays that start inside of the surface, like refracted ones, march out of it instead of into it
+	t := tMin
+	side := 1.0
+	if s.Distance(ray.At(t)) < 0 {
+		side = -1
+	}
+	for step := 0; step < s.MaxSteps && t <= tMax; step++ {
+		distance := side * s.Distance(ray.At(t))
+		if distance < s.Epsilon {
+			s.record(ray, t, hitRecord)
+			return true
+		}
+		// distances are along the surface's space, and t is in units of the ray's direction
+		t += distance / length
+	}
+	return false
+}
+
+// Validate returns an error if the surface has no distance function, or the march has no steps or epsilon
+func (s *SDF) Validate() error {
+	if s.Distance == nil {
+		return validationError("sdf", "distance function", ErrMissing)
+	}
+	if s.MaxSteps <= 0 {
+		return validationError("sdf", "step budget", ErrNotPositive)
+	}
+	if err := checkPositive("sdf", "epsilon", s.Epsilon); err != nil {
+		return err
+	}
+	if s.Bounds == nil {
+		return checkPositive("sdf", "maximum distance", s.MaxDistance)
+	}
+	return nil
+}
+
+// BoundingBox returns the bounds of the surface, which is nil if it does not have any
+func (s *SDF) BoundingBox() *AABB {
+	return s.Bounds
+}
+
+// record fills in the hit record of the point at t along the ray
+func (s *SDF) record(ray Ray, t float64, hitRecord *HitRecord) {
+	*hitRecord = HitRecord{T: t, P: ray.At(t), ObjectID: s.ID, Material: s.Material}
+	if hitRecord.Material == nil {
+		hitRecord.Material = defaultMaterial
+	}
+	hitRecord.SetFaceNormal(ray, s.Normal(hitRecord.P))
+}
+
+// tetrahedron is the corners of a tetrahedron around the origin, which Normal samples the distance function at
+var tetrahedron = [4]Vec3{{1, -1, -1}, {-1, -1, 1}, {-1, 1, -1}, {1, 1, 1}}
+
+// Normal estimates the outward normal of the surface at a point from the gradient of the distance function. It
+// samples the function at the corners of a small tetrahedron around the point, which takes four samples instead of
+// the six of central differences.
+func (s *SDF) Normal(p Vec3) Vec3 {
+	h := s.Epsilon
+	gradient := NewVec3(0, 0, 0)
+	for _, k := range tetrahedron {
+		gradient = gradient.AddVector(k.MultiplyFloat(s.Distance(p.AddVector(k.MultiplyFloat(h)))))
+	}
+	normal, err := gradient.Unit()
+	if err != nil {
+		// the gradient vanishes where the surface has no normal, like the inside of a fractal
+		return NewVec3(0, 1, 0)
+	}
+	return normal
+}
+
+// SDFSphere returns the distance to a sphere
+func SDFSphere(center Vec3, radius float64) DistanceFunc {
+	return func(p Vec3) float64 {
+		return p.SubtractVector(center).Length() - radius
+	}
+}
+
+// SDFBox returns the distance to a box with the passed-in half of its size along each axis
+func SDFBox(center, halfSize Vec3) DistanceFunc {
+	return SDFRoundBox(center, halfSize, 0)
+}
+
+// SDFRoundBox returns the distance to a box whose edges are rounded off by radius. The rounding is taken out of
+// the box, so it keeps its size.
+func SDFRoundBox(center, halfSize Vec3, radius float64) DistanceFunc {
+	return func(p Vec3) float64 {
+		local := p.SubtractVector(center)
+		q := NewVec3(
+			math.Abs(local.X)-halfSize.X+radius,
+			math.Abs(local.Y)-halfSize.Y+radius,
+			math.Abs(local.Z)-halfSize.Z+radius,
+		)
+		outside := NewVec3(math.Max(q.X, 0), math.Max(q.Y, 0), math.Max(q.Z, 0)).Length()
+		inside := math.Min(math.Max(q.X, math.Max(q.Y, q.Z)), 0)
+		return outside + inside - radius
+	}
+}
+
+// SDFTorus returns the distance to a torus that lies around the Y axis, like Torus
+func SDFTorus(center Vec3, majorRadius, minorRadius float64) DistanceFunc {
+	return func(p Vec3) float64 {
+		local := p.SubtractVector(center)
+		ring := math.Sqrt(local.X*local.X+local.Z*local.Z) - majorRadius
+		return math.Sqrt(ring*ring+local.Y*local.Y) - minorRadius
+	}
+}
+
+// SDFCapsule returns the distance to a capsule: the points within radius of the line segment from a to b
+func SDFCapsule(a, b Vec3, radius float64) DistanceFunc {
+	ab := b.SubtractVector(a)
+	return func(p Vec3) float64 {
+		ap := p.SubtractVector(a)
+		h := 0.0
+		if lengthSquared := ab.LengthSquared(); lengthSquared > 0 {
+			h = clamp(ap.Dot(ab)/lengthSquared, 0, 1)
+		}
+		return ap.SubtractVector(ab.MultiplyFloat(h)).Length() - radius
+	}
+}
+
+// SDFMandelbulb returns an estimate of the distance to the Mandelbulb fractal of the passed-in power, which fits
+// inside a sphere of radius 1.2 around the origin. More iterations add finer detail.
+func SDFMandelbulb(power float64, iterations int) DistanceFunc {
+	return func(p Vec3) float64 {
+		z := p
+		dr, r := 1.0, 0.0
+		for i := 0; i < iterations; i++ {
+			r = z.Length()
+			if r > 2 {
+				break
+			}
+			if r == 0 {
+				// zero raised to the power is zero, which leaves just the point
+				z = p
+				continue
+			}
+			// raise the point to the power in spherical coordinates, tracking the derivative for the estimate
+			theta := math.Acos(clamp(z.Z/r, -1, 1)) * power
+			phi := math.Atan2(z.Y, z.X) * power
+			dr = math.Pow(r, power-1)*power*dr + 1
+			zr := math.Pow(r, power)
+			sinTheta, cosTheta := math.Sincos(theta)
+			sinPhi, cosPhi := math.Sincos(phi)
+			z = Vec3{zr*sinTheta*cosPhi + p.X, zr*sinTheta*sinPhi + p.Y, zr*cosTheta + p.Z}
+		}
+		if r == 0 {
+			return 0
+		}
+		return 0.5 * math.Log(r) * r / dr
+	}
+}
+
+// SDFUnion returns the distance to the surface around the space inside of either a or b
+func SDFUnion(a, b DistanceFunc) DistanceFunc {
+	return func(p Vec3) float64 {
+		return math.Min(a(p), b(p))
+	}
+}
+
+// SDFSubtraction returns the distance to the surface around the space inside of a and outside of b
+func SDFSubtraction(a, b DistanceFunc) DistanceFunc {
+	return func(p Vec3) float64 {
+		return math.Max(a(p), -b(p))
+	}
+}
+
+// SDFSmoothUnion returns the distance to the union of a and b, with the crease where they meet filled in over a
+// distance of about k
+func SDFSmoothUnion(a, b DistanceFunc, k float64) DistanceFunc {
+	if k <= 0 {
+		return SDFUnion(a, b)
+	}
+	return func(p Vec3) float64 {
+		da, db := a(p), b(p)
+		h := clamp(0.5+0.5*(db-da)/k, 0, 1)
+		return db + (da-db)*h - k*h*(1-h)
+	}
+}
+
+// SDFSmoothSubtraction returns the distance to a with b cut out of it, with the edge of the cut rounded off over a
+// distance of about k
+func SDFSmoothSubtraction(a, b DistanceFunc, k float64) DistanceFunc {
+	if k <= 0 {
+		return SDFSubtraction(a, b)
+	}
+	return func(p Vec3) float64 {
+		da, db := a(p), b(p)
+		h := clamp(0.5-0.5*(da+db)/k, 0, 1)
+		return da + (-db-da)*h + k*h*(1-h)
+	}
+}
+
+// SDFRepeat repeats a surface forever along each axis with a positive period. The surface should fit inside one
+// period around the origin, or it is cut off at the edges of its cell.
+func SDFRepeat(f DistanceFunc, period Vec3) DistanceFunc {
+	repeat := func(x, period float64) float64 {
+		if period <= 0 {
+			return x
+		}
+		return x - period*math.Round(x/period)
+	}
+	return func(p Vec3) float64 {
+		return f(Vec3{repeat(p.X, period.X), repeat(p.Y, period.Y), repeat(p.Z, period.Z)})
+	}
+}
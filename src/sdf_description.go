@@ -0,0 +1,148 @@
+package raytracer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SDFDescription describes a signed distance function as a tree of shapes. Type is one of:
+//
+//   - "sphere" with a Center and Radius
+//   - "box" with a Center and HalfSize, and "roundBox" with edges rounded off by Radius
+//   - "torus" with a Center, Radius and MinorRadius, lying around the Y axis
+//   - "capsule" from A to B with a Radius
+//   - "mandelbulb" with a Center, Power and Iterations
+//   - "union" and "subtraction" of Shapes, where subtraction cuts the others out of the first one. Smoothness rounds
+//     off the creases where they meet.
+//   - "repeat" of a single shape in Shapes, every Period along each axis with a positive period
+//
+// For example, a box with rounded holes cut through it:
+//
+//	{"type": "subtraction", "smoothness": 0.05, "shapes": [
+//	  {"type": "roundBox", "halfSize": [0.5, 0.5, 0.5], "radius": 0.05},
+//	  {"type": "capsule", "a": [-1, 0, 0], "b": [1, 0, 0], "radius": 0.25}
+//	]}
+type SDFDescription struct {
+	Type        string           `json:"type"`
+	Center      [3]float64       `json:"center"`
+	HalfSize    [3]float64       `json:"halfSize"`
+	Radius      float64          `json:"radius,omitempty"`
+	MinorRadius float64          `json:"minorRadius,omitempty"`
+	A           [3]float64       `json:"a"`
+	B           [3]float64       `json:"b"`
+	Power       float64          `json:"power,omitempty"`
+	Iterations  int              `json:"iterations,omitempty"`
+	Smoothness  float64          `json:"smoothness,omitempty"`
+	Period      [3]float64       `json:"period"`
+	Shapes      []SDFDescription `json:"shapes,omitempty"`
+}
+
+// Build returns the distance function that the description describes, along with a box around its surface. The
+// box is nil for surfaces that go on forever, like repetitions.
+func (sd SDFDescription) Build() (DistanceFunc, *AABB, error) {
+	center := vec3FromArray(sd.Center)
+	switch strings.ToLower(sd.Type) {
+	case "sphere":
+		if sd.Radius <= 0 {
+			return nil, nil, errors.New("the radius of a sphere must be positive")
+		}
+		return SDFSphere(center, sd.Radius), boxAround(center, NewVec3(sd.Radius, sd.Radius, sd.Radius)), nil
+
+	case "box", "roundbox":
+		halfSize := vec3FromArray(sd.HalfSize)
+		if halfSize.X <= 0 || halfSize.Y <= 0 || halfSize.Z <= 0 {
+			return nil, nil, fmt.Errorf("the halfSize of a %s must be positive", sd.Type)
+		}
+		if sd.Radius < 0 || sd.Radius > halfSize.X || sd.Radius > halfSize.Y || sd.Radius > halfSize.Z {
+			return nil, nil, errors.New("the rounding radius of a box must be between 0 and its halfSize")
+		}
+		return SDFRoundBox(center, halfSize, sd.Radius), boxAround(center, halfSize), nil
+
+	case "torus":
+		if sd.Radius <= 0 || sd.MinorRadius <= 0 {
+			return nil, nil, errors.New("the radii of a torus must be positive")
+		}
+		outer := sd.Radius + sd.MinorRadius
+		return SDFTorus(center, sd.Radius, sd.MinorRadius), boxAround(center, NewVec3(outer, sd.MinorRadius, outer)), nil
+
+	case "capsule":
+		if sd.Radius <= 0 {
+			return nil, nil, errors.New("the radius of a capsule must be positive")
+		}
+		a, b := vec3FromArray(sd.A), vec3FromArray(sd.B)
+		extent := NewVec3(sd.Radius, sd.Radius, sd.Radius)
+		box := NewAABB(a.SubtractVector(extent), a.AddVector(extent)).Union(NewAABB(b.SubtractVector(extent), b.AddVector(extent)))
+		return SDFCapsule(a, b, sd.Radius), box, nil
+
+	case "mandelbulb":
+		power, iterations := sd.Power, sd.Iterations
+		if power == 0 {
+			power = 8
+		}
+		if iterations == 0 {
+			iterations = 12
+		}
+		if power < 2 || iterations < 1 {
+			return nil, nil, errors.New("a mandelbulb needs a power of at least 2 and at least 1 iteration")
+		}
+		bulb := SDFMandelbulb(power, iterations)
+		f := func(p Vec3) float64 { return bulb(p.SubtractVector(center)) }
+		return f, boxAround(center, NewVec3(1.2, 1.2, 1.2)), nil
+
+	case "union", "subtraction":
+		return sd.combination()
+
+	case "repeat":
+		if len(sd.Shapes) != 1 {
+			return nil, nil, errors.New("a repeat needs exactly one shape")
+		}
+		f, _, err := sd.Shapes[0].Build()
+		if err != nil {
+			return nil, nil, err
+		}
+		return SDFRepeat(f, vec3FromArray(sd.Period)), nil, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown SDF type %q", sd.Type)
+	}
+}
+
+// combination builds a union or a subtraction of the shapes
+func (sd SDFDescription) combination() (DistanceFunc, *AABB, error) {
+	if len(sd.Shapes) < 2 {
+		return nil, nil, fmt.Errorf("a %s needs at least two shapes", sd.Type)
+	}
+	f, box, err := sd.Shapes[0].Build()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid shape 0: %s", err)
+	}
+	isUnion := strings.EqualFold(sd.Type, "union")
+	for i, shape := range sd.Shapes[1:] {
+		g, shapeBox, err := shape.Build()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid shape %d: %s", i+1, err)
+		}
+		if !isUnion {
+			// cutting a shape out never makes the surface larger
+			f = SDFSmoothSubtraction(f, g, sd.Smoothness)
+			continue
+		}
+		f = SDFSmoothUnion(f, g, sd.Smoothness)
+		if box != nil && shapeBox != nil {
+			box = box.Union(shapeBox)
+		} else {
+			box = nil
+		}
+	}
+	if isUnion && box != nil && sd.Smoothness > 0 {
+		// blending fills in the space between the shapes, by less than the smoothness
+		box = boxAround(box.Center(), box.Max.SubtractVector(box.Center()).AddVector(NewVec3(sd.Smoothness, sd.Smoothness, sd.Smoothness)))
+	}
+	return f, box, nil
+}
+
+// boxAround returns the box with the passed-in center and half of its size along each axis
+func boxAround(center, halfSize Vec3) *AABB {
+	return NewAABB(center.SubtractVector(halfSize), center.AddVector(halfSize))
+}
@@ -0,0 +1,155 @@
+package raytracer_test
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistanceFuncs(t *testing.T) {
+	origin := rt.NewVec3(0, 0, 0)
+	unitSphere := rt.SDFSphere(origin, 1)
+	shifted := rt.SDFSphere(rt.NewVec3(1.5, 0, 0), 1)
+	for _, tc := range []struct {
+		desc string
+		f    rt.DistanceFunc
+		p    rt.Vec3
+		want float64
+	}{
+		{desc: "sphere outside", f: unitSphere, p: rt.NewVec3(3, 0, 0), want: 2},
+		{desc: "sphere inside", f: unitSphere, p: rt.NewVec3(0, 0.5, 0), want: -0.5},
+		{desc: "box face", f: rt.SDFBox(origin, rt.NewVec3(1, 2, 3)), p: rt.NewVec3(0, 5, 0), want: 3},
+		{desc: "box corner", f: rt.SDFBox(origin, rt.NewVec3(1, 1, 1)), p: rt.NewVec3(2, 2, 1), want: math.Sqrt2},
+		{desc: "box inside", f: rt.SDFBox(origin, rt.NewVec3(1, 1, 1)), p: rt.NewVec3(0.5, 0, 0), want: -0.5},
+		{desc: "round box face", f: rt.SDFRoundBox(origin, rt.NewVec3(1, 1, 1), 0.25), p: rt.NewVec3(0, 2, 0), want: 1},
+		{desc: "round box corner", f: rt.SDFRoundBox(origin, rt.NewVec3(1, 1, 1), 0.25), p: rt.NewVec3(1, 1, 1), want: math.Sqrt(3)*0.25 - 0.25},
+		{desc: "torus tube", f: rt.SDFTorus(origin, 2, 0.5), p: rt.NewVec3(0, 0, 2), want: -0.5},
+		{desc: "torus hole", f: rt.SDFTorus(origin, 2, 0.5), p: origin, want: 1.5},
+		{desc: "capsule side", f: rt.SDFCapsule(origin, rt.NewVec3(0, 2, 0), 0.5), p: rt.NewVec3(1, 1, 0), want: 0.5},
+		{desc: "capsule end", f: rt.SDFCapsule(origin, rt.NewVec3(0, 2, 0), 0.5), p: rt.NewVec3(0, 3, 0), want: 0.5},
+		{desc: "union", f: rt.SDFUnion(unitSphere, shifted), p: rt.NewVec3(3, 0, 0), want: 0.5},
+		{desc: "subtraction", f: rt.SDFSubtraction(unitSphere, shifted), p: rt.NewVec3(0.75, 0, 0), want: 0.25},
+		{desc: "smooth union away from the crease", f: rt.SDFSmoothUnion(unitSphere, shifted, 0.1), p: rt.NewVec3(-3, 0, 0), want: 2},
+		{desc: "smooth union fills the crease", f: rt.SDFSmoothUnion(unitSphere, shifted, 1), p: rt.NewVec3(0.75, 1, 0), want: rt.SDFUnion(unitSphere, shifted)(rt.NewVec3(0.75, 1, 0)) - 0.25},
+		{desc: "smooth subtraction away from the cut", f: rt.SDFSmoothSubtraction(unitSphere, shifted, 0.1), p: rt.NewVec3(-3, 0, 0), want: 2},
+		{desc: "repeat", f: rt.SDFRepeat(unitSphere, rt.NewVec3(4, 0, 4)), p: rt.NewVec3(8, 2, -4), want: 1},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.InDelta(t, tc.want, tc.f(tc.p), 1e-9)
+		})
+	}
+}
+
+func TestSDF_Hit(t *testing.T) {
+	// a sphere traced from its distance function matches the analytic sphere
+	center := rt.NewVec3(0.5, -0.25, -3)
+	sphere := rt.NewSphere(center, 1)
+	sdf := rt.NewSDF(rt.SDFSphere(center, 1), sphere.BoundingBox())
+	unbounded := rt.NewSDF(rt.SDFSphere(center, 1), nil)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		origin := rt.NewVec3(rng.Float64()-0.5, rng.Float64()-0.5, rng.Float64()-0.5)
+		ray := rt.NewRay(origin, center.AddVector(rt.NewVec3(rng.Float64()*3-1.5, rng.Float64()*3-1.5, 0)).SubtractVector(origin))
+		// rays that only graze the sphere can come within epsilon of it without hitting
+		toCenter := center.SubtractVector(origin)
+		unit, _ := ray.Direction().Unit()
+		if miss := toCenter.SubtractVector(unit.MultiplyFloat(toCenter.Dot(unit))).Length(); math.Abs(miss-1) < 1e-2 {
+			continue
+		}
+		want := &rt.HitRecord{}
+		wantHit := sphere.Hit(ray, 0.001, math.Inf(1), want)
+		for _, s := range []*rt.SDF{sdf, unbounded} {
+			got := &rt.HitRecord{}
+			gotHit := s.Hit(ray, 0.001, math.Inf(1), got)
+			assert.Equal(t, wantHit, gotHit)
+			if wantHit && gotHit {
+				assert.InDelta(t, want.T, got.T, 1e-3)
+				assert.InDelta(t, 0, want.Normal.SubtractVector(got.Normal).Length(), 1e-3)
+				assert.Equal(t, want.FrontFace, got.FrontFace)
+			}
+		}
+	}
+
+	t.Run("from inside", func(t *testing.T) {
+		hitRecord := &rt.HitRecord{}
+		didHit := sdf.Hit(rt.NewRay(center, rt.NewVec3(0, 0, 2)), 0.001, math.Inf(1), hitRecord)
+		assert.True(t, didHit)
+		assert.InDelta(t, 0.5, hitRecord.T, 1e-3)
+		assert.False(t, hitRecord.FrontFace)
+		assert.InDelta(t, -1, hitRecord.Normal.Z, 1e-3)
+	})
+
+	t.Run("step budget", func(t *testing.T) {
+		ray := rt.NewRay(rt.NewVec3(0, 0, 0), rt.NewVec3(0, 0, -1))
+		tight := rt.NewSDF(rt.SDFBox(rt.NewVec3(0, 0, -5), rt.NewVec3(1, 1, 1)), nil)
+		// the ray runs along the edge of a box, so every step only gets it a little closer
+		tight.Distance = rt.SDFRepeat(tight.Distance, rt.NewVec3(2.5, 0, 0))
+		didHit := tight.Hit(rt.NewRay(rt.NewVec3(1.25, 1.1, 0), rt.NewVec3(0, 0, -1)), 0, math.Inf(1), &rt.HitRecord{})
+		assert.False(t, didHit)
+
+		tight.MaxSteps = 1
+		didHit = tight.Hit(ray, 0, math.Inf(1), &rt.HitRecord{})
+		assert.False(t, didHit, "the first step only reaches the front of the box")
+		tight.MaxSteps = 2
+		didHit = tight.Hit(ray, 0, math.Inf(1), &rt.HitRecord{})
+		assert.True(t, didHit)
+	})
+
+	t.Run("mandelbulb", func(t *testing.T) {
+		bulb := rt.NewSDF(rt.SDFMandelbulb(8, 10), rt.NewAABB(rt.NewVec3(-1.2, -1.2, -1.2), rt.NewVec3(1.2, 1.2, 1.2)))
+		hitRecord := &rt.HitRecord{}
+		didHit := bulb.Hit(rt.NewRay(rt.NewVec3(0, 0.1, 3), rt.NewVec3(0, 0, -1)), 0, math.Inf(1), hitRecord)
+		assert.True(t, didHit)
+		assert.True(t, hitRecord.P.Length() < 1.2 && hitRecord.P.Length() > 0.5, "hit at %v", hitRecord.P)
+		assert.InDelta(t, 1, hitRecord.Normal.Length(), 1e-9)
+	})
+}
+
+func TestSceneDescription_SDF(t *testing.T) {
+	description, err := rt.ParseSceneDescription(strings.NewReader(`{"objects": [
+		{"type": "sdf", "maxSteps": 64, "epsilon": 0.001, "sdf": {"type": "subtraction", "smoothness": 0.05, "shapes": [
+			{"type": "roundBox", "center": [0, 0, -3], "halfSize": [0.5, 0.5, 0.5], "radius": 0.05},
+			{"type": "capsule", "a": [-1, 0, -3], "b": [1, 0, -3], "radius": 0.25}
+		]}},
+		{"type": "sdf", "sdf": {"type": "repeat", "period": [2, 0, 2], "shapes": [{"type": "torus", "radius": 0.5, "minorRadius": 0.1}]}}
+	]}`))
+	assert.Nil(t, err)
+	scene, _, err := description.Build()
+	assert.Nil(t, err)
+	world := scene.World.(*rt.HittableList)
+	box := world.Objects[0].(*rt.SDF)
+	assert.Equal(t, 64, box.MaxSteps)
+	assert.Equal(t, 0.001, box.Epsilon)
+	assert.Equal(t, rt.NewAABB(rt.NewVec3(-0.5, -0.5, -3.5), rt.NewVec3(0.5, 0.5, -2.5)), box.Bounds)
+	assert.Nil(t, world.Objects[1].(*rt.SDF).Bounds, "repetitions go on forever")
+
+	// the capsule drills a hole through the middle of the box
+	didHit := box.Hit(rt.NewRay(rt.NewVec3(0, 0, 0), rt.NewVec3(0, 0, -1)), 0, math.Inf(1), &rt.HitRecord{})
+	assert.True(t, didHit)
+	didHit = box.Hit(rt.NewRay(rt.NewVec3(-3, 0, -3), rt.NewVec3(1, 0, 0)), 0, math.Inf(1), &rt.HitRecord{})
+	assert.False(t, didHit)
+
+	for _, tc := range []struct {
+		desc, input, wantError string
+	}{
+		{desc: "missing sdf", input: `{"type": "sdf"}`, wantError: "needs an sdf"},
+		{desc: "unknown shape", input: `{"type": "sdf", "sdf": {"type": "teapot"}}`, wantError: `unknown SDF type "teapot"`},
+		{desc: "lonely union", input: `{"type": "sdf", "sdf": {"type": "union", "shapes": [{"type": "sphere", "radius": 1}]}}`, wantError: "at least two shapes"},
+		{desc: "flat box", input: `{"type": "sdf", "sdf": {"type": "box", "halfSize": [1, 0, 1]}}`, wantError: "halfSize"},
+		{desc: "bad nested shape", input: `{"type": "sdf", "sdf": {"type": "union", "shapes": [{"type": "sphere", "radius": 1}, {"type": "sphere"}]}}`, wantError: "invalid shape 1"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			description, err := rt.ParseSceneDescription(strings.NewReader(`{"objects": [` + tc.input + `]}`))
+			assert.Nil(t, err)
+			_, _, err = description.Build()
+			assert.Error(t, err)
+			if err != nil {
+				assert.Contains(t, err.Error(), tc.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+)
+
+// Status is the stage of its life that a job is in
+type Status string
+
+const (
+	// StatusQueued jobs are waiting for a free renderer
+	StatusQueued Status = "queued"
+	// StatusRunning jobs are being rendered
+	StatusRunning Status = "running"
+	// StatusDone jobs have finished, and their image can be downloaded
+	StatusDone Status = "done"
+	// StatusFailed jobs stopped because of an error
+	StatusFailed Status = "failed"
+	// StatusCanceled jobs were stopped by a client or by the server shutting down
+	StatusCanceled Status = "canceled"
+)
+
+// JobStatus is the JSON report of a job's progress
+type JobStatus struct {
+	ID     string `json:"id"`
+	Status Status `json:"status"`
+	// Progress is the fraction of the passes that have been rendered, from 0 to 1
+	Progress float64 `json:"progress"`
+	// Passes is the number of passes rendered so far, each of which adds a sample to every pixel
+	Passes      int `json:"passes"`
+	TotalPasses int `json:"totalPasses"`
+	Width       int `json:"width"`
+	Height      int `json:"height"`
+	// Error explains why a failed job stopped
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// job is a render that was submitted to the server
+type job struct {
+	id     string
+	number int
+	scene  *rt.Scene
+	camera rt.Camera
+	opts   rt.RenderOptions
+
+	// ctx is cancelled to stop the job
+	ctx  context.Context
+	stop context.CancelFunc
+
+	mu                         sync.Mutex
+	state                      Status
+	passes                     int
+	err                        error
+	fb                         *rt.Framebuffer
+	created, started, finished time.Time
+}
+
+// newJob returns a queued job that is stopped when parent is cancelled
+func newJob(parent context.Context, number int, scene *rt.Scene, camera rt.Camera, opts rt.RenderOptions) *job {
+	ctx, stop := context.WithCancel(parent)
+	return &job{
+		id:      strconv.Itoa(number),
+		number:  number,
+		scene:   scene,
+		camera:  camera,
+		opts:    opts,
+		ctx:     ctx,
+		stop:    stop,
+		state:   StatusQueued,
+		created: time.Now(),
+	}
+}
+
+// run renders the job, unless it was cancelled while it was queued
+func (j *job) run() {
+	j.mu.Lock()
+	if j.state != StatusQueued {
+		// the job was cancelled while it was queued
+		j.mu.Unlock()
+		return
+	}
+	if j.ctx.Err() != nil {
+		// the server is shutting down
+		j.finish(StatusCanceled, nil, nil)
+		j.mu.Unlock()
+		return
+	}
+	j.state = StatusRunning
+	j.started = time.Now()
+	j.mu.Unlock()
+
+	opts := j.opts
+	opts.OnPass = func(fb *rt.Framebuffer) error {
+		j.mu.Lock()
+		j.passes = fb.Passes
+		j.mu.Unlock()
+		return nil
+	}
+	fb, err := rt.Render(j.ctx, j.scene, j.camera, opts)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case j.ctx.Err() != nil:
+		j.finish(StatusCanceled, nil, nil)
+	case err != nil:
+		j.finish(StatusFailed, nil, err)
+	default:
+		j.finish(StatusDone, fb, nil)
+	}
+}
+
+// finish records the outcome of a queued or running job. j.mu must be held.
+func (j *job) finish(state Status, fb *rt.Framebuffer, err error) {
+	j.state = state
+	j.fb = fb
+	j.err = err
+	j.finished = time.Now()
+	j.stop()
+}
+
+// cancel stops the job. Queued jobs are cancelled straight away, and running jobs stop after their current row.
+func (j *job) cancel() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.state == StatusQueued {
+		j.finish(StatusCanceled, nil, nil)
+		return
+	}
+	j.stop()
+}
+
+// result returns the framebuffer of a finished job along with the job's status
+func (j *job) result() (*rt.Framebuffer, Status) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.fb, j.state
+}
+
+// finishedAt returns when the job finished, and whether it has finished
+func (j *job) finishedAt() (time.Time, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.finished, !j.finished.IsZero()
+}
+
+// status reports the progress of the job
+func (j *job) status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := JobStatus{
+		ID:          j.id,
+		Status:      j.state,
+		Progress:    float64(j.passes) / float64(j.opts.SamplesPerPixel),
+		Passes:      j.passes,
+		TotalPasses: j.opts.SamplesPerPixel,
+		Width:       j.opts.Width,
+		Height:      j.opts.Height,
+		CreatedAt:   j.created,
+		StartedAt:   timeOrNil(j.started),
+		FinishedAt:  timeOrNil(j.finished),
+	}
+	if j.err != nil {
+		status.Error = j.err.Error()
+	}
+	return status
+}
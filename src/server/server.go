@@ -0,0 +1,434 @@
+// Package server runs renders submitted over HTTP. Clients post a JSON scene description, poll the job for its
+// progress and download the finished image:
+//
+//	POST /jobs?width=400&height=225&spp=100   queue a render of the scene in the request body
+//	GET  /jobs                                 list every job
+//	GET  /jobs/{id}                            report the status and progress of a job
+//	POST /jobs/{id}/cancel                     stop a queued or running job
+//	GET  /jobs/{id}/image?format=png           download the finished image as png, ppm, pfm or exr
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+)
+
+// maxSceneSize is the largest scene document that the server accepts
+const maxSceneSize = 10 << 20
+
+// Options configures a server
+type Options struct {
+	// Concurrency is the number of jobs that are rendered at the same time
+	Concurrency int
+	// QueueSize is the number of jobs that can wait for a free renderer. Jobs submitted while the queue is full are
+	// turned away.
+	QueueSize int
+	// AssetDir is the directory that file paths in scene documents are resolved against. Scenes cannot read files
+	// outside of it.
+	AssetDir string
+	// Defaults holds the image size, samples per pixel, maximum depth and seed of jobs that do not set them
+	Defaults rt.RenderOptions
+	// MaxWidth, MaxHeight, MaxSamplesPerPixel and MaxDepth are the largest settings that a job can ask for. Jobs
+	// asking for more are turned away. 0 does not limit the setting.
+	MaxWidth, MaxHeight, MaxSamplesPerPixel, MaxDepth int
+	// JobTTL is how long finished jobs and their images are kept for before they are forgotten. 0 keeps them until
+	// they are pushed out by MaxJobs.
+	JobTTL time.Duration
+	// MaxJobs is the number of jobs that are kept. Once there are more, the jobs that finished first are forgotten.
+	// 0 keeps every job until its JobTTL is up.
+	MaxJobs int
+}
+
+// DefaultOptions returns options that render one job at a time, matching the settings of the command line renderer
+func DefaultOptions() Options {
+	return Options{
+		Concurrency: 1,
+		QueueSize:   16,
+		Defaults: rt.RenderOptions{
+			Width:           400,
+			Height:          225,
+			SamplesPerPixel: 100,
+			MaxDepth:        50,
+			Seed:            1,
+		},
+		MaxWidth:           4096,
+		MaxHeight:          4096,
+		MaxSamplesPerPixel: 100000,
+		MaxDepth:           1000,
+		JobTTL:             time.Hour,
+		MaxJobs:            100,
+	}
+}
+
+// Server is an http.Handler that queues render jobs and renders them in the background. Finished jobs are forgotten
+// once their JobTTL is up, or to make room for newer jobs past MaxJobs.
+type Server struct {
+	opts  Options
+	queue chan *job
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	nextID int
+	closed bool
+
+	// ctx is cancelled when the server is closed, which stops every job
+	ctx     context.Context
+	stop    context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// New returns a server and starts its renderers. Close must be called to stop them.
+func New(opts Options) (*Server, error) {
+	if opts.Concurrency <= 0 {
+		return nil, errors.New("at least one job must be able to run at a time")
+	}
+	if opts.QueueSize < 0 {
+		return nil, errors.New("the queue size cannot be negative")
+	}
+	if opts.MaxWidth < 0 || opts.MaxHeight < 0 || opts.MaxSamplesPerPixel < 0 || opts.MaxDepth < 0 || opts.JobTTL < 0 || opts.MaxJobs < 0 {
+		return nil, errors.New("the limits cannot be negative")
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	s := &Server{
+		opts:  opts,
+		queue: make(chan *job, opts.QueueSize),
+		jobs:  map[string]*job{},
+		ctx:   ctx,
+		stop:  stop,
+	}
+	for i := 0; i < opts.Concurrency; i++ {
+		s.workers.Add(1)
+		go s.work()
+	}
+	return s, nil
+}
+
+// Close cancels every job and waits for the renderers to stop
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	s.stop()
+	s.workers.Wait()
+}
+
+// work renders queued jobs until the server is closed
+func (s *Server) work() {
+	defer s.workers.Done()
+	for j := range s.queue {
+		j.run()
+	}
+}
+
+// ServeHTTP routes a request to the handler for its path
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "jobs" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.submit(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.list(w)
+	case len(parts) == 1:
+		writeMethodNotAllowed(w, "GET, POST")
+	case len(parts) > 3:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	default:
+		j, ok := s.job(parts[1])
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("job %q does not exist", parts[1]))
+			return
+		}
+		action := ""
+		if len(parts) == 3 {
+			action = parts[2]
+		}
+		s.serveJob(w, r, j, action)
+	}
+}
+
+// serveJob handles the requests about a single job
+func (s *Server) serveJob(w http.ResponseWriter, r *http.Request, j *job, action string) {
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, "GET")
+			return
+		}
+		writeJSON(w, http.StatusOK, j.status())
+	case "cancel":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, "POST")
+			return
+		}
+		j.cancel()
+		writeJSON(w, http.StatusOK, j.status())
+	case "image":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, "GET")
+			return
+		}
+		s.image(w, r, j)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// submit parses a scene document and queues a job to render it
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	opts, err := s.renderOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// the scene is read in full first, so that a scene that is too large is told apart from a malformed one
+	document, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSceneSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("the scene must be at most %d bytes", tooLarge.Limit))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("could not read scene: %s", err))
+		return
+	}
+	description, err := rt.ParseSceneDescription(bytes.NewReader(document))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	description.BaseDir = s.opts.AssetDir
+	description.RestrictPaths = true
+	scene, camera, err := description.Build()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("could not build scene: %s", err))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		writeError(w, http.StatusServiceUnavailable, errors.New("the server is shutting down"))
+		return
+	}
+	s.nextID++
+	j := newJob(s.ctx, s.nextID, scene, camera, opts)
+	select {
+	case s.queue <- j:
+	default:
+		s.nextID--
+		writeError(w, http.StatusServiceUnavailable, errors.New("the job queue is full"))
+		return
+	}
+	s.jobs[j.id] = j
+	s.prune()
+
+	w.Header().Set("Location", "/jobs/"+j.id)
+	writeJSON(w, http.StatusAccepted, j.status())
+}
+
+// renderOptions reads the settings of a job from the query string of a request
+func (s *Server) renderOptions(r *http.Request) (rt.RenderOptions, error) {
+	opts := s.opts.Defaults
+	query := r.URL.Query()
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{name: "width", value: &opts.Width},
+		{name: "height", value: &opts.Height},
+		{name: "spp", value: &opts.SamplesPerPixel},
+		{name: "maxDepth", value: &opts.MaxDepth},
+	} {
+		if query.Get(setting.name) == "" {
+			continue
+		}
+		value, err := strconv.Atoi(query.Get(setting.name))
+		if err != nil || value <= 0 {
+			return opts, fmt.Errorf("%s must be a positive integer", setting.name)
+		}
+		*setting.value = value
+	}
+	if query.Get("seed") != "" {
+		seed, err := strconv.ParseInt(query.Get("seed"), 10, 64)
+		if err != nil {
+			return opts, errors.New("seed must be an integer")
+		}
+		opts.Seed = seed
+	}
+	if opts.Width <= 0 || opts.Height <= 0 || opts.SamplesPerPixel <= 0 {
+		return opts, errors.New("the image size and samples per pixel must be set")
+	}
+	for _, limit := range []struct {
+		name       string
+		value, max int
+	}{
+		{name: "width", value: opts.Width, max: s.opts.MaxWidth},
+		{name: "height", value: opts.Height, max: s.opts.MaxHeight},
+		{name: "spp", value: opts.SamplesPerPixel, max: s.opts.MaxSamplesPerPixel},
+		{name: "maxDepth", value: opts.MaxDepth, max: s.opts.MaxDepth},
+	} {
+		if limit.max > 0 && limit.value > limit.max {
+			return opts, fmt.Errorf("%s must be at most %d", limit.name, limit.max)
+		}
+	}
+	return opts, nil
+}
+
+// prune forgets the jobs that finished longer than JobTTL ago, and then the jobs that finished first until at most
+// MaxJobs are left. Jobs that have not finished are always kept. s.mu must be held.
+func (s *Server) prune() {
+	now := time.Now()
+	finished := make([]*job, 0, len(s.jobs))
+	for id, j := range s.jobs {
+		at, ok := j.finishedAt()
+		switch {
+		case !ok:
+		case s.opts.JobTTL > 0 && now.Sub(at) > s.opts.JobTTL:
+			delete(s.jobs, id)
+		default:
+			finished = append(finished, j)
+		}
+	}
+	if s.opts.MaxJobs <= 0 || len(s.jobs) <= s.opts.MaxJobs {
+		return
+	}
+
+	sort.Slice(finished, func(a, b int) bool {
+		atA, _ := finished[a].finishedAt()
+		atB, _ := finished[b].finishedAt()
+		return atA.Before(atB)
+	})
+	for _, j := range finished {
+		if len(s.jobs) <= s.opts.MaxJobs {
+			break
+		}
+		delete(s.jobs, j.id)
+	}
+}
+
+// list reports the status of every job, oldest first
+func (s *Server) list(w http.ResponseWriter) {
+	s.mu.Lock()
+	s.prune()
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].number < jobs[b].number })
+	statuses := make([]JobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		statuses = append(statuses, j.status())
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// job returns the job with the passed-in ID
+func (s *Server) job(id string) (*job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	j, ok := s.jobs[id]
+	return j, ok
+}
+
+// imageFormats maps the formats that finished images can be downloaded in to their content types
+var imageFormats = map[string]string{
+	"png": "image/png",
+	"ppm": "image/x-portable-pixmap",
+	"pfm": "image/x-portable-floatmap",
+	"exr": "image/x-exr",
+}
+
+// image writes the finished image of a job in the format picked by the format query parameter
+func (s *Server) image(w http.ResponseWriter, r *http.Request, j *job) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "png"
+	}
+	contentType, ok := imageFormats[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown image format %q: expected png, ppm, pfm or exr", format))
+		return
+	}
+
+	fb, status := j.result()
+	if status != StatusDone {
+		writeError(w, http.StatusConflict, fmt.Errorf("job %s is %s", j.id, status))
+		return
+	}
+
+	// encode into memory first so that an encoding error can still be reported with a status code
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = rt.EncodePNG(&buf, fb.Image())
+	case "ppm":
+		err = rt.WritePPM(&buf, fb.Image())
+	case "pfm":
+		err = rt.EncodePFM(&buf, fb.Image())
+	case "exr":
+		err = rt.WriteFramebufferEXR(&buf, fb)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("could not encode image: %s", err))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+// writeJSON writes a value as the JSON body of a response
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes an error as a JSON object with an error field
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// writeMethodNotAllowed rejects a request whose method the path does not support
+func writeMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+// timeOrNil returns a pointer to t, or nil if t is not set, so that unset times are left out of JSON
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,301 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/andrewzlchen/raytracer/src/server"
+	"github.com/stretchr/testify/assert"
+)
+
+const testScene = `{
+  "camera": {"origin": [0, 0, 0]},
+  "objects": [
+    {"type": "sphere", "center": [0, 0, -1], "radius": 0.5},
+    {"type": "sphere", "center": [0, -100.5, -1], "radius": 100}
+  ]
+}`
+
+// newTestServer starts a server on a local port and stops it when the test is done
+func newTestServer(t *testing.T, concurrency, queueSize int) *httptest.Server {
+	opts := server.DefaultOptions()
+	opts.Concurrency = concurrency
+	opts.QueueSize = queueSize
+	return startServer(t, opts)
+}
+
+// startServer starts a server with the passed-in options on a local port and stops it when the test is done
+func startServer(t *testing.T, opts server.Options) *httptest.Server {
+	s, err := server.New(opts)
+	assert.Nil(t, err)
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return ts
+}
+
+// submit posts the test scene and returns the response code and the job status
+func submit(t *testing.T, ts *httptest.Server, query string) (int, server.JobStatus) {
+	resp, err := http.Post(ts.URL+"/jobs?"+query, "application/json", strings.NewReader(testScene))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	var status server.JobStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	return resp.StatusCode, status
+}
+
+// getStatus returns the current status of a job
+func getStatus(t *testing.T, ts *httptest.Server, id string) server.JobStatus {
+	resp, err := http.Get(ts.URL + "/jobs/" + id)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var status server.JobStatus
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&status))
+	return status
+}
+
+// waitFor polls a job until its status is one of the wanted ones
+func waitFor(t *testing.T, ts *httptest.Server, id string, wanted ...server.Status) server.JobStatus {
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		status := getStatus(t, ts, id)
+		for _, w := range wanted {
+			if status.Status == w {
+				return status
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is still %s", id, status.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServer_RenderJob(t *testing.T) {
+	ts := newTestServer(t, 2, 4)
+
+	code, status := submit(t, ts, "width=16&height=9&spp=3")
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, 3, status.TotalPasses)
+
+	status = waitFor(t, ts, status.ID, server.StatusDone, server.StatusFailed)
+	assert.Equal(t, server.StatusDone, status.Status)
+	assert.Equal(t, 1.0, status.Progress)
+	assert.NotNil(t, status.FinishedAt)
+
+	resp, err := http.Get(ts.URL + "/jobs/" + status.ID + "/image?format=png")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	img, err := png.Decode(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, img.Bounds().Dx())
+	assert.Equal(t, 9, img.Bounds().Dy())
+
+	for format, prefix := range map[string]string{"ppm": "P3\n16 9\n", "pfm": "PF\n16 9\n", "exr": "\x76\x2f\x31\x01"} {
+		resp, err := http.Get(ts.URL + "/jobs/" + status.ID + "/image?format=" + format)
+		assert.Nil(t, err)
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		resp.Body.Close()
+		assert.True(t, strings.HasPrefix(body.String(), prefix), "%s image starts with %q", format, body.String()[:8])
+	}
+
+	resp, err = http.Get(ts.URL + "/jobs")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	var statuses []server.JobStatus
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&statuses))
+	assert.Len(t, statuses, 1)
+}
+
+func TestServer_CancelJob(t *testing.T) {
+	ts := newTestServer(t, 1, 4)
+
+	_, running := submit(t, ts, "width=32&height=18&spp=100000")
+	_, queued := submit(t, ts, "width=16&height=9&spp=1")
+	waitFor(t, ts, running.ID, server.StatusRunning)
+
+	// the image is not available until the job is done
+	resp, err := http.Get(ts.URL + "/jobs/" + running.ID + "/image")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// cancelling a queued job stops it straight away
+	resp, err = http.Post(ts.URL+"/jobs/"+queued.ID+"/cancel", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, server.StatusCanceled, getStatus(t, ts, queued.ID).Status)
+
+	// a running job stops after its current row
+	resp, err = http.Post(ts.URL+"/jobs/"+running.ID+"/cancel", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	status := waitFor(t, ts, running.ID, server.StatusCanceled, server.StatusDone)
+	assert.Equal(t, server.StatusCanceled, status.Status)
+	assert.True(t, status.Passes < status.TotalPasses)
+}
+
+func TestServer_QueueLimit(t *testing.T) {
+	ts := newTestServer(t, 1, 1)
+
+	_, running := submit(t, ts, "width=32&height=18&spp=100000")
+	waitFor(t, ts, running.ID, server.StatusRunning)
+
+	code, queued := submit(t, ts, "width=16&height=9&spp=1")
+	assert.Equal(t, http.StatusAccepted, code)
+	code, _ = submit(t, ts, "width=16&height=9&spp=1")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "only one job can wait")
+
+	assert.Equal(t, server.StatusQueued, getStatus(t, ts, queued.ID).Status)
+}
+
+func TestServer_BadRequests(t *testing.T) {
+	ts := newTestServer(t, 1, 1)
+
+	for _, tc := range []struct {
+		desc   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{desc: "invalid scene", method: http.MethodPost, path: "/jobs", body: `{"objects": [{"type": "cube"}]}`, want: http.StatusBadRequest},
+		{desc: "malformed scene", method: http.MethodPost, path: "/jobs", body: `{`, want: http.StatusBadRequest},
+		{desc: "invalid size", method: http.MethodPost, path: "/jobs?width=-1", body: testScene, want: http.StatusBadRequest},
+		{desc: "too wide", method: http.MethodPost, path: "/jobs?width=100000", body: testScene, want: http.StatusBadRequest},
+		{desc: "too tall", method: http.MethodPost, path: "/jobs?height=100000", body: testScene, want: http.StatusBadRequest},
+		{desc: "too many samples", method: http.MethodPost, path: "/jobs?spp=100000000", body: testScene, want: http.StatusBadRequest},
+		{desc: "too deep", method: http.MethodPost, path: "/jobs?maxDepth=100000", body: testScene, want: http.StatusBadRequest},
+		{desc: "scene too large", method: http.MethodPost, path: "/jobs", body: testScene + strings.Repeat(" ", 10<<20), want: http.StatusRequestEntityTooLarge},
+		{desc: "unknown job", method: http.MethodGet, path: "/jobs/404", want: http.StatusNotFound},
+		{desc: "unknown path", method: http.MethodGet, path: "/render", want: http.StatusNotFound},
+		{desc: "wrong method", method: http.MethodDelete, path: "/jobs", want: http.StatusMethodNotAllowed},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+tc.path, strings.NewReader(tc.body))
+			assert.Nil(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			assert.Nil(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tc.want, resp.StatusCode)
+
+			var body map[string]string
+			assert.Nil(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.NotEmpty(t, body["error"])
+		})
+	}
+}
+
+func TestServer_Retention(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		ttl     time.Duration
+		maxJobs int
+		jobs    int
+		wait    time.Duration
+		want    []bool
+	}{
+		{desc: "the oldest jobs make room for new ones", maxJobs: 2, jobs: 3, want: []bool{false, true, true}},
+		{desc: "finished jobs expire", ttl: 50 * time.Millisecond, jobs: 2, wait: 100 * time.Millisecond, want: []bool{false, false}},
+		{desc: "jobs are kept until they expire", ttl: time.Hour, maxJobs: 5, jobs: 3, want: []bool{true, true, true}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := server.DefaultOptions()
+			opts.JobTTL = tc.ttl
+			opts.MaxJobs = tc.maxJobs
+			ts := startServer(t, opts)
+
+			ids := make([]string, tc.jobs)
+			for i := range ids {
+				_, status := submit(t, ts, "width=4&height=2&spp=1")
+				waitFor(t, ts, status.ID, server.StatusDone)
+				ids[i] = status.ID
+			}
+			time.Sleep(tc.wait)
+
+			// listing the jobs also forgets the expired ones
+			resp, err := http.Get(ts.URL + "/jobs")
+			assert.Nil(t, err)
+			var statuses []server.JobStatus
+			assert.Nil(t, json.NewDecoder(resp.Body).Decode(&statuses))
+			resp.Body.Close()
+			kept := 0
+			for i, id := range ids {
+				resp, err := http.Get(ts.URL + "/jobs/" + id)
+				assert.Nil(t, err)
+				resp.Body.Close()
+				assert.Equal(t, tc.want[i], resp.StatusCode == http.StatusOK, "job %s", id)
+				if tc.want[i] {
+					kept++
+				}
+			}
+			assert.Len(t, statuses, kept)
+		})
+	}
+}
+
+func TestServer_UnknownImageFormat(t *testing.T) {
+	ts := newTestServer(t, 1, 1)
+	_, status := submit(t, ts, "width=4&height=2&spp=1")
+	waitFor(t, ts, status.ID, server.StatusDone)
+
+	resp, err := http.Get(ts.URL + "/jobs/" + status.ID + "/image?format=gif")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServer_AssetPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "assets")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assets := filepath.Join(dir, "assets")
+	assert.Nil(t, os.Mkdir(assets, 0755))
+	// a sky inside of the asset directory, and a file next to it that scenes must not be able to read
+	for _, path := range []string{filepath.Join(assets, "sky.pfm"), filepath.Join(dir, "x")} {
+		f, err := os.Create(path)
+		assert.Nil(t, err)
+		assert.Nil(t, rt.EncodePFM(f, rt.NewHDRImage(2, 1)))
+		f.Close()
+	}
+
+	opts := server.DefaultOptions()
+	opts.AssetDir = assets
+	ts := startServer(t, opts)
+
+	for _, tc := range []struct {
+		desc string
+		path string
+		want int
+	}{
+		{desc: "a file in the asset directory", path: "sky.pfm", want: http.StatusAccepted},
+		{desc: "a path that leaves and comes back", path: "../assets/sky.pfm", want: http.StatusAccepted},
+		{desc: "an absolute path", path: "/etc/passwd", want: http.StatusBadRequest},
+		{desc: "a path outside of the asset directory", path: "../x", want: http.StatusBadRequest},
+		{desc: "a path that escapes through a subdirectory", path: "textures/../../x", want: http.StatusBadRequest},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			scene := `{"camera": {"origin": [0, 0, 0]}, "environment": {"path": "` + tc.path + `"}, "objects": []}`
+			resp, err := http.Post(ts.URL+"/jobs?width=4&height=2&spp=1", "application/json", strings.NewReader(scene))
+			assert.Nil(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tc.want, resp.StatusCode)
+		})
+	}
+}
@@ -1,18 +1,19 @@
 package raytracer
 
-import (
-	"errors"
-	"math"
-)
+import "math"
 
 // Sphere is a struct that represents a sphere in 3d space
 type Sphere struct {
-	Center *Vec3
+	Center Vec3
 	Radius float64
+	// Material is the material that the sphere is made of. A nil material is a grey diffuse surface.
+	Material Material
+	// ID identifies the sphere in the object ID pass. 0 is reserved for the background.
+	ID int
 }
 
 // NewSphere returns a new sphere
-func NewSphere(center *Vec3, radius float64) *Sphere {
+func NewSphere(center Vec3, radius float64) *Sphere {
 	return &Sphere{
 		Center: center,
 		Radius: radius,
@@ -20,7 +21,7 @@ func NewSphere(center *Vec3, radius float64) *Sphere {
 }
 
 // Hit returns whether the passed-in ray hits the current sphere
-func (s *Sphere) Hit(ray *Ray, tMin, tMax float64) (*HitRecord, bool, error) {
+func (s *Sphere) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
 	// Use quadratic equation to solve for t (a point on ray r such that it intersects with the sphere)
 	// Using vector math, it works out that we need to solve for:
 	//
@@ -41,7 +42,8 @@ func (s *Sphere) Hit(ray *Ray, tMin, tMax float64) (*HitRecord, bool, error) {
 	c := oc.LengthSquared() - s.Radius*s.Radius
 
 	if a == 0 {
-		return nil, false, errors.New("a ray with no direction cannot intersect anything")
+		// a ray with no direction cannot intersect anything
+		return false
 	}
 
 	// Use the discriminant to see whether there are any solutions
@@ -50,7 +52,7 @@ func (s *Sphere) Hit(ray *Ray, tMin, tMax float64) (*HitRecord, bool, error) {
 	// if discriminant > 0, 2 solutions
 	discriminant := halfB*halfB - a*c
 	if discriminant < 0 {
-		return nil, false, nil
+		return false
 	}
 	// At this point, there must be at least one root
 	// Find the nearest root that lies in the acceptable range
@@ -60,18 +62,86 @@ func (s *Sphere) Hit(ray *Ray, tMin, tMax float64) (*HitRecord, bool, error) {
 		// this root does not fall into the acceptable range; try the other root instead
 		root = (-halfB + squareRootDiscriminant) / a
 		if root < tMin || tMax < root {
-			return nil, false, nil
+			return false
 		}
 	}
 
-	hitRecord := &HitRecord{}
-	hitRecord.T = root
-	hitRecord.P = ray.At(hitRecord.T)
-	outwardNormal, err := hitRecord.P.SubtractVector(s.Center).DivideFloat(s.Radius)
-	if err != nil {
-		return nil, false, errors.New("could not find the normal vector")
+	s.surface(ray, root, hitRecord)
+	hitRecord.SetFaceNormal(ray, hitRecord.Normal)
+	return true
+}
+
+// Intervals appends the span of the ray that is inside the sphere to intervals, unless the ray misses it
+func (s *Sphere) Intervals(ray Ray, intervals []Interval) []Interval {
+	oc := ray.Origin().SubtractVector(s.Center)
+	a := ray.Direction().LengthSquared()
+	halfB := oc.Dot(ray.Direction())
+	c := oc.LengthSquared() - s.Radius*s.Radius
+	discriminant := halfB*halfB - a*c
+	if a == 0 || discriminant <= 0 {
+		// a ray that only grazes the sphere does not pass through its inside
+		return intervals
 	}
-	hitRecord.SetFaceNormal(ray, outwardNormal)
 
-	return hitRecord, true, nil
+	squareRootDiscriminant := math.Sqrt(discriminant)
+	intervals = append(intervals, Interval{})
+	interval := &intervals[len(intervals)-1]
+	s.surface(ray, (-halfB-squareRootDiscriminant)/a, &interval.Enter)
+	s.surface(ray, (-halfB+squareRootDiscriminant)/a, &interval.Exit)
+	return intervals
+}
+
+// surface fills in the hit record of the point on the sphere at t along the ray, with the outward normal
+func (s *Sphere) surface(ray Ray, t float64, hitRecord *HitRecord) {
+	p := ray.At(t)
+	outwardNormal := p.SubtractVector(s.Center).MultiplyFloat(1 / s.Radius)
+	*hitRecord = HitRecord{T: t, P: p, Normal: outwardNormal, GeometricNormal: outwardNormal, ObjectID: s.ID, Material: s.Material}
+	hitRecord.U, hitRecord.V = sphereUV(outwardNormal)
+	hitRecord.Tangent, hitRecord.Bitangent = s.partialDerivatives(outwardNormal)
+	if hitRecord.Material == nil {
+		hitRecord.Material = defaultMaterial
+	}
+}
+
+// Validate returns an error if the sphere's center is not finite or its radius is zero. A negative radius turns
+// the sphere inside out.
+func (s *Sphere) Validate() error {
+	if err := checkPoint("sphere", "center", s.Center); err != nil {
+		return err
+	}
+	if err := checkFinite("sphere", "radius", s.Radius); err != nil {
+		return err
+	}
+	if s.Radius == 0 {
+		return validationError("sphere", "radius", ErrZero)
+	}
+	return nil
+}
+
+// BoundingBox returns the box around the sphere
+func (s *Sphere) BoundingBox() *AABB {
+	r := math.Abs(s.Radius)
+	extent := NewVec3(r, r, r)
+	return NewAABB(s.Center.SubtractVector(extent), s.Center.AddVector(extent))
+}
+
+// sphereUV returns the surface coordinates of a point on the unit sphere. u is the angle around the Y axis
+// starting from -X, and v is the angle from -Y to +Y, both scaled to [0, 1].
+func sphereUV(p Vec3) (u, v float64) {
+	theta := math.Acos(clamp(-p.Y, -1, 1))
+	phi := math.Atan2(-p.Z, p.X) + math.Pi
+	return phi / (2 * math.Pi), theta / math.Pi
+}
+
+// partialDerivatives returns how a point on the sphere with the passed-in outward normal moves as its u and v
+// coordinates increase
+func (s *Sphere) partialDerivatives(n Vec3) (dpdu, dpdv Vec3) {
+	sinTheta := math.Sqrt(math.Max(0, 1-n.Y*n.Y))
+	if sinTheta < 1e-8 {
+		// the parameterization is degenerate at the poles
+		return Vec3{}, Vec3{}
+	}
+	dpdu = NewVec3(n.Z, 0, -n.X).MultiplyFloat(2 * math.Pi * s.Radius)
+	dpdv = NewVec3(-n.X*n.Y/sinTheta, sinTheta, -n.Y*n.Z/sinTheta).MultiplyFloat(math.Pi * s.Radius)
+	return dpdu, dpdv
 }
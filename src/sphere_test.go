@@ -10,7 +10,7 @@ import (
 
 func TestSphere_Hit(t *testing.T) {
 	type args struct {
-		ray  *rt.Ray
+		ray  rt.Ray
 		tMin float64
 		tMax float64
 	}
@@ -19,7 +19,6 @@ func TestSphere_Hit(t *testing.T) {
 		s            *rt.Sphere
 		args         args
 		wantedDidHit bool
-		wantedError  error
 	}{
 		{
 			name: "zero direction ray should not intersect sphere",
@@ -44,13 +43,30 @@ func TestSphere_Hit(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, didHit, err := tt.s.Hit(tt.args.ray, tt.args.tMin, tt.args.tMax)
-			if tt.wantedError != nil {
-				assert.Error(t, err)
-				assert.Equal(t, tt.wantedError, err)
-			} else {
-				assert.Equal(t, tt.wantedDidHit, didHit)
-			}
+			didHit := tt.s.Hit(tt.args.ray, tt.args.tMin, tt.args.tMax, &rt.HitRecord{})
+			assert.Equal(t, tt.wantedDidHit, didHit)
 		})
 	}
 }
+
+func TestSphere_HitTangents(t *testing.T) {
+	s := rt.NewSphere(rt.NewVec3(0, 0, -2), 1)
+	for _, direction := range []rt.Vec3{rt.NewVec3(0, 0, -1), rt.NewVec3(0.3, 0.2, -1), rt.NewVec3(-0.2, -0.4, -1)} {
+		hitRecord := &rt.HitRecord{}
+		didHit := s.Hit(rt.NewRay(rt.NewVec3(0, 0, 0), direction), 0, 100, hitRecord)
+		assert.True(t, didHit)
+
+		// the tangents lie in the surface and follow the right hand rule with the outward normal
+		assert.InDelta(t, 0, hitRecord.Tangent.Dot(hitRecord.Normal), 1e-9)
+		assert.InDelta(t, 0, hitRecord.Bitangent.Dot(hitRecord.Normal), 1e-9)
+		outward := hitRecord.P.SubtractVector(s.Center)
+		assert.True(t, hitRecord.Tangent.Cross(hitRecord.Bitangent).Dot(outward) > 0)
+
+		// moving along the tangent changes u and nothing else
+		step := hitRecord.Tangent.MultiplyFloat(1e-6)
+		nearby := &rt.HitRecord{}
+		s.Hit(rt.NewRay(rt.NewVec3(0, 0, 0), hitRecord.P.AddVector(step)), 0, 100, nearby)
+		assert.InDelta(t, 1e-6, nearby.U-hitRecord.U, 1e-8)
+		assert.InDelta(t, 0, nearby.V-hitRecord.V, 1e-8)
+	}
+}
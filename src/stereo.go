@@ -0,0 +1,171 @@
+package raytracer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StereoLayout is how the images of the left and right eyes are put together into one image
+type StereoLayout int
+
+const (
+	// SideBySide puts the left eye's image in the left half and the right eye's in the right half. Each eye's image
+	// is squeezed to half of its width, like half side-by-side video.
+	SideBySide StereoLayout = iota
+	// TopBottom puts the left eye's image in the top half and the right eye's in the bottom half. Each eye's image
+	// is squeezed to half of its height.
+	TopBottom
+)
+
+var stereoLayoutNames = map[StereoLayout]string{
+	SideBySide: "side-by-side",
+	TopBottom:  "top-bottom",
+}
+
+// String returns the name of the layout
+func (l StereoLayout) String() string {
+	if name, ok := stereoLayoutNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("StereoLayout(%d)", int(l))
+}
+
+// ParseStereoLayout returns the layout with the passed-in name, ignoring case
+func ParseStereoLayout(name string) (StereoLayout, error) {
+	for layout, n := range stereoLayoutNames {
+		if strings.EqualFold(n, name) {
+			return layout, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown stereo layout %q: expected side-by-side or top-bottom", name)
+}
+
+// eye returns whether the (u,v) point of a stereo image is seen by the left eye, and where it is in that eye's image
+func (l StereoLayout) eye(u, v float64) (left bool, eyeU, eyeV float64) {
+	if l == TopBottom {
+		if v >= 0.5 {
+			return true, u, 2*v - 1
+		}
+		return false, u, 2 * v
+	}
+	if u < 0.5 {
+		return true, 2 * u, v
+	}
+	return false, 2*u - 1, v
+}
+
+// eyeOffset returns how far an eye is from the middle of a stereo camera, along the camera's right direction
+func eyeOffset(left bool, interocular float64) float64 {
+	if left {
+		return -interocular / 2
+	}
+	return interocular / 2
+}
+
+// checkStereo returns an error if the distance between the eyes of a stereo camera is negative or not finite. A
+// distance of zero is allowed and renders the same view for both eyes.
+func checkStereo(object string, interocular float64) error {
+	if err := checkFinite(object, "interocular distance", interocular); err != nil {
+		return err
+	}
+	if interocular < 0 {
+		return validationError(object, "interocular distance", ErrOutOfRange)
+	}
+	return nil
+}
+
+// StereoCamera is a rig of two perspective cameras that renders the left and right eyes' views into one image. The
+// eyes look in parallel, with their views shifted so that objects at the convergence distance appear at the same
+// place in both images, at the depth of the screen.
+type StereoCamera struct {
+	center *PerspectiveCamera
+	// right is the unit direction from the left eye to the right eye
+	right Vec3
+	// interocular is the distance between the eyes and convergence is the distance to the plane of the screen
+	interocular, convergence float64
+	layout                   StereoLayout
+}
+
+// NewStereoCamera returns a stereo camera whose eyes are either side of origin and which is turned by rotation from
+// looking down the negative Z axis
+func NewStereoCamera(origin Vec3, rotation Matrix4, interocular, convergence float64, layout StereoLayout) (*StereoCamera, error) {
+	center, err := NewRotatedCamera(origin, rotation)
+	if err != nil {
+		return nil, err
+	}
+	right, _, _ := cameraAxes(rotation)
+	right, err = right.Unit()
+	if err != nil {
+		return nil, validationError("stereo camera", "rotation", ErrDegenerate)
+	}
+	c := &StereoCamera{center: center, right: right, interocular: interocular, convergence: convergence, layout: layout}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the eyes are crossed or the screen is not in front of them. Eyes that are not apart
+// are allowed and see the same view.
+func (c *StereoCamera) Validate() error {
+	if err := c.center.Validate(); err != nil {
+		return err
+	}
+	if err := checkStereo("stereo camera", c.interocular); err != nil {
+		return err
+	}
+	return checkPositive("stereo camera", "convergence distance", c.convergence)
+}
+
+// GetRay returns the ray through the (u,v) point of the stereo image, from the eye whose half of the image it is in
+func (c *StereoCamera) GetRay(u, v float64) Ray {
+	left, eyeU, eyeV := c.layout.eye(u, v)
+	center := c.center.GetRay(eyeU, eyeV)
+
+	// both eyes look through the same point on the screen, which is convergence away along the camera's axis
+	direction := center.Direction()
+	screen := center.Origin().AddVector(direction.MultiplyFloat(c.convergence / c.center.FocalLength()))
+	origin := center.Origin().AddVector(c.right.MultiplyFloat(eyeOffset(left, c.interocular)))
+	return NewRay(origin, screen.SubtractVector(origin))
+}
+
+// ODSCamera is an omni-directional stereo camera that renders 360° panoramas for the left and right eyes into one
+// image. Each column of a panorama is seen from an eye on a circle, with the circle's diameter being the distance
+// between the eyes, so that there is stereo parallax in every direction that the viewer turns to.
+type ODSCamera struct {
+	panorama    *EquirectangularCamera
+	interocular float64
+	layout      StereoLayout
+}
+
+// NewODSCamera returns an omni-directional stereo camera centered on origin that is turned by rotation from looking
+// down the negative Z axis
+func NewODSCamera(origin Vec3, rotation Matrix4, interocular float64, layout StereoLayout) (*ODSCamera, error) {
+	panorama, err := NewEquirectangularCamera(origin, rotation)
+	if err != nil {
+		return nil, err
+	}
+	c := &ODSCamera{panorama: panorama, interocular: interocular, layout: layout}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the eyes are crossed or the panorama's rotation collapses space. Eyes that are not
+// apart are allowed and see the same view.
+func (c *ODSCamera) Validate() error {
+	if err := c.panorama.Validate(); err != nil {
+		return err
+	}
+	return checkStereo("ODS camera", c.interocular)
+}
+
+// GetRay returns the ray through the (u,v) point of the stereo panorama, from the eye whose half of the image it is
+// in
+func (c *ODSCamera) GetRay(u, v float64) Ray {
+	left, eyeU, eyeV := c.layout.eye(u, v)
+	direction, right := c.panorama.look(eyeU, eyeV)
+	origin := c.panorama.origin.AddVector(right.MultiplyFloat(eyeOffset(left, c.interocular)))
+	return NewRay(origin, direction)
+}
@@ -0,0 +1,105 @@
+package raytracer
+
+import (
+	"fmt"
+	"image"
+	// register the decoders of the low dynamic range formats that textures can be loaded from
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Texture is a color that varies over a surface
+type Texture interface {
+	// Value returns the color at the surface coordinates (u, v) of the hit point p
+	Value(u, v float64, p Vec3) Vec3
+}
+
+// SolidColor is a texture that is the same color everywhere
+type SolidColor struct {
+	Color Vec3
+}
+
+// NewSolidColor returns a texture of a single color
+func NewSolidColor(color Vec3) *SolidColor {
+	return &SolidColor{Color: color}
+}
+
+// NewConstantTexture returns a texture that has the same value in every channel, for scalar material parameters
+func NewConstantTexture(value float64) *SolidColor {
+	return NewSolidColor(NewVec3(value, value, value))
+}
+
+// Value returns the color of the texture
+func (s *SolidColor) Value(u, v float64, p Vec3) Vec3 {
+	return s.Color
+}
+
+// ImageTexture is a texture that wraps an image around a surface using its (u, v) coordinates
+type ImageTexture struct {
+	Image *HDRImage
+}
+
+// NewImageTexture returns a texture that looks up colors in the passed-in image
+func NewImageTexture(image *HDRImage) *ImageTexture {
+	return &ImageTexture{Image: image}
+}
+
+// Value returns the color of the texel at (u, v), where v = 0 is the bottom of the image. Coordinates outside of
+// [0, 1] wrap around.
+func (t *ImageTexture) Value(u, v float64, p Vec3) Vec3 {
+	u -= math.Floor(u)
+	v -= math.Floor(v)
+	x := clampIndex(int(u*float64(t.Image.Width)), t.Image.Width)
+	y := clampIndex(int((1-v)*float64(t.Image.Height)), t.Image.Height)
+	return t.Image.At(x, y)
+}
+
+// LoadImageTexture reads a texture from a .hdr, .pfm, .png or .jpeg image. High dynamic range images are already
+// linear. Low dynamic range images are converted from sRGB to linear values when srgb is true, which should be the
+// case for colors but not for data like roughness or normals.
+func LoadImageTexture(path string, srgb bool) (*ImageTexture, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hdr", ".pic", ".pfm":
+		img, err := LoadHDRImage(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewImageTexture(img), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open texture: %s", err)
+	}
+	defer f.Close()
+	decoded, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode texture: %s", err)
+	}
+
+	bounds := decoded.Bounds()
+	img := NewHDRImage(bounds.Dx(), bounds.Dy())
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			r, g, b, _ := decoded.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			color := NewVec3(float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff)
+			if srgb {
+				color = NewVec3(srgbToLinear(color.X), srgbToLinear(color.Y), srgbToLinear(color.Z))
+			}
+			img.Set(x, y, color)
+		}
+	}
+	return NewImageTexture(img), nil
+}
+
+// srgbToLinear undoes the sRGB transfer curve
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
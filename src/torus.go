@@ -0,0 +1,118 @@
+package raytracer
+
+import "math"
+
+// Torus is a ring around the Y axis, made by sweeping a circle with the minor radius around a circle with the
+// major radius that lies in the XZ plane
+type Torus struct {
+	Center                   Vec3
+	MajorRadius, MinorRadius float64
+	// PhiMax is the angle in degrees that the torus sweeps around its axis, starting from +X. 0 is a full turn.
+	PhiMax float64
+	// Material is the material that the torus is made of. A nil material is a grey diffuse surface.
+	Material Material
+	// ID identifies the torus in the object ID pass. 0 is reserved for the background.
+	ID int
+}
+
+// NewTorus returns a new torus
+func NewTorus(center Vec3, majorRadius, minorRadius float64) *Torus {
+	return &Torus{Center: center, MajorRadius: majorRadius, MinorRadius: minorRadius}
+}
+
+// Hit returns whether the passed-in ray hits the torus
+func (t *Torus) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	var crossings crossingList
+	t.crossings(ray, &crossings)
+	return crossings.first(ray, tMin, tMax, hitRecord)
+}
+
+// Closed returns whether the torus has an inside, which it has when it sweeps a full turn
+func (t *Torus) Closed() bool {
+	return sweep(t.PhiMax) == 2*math.Pi
+}
+
+// Intervals returns the spans of the ray that are inside the torus. They are empty if the torus is not closed.
+func (t *Torus) Intervals(ray Ray, intervals []Interval) []Interval {
+	if !t.Closed() {
+		return intervals
+	}
+	var crossings crossingList
+	t.crossings(ray, &crossings)
+	return crossings.intervals(intervals)
+}
+
+// Validate returns an error if the torus has no ring or no tube
+func (t *Torus) Validate() error {
+	if err := checkPoint("torus", "center", t.Center); err != nil {
+		return err
+	}
+	if err := checkPositive("torus", "radius", t.MajorRadius); err != nil {
+		return err
+	}
+	if err := checkPositive("torus", "minor radius", t.MinorRadius); err != nil {
+		return err
+	}
+	return checkSweep("torus", t.PhiMax)
+}
+
+// BoundingBox returns the box around the torus
+func (t *Torus) BoundingBox() *AABB {
+	outer := t.MajorRadius + t.MinorRadius
+	extent := NewVec3(outer, t.MinorRadius, outer)
+	return NewAABB(t.Center.SubtractVector(extent), t.Center.AddVector(extent))
+}
+
+// crossings adds where the ray crosses the torus to the list. u turns around the Y axis and v turns around the tube,
+// starting from its outside.
+func (t *Torus) crossings(ray Ray, crossings *crossingList) {
+	o, d, ok := localRay(ray, t.Center)
+	if !ok {
+		return
+	}
+
+	// the quartic is solved along a unit direction from the point on the line closest to the center, which keeps
+	// its coefficients small and well conditioned
+	length := d.Length()
+	unit := d.MultiplyFloat(1 / length)
+	shift := -o.Dot(unit)
+	closest := o.AddVector(unit.MultiplyFloat(shift))
+	R, r := t.MajorRadius, t.MinorRadius
+	if closest.Length() > R+r {
+		return
+	}
+
+	// (x^2 + y^2 + z^2 + R^2 - r^2)^2 = 4 R^2 (x^2 + z^2) along the ray
+	e := closest.LengthSquared() + R*R - r*r
+	f := closest.Dot(unit)
+	roots, n := solveQuartic(
+		1,
+		4*f,
+		2*e+4*f*f-4*R*R*(unit.X*unit.X+unit.Z*unit.Z),
+		4*f*e-8*R*R*(closest.X*unit.X+closest.Z*unit.Z),
+		e*e-4*R*R*(closest.X*closest.X+closest.Z*closest.Z),
+	)
+
+	phiMax := sweep(t.PhiMax)
+	for _, root := range roots[:n] {
+		along := (root + shift) / length
+		x, y, z := o.X+along*d.X, o.Y+along*d.Y, o.Z+along*d.Z
+		phi := azimuth(x, z)
+		rho := math.Sqrt(x*x + z*z)
+		if phi > phiMax || rho < 1e-12 {
+			continue
+		}
+
+		// the normal points away from the nearest point on the circle in the middle of the tube
+		normal, err := NewVec3(x-R*x/rho, y, z-R*z/rho).Unit()
+		if err != nil {
+			continue
+		}
+		theta := math.Atan2(y, rho-R)
+		if theta < 0 {
+			theta += 2 * math.Pi
+		}
+		dpdv := NewVec3(-y*x/rho, rho-R, -y*z/rho).MultiplyFloat(2 * math.Pi)
+		setSurface(crossings.add(), ray, along, normal, aroundAxis(x, z, phiMax), dpdv, phi/phiMax, theta/(2*math.Pi), t.Material, t.ID)
+	}
+}
@@ -0,0 +1,246 @@
+package raytracer
+
+import (
+	"errors"
+	"math"
+)
+
+// Matrix4 is a 4x4 matrix in row-major order that transforms points as column vectors
+type Matrix4 [4][4]float64
+
+// Identity returns the matrix that leaves points where they are
+func Identity() Matrix4 {
+	return Matrix4{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+}
+
+// Translation returns a matrix that moves points by offset
+func Translation(offset Vec3) Matrix4 {
+	m := Identity()
+	m[0][3], m[1][3], m[2][3] = offset.X, offset.Y, offset.Z
+	return m
+}
+
+// Scaling returns a matrix that scales points about the origin by a separate factor along each axis
+func Scaling(factors Vec3) Matrix4 {
+	m := Identity()
+	m[0][0], m[1][1], m[2][2] = factors.X, factors.Y, factors.Z
+	return m
+}
+
+// RotationX returns a matrix that rotates points about the X axis by the passed-in angle in degrees
+func RotationX(degrees float64) Matrix4 {
+	sin, cos := math.Sincos(degreesToRadians(degrees))
+	m := Identity()
+	m[1][1], m[1][2] = cos, -sin
+	m[2][1], m[2][2] = sin, cos
+	return m
+}
+
+// RotationY returns a matrix that rotates points about the Y axis by the passed-in angle in degrees
+func RotationY(degrees float64) Matrix4 {
+	sin, cos := math.Sincos(degreesToRadians(degrees))
+	m := Identity()
+	m[0][0], m[0][2] = cos, sin
+	m[2][0], m[2][2] = -sin, cos
+	return m
+}
+
+// RotationZ returns a matrix that rotates points about the Z axis by the passed-in angle in degrees
+func RotationZ(degrees float64) Matrix4 {
+	sin, cos := math.Sincos(degreesToRadians(degrees))
+	m := Identity()
+	m[0][0], m[0][1] = cos, -sin
+	m[1][0], m[1][1] = sin, cos
+	return m
+}
+
+// EulerRotation returns a matrix that rotates points about the X, then the Y, then the Z axis by the components
+// of degrees
+func EulerRotation(degrees Vec3) Matrix4 {
+	return RotationZ(degrees.Z).Multiply(RotationY(degrees.Y)).Multiply(RotationX(degrees.X))
+}
+
+// Multiply returns m * n, which applies n first and then m
+func (m Matrix4) Multiply(n Matrix4) Matrix4 {
+	var product Matrix4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				product[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return product
+}
+
+// Transpose returns the matrix with its rows and columns swapped
+func (m Matrix4) Transpose() Matrix4 {
+	var t Matrix4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			t[i][j] = m[j][i]
+		}
+	}
+	return t
+}
+
+// Inverse returns the matrix that undoes m, using Gauss-Jordan elimination with partial pivoting
+func (m Matrix4) Inverse() (Matrix4, error) {
+	a := m
+	inverse := Identity()
+	for column := 0; column < 4; column++ {
+		pivot := column
+		for row := column + 1; row < 4; row++ {
+			if math.Abs(a[row][column]) > math.Abs(a[pivot][column]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][column]) < 1e-12 {
+			return Matrix4{}, errors.New("matrix is not invertible")
+		}
+		a[column], a[pivot] = a[pivot], a[column]
+		inverse[column], inverse[pivot] = inverse[pivot], inverse[column]
+
+		scale := 1 / a[column][column]
+		for j := 0; j < 4; j++ {
+			a[column][j] *= scale
+			inverse[column][j] *= scale
+		}
+		for row := 0; row < 4; row++ {
+			if row == column {
+				continue
+			}
+			factor := a[row][column]
+			for j := 0; j < 4; j++ {
+				a[row][j] -= factor * a[column][j]
+				inverse[row][j] -= factor * inverse[column][j]
+			}
+		}
+	}
+	return inverse, nil
+}
+
+// TransformPoint applies the matrix to a point, including its translation
+func (m Matrix4) TransformPoint(p Vec3) Vec3 {
+	return NewVec3(
+		m[0][0]*p.X+m[0][1]*p.Y+m[0][2]*p.Z+m[0][3],
+		m[1][0]*p.X+m[1][1]*p.Y+m[1][2]*p.Z+m[1][3],
+		m[2][0]*p.X+m[2][1]*p.Y+m[2][2]*p.Z+m[2][3],
+	)
+}
+
+// TransformVector applies the matrix to a direction, ignoring its translation
+func (m Matrix4) TransformVector(v Vec3) Vec3 {
+	return NewVec3(
+		m[0][0]*v.X+m[0][1]*v.Y+m[0][2]*v.Z,
+		m[1][0]*v.X+m[1][1]*v.Y+m[1][2]*v.Z,
+		m[2][0]*v.X+m[2][1]*v.Y+m[2][2]*v.Z,
+	)
+}
+
+// TransformNormal transforms a surface normal by the matrix whose inverse is m. Normals are transformed by the
+// inverse transpose so that they stay perpendicular to the transformed surface.
+func (m Matrix4) TransformNormal(n Vec3) Vec3 {
+	return m.Transpose().TransformVector(n)
+}
+
+// TransformedObject places an object in the scene with a transformation matrix, for example to move, rotate or
+// scale it
+type TransformedObject struct {
+	Object Hittable
+	// toWorld takes points from the object's space into the scene, and toObject takes them back
+	toWorld, toObject Matrix4
+}
+
+// NewTransformedObject returns the object transformed by the passed-in matrix
+func NewTransformedObject(object Hittable, matrix Matrix4) (*TransformedObject, error) {
+	t := &TransformedObject{Object: object}
+	if err := t.SetMatrix(matrix); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SetMatrix changes the transformation of the object
+func (t *TransformedObject) SetMatrix(matrix Matrix4) error {
+	inverse, err := matrix.Inverse()
+	if err != nil {
+		return errors.New("the transformation cannot be undone: " + err.Error())
+	}
+	t.toWorld, t.toObject = matrix, inverse
+	return nil
+}
+
+// Matrix returns the transformation of the object
+func (t *TransformedObject) Matrix() Matrix4 {
+	return t.toWorld
+}
+
+// Hit intersects the ray with the object in the object's own space, and moves the hit back into the scene. The
+// direction of the ray is not normalized, so distances along it are the same in both spaces.
+func (t *TransformedObject) Hit(ray Ray, tMin, tMax float64, hitRecord *HitRecord) bool {
+	local := NewRay(t.toObject.TransformPoint(ray.Origin()), t.toObject.TransformVector(ray.Direction()))
+	if !t.Object.Hit(local, tMin, tMax, hitRecord) {
+		return false
+	}
+	t.toWorldRecord(hitRecord)
+	return true
+}
+
+// Intervals appends the spans of the ray that are inside the object to intervals. There are none if the object is
+// not a Solid.
+func (t *TransformedObject) Intervals(ray Ray, intervals []Interval) []Interval {
+	solid, ok := t.Object.(Solid)
+	if !ok {
+		return intervals
+	}
+	local := NewRay(t.toObject.TransformPoint(ray.Origin()), t.toObject.TransformVector(ray.Direction()))
+	start := len(intervals)
+	intervals = solid.Intervals(local, intervals)
+	// the hit records are in the space of the object, and are moved into the scene
+	for i := start; i < len(intervals); i++ {
+		t.toWorldRecord(&intervals[i].Enter)
+		t.toWorldRecord(&intervals[i].Exit)
+	}
+	return intervals
+}
+
+// Validate returns an error if the transformation cannot be undone, or the object cannot be traced
+func (t *TransformedObject) Validate() error {
+	if _, err := t.toWorld.Inverse(); err != nil {
+		return validationError("transformed object", "matrix", ErrDegenerate)
+	}
+	return validate(t.Object)
+}
+
+// toWorldRecord moves a hit record from the object's space into the scene. The matrix can be inverted, so the
+// transformed normals never vanish.
+func (t *TransformedObject) toWorldRecord(hitRecord *HitRecord) {
+	hitRecord.P = t.toWorld.TransformPoint(hitRecord.P)
+	hitRecord.Normal, _ = t.toObject.TransformNormal(hitRecord.Normal).Unit()
+	if !hitRecord.GeometricNormal.IsZero() {
+		hitRecord.GeometricNormal, _ = t.toObject.TransformNormal(hitRecord.GeometricNormal).Unit()
+	}
+	if !hitRecord.Tangent.IsZero() {
+		hitRecord.Tangent = t.toWorld.TransformVector(hitRecord.Tangent)
+	}
+	if !hitRecord.Bitangent.IsZero() {
+		hitRecord.Bitangent = t.toWorld.TransformVector(hitRecord.Bitangent)
+	}
+}
+
+// BoundingBox returns the box around the transformed bounding box of the object. It is nil if the object does not
+// have one.
+func (t *TransformedObject) BoundingBox() *AABB {
+	box := boundingBoxOf(t.Object)
+	if box == nil {
+		return nil
+	}
+	corners := box.Corners()
+	box = NewAABB(t.toWorld.TransformPoint(corners[0]), t.toWorld.TransformPoint(corners[0]))
+	for _, corner := range corners[1:] {
+		p := t.toWorld.TransformPoint(corner)
+		box = box.Union(NewAABB(p, p))
+	}
+	return box
+}
@@ -0,0 +1,109 @@
+package raytracer_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrix4_Inverse(t *testing.T) {
+	m := rt.Translation(rt.NewVec3(1, -2, 3)).
+		Multiply(rt.EulerRotation(rt.NewVec3(30, 45, 60))).
+		Multiply(rt.Scaling(rt.NewVec3(2, 0.5, 3)))
+	inverse, err := m.Inverse()
+	assert.Nil(t, err)
+	product := m.Multiply(inverse)
+	identity := rt.Identity()
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			assert.InDelta(t, identity[i][j], product[i][j], 1e-12)
+		}
+	}
+
+	_, err = rt.Scaling(rt.NewVec3(1, 0, 1)).Inverse()
+	assert.Error(t, err)
+}
+
+func TestRotation(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		m      rt.Matrix4
+		p      rt.Vec3
+		wanted rt.Vec3
+	}{
+		{desc: "x", m: rt.RotationX(90), p: rt.NewVec3(0, 1, 0), wanted: rt.NewVec3(0, 0, 1)},
+		{desc: "y", m: rt.RotationY(90), p: rt.NewVec3(0, 0, 1), wanted: rt.NewVec3(1, 0, 0)},
+		{desc: "z", m: rt.RotationZ(90), p: rt.NewVec3(1, 0, 0), wanted: rt.NewVec3(0, 1, 0)},
+		{desc: "euler applies x first", m: rt.EulerRotation(rt.NewVec3(90, 0, 90)), p: rt.NewVec3(0, 1, 0), wanted: rt.NewVec3(0, 0, 1)},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := tc.m.TransformPoint(tc.p)
+			assert.InDelta(t, tc.wanted.X, got.X, 1e-12)
+			assert.InDelta(t, tc.wanted.Y, got.Y, 1e-12)
+			assert.InDelta(t, tc.wanted.Z, got.Z, 1e-12)
+		})
+	}
+}
+
+func TestTransformedObject_Hit(t *testing.T) {
+	// a unit sphere stretched into an ellipsoid three times as tall, and moved away from the origin
+	m := rt.Translation(rt.NewVec3(0, 0, -5)).Multiply(rt.Scaling(rt.NewVec3(1, 3, 1)))
+	object, err := rt.NewTransformedObject(rt.NewSphere(rt.NewVec3(0, 0, 0), 1), m)
+	assert.Nil(t, err)
+
+	hitRecord := &rt.HitRecord{}
+	didHit := object.Hit(rt.NewRay(rt.NewVec3(0, 0, 0), rt.NewVec3(0, 0, -1)), 0.001, math.Inf(1), hitRecord)
+	assert.True(t, didHit)
+	assert.InDelta(t, 4, hitRecord.T, 1e-9)
+	assert.InDelta(t, -4, hitRecord.P.Z, 1e-9)
+	assert.InDelta(t, 1, hitRecord.Normal.Z, 1e-9)
+
+	// the top of the ellipsoid is 3 above its center, where the sphere would have been missed
+	didHit = object.Hit(rt.NewRay(rt.NewVec3(0, 2.5, 0), rt.NewVec3(0, 0, -1)), 0.001, math.Inf(1), &rt.HitRecord{})
+	assert.True(t, didHit)
+	didHit = object.Hit(rt.NewRay(rt.NewVec3(0, 3.5, 0), rt.NewVec3(0, 0, -1)), 0.001, math.Inf(1), &rt.HitRecord{})
+	assert.False(t, didHit)
+
+	// normals stay perpendicular to the stretched surface
+	hitRecord = &rt.HitRecord{}
+	didHit = object.Hit(rt.NewRay(rt.NewVec3(0, 1.5, 0), rt.NewVec3(0, 0, -1)), 0.001, math.Inf(1), hitRecord)
+	assert.True(t, didHit)
+	assert.InDelta(t, 1, hitRecord.Normal.Length(), 1e-9)
+	assert.True(t, hitRecord.Normal.Y > 0 && hitRecord.Normal.Y < hitRecord.Normal.Z, "normal %v", hitRecord.Normal)
+
+	box := object.BoundingBox()
+	assert.Equal(t, rt.NewVec3(-1, -3, -6), box.Min)
+	assert.Equal(t, rt.NewVec3(1, 3, -4), box.Max)
+}
+
+func TestBVH_MatchesHittableList(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	list := &rt.HittableList{}
+	for i := 0; i < 50; i++ {
+		center := rt.NewVec3(rng.Float64()*10-5, rng.Float64()*10-5, rng.Float64()*10-15)
+		list.Add(&rt.Sphere{Center: center, Radius: 0.2 + rng.Float64(), ID: i + 1})
+	}
+	bvh, err := rt.NewBVH(list.Objects)
+	assert.Nil(t, err)
+
+	for i := 0; i < 200; i++ {
+		ray := rt.NewRay(rt.NewVec3(0, 0, 0), rt.NewVec3(rng.Float64()*2-1, rng.Float64()*2-1, -1))
+		want := &rt.HitRecord{}
+		wantHit := list.Hit(ray, 0.001, math.Inf(1), want)
+		got := &rt.HitRecord{}
+		gotHit := bvh.Hit(ray, 0.001, math.Inf(1), got)
+		assert.Equal(t, wantHit, gotHit)
+		if wantHit && gotHit {
+			assert.Equal(t, want.ObjectID, got.ObjectID)
+			assert.Equal(t, want.T, got.T)
+		}
+	}
+
+	_, err = rt.NewBVH(nil)
+	assert.Error(t, err)
+	_, err = rt.NewBVH([]rt.Hittable{&rt.HittableList{}})
+	assert.Error(t, err, "objects without a bounding box cannot be put in a BVH")
+}
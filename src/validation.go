@@ -0,0 +1,111 @@
+package raytracer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The reasons that a ValidationError can have, which can be checked for with errors.Is
+var (
+	// ErrNotFinite is the reason for a number that is NaN or infinite
+	ErrNotFinite = errors.New("must be finite")
+	// ErrNotPositive is the reason for a size that is zero or negative
+	ErrNotPositive = errors.New("must be positive")
+	// ErrZero is the reason for a size that is zero
+	ErrZero = errors.New("must not be zero")
+	// ErrOutOfRange is the reason for a parameter that is outside of the range it must be in
+	ErrOutOfRange = errors.New("is out of range")
+	// ErrMissing is the reason for a parameter that has not been set
+	ErrMissing = errors.New("is missing")
+	// ErrDegenerate is the reason for a direction or a transformation that collapses space, like a camera that
+	// cannot tell its rays apart
+	ErrDegenerate = errors.New("is degenerate")
+)
+
+// ValidationError is returned when an object or camera cannot be traced, like a sphere with a zero radius or a NaN
+// center. Scenes are validated before they are rendered, so that intersecting and shading never fail.
+type ValidationError struct {
+	// Object is the kind of object that is invalid, like "sphere"
+	Object string
+	// Field is the parameter of the object that is invalid, like "radius"
+	Field string
+	// Reason is what is wrong with the parameter, which is one of the Err values
+	Reason error
+}
+
+// Error describes what is wrong with the object
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("the %s of a %s %s", e.Field, e.Object, e.Reason)
+}
+
+// Unwrap returns the reason, so that errors.Is can check for it
+func (e *ValidationError) Unwrap() error {
+	return e.Reason
+}
+
+// Validator is implemented by objects that can check that they are able to be traced
+type Validator interface {
+	// Validate returns a *ValidationError if the object cannot be traced
+	Validate() error
+}
+
+// Validate returns an error if any object or light in the scene cannot be traced
+func (s *Scene) Validate() error {
+	if s.World == nil {
+		return &ValidationError{Object: "scene", Field: "world", Reason: ErrMissing}
+	}
+	if err := validate(s.World); err != nil {
+		return err
+	}
+	for _, light := range s.Lights {
+		if light == nil {
+			return &ValidationError{Object: "scene", Field: "light", Reason: ErrMissing}
+		}
+		if v, ok := light.(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validate validates an object if it is able to validate itself
+func validate(object Hittable) error {
+	if v, ok := object.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// validationError returns a *ValidationError for a field of an object
+func validationError(object, field string, reason error) error {
+	return &ValidationError{Object: object, Field: field, Reason: reason}
+}
+
+// checkFinite returns an error if the field of an object is NaN or infinite
+func checkFinite(object, field string, values ...float64) error {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return validationError(object, field, ErrNotFinite)
+		}
+	}
+	return nil
+}
+
+// checkPositive returns an error if the field of an object is not a finite positive number
+func checkPositive(object, field string, value float64) error {
+	if err := checkFinite(object, field, value); err != nil {
+		return err
+	}
+	if value <= 0 {
+		return validationError(object, field, ErrNotPositive)
+	}
+	return nil
+}
+
+// checkPoint returns an error if a point or vector field of an object is not finite
+func checkPoint(object, field string, p Vec3) error {
+	return checkFinite(object, field, p.X, p.Y, p.Z)
+}
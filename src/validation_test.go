@@ -0,0 +1,78 @@
+package raytracer_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	rt "github.com/andrewzlchen/raytracer/src"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	nan := math.NaN()
+	for _, tc := range []struct {
+		desc   string
+		object rt.Validator
+		field  string
+		reason error
+	}{
+		{desc: "a sphere", object: rt.NewSphere(rt.NewVec3(0, 0, -1), 0.5)},
+		{desc: "an inside out sphere", object: rt.NewSphere(rt.NewVec3(0, 0, -1), -0.5)},
+		{desc: "a sphere with a zero radius", object: rt.NewSphere(rt.NewVec3(0, 0, -1), 0), field: "radius", reason: rt.ErrZero},
+		{desc: "a sphere with a NaN center", object: rt.NewSphere(rt.NewVec3(nan, 0, -1), 1), field: "center", reason: rt.ErrNotFinite},
+		{desc: "a sphere with an infinite radius", object: rt.NewSphere(rt.NewVec3(0, 0, -1), math.Inf(1)), field: "radius", reason: rt.ErrNotFinite},
+		{desc: "a torus with a negative minor radius", object: rt.NewTorus(rt.NewVec3(0, 0, 0), 1, -0.2), field: "minor radius", reason: rt.ErrNotPositive},
+		{desc: "a disk with a hole larger than itself", object: &rt.Disk{Radius: 1, InnerRadius: 2}, field: "inner radius", reason: rt.ErrOutOfRange},
+		{desc: "a disk with a hole as large as itself", object: &rt.Disk{Radius: 1, InnerRadius: 1}, field: "inner radius", reason: rt.ErrOutOfRange},
+		{desc: "a cylinder swept past a full turn", object: &rt.Cylinder{Radius: 1, Height: 1, PhiMax: 400}, field: "phiMax", reason: rt.ErrOutOfRange},
+		{desc: "an SDF without a distance", object: &rt.SDF{MaxSteps: 10, Epsilon: 1e-4}, field: "distance function", reason: rt.ErrMissing},
+		{desc: "a transformation that cannot be undone", object: &rt.TransformedObject{Object: rt.NewSphere(rt.NewVec3(0, 0, 0), 1)}, field: "matrix", reason: rt.ErrDegenerate},
+		{desc: "a list with an invalid object", object: &rt.HittableList{Objects: []rt.Hittable{rt.NewSphere(rt.NewVec3(0, 0, 0), 0)}}, field: "radius", reason: rt.ErrZero},
+		{desc: "a scene without a world", object: &rt.Scene{}, field: "world", reason: rt.ErrMissing},
+		{desc: "a point light at NaN", object: &rt.PointLight{Position: rt.NewVec3(nan, 0, 0)}, field: "position", reason: rt.ErrNotFinite},
+		{desc: "a spot light without a direction", object: &rt.SpotLight{Angle: 30}, field: "direction", reason: rt.ErrZero},
+		{desc: "a spot light wider than a sphere", object: &rt.SpotLight{Direction: rt.NewVec3(0, -1, 0), Angle: 200}, field: "angle", reason: rt.ErrOutOfRange},
+		{desc: "a spot light with too soft an edge", object: &rt.SpotLight{Direction: rt.NewVec3(0, -1, 0), Angle: 30, Softness: 2}, field: "softness", reason: rt.ErrOutOfRange},
+		{desc: "a sun that covers half of the sky", object: &rt.SunLight{Direction: rt.NewVec3(0, -1, 0), AngularDiameter: 180}, field: "angular diameter", reason: rt.ErrOutOfRange},
+		{desc: "a scene with an invalid light", object: &rt.Scene{World: &rt.HittableList{}, Lights: []rt.Light{&rt.SunLight{}}}, field: "direction", reason: rt.ErrZero},
+		{desc: "a scene with a nil light", object: &rt.Scene{World: &rt.HittableList{}, Lights: []rt.Light{nil}}, field: "light", reason: rt.ErrMissing},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := tc.object.Validate()
+			if tc.reason == nil {
+				assert.Nil(t, err)
+				return
+			}
+			var validationError *rt.ValidationError
+			assert.True(t, errors.As(err, &validationError), "the error should be a *ValidationError")
+			assert.Equal(t, tc.field, validationError.Field)
+			assert.True(t, errors.Is(err, tc.reason), "the error should be caused by %s", tc.reason)
+		})
+	}
+}
+
+func TestCamera_Validate(t *testing.T) {
+	_, err := rt.NewCamera(rt.NewVec3(0, math.NaN(), 0))
+	assert.True(t, errors.Is(err, rt.ErrNotFinite))
+
+	_, err = rt.NewRotatedCamera(rt.NewVec3(0, 0, 0), rt.Scaling(rt.NewVec3(1, 0, 1)))
+	assert.True(t, errors.Is(err, rt.ErrDegenerate), "a camera that is flattened has rays with no direction")
+}
+
+func TestRender_Validates(t *testing.T) {
+	camera, err := rt.NewCamera(rt.NewVec3(0, 0, 0))
+	assert.Nil(t, err)
+	scene := &rt.Scene{World: &rt.HittableList{Objects: []rt.Hittable{rt.NewSphere(rt.NewVec3(0, 0, -1), 0)}}}
+	_, err = rt.Render(context.Background(), scene, camera, rt.RenderOptions{Width: 2, Height: 2, SamplesPerPixel: 1, MaxDepth: 2})
+	assert.True(t, errors.Is(err, rt.ErrZero))
+
+	description, err := rt.ParseSceneDescription(strings.NewReader(`{"objects": [{"type": "sphere", "center": [0, 0, -1]}]}`))
+	assert.Nil(t, err)
+	_, _, err = description.Build()
+	var validationError *rt.ValidationError
+	assert.True(t, errors.As(err, &validationError), "the description should fail to build with a *ValidationError")
+	assert.EqualError(t, validationError, "the radius of a sphere must not be zero")
+}
@@ -6,28 +6,34 @@ import (
 	"math/rand"
 )
 
-// Vec3 is a representation of a 3 dimensional vector
+// errDivideByZero and errZeroVector are shared so that the vector math never allocates, even when it fails
+var (
+	errDivideByZero = errors.New("cannot divide by 0")
+	errZeroVector   = errors.New("cannot get the unit vector of a zero vector")
+)
+
+// Vec3 is a representation of a 3 dimensional vector. Vectors are values, so the vector math does not allocate.
 type Vec3 struct {
 	X, Y, Z float64
 }
 
 // NewVec3 returns a vec3 struct from a tuple of values representing the vector's dimensions
-func NewVec3(x, y, z float64) *Vec3 {
-	return &Vec3{
+func NewVec3(x, y, z float64) Vec3 {
+	return Vec3{
 		x, y, z,
 	}
 }
 
 // Dot returns the dot product of two vec3 structs
-func (v *Vec3) Dot(other *Vec3) float64 {
+func (v Vec3) Dot(other Vec3) float64 {
 	return v.X*other.X +
 		v.Y*other.Y +
 		v.Z*other.Z
 }
 
 // AddVector returns a new Vec3 that is a returned by adding two Vec3 structs together
-func (v *Vec3) AddVector(other *Vec3) *Vec3 {
-	return &Vec3{
+func (v Vec3) AddVector(other Vec3) Vec3 {
+	return Vec3{
 		X: other.X + v.X,
 		Y: other.Y + v.Y,
 		Z: other.Z + v.Z,
@@ -35,8 +41,8 @@ func (v *Vec3) AddVector(other *Vec3) *Vec3 {
 }
 
 // SubtractVector returns a new Vec3 that is a returned by dividing a Vec3 by a float
-func (v *Vec3) SubtractVector(subtractor *Vec3) *Vec3 {
-	return &Vec3{
+func (v Vec3) SubtractVector(subtractor Vec3) Vec3 {
+	return Vec3{
 		X: v.X - subtractor.X,
 		Y: v.Y - subtractor.Y,
 		Z: v.Z - subtractor.Z,
@@ -44,8 +50,8 @@ func (v *Vec3) SubtractVector(subtractor *Vec3) *Vec3 {
 }
 
 // MultiplyVector returns a new vector that is obtained by multiplying the Vec3 that is by another vector
-func (v *Vec3) MultiplyVector(multiplier *Vec3) *Vec3 {
-	return &Vec3{
+func (v Vec3) MultiplyVector(multiplier Vec3) Vec3 {
+	return Vec3{
 		X: v.X * multiplier.X,
 		Y: v.Y * multiplier.Y,
 		Z: v.Z * multiplier.Z,
@@ -53,8 +59,8 @@ func (v *Vec3) MultiplyVector(multiplier *Vec3) *Vec3 {
 }
 
 // MultiplyFloat returns a new Vec3 that is a returned by multiplying a Vec3 by a float
-func (v *Vec3) MultiplyFloat(multiplier float64) *Vec3 {
-	return &Vec3{
+func (v Vec3) MultiplyFloat(multiplier float64) Vec3 {
+	return Vec3{
 		X: v.X * multiplier,
 		Y: v.Y * multiplier,
 		Z: v.Z * multiplier,
@@ -62,11 +68,11 @@ func (v *Vec3) MultiplyFloat(multiplier float64) *Vec3 {
 }
 
 // DivideVector returns a new Vec3 that is a returned by dividing two Vec3 structs together
-func (v *Vec3) DivideVector(other *Vec3) (*Vec3, error) {
+func (v Vec3) DivideVector(other Vec3) (Vec3, error) {
 	if other.X == 0 || other.Y == 0 || other.Z == 0 {
-		return nil, errors.New("cannot divide by 0")
+		return Vec3{}, errDivideByZero
 	}
-	return &Vec3{
+	return Vec3{
 		X: v.X / other.X,
 		Y: v.Y / other.Y,
 		Z: v.Z / other.Z,
@@ -74,11 +80,11 @@ func (v *Vec3) DivideVector(other *Vec3) (*Vec3, error) {
 }
 
 // DivideFloat returns a new Vec3 that is a returned by dividing a Vec3 by a float
-func (v *Vec3) DivideFloat(divisor float64) (*Vec3, error) {
+func (v Vec3) DivideFloat(divisor float64) (Vec3, error) {
 	if divisor == 0 {
-		return nil, errors.New("cannot divide by 0")
+		return Vec3{}, errDivideByZero
 	}
-	return &Vec3{
+	return Vec3{
 		X: v.X / divisor,
 		Y: v.Y / divisor,
 		Z: v.Z / divisor,
@@ -86,36 +92,36 @@ func (v *Vec3) DivideFloat(divisor float64) (*Vec3, error) {
 }
 
 // Length returns the length of the vector
-func (v *Vec3) Length() float64 {
+func (v Vec3) Length() float64 {
 	return math.Sqrt(v.LengthSquared())
 }
 
 // LengthSquared returns the squared length of the vector
-func (v *Vec3) LengthSquared() float64 {
+func (v Vec3) LengthSquared() float64 {
 	return v.Dot(v)
 }
 
 // Unit returns a unit vector of the caller
-func (v *Vec3) Unit() (*Vec3, error) {
+func (v Vec3) Unit() (Vec3, error) {
 	v, err := v.DivideFloat(v.Length())
 	if err != nil {
-		return nil, errors.New("cannot get the unit vector of a zero vector")
+		return Vec3{}, errZeroVector
 	}
 	return v, nil
 }
 
 // Random returns a vec3 with random x, y and z values
-func Random() *Vec3 {
+func Random() Vec3 {
 	return NewVec3(rand.Float64(), rand.Float64(), rand.Float64())
 }
 
 // RandomBound returns a vec3 with a random x, y, and z values between min and max
-func RandomBound(min, max float64) *Vec3 {
+func RandomBound(min, max float64) Vec3 {
 	return NewVec3(randomFloat(min, max), randomFloat(min, max), randomFloat(min, max))
 }
 
 // RandomUnitInUnitSphere returns a vector that touches the unit sphere
-func RandomUnitInUnitSphere() *Vec3 {
+func RandomUnitInUnitSphere() Vec3 {
 	for {
 		p := RandomBound(-1.0, 1.0)
 		if p.LengthSquared() >= 1 {
@@ -126,19 +132,54 @@ func RandomUnitInUnitSphere() *Vec3 {
 }
 
 // RandomUnitVector returns the unit vector of a vector that touches the the unit sphere
-func RandomUnitVector() (*Vec3, error) {
+func RandomUnitVector() (Vec3, error) {
 	unit, err := RandomUnitInUnitSphere().Unit()
 	if err != nil {
-		return nil, err
+		return Vec3{}, err
 	}
 	return unit, nil
 }
 
 // RandomInHemisphere returns a random vector within the same hemisphere of the normal
-func RandomInHemisphere(normal *Vec3) *Vec3 {
+func RandomInHemisphere(normal Vec3) Vec3 {
 	inUnitSphere := RandomUnitInUnitSphere()
 	if inUnitSphere.Dot(normal) > 0.0 {
 		return inUnitSphere
 	}
 	return inUnitSphere.MultiplyFloat(-1.0)
 }
+
+// Cross returns the cross product of two vec3 structs
+func (v Vec3) Cross(other Vec3) Vec3 {
+	return Vec3{
+		X: v.Y*other.Z - v.Z*other.Y,
+		Y: v.Z*other.X - v.X*other.Z,
+		Z: v.X*other.Y - v.Y*other.X,
+	}
+}
+
+// Negate returns a new Vec3 that points in the opposite direction
+func (v Vec3) Negate() Vec3 {
+	return v.MultiplyFloat(-1.0)
+}
+
+// Reflect returns the vector mirrored about the passed-in normal
+func (v Vec3) Reflect(normal Vec3) Vec3 {
+	return v.SubtractVector(normal.MultiplyFloat(2 * v.Dot(normal)))
+}
+
+// IsZero returns whether every dimension of the vector is exactly 0
+func (v Vec3) IsZero() bool {
+	return v == Vec3{}
+}
+
+// NearZero returns whether every dimension of the vector is very close to 0
+func (v Vec3) NearZero() bool {
+	const s = 1e-8
+	return math.Abs(v.X) < s && math.Abs(v.Y) < s && math.Abs(v.Z) < s
+}
+
+// MaxComponent returns the largest of the vector's dimensions
+func (v Vec3) MaxComponent() float64 {
+	return math.Max(v.X, math.Max(v.Y, v.Z))
+}
@@ -20,7 +20,7 @@ func TestVec3Add(t *testing.T) {
 	t.Run("Adding using the Vec3 Add method", func(t *testing.T) {
 		for _, tc := range []struct {
 			desc         string
-			a, b, result *raytracer.Vec3
+			a, b, result raytracer.Vec3
 		}{
 			{desc: "two positive", a: raytracer.NewVec3(1, 1, 1), b: raytracer.NewVec3(1, 1, 1), result: raytracer.NewVec3(2, 2, 2)},
 			{desc: "one positive, one negative", a: raytracer.NewVec3(1, 1, 1), b: raytracer.NewVec3(-1, -1, -1), result: raytracer.NewVec3(0, 0, 0)},
@@ -38,7 +38,7 @@ func TestVec3Multiply(t *testing.T) {
 	t.Run("Multiplying two vectors", func(t *testing.T) {
 		for _, tc := range []struct {
 			desc         string
-			a, b, result *raytracer.Vec3
+			a, b, result raytracer.Vec3
 		}{
 			{desc: "two unit vectors", a: raytracer.NewVec3(1, 1, 1), b: raytracer.NewVec3(1, 1, 1), result: raytracer.NewVec3(1, 1, 1)},
 			{desc: "a vector and a zero vector", a: raytracer.NewVec3(1, 1, 1), b: raytracer.NewVec3(0, 0, 0), result: raytracer.NewVec3(0, 0, 0)},
@@ -56,7 +56,7 @@ func TestVec3Multiply(t *testing.T) {
 	t.Run("Multiplying vectors by a constant", func(t *testing.T) {
 		for _, tc := range []struct {
 			desc      string
-			a, result *raytracer.Vec3
+			a, result raytracer.Vec3
 			b         float64
 		}{
 			{desc: "multiplying a vector by 0", a: raytracer.NewVec3(1, 1, 1), b: float64(0), result: raytracer.NewVec3(0, 0, 0)},
@@ -77,7 +77,7 @@ func TestVec3Divide(t *testing.T) {
 	t.Run("Dividing two vectors", func(t *testing.T) {
 		for _, tc := range []struct {
 			desc         string
-			a, b, result *raytracer.Vec3
+			a, b, result raytracer.Vec3
 			isError      bool
 		}{
 			{desc: "dividing a vector by a zero vector", a: raytracer.NewVec3(1, 1, 1), b: raytracer.NewVec3(0, 0, 0), isError: true},
@@ -89,7 +89,7 @@ func TestVec3Divide(t *testing.T) {
 			t.Run(tc.desc, func(t *testing.T) {
 				out, err := tc.a.DivideVector(tc.b)
 				if tc.isError {
-					assert.Nil(t, out)
+					assert.Equal(t, raytracer.Vec3{}, out)
 					assert.EqualError(t, err, "cannot divide by 0")
 				} else {
 					assert.Nil(t, err)
@@ -102,7 +102,7 @@ func TestVec3Divide(t *testing.T) {
 	t.Run("Dividing vectors by a constant", func(t *testing.T) {
 		for _, tc := range []struct {
 			desc      string
-			a, result *raytracer.Vec3
+			a, result raytracer.Vec3
 			b         float64
 			isError   bool
 		}{
@@ -115,7 +115,7 @@ func TestVec3Divide(t *testing.T) {
 			t.Run(tc.desc, func(t *testing.T) {
 				out, err := tc.a.DivideFloat(tc.b)
 				if tc.isError {
-					assert.Nil(t, out)
+					assert.Equal(t, raytracer.Vec3{}, out)
 					assert.EqualError(t, err, "cannot divide by 0")
 				} else {
 					assert.Equal(t, tc.result, out)